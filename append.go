@@ -0,0 +1,88 @@
+package fssync
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// AppendMode option: the regular files of the destination which are smaller
+// than their source, like log files which only grew since the last sync, are
+// completed in place with the tail of the source if their content is the
+// prefix of the source, verified with the checksum of the WithHash algorithm.
+// The other changed files are replaced by a copy as usual. The appended files
+// are not replaced atomically, and the files hardlinked on the destination
+// are always replaced to not modify their other links, like the source files
+// with several links unless NoHardlinks is set, whose aliases are then
+// hardlinked to the new copy.
+func AppendMode(s *FsSyncer) {
+	s.appendMode = true
+}
+
+// appendTail appends the tail of the src file to the dst file if dst is a
+// strict prefix of src, see AppendMode. It returns false if dst must be
+// replaced instead, and the number of bytes appended.
+func (s *FsSyncer) appendTail(state syncState, src, dst syncInfo) (bool, int64, error) {
+	if !s.appendMode || !src.fileInfo.Mode().IsRegular() || !dst.fileInfo.Mode().IsRegular() ||
+		dst.fileInfo.Size() >= src.fileInfo.Size() || dst.stat == nil || dst.stat.Nlink > 1 ||
+		(!s.noHardlinks && (src.stat == nil || src.stat.Nlink > 1)) {
+		return false, 0, nil
+	}
+
+	s.throttleOp()
+	sfd, err := openSource(src.path, src.fileInfo)
+	if err != nil {
+		err = sourceReadError(err)
+		return false, 0, errors.Wrapf(err, "fail to open src %v", src.path)
+	}
+	defer sfd.Close()
+
+	var appended bool
+	var n int64
+	err = s.onDestinationEntry(state, dst.path, func(path string) error {
+		fd, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return errors.Wrapf(err, "fail to open dest %v", dst.path)
+		}
+		defer fd.Close()
+
+		size := dst.fileInfo.Size()
+		isPrefix, err := s.isPrefix(sfd, fd, size)
+		if err != nil || !isPrefix {
+			return err
+		}
+		n, err = s.copier.Copy(fd, sfd)
+		if err != nil {
+			return errors.Wrapf(err, "fail to copy data")
+		}
+		appended = true
+		return fd.Close()
+	})
+	if err != nil {
+		return false, 0, errors.Wrapf(err, "fail to append %v to %v", src.path, dst.path)
+	}
+	if appended {
+		s.log(slog.LevelDebug, "file appended", "src", src.path, "bytes", n)
+	}
+	return appended, n, nil
+}
+
+// isPrefix returns true if the size first bytes of src and dst have the same
+// checksum, both files are then positioned at size
+func (s *FsSyncer) isPrefix(src, dst *os.File, size int64) (bool, error) {
+	srcChecksum := s.newHash()
+	_, err := io.CopyN(srcChecksum, src, size)
+	if err != nil {
+		err = sourceReadError(err)
+		return false, errors.Wrapf(err, "fail to compute checksum of %v", src.Name())
+	}
+	dstChecksum := s.newHash()
+	_, err = io.CopyN(dstChecksum, dst, size)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to compute checksum of %v", dst.Name())
+	}
+	return bytes.Equal(srcChecksum.Sum(nil), dstChecksum.Sum(nil)), nil
+}
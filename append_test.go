@@ -0,0 +1,78 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_AppendMode(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.Mkdir(src, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "log"), []byte("line 1\n"), 0644))
+	syncer := New(AppendMode)
+	_, err = syncer.Sync(dst, src)
+	assert.NoError(t, err)
+
+	t.Run("it should only copy the tail of a grown file", func(t *testing.T) {
+		before, err := os.Stat(filepath.Join(dst, "log"))
+		assert.NoError(t, err)
+		fd, err := os.OpenFile(filepath.Join(src, "log"), os.O_APPEND|os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		_, err = fd.WriteString("line 2\n")
+		assert.NoError(t, err)
+		assert.NoError(t, fd.Close())
+
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len("line 2\n")), report.CopiedBytes())
+		assert.True(t, report.HasChanged(filepath.Join(dst, "log")))
+		content, err := os.ReadFile(filepath.Join(dst, "log"))
+		assert.NoError(t, err)
+		assert.Equal(t, "line 1\nline 2\n", string(content))
+		after, err := os.Stat(filepath.Join(dst, "log"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(before, after))
+	})
+
+	t.Run("it should replace a file whose prefix changed", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "log"), []byte("rotated\nline 3\n"), 0644))
+
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len("rotated\nline 3\n")), report.CopiedBytes())
+		content, err := os.ReadFile(filepath.Join(dst, "log"))
+		assert.NoError(t, err)
+		assert.Equal(t, "rotated\nline 3\n", string(content))
+	})
+	t.Run("it should keep the destination hardlinks of a grown file", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "linked"), []byte("line 1\n"), 0644))
+		assert.NoError(t, os.Link(filepath.Join(src, "linked"), filepath.Join(src, "alias")))
+		_, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+
+		fd, err := os.OpenFile(filepath.Join(src, "linked"), os.O_APPEND|os.O_WRONLY, 0)
+		assert.NoError(t, err)
+		_, err = fd.WriteString("line 2\n")
+		assert.NoError(t, err)
+		assert.NoError(t, fd.Close())
+
+		_, err = syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		linked, err := os.Stat(filepath.Join(dst, "linked"))
+		assert.NoError(t, err)
+		alias, err := os.Stat(filepath.Join(dst, "alias"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(linked, alias))
+		content, err := os.ReadFile(filepath.Join(dst, "alias"))
+		assert.NoError(t, err)
+		assert.Equal(t, "line 1\nline 2\n", string(content))
+	})
+}
@@ -0,0 +1,54 @@
+package fssync
+
+import (
+	"sync"
+	"time"
+)
+
+// WithBandwidthLimit option: bound to bytesPerSecond the rate at which the
+// content of the files is copied, shared by all the copies of the syncer, to
+// not saturate the disks or the network of a mounted destination. The content
+// copied with CloneMode is not limited.
+func WithBandwidthLimit(bytesPerSecond int64) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.bandwidthLimit = bytesPerSecond
+	}
+}
+
+// rateLimiter delays the copy of content to keep its average rate below limit
+// bytes per second. The rate is averaged since the first copied bytes, a
+// limiter idle for more than a second restarts its average so that the idle
+// time is not spent in bursts.
+type rateLimiter struct {
+	limit int64
+	// sleep is replaced in tests
+	sleep func(time.Duration)
+	now   func() time.Time
+
+	mu    sync.Mutex
+	start time.Time
+	last  time.Time
+	bytes int64
+}
+
+func newRateLimiter(limit int64) *rateLimiter {
+	return &rateLimiter{limit: limit, sleep: time.Sleep, now: time.Now}
+}
+
+// wait accounts n copied bytes and blocks until they fit in the limit
+func (l *rateLimiter) wait(n int64) {
+	l.mu.Lock()
+	now := l.now()
+	if l.start.IsZero() || now.Sub(l.last) > time.Second {
+		l.start = now
+		l.bytes = 0
+	}
+	l.bytes += n
+	due := l.start.Add(time.Duration(float64(l.bytes) / float64(l.limit) * float64(time.Second)))
+	l.last = due
+	l.mu.Unlock()
+
+	if delay := due.Sub(now); delay > 0 {
+		l.sleep(delay)
+	}
+}
@@ -0,0 +1,56 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_wait(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	slept := []time.Duration{}
+	limiter := newRateLimiter(1000)
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+
+	limiter.wait(500)
+	limiter.wait(500)
+	assert.Equal(t, []time.Duration{500 * time.Millisecond, 500 * time.Millisecond}, slept)
+
+	// Slow copies are not delayed
+	now = now.Add(800 * time.Millisecond)
+	limiter.wait(500)
+	assert.Len(t, slept, 2)
+
+	// The average restarts after an idle period
+	now = now.Add(time.Minute)
+	limiter.wait(2000)
+	assert.Equal(t, 2*time.Second, slept[2])
+}
+
+func TestFsSyncer_Sync_WithBandwidthLimit(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a"), make([]byte, 3000), 0644))
+
+	start := time.Now()
+	report, err := New(WithBandwidthLimit(10000), WithBufferSize(1000)).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3000), report.CopiedBytes())
+	assert.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+
+	content, err := os.ReadFile(filepath.Join(dst, "a"))
+	assert.NoError(t, err)
+	assert.Len(t, content, 3000)
+}
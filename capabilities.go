@@ -0,0 +1,181 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Capabilities lists the features supported by the filesystem of a directory
+type Capabilities struct {
+	Hardlinks       bool
+	Symlinks        bool
+	Xattrs          bool
+	Reflink         bool
+	SubSecondMtimes bool
+	Fallocate       bool
+	// StableMtimes is true if the modification times set on files are read
+	// back with a constant MtimeSkew, which is not the case when the server of
+	// a network filesystem sets its own clock time
+	StableMtimes bool
+	// MtimeSkew is the difference between the modification times read back
+	// and the ones set on files
+	MtimeSkew time.Duration
+}
+
+// ProbeCapabilities detects the features supported by the filesystem of dir
+// by exercising them in a temporary directory created in dir, removed once
+// done. An error is returned only if the temporary directory can't be used.
+func ProbeCapabilities(dir string) (Capabilities, error) {
+	caps := Capabilities{}
+
+	probeDir, err := os.MkdirTemp(dir, ".fssync-probe-")
+	if err != nil {
+		return caps, errors.Wrapf(err, "fail to create probe directory in %v", dir)
+	}
+	defer os.RemoveAll(probeDir)
+
+	file := filepath.Join(probeDir, "file")
+	fd, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return caps, errors.Wrapf(err, "fail to create probe file in %v", probeDir)
+	}
+	defer fd.Close()
+	_, err = fd.Write([]byte("fssync"))
+	if err != nil {
+		return caps, errors.Wrapf(err, "fail to write probe file in %v", probeDir)
+	}
+
+	caps.Hardlinks = os.Link(file, filepath.Join(probeDir, "hardlink")) == nil
+	caps.Symlinks = os.Symlink("file", filepath.Join(probeDir, "symlink")) == nil
+	caps.Xattrs = lsetxattr(file, "user.fssync.probe", []byte("1")) == nil
+	caps.Fallocate = fallocate(fd, 4096) == nil
+	caps.Reflink = probeReflink(fd, filepath.Join(probeDir, "reflink"))
+	caps.SubSecondMtimes = probeSubSecondMtimes(file)
+	caps.MtimeSkew, caps.StableMtimes = probeMtimeSkew(file)
+
+	return caps, nil
+}
+
+func probeReflink(src *os.File, path string) bool {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return false
+	}
+	defer fd.Close()
+	return cloneFile(fd, src) == nil
+}
+
+func probeSubSecondMtimes(path string) bool {
+	mtime := time.Unix(1e9, 123456789)
+	err := lutimes(path, mtime, mtime)
+	if err != nil {
+		return false
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	stat, ok := fileStat(info)
+	if !ok {
+		return false
+	}
+	return statMtime(stat).Nanosecond() != 0
+}
+
+// probeMtimeSkew sets two modification times to path and returns the skew of
+// the times read back, stable is false if it's not the same for both
+func probeMtimeSkew(path string) (skew time.Duration, stable bool) {
+	skews := []time.Duration{}
+	for _, mtime := range []time.Time{time.Unix(1e9, 0), time.Unix(1.5e9, 0)} {
+		err := lutimes(path, mtime, mtime)
+		if err != nil {
+			return 0, false
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return 0, false
+		}
+		skews = append(skews, info.ModTime().Sub(mtime))
+	}
+	return skews[0], skews[0] == skews[1]
+}
+
+type capability int
+
+const (
+	hardlinksCapability capability = iota
+	symlinksCapability
+	subSecondMtimesCapability
+)
+
+var capabilityDegradations = map[capability]string{
+	hardlinksCapability:       "hardlinks are not supported, linked files are copied",
+	symlinksCapability:        "symlinks are not supported, they are skipped",
+	subSecondMtimesCapability: "sub-second modification times are not supported, they are compared to the second",
+}
+
+func (c Capabilities) supports(feature capability) bool {
+	switch feature {
+	case hardlinksCapability:
+		return c.Hardlinks
+	case symlinksCapability:
+		return c.Symlinks
+	case subSecondMtimesCapability:
+		return c.SubSecondMtimes
+	}
+	return true
+}
+
+// supports returns whether the filesystem where path is going to be created
+// supports feature. Capabilities are only probed with the
+// DetectCapabilities option, otherwise everything is considered supported.
+// The probe is done once per filesystem and the missing capabilities are
+// reported as warnings.
+func (s *FsSyncer) supports(state syncState, path string, feature capability) bool {
+	if !s.detectCaps {
+		return true
+	}
+	caps, ok := s.filesystemCapabilities(state, path)
+	if !ok {
+		return true
+	}
+	return caps.supports(feature)
+}
+
+// filesystemCapabilities returns the capabilities of the filesystem where
+// path is going to be created, probed once per filesystem. ok is false if the
+// filesystem can't be identified.
+func (s *FsSyncer) filesystemCapabilities(state syncState, path string) (Capabilities, bool) {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return Capabilities{}, false
+	}
+	stat, ok := fileStat(info)
+	if !ok {
+		return Capabilities{}, false
+	}
+
+	caps, ok := state.capabilities[uint64(stat.Dev)]
+	if ok {
+		return caps, true
+	}
+	caps, err = ProbeCapabilities(dir)
+	if err != nil {
+		// Without being able to probe, keep trying every feature
+		state.report.warn("fail to probe capabilities of the filesystem of %v: %v", dir, err)
+		caps = Capabilities{Hardlinks: true, Symlinks: true, SubSecondMtimes: true, StableMtimes: true}
+	}
+	state.capabilities[uint64(stat.Dev)] = caps
+	if s.detectCaps {
+		for _, c := range []capability{hardlinksCapability, symlinksCapability, subSecondMtimesCapability} {
+			if !caps.supports(c) {
+				state.report.warn("filesystem of %v: %s", dir, capabilityDegradations[c])
+			}
+		}
+	}
+	return caps, true
+}
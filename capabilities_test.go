@@ -0,0 +1,68 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeCapabilities(t *testing.T) {
+	dir, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	caps, err := ProbeCapabilities(dir)
+	assert.NoError(t, err)
+	assert.True(t, caps.Hardlinks)
+	assert.True(t, caps.Symlinks)
+	assert.True(t, caps.StableMtimes)
+	assert.Zero(t, caps.MtimeSkew)
+
+	t.Run("it should remove the probe directory", func(t *testing.T) {
+		entries, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("it should fail if the directory does not exist", func(t *testing.T) {
+		_, err := ProbeCapabilities("./.tmp/does-not-exist")
+		assert.Error(t, err)
+	})
+}
+
+func TestFsSyncer_supports(t *testing.T) {
+	dir, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+
+	t.Run("it should consider everything supported without DetectCapabilities", func(t *testing.T) {
+		state := syncState{capabilities: map[uint64]Capabilities{}, report: &fsSyncReport{}}
+		assert.True(t, New().supports(state, path, symlinksCapability))
+		assert.Empty(t, state.capabilities)
+	})
+
+	t.Run("it should probe the filesystem once", func(t *testing.T) {
+		state := syncState{capabilities: map[uint64]Capabilities{}, report: &fsSyncReport{}}
+		s := New(DetectCapabilities)
+		assert.True(t, s.supports(state, path, hardlinksCapability))
+		assert.True(t, s.supports(state, path, symlinksCapability))
+		assert.Len(t, state.capabilities, 1)
+	})
+
+	t.Run("it should use the capabilities already probed", func(t *testing.T) {
+		info, err := os.Stat(dir)
+		assert.NoError(t, err)
+		dev := uint64(sysStatOf(t, info).Dev)
+		state := syncState{
+			capabilities: map[uint64]Capabilities{dev: {Hardlinks: true}},
+			report:       &fsSyncReport{},
+		}
+		s := New(DetectCapabilities)
+		assert.True(t, s.supports(state, path, hardlinksCapability))
+		assert.False(t, s.supports(state, path, symlinksCapability))
+		assert.False(t, s.supports(state, path, subSecondMtimesCapability))
+	})
+}
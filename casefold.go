@@ -0,0 +1,62 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CaseCollisionPolicy defines how source entries whose paths only differ by
+// their case are handled, as they would overwrite each other on a
+// case-insensitive destination
+type CaseCollisionPolicy int
+
+const (
+	// CaseCollisionIgnore syncs all the entries, on a case-insensitive
+	// destination the last one in lexical order wins. This is the default.
+	CaseCollisionIgnore CaseCollisionPolicy = iota
+	// CaseCollisionFirstWins only syncs the first entry in lexical order, the
+	// following ones are skipped with a warning in the report
+	CaseCollisionFirstWins
+	// CaseCollisionFail makes the sync fail with ErrCaseCollision
+	CaseCollisionFail
+)
+
+// ErrCaseCollision is returned with the CaseCollisionFail policy when two
+// source paths only differ by their case
+var ErrCaseCollision = errors.New("source paths only differ by their case")
+
+// WithCaseCollisionPolicy option: lets you configure how source entries whose
+// paths only differ by their case are handled
+// Default is CaseCollisionIgnore
+func WithCaseCollisionPolicy(policy CaseCollisionPolicy) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.caseCollisionPolicy = policy
+	}
+}
+
+// checkCaseCollision returns true if the source entry at path should be
+// skipped because an entry with the same case-folded path has already been
+// synced
+func (s *FsSyncer) checkCaseCollision(state syncState, path string, info os.FileInfo) (bool, error) {
+	if s.caseCollisionPolicy == CaseCollisionIgnore {
+		return false, nil
+	}
+	folded := strings.ToLower(path)
+	first, ok := state.caseFolded[folded]
+	// Paths can be walked twice, see WithPriorityPaths
+	if !ok || first == path {
+		state.caseFolded[folded] = path
+		return false, nil
+	}
+	if s.caseCollisionPolicy == CaseCollisionFail {
+		return false, errors.Wrapf(ErrCaseCollision, "%v and %v", first, path)
+	}
+	state.report.warn("%v only differs by its case from %v, skipped", path, first)
+	if info.IsDir() {
+		return true, filepath.SkipDir
+	}
+	return true, nil
+}
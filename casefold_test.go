@@ -0,0 +1,52 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_CaseCollision(t *testing.T) {
+	src := filepath.Join("test-fixtures", "src", "case-collision")
+
+	t.Run("it should sync every entry by default", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+
+		report, err := New().Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Empty(t, report.Warnings())
+		assert.FileExists(t, filepath.Join(dst, "readme"))
+		assert.FileExists(t, filepath.Join(dst, "dir", "b"))
+	})
+
+	t.Run("it should only sync the first entry with CaseCollisionFirstWins", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+
+		report, err := New(WithCaseCollisionPolicy(CaseCollisionFirstWins)).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Len(t, report.Warnings(), 2)
+
+		content, err := os.ReadFile(filepath.Join(dst, "README"))
+		assert.NoError(t, err)
+		assert.Equal(t, "upper\n", string(content))
+		assert.FileExists(t, filepath.Join(dst, "Dir", "a"))
+		assert.NoFileExists(t, filepath.Join(dst, "readme"))
+		assert.NoDirExists(t, filepath.Join(dst, "dir"))
+	})
+
+	t.Run("it should fail with CaseCollisionFail", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+
+		_, err = New(WithCaseCollisionPolicy(CaseCollisionFail)).Sync(dst, src)
+		assert.Equal(t, ErrCaseCollision, errors.Cause(err))
+	})
+}
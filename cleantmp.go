@@ -0,0 +1,112 @@
+package fssync
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CleanTempFiles removes the temporary entries left in the dst destination
+// by the syncs interrupted by a crash, named .<name>-<9 digits> like the
+// entries of tmpFileName, and in the directory of WithTempDir if any. The
+// paths of WithProtectedPaths are not walked. It returns the removed paths.
+// It must not be called while a sync of dst is running: the temporary
+// entries of the running sync would be removed.
+//
+// The source entries named like temporary entries are never synced, they're
+// skipped with a warning as they would be removed by CleanTempFiles.
+func (s *FsSyncer) CleanTempFiles(dst string) ([]string, error) {
+	dst = filepath.Clean(dst)
+	protected := map[string]bool{}
+	for _, path := range s.protectedPaths {
+		protected[filepath.Join(dst, path)] = true
+	}
+
+	removed := []string{}
+	clean := func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if protected[path] {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isTmpFileName(entry.Name()) || path == dst || path == s.tempDir {
+			return nil
+		}
+		err = s.removeTempEntry(path, &removed)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	err := filepath.WalkDir(dst, clean)
+	if err != nil {
+		return removed, errors.Wrapf(err, "fail to clean temporary entries of %v", dst)
+	}
+	// The staging directory of SyncFromTar is created next to the destination
+	err = s.cleanTempSiblings(dst, &removed)
+	if err != nil {
+		return removed, err
+	}
+	if s.tempDir != "" {
+		err = filepath.WalkDir(s.tempDir, clean)
+		if err != nil {
+			return removed, errors.Wrapf(err, "fail to clean temporary entries of %v", s.tempDir)
+		}
+	}
+	return removed, nil
+}
+
+// cleanTempSiblings removes the temporary entries of dst located in its
+// parent directory, the other temporary entries of the parent directory are
+// kept as they belong to other destinations
+func (s *FsSyncer) cleanTempSiblings(dst string, removed *[]string) error {
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get absolute path of %v", dst)
+	}
+	parent := filepath.Dir(absDst)
+	names, err := readDirNames(parent, 0)
+	if err != nil {
+		return errors.Wrapf(err, "fail to list %v", parent)
+	}
+	prefix := "." + filepath.Base(absDst) + "-"
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) || len(name) != len(prefix)+9 || !isTmpFileName(name) {
+			continue
+		}
+		err = s.removeTempEntry(filepath.Join(parent, name), removed)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTempEntry removes the temporary entry at path, with its content if
+// it's a directory like the staging directories of SyncFromTar, and appends
+// it to removed
+func (s *FsSyncer) removeTempEntry(path string, removed *[]string) error {
+	s.throttleOp()
+	err := os.RemoveAll(path)
+	if err != nil {
+		return errors.Wrapf(err, "fail to remove temporary entry %v", path)
+	}
+	s.log(slog.LevelInfo, "temporary entry removed", "dst", path)
+	*removed = append(*removed, path)
+	return nil
+}
@@ -0,0 +1,51 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_CleanTempFiles(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	dst := filepath.Join(tmp, "dst")
+	tempDir := filepath.Join(tmp, "temp")
+	for _, dir := range []string{"dir", "protected", ".staging-123456789/dir"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, dir), 0755))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(tmp, ".dst-987654321"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(tmp, ".other-987654321"), 0755))
+	assert.NoError(t, os.MkdirAll(tempDir, 0755))
+	for _, file := range []string{
+		"file", ".file-123456789", "dir/.a-000000001", "dir/.a-1", "protected/.b-123456789",
+		"../temp/.c-123456789", "../temp/kept",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, file), nil, 0644))
+	}
+
+	removed, err := New(WithTempDir(tempDir), WithProtectedPaths("protected")).CleanTempFiles(dst)
+	assert.NoError(t, err)
+	absTmp, err := filepath.Abs(tmp)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dst, ".file-123456789"),
+		filepath.Join(dst, ".staging-123456789"),
+		filepath.Join(dst, "dir", ".a-000000001"),
+		filepath.Join(absTmp, ".dst-987654321"),
+		filepath.Join(tempDir, ".c-123456789"),
+	}, removed)
+
+	for _, path := range []string{"file", "dir/.a-1", "protected/.b-123456789", "../temp/kept", "../.other-987654321"} {
+		_, err := os.Lstat(filepath.Join(dst, path))
+		assert.NoError(t, err, path)
+	}
+	for _, path := range removed {
+		_, err := os.Lstat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+}
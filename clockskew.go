@@ -0,0 +1,83 @@
+package fssync
+
+import (
+	"time"
+)
+
+// ClockSkewPolicy defines how the modification times of the destination are
+// compared when they are not read back as they have been set, like on network
+// filesystems whose server uses its own clock. Such destinations are otherwise
+// copied again on every sync.
+type ClockSkewPolicy int
+
+const (
+	// ClockSkewIgnore compares the modification times as they are read. This
+	// is the default.
+	ClockSkewIgnore ClockSkewPolicy = iota
+	// ClockSkewCompensate probes the skew of the modification times of the
+	// destination filesystem and compensates it in comparisons. Files are
+	// compared by checksum if the skew is not constant.
+	ClockSkewCompensate
+	// ClockSkewChecksum compares the files by checksum if the modification
+	// times of the destination filesystem are skewed
+	ClockSkewChecksum
+)
+
+// WithClockSkewPolicy option: lets you configure how skewed modification
+// times of the destination are compared, the skew is probed once per
+// filesystem by setting times to a temporary file
+// Default is ClockSkewIgnore
+func WithClockSkewPolicy(policy ClockSkewPolicy) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.clockSkewPolicy = policy
+	}
+}
+
+// WithModTimeWindow option: modification times which differ by at most window
+// are considered equal, for destinations whose timestamps are coarser than
+// the source ones like FAT filesystems (2 seconds) or some NFS and SMB mounts,
+// like rsync --modify-window
+func WithModTimeWindow(window time.Duration) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.modTimeWindow = window
+	}
+}
+
+// mtimesEqual returns true if the modification time dstMtime of the
+// destination entry at dstPath is the one set from srcMtime
+func (s *FsSyncer) mtimesEqual(state syncState, dstPath string, srcMtime, dstMtime time.Time) bool {
+	if !s.supports(state, dstPath, subSecondMtimesCapability) {
+		srcMtime, dstMtime = srcMtime.Truncate(time.Second), dstMtime.Truncate(time.Second)
+	}
+	if s.clockSkewPolicy == ClockSkewCompensate {
+		caps, ok := s.filesystemCapabilities(state, dstPath)
+		if ok && caps.StableMtimes {
+			dstMtime = dstMtime.Add(-caps.MtimeSkew)
+		}
+	}
+	if s.modTimeWindow > 0 {
+		diff := srcMtime.Sub(dstMtime)
+		return diff <= s.modTimeWindow && diff >= -s.modTimeWindow
+	}
+	return srcMtime.Equal(dstMtime)
+}
+
+// compareByChecksum returns true if the destination file at dstPath must be
+// compared by checksum, with WithChecksum or when its modification times are
+// unreliable
+func (s *FsSyncer) compareByChecksum(state syncState, dstPath string) bool {
+	if s.checkChecksum || state.checksumPaths[dstPath] {
+		return true
+	}
+	if s.clockSkewPolicy == ClockSkewIgnore {
+		return false
+	}
+	caps, ok := s.filesystemCapabilities(state, dstPath)
+	if !ok {
+		return false
+	}
+	if s.clockSkewPolicy == ClockSkewChecksum {
+		return !caps.StableMtimes || caps.MtimeSkew != 0
+	}
+	return !caps.StableMtimes
+}
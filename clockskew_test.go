@@ -0,0 +1,56 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_mtimesEqual(t *testing.T) {
+	dir, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	info, err := os.Stat(dir)
+	assert.NoError(t, err)
+	dev := uint64(sysStatOf(t, info).Dev)
+
+	mtime := time.Unix(1e9, 0)
+	skewed := Capabilities{SubSecondMtimes: true, StableMtimes: true, MtimeSkew: time.Hour}
+	unstable := Capabilities{SubSecondMtimes: true}
+
+	cases := []struct {
+		name       string
+		policy     ClockSkewPolicy
+		window     time.Duration
+		caps       Capabilities
+		dstMtime   time.Time
+		equal      bool
+		byChecksum bool
+	}{
+		{name: "ignored skew", policy: ClockSkewIgnore, caps: skewed, dstMtime: mtime.Add(time.Hour)},
+		{name: "compensated skew", policy: ClockSkewCompensate, caps: skewed, dstMtime: mtime.Add(time.Hour), equal: true},
+		{name: "compensated skew of other time", policy: ClockSkewCompensate, caps: skewed, dstMtime: mtime},
+		{name: "unstable times compensated", policy: ClockSkewCompensate, caps: unstable, dstMtime: mtime, equal: true, byChecksum: true},
+		{name: "skew compared by checksum", policy: ClockSkewChecksum, caps: skewed, dstMtime: mtime.Add(time.Hour), byChecksum: true},
+		{name: "no skew compared by mtime", policy: ClockSkewChecksum, caps: Capabilities{SubSecondMtimes: true, StableMtimes: true}, dstMtime: mtime, equal: true},
+		{name: "later time in window", window: 2 * time.Second, caps: unstable, dstMtime: mtime.Add(2 * time.Second), equal: true},
+		{name: "earlier time in window", window: 2 * time.Second, caps: unstable, dstMtime: mtime.Add(-time.Second), equal: true},
+		{name: "time outside of window", window: 2 * time.Second, caps: unstable, dstMtime: mtime.Add(3 * time.Second)},
+		{name: "compensated skew in window", policy: ClockSkewCompensate, window: time.Second, caps: skewed, dstMtime: mtime.Add(time.Hour + time.Second), equal: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := syncState{
+				capabilities: map[uint64]Capabilities{dev: c.caps},
+				report:       &fsSyncReport{},
+			}
+			s := New(WithClockSkewPolicy(c.policy), WithModTimeWindow(c.window))
+			assert.Equal(t, c.equal, s.mtimesEqual(state, path, mtime, c.dstMtime))
+			assert.Equal(t, c.byChecksum, s.compareByChecksum(state, path))
+		})
+	}
+}
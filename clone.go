@@ -0,0 +1,59 @@
+package fssync
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// CloneMode option: the destination is considered empty or disposable, the
+// source tree is copied without stating nor comparing the destination entries
+// and extraneous files are not deleted. File contents are cloned with
+// reflinks when the filesystem supports it, or copied in the kernel with
+// copy_file_range otherwise, which makes first-time syncs much faster.
+// Existing destination files are overwritten.
+func CloneMode(s *FsSyncer) {
+	s.cloneMode = true
+}
+
+// lstatDestination returns the info of the destination entry at path, in
+// clone mode the destination is considered empty
+func (s *FsSyncer) lstatDestination(path string) (os.FileInfo, error) {
+	if s.cloneMode {
+		return nil, os.ErrNotExist
+	}
+	s.throttleOp()
+	return os.Lstat(path)
+}
+
+// cloneContent shares the extents of src with dst with cloneFile, supported
+// by btrfs or XFS for instance. Content is copied otherwise.
+func cloneContent(dst, src *os.File) (int64, error) {
+	err := cloneFile(dst, src)
+	if err == nil {
+		info, err := src.Stat()
+		if err != nil {
+			return -1, errors.Wrapf(err, "fail to stat src %v", src.Name())
+		}
+		return info.Size(), nil
+	}
+	// io.Copy between files uses copy_file_range or sendfile
+	n, err := io.Copy(dst, src)
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to copy data")
+	}
+	return n, nil
+}
+
+// isClone returns true if the regular files src and dst are proven identical
+// by their extents, see sharesExtents, which spares the computation of their
+// checksums when the destination is a clone of the source
+func isClone(src, dst syncInfo) bool {
+	if src.stat == nil || dst.stat == nil || uint64(src.stat.Dev) != uint64(dst.stat.Dev) ||
+		!src.fileInfo.Mode().IsRegular() || !dst.fileInfo.Mode().IsRegular() ||
+		src.fileInfo.Size() != dst.fileInfo.Size() {
+		return false
+	}
+	return sharesExtents(dst.path, src.path)
+}
@@ -0,0 +1,47 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_CloneMode(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0644))
+	assert.NoError(t, os.Symlink("dir/file", filepath.Join(src, "link")))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "stale"), []byte("new"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "stale"), []byte("old content"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous"), []byte("extraneous"), 0644))
+
+	report, err := New(CloneMode).Sync(dst, src)
+	assert.NoError(t, err)
+
+	// Every entry is written, even if it already exists
+	assert.Equal(t, 5, report.ChangeCount())
+	assert.Equal(t, int64(len("content")+len("new")), report.CopiedBytes())
+	content, err := os.ReadFile(filepath.Join(dst, "dir", "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+	content, err = os.ReadFile(filepath.Join(dst, "stale"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "dir/file", target)
+	assert.FileExists(t, filepath.Join(dst, "extraneous"))
+
+	// Times are synced like in the default mode
+	os.Remove(filepath.Join(dst, "extraneous"))
+	report, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, report.ChangeCount())
+}
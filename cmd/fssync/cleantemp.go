@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// cleanTempCommand removes the temporary files left in the destination
+// directory by the interrupted syncs
+func cleanTempCommand(args []string) {
+	flags := flag.NewFlagSet("clean-temp", flag.ExitOnError)
+	tempDir := flags.String("temp-dir", "", "also clean this directory of temporary files, see the -temp-dir flag of sync")
+	var protectedPaths stringList
+	flags.Var(&protectedPaths, "protect", "path relative to the destination which is not cleaned, can be repeated")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatalln("Usage: ./fssync clean-temp [-temp-dir=] [-protect=path] <dst>")
+	}
+
+	options := []func(*fssync.FsSyncer){fssync.WithProtectedPaths(protectedPaths...)}
+	if *tempDir != "" {
+		options = append(options, fssync.WithTempDir(*tempDir))
+	}
+	removed, err := fssync.New(options...).CleanTempFiles(flags.Arg(0))
+	for _, path := range removed {
+		fmt.Println(path)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// runHookCommand runs the shell command of -pre-cmd or -post-cmd with the
+// environment of the process and env, its output is the one of the process
+func runHookCommand(command string, env []string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return errors.Wrapf(err, "fail to run %v", command)
+	}
+	return nil
+}
+
+// syncEnv returns the environment variables describing the sync given to the
+// -pre-cmd and -post-cmd commands
+func syncEnv(src, dst string) []string {
+	return []string{"FSSYNC_SRC=" + src, "FSSYNC_DST=" + dst}
+}
+
+// reportEnv returns the environment variables summarizing the result of the
+// sync given to the -post-cmd command
+func reportEnv(report fssync.SyncReport, duration time.Duration, err error) []string {
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	env := []string{
+		"FSSYNC_STATUS=" + status,
+		"FSSYNC_DURATION=" + fmt.Sprintf("%.3f", duration.Seconds()),
+	}
+	if err != nil {
+		env = append(env, "FSSYNC_ERROR="+err.Error())
+	}
+	if report != nil {
+		env = append(env,
+			"FSSYNC_CHANGES="+strconv.Itoa(report.ChangeCount()),
+			"FSSYNC_COPIED_BYTES="+strconv.FormatInt(report.CopiedBytes(), 10),
+			"FSSYNC_WARNINGS="+strconv.Itoa(len(report.Warnings())),
+		)
+	}
+	return env
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// config is the content of the configuration file given to ./fssync run
+type config struct {
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+// profile is a named sync, its options are the flags of the command line
+// without their leading dash, like checksum: true or protect: [a, b]
+type profile struct {
+	Src      string                 `yaml:"src"`
+	Dst      string                 `yaml:"dst"`
+	Options  map[string]interface{} `yaml:"options"`
+	Excludes []string               `yaml:"excludes"`
+	// Bandwidth is the limit of the copy in bytes per second, like -bwlimit
+	Bandwidth int64 `yaml:"bandwidth"`
+	// PreCmd and PostCmd are the shell commands run before and after the
+	// sync, like -pre-cmd and -post-cmd
+	PreCmd  string `yaml:"pre-cmd"`
+	PostCmd string `yaml:"post-cmd"`
+}
+
+func readConfig(path string) (config, error) {
+	var cfg config
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, errors.Wrapf(err, "fail to read config file %v", path)
+	}
+	err = yaml.Unmarshal(content, &cfg)
+	if err != nil {
+		return cfg, errors.Wrapf(err, "invalid config file %v", path)
+	}
+	return cfg, nil
+}
+
+// args returns the command line equivalent to the profile, the extra flags
+// are added after the ones of the profile to override them
+func (p profile) args(extra []string) ([]string, error) {
+	if p.Src == "" || p.Dst == "" {
+		return nil, errors.New("src and dst are required")
+	}
+	args := []string{}
+	names := make([]string, 0, len(p.Options))
+	for name := range p.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch value := p.Options[name].(type) {
+		case []interface{}:
+			for _, v := range value {
+				args = append(args, fmt.Sprintf("-%s=%v", name, v))
+			}
+		case map[string]interface{}, nil:
+			return nil, errors.Errorf("invalid value of option %v", name)
+		default:
+			args = append(args, fmt.Sprintf("-%s=%v", name, value))
+		}
+	}
+	for _, pattern := range p.Excludes {
+		args = append(args, "-exclude="+pattern)
+	}
+	if p.Bandwidth != 0 {
+		args = append(args, fmt.Sprintf("-bwlimit=%d", p.Bandwidth))
+	}
+	if p.PreCmd != "" {
+		args = append(args, "-pre-cmd="+p.PreCmd)
+	}
+	if p.PostCmd != "" {
+		args = append(args, "-post-cmd="+p.PostCmd)
+	}
+	args = append(args, extra...)
+	return append(args, p.Src, p.Dst), nil
+}
+
+// runCommand syncs the profile of the configuration file named by the first
+// argument, the flags following its name override its options
+func runCommand(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := flags.String("config", "fssync.yml", "configuration file defining the profiles")
+	flags.Parse(args)
+
+	if flags.NArg() < 1 {
+		log.Fatalln("Usage: ./fssync run [-config fssync.yml] <profile> [options]")
+	}
+	cfg, err := readConfig(*configPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	name := flags.Arg(0)
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		log.Fatalf("no profile %v in %v", name, *configPath)
+	}
+	profileArgs, err := p.args(flags.Args()[1:])
+	if err != nil {
+		log.Fatalf("invalid profile %v: %v", name, err)
+	}
+	syncCommand(profileArgs)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// diffCommand lists the entries a sync of src would create, update and
+// delete in dst without modifying it
+func diffCommand(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	syncFlags := newSyncFlags(flags)
+	itemize := flags.Bool("itemize", false, "itemize the changes like rsync, the exit status is 1 if any, like ./fssync sync -dry-run")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatalln("Usage: ./fssync diff [options] <src> <dst>")
+	}
+	src, dst := flags.Arg(0), flags.Arg(1)
+
+	syncer := fssync.New(syncFlags.options()...)
+	syncFlags.switchUser(syncer)
+	if *itemize {
+		dryRunCommand(syncer, dst, src)
+		return
+	}
+	plan, err := syncer.Diff(dst, src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, change := range plan.Changes {
+		fmt.Println(change.Type, change.Path)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// doctorCommand probes the filesystem of the destination directory and
+// displays which features of fssync will work when syncing onto it
+func doctorCommand(args []string) {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		log.Fatalln("Usage: ./fssync doctor <dst>")
+	}
+	dst := flags.Arg(0)
+
+	caps, err := fssync.ProbeCapabilities(dst)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	checks := []struct {
+		capability string
+		supported  bool
+		feature    string
+	}{
+		{"hardlinks", caps.Hardlinks, "hardlinks preservation, files are copied otherwise"},
+		{"symlinks", caps.Symlinks, "symlinks preservation"},
+		{"sub-second mtimes", caps.SubSecondMtimes, "exact modification times, files are copied on every run unless -checksum is used otherwise"},
+		{"xattrs", caps.Xattrs, "extended attributes (not synced by fssync)"},
+		{"reflink", caps.Reflink, "copy-on-write clones with -clone, contents are copied otherwise"},
+		{"fallocate", caps.Fallocate, "space preallocation (not used by fssync)"},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CAPABILITY\tSUPPORTED\tFEATURE")
+	for _, check := range checks {
+		supported := "no"
+		if check.supported {
+			supported = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.capability, supported, check.feature)
+	}
+	w.Flush()
+
+	if !caps.StableMtimes {
+		fmt.Println("\nModification times are not read back as set, use -clock-skew=compensate or -checksum")
+	} else if caps.MtimeSkew != 0 {
+		fmt.Printf("\nModification times are read back with a skew of %v, use -clock-skew=compensate\n", caps.MtimeSkew)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// dryRunCommand itemizes the changes a sync of src would make to dst, like
+// rsync --itemize-changes, without modifying it. The exit status is 1 if any,
+// to detect a drift of the destination.
+func dryRunCommand(syncer *fssync.FsSyncer, dst, src string) {
+	plan, err := syncer.Diff(dst, src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, change := range plan.Changes {
+		fmt.Println(itemizeChange(plan.Dst, change))
+	}
+	if len(plan.Changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+// itemizeChange formats a change with the rsync itemized notation: the update
+// type, the file type and the changed attributes, followed by the path
+// relative to the destination
+func itemizeChange(dst string, change fssync.Change) string {
+	path, err := filepath.Rel(dst, change.Path)
+	if err != nil {
+		path = change.Path
+	}
+	if change.Type == fssync.ChangeDelete {
+		return "*deleting   " + path
+	}
+
+	updateType, fileType := byte('>'), byte('f')
+	info, err := os.Lstat(change.SrcPath)
+	if err == nil {
+		switch {
+		case info.IsDir():
+			updateType, fileType = 'c', 'd'
+			path += string(filepath.Separator)
+		case info.Mode()&os.ModeSymlink != 0:
+			updateType, fileType = 'c', 'L'
+		case !info.Mode().IsRegular():
+			updateType, fileType = 'c', 'D'
+		}
+	}
+	attributes := "c........"
+	if change.Type == fssync.ChangeCreate {
+		attributes = "+++++++++"
+	}
+	return fmt.Sprintf("%c%c%s %s", updateType, fileType, attributes, path)
+}
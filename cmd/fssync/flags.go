@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// stringList is the value of a flag which can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// sinceTime is the value of a flag which is either a RFC 3339 date or a
+// duration before now, like 24h
+type sinceTime struct {
+	time.Time
+}
+
+func (t *sinceTime) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *sinceTime) Set(value string) error {
+	d, err := time.ParseDuration(value)
+	if err == nil {
+		t.Time = time.Now().Add(-d)
+		return nil
+	}
+	t.Time, err = time.Parse(time.RFC3339, value)
+	return err
+}
+
+// octalMode is the value of a flag which is a mode in octal, like 0644
+type octalMode struct {
+	os.FileMode
+}
+
+func (m *octalMode) String() string {
+	if m.FileMode == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%04o", uint32(m.FileMode))
+}
+
+func (m *octalMode) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 12)
+	if err != nil {
+		return errors.Errorf("invalid octal mode %v", value)
+	}
+	m.FileMode = unixFileMode(uint32(mode))
+	return nil
+}
+
+// chmodClauses is the value of a flag which is a list of symbolic chmod
+// clauses, like u+rw,go-w. The = operator clears the permissions of the
+// designated classes before setting the given ones.
+type chmodClauses struct {
+	value string
+	set   os.FileMode
+	clear os.FileMode
+}
+
+func (c *chmodClauses) String() string {
+	return c.value
+}
+
+func (c *chmodClauses) Set(value string) error {
+	for _, clause := range strings.Split(value, ",") {
+		i := strings.IndexAny(clause, "+-=")
+		if i < 0 {
+			return errors.Errorf("invalid chmod clause %v", clause)
+		}
+		who, op, perms := clause[:i], clause[i], clause[i+1:]
+		if who == "" {
+			who = "a"
+		}
+		var classes, bits uint32
+		for _, w := range who {
+			switch w {
+			case 'u':
+				classes |= 0700 | modeSetuid
+			case 'g':
+				classes |= 0070 | modeSetgid
+			case 'o':
+				classes |= 0007 | modeSticky
+			case 'a':
+				classes |= 0777 | modeSetuid | modeSetgid | modeSticky
+			default:
+				return errors.Errorf("invalid chmod clause %v", clause)
+			}
+		}
+		for _, p := range perms {
+			switch p {
+			case 'r':
+				bits |= 0444
+			case 'w':
+				bits |= 0222
+			case 'x':
+				bits |= 0111
+			case 's':
+				bits |= modeSetuid | modeSetgid
+			case 't':
+				bits |= modeSticky
+			default:
+				return errors.Errorf("invalid chmod clause %v", clause)
+			}
+		}
+		mode := unixFileMode(classes & bits)
+		switch op {
+		case '+':
+			c.set |= mode
+			c.clear &^= mode
+		case '-':
+			c.clear |= mode
+			c.set &^= mode
+		case '=':
+			c.clear |= unixFileMode(classes)
+			c.set = c.set&^unixFileMode(classes) | mode
+			c.clear &^= mode
+		}
+	}
+	c.value = value
+	return nil
+}
+
+// Special bits of the modes of chmod(2), spelled out as they are not defined
+// on Windows
+const (
+	modeSetuid = 04000
+	modeSetgid = 02000
+	modeSticky = 01000
+)
+
+// unixFileMode converts the permission bits of chmod(2) to a os.FileMode
+func unixFileMode(mode uint32) os.FileMode {
+	m := os.FileMode(mode & 0777)
+	if mode&modeSetuid != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&modeSetgid != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&modeSticky != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// idMapping is the value of a flag mapping a source user or group ID to a
+// destination one, as src:dst, which can be repeated
+type idMapping map[int]int
+
+func (m idMapping) String() string {
+	mappings := []string{}
+	for src, dst := range m {
+		mappings = append(mappings, fmt.Sprintf("%d:%d", src, dst))
+	}
+	return strings.Join(mappings, ",")
+}
+
+func (m idMapping) Set(value string) error {
+	src, dst, ok := strings.Cut(value, ":")
+	if !ok {
+		return errors.Errorf("invalid ID mapping %v, must be src:dst", value)
+	}
+	srcID, err := strconv.Atoi(src)
+	if err != nil {
+		return errors.Errorf("invalid source ID %v", src)
+	}
+	dstID, err := strconv.Atoi(dst)
+	if err != nil {
+		return errors.Errorf("invalid destination ID %v", dst)
+	}
+	m[srcID] = dstID
+	return nil
+}
+
+// filterRuleFlag is the value of the -include and -exclude flags, which append
+// their rules to the same list to keep the order of the command line
+type filterRuleFlag struct {
+	rules   *[]fssync.FilterRule
+	include bool
+}
+
+func (f filterRuleFlag) String() string {
+	if f.rules == nil {
+		return ""
+	}
+	patterns := []string{}
+	for _, rule := range *f.rules {
+		if rule.Include == f.include {
+			patterns = append(patterns, rule.Pattern)
+		}
+	}
+	return strings.Join(patterns, ",")
+}
+
+func (f filterRuleFlag) Set(value string) error {
+	*f.rules = append(*f.rules, fssync.FilterRule{Include: f.include, Pattern: value})
+	return nil
+}
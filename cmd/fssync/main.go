@@ -1,43 +1,50 @@
 package main
 
 import (
-	"flag"
-	"log"
-
-	"github.com/Scalingo/go-fssync"
+	"fmt"
+	"os"
+	"sort"
 )
 
-func main() {
-	withCheckum := flag.Bool("checksum", false, "compare files with checksum")
-	preserveOwnership := flag.Bool("preserve-ownership", false, "preservice ownership of source")
-	noCache := flag.Bool("no-cache", false, "don't cache read/write content")
-	bufferSize := flag.Int64("buffer-size", 0, "size of the buffer to use during the copy (512kB by default)")
-
-	flag.Parse()
+// commands are the subcommands of ./fssync, a command line starting with
+// none of them is given to the sync command
+var commands = map[string]func(args []string){
+	"sync":       syncCommand,
+	"diff":       diffCommand,
+	"verify":     verifyCommand,
+	"watch":      watchCommand,
+	"manifest":   manifestCommand,
+	"run":        runCommand,
+	"stats":      statsCommand,
+	"doctor":     doctorCommand,
+	"clean-temp": cleanTempCommand,
+}
 
-	options := []func(s *fssync.FsSyncer){}
-	if *withCheckum {
-		options = append(options, fssync.WithChecksum)
-	}
-	if *preserveOwnership {
-		options = append(options, fssync.PreserveOwnership)
-	}
-	if *noCache {
-		options = append(options, fssync.NoCache)
-	}
-	if *bufferSize != 0 {
-		options = append(options, fssync.WithBufferSize(*bufferSize))
+func main() {
+	if len(os.Args) > 1 {
+		if os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "-help" {
+			usage()
+			return
+		}
+		command, ok := commands[os.Args[1]]
+		if ok {
+			command(os.Args[2:])
+			return
+		}
 	}
-	syncer := fssync.New(options...)
+	syncCommand(os.Args[1:])
+}
 
-	args := flag.Args()
-	if len(args) != 2 {
-		log.Fatalln("Usage: ./fssync [options] <src> <dst>")
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
 	}
-	src := args[0]
-	dst := args[1]
-	_, err := syncer.Sync(dst, src)
-	if err != nil {
-		log.Fatalln(err)
+	sort.Strings(names)
+	fmt.Println("Usage: ./fssync <command> [options] <args>, ./fssync [options] <src> <dst> is ./fssync sync")
+	fmt.Println("Commands:")
+	for _, name := range names {
+		fmt.Println("  " + name)
 	}
+	fmt.Println("Options of a command are listed with ./fssync <command> -h")
 }
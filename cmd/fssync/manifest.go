@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// manifestCommand generates the tree manifest of a source or syncs a
+// destination from one
+func manifestCommand(args []string) {
+	if len(args) < 1 {
+		log.Fatalln("Usage: ./fssync manifest generate|apply [options] <args>")
+	}
+	switch args[0] {
+	case "generate":
+		generateManifestCommand(args[1:])
+	case "apply":
+		applyManifestCommand(args[1:])
+	default:
+		log.Fatalf("unknown manifest command %v, must be generate or apply", args[0])
+	}
+}
+
+// generateManifestCommand writes the tree manifest of src to the manifest
+// file, or to the standard output if it is -
+func generateManifestCommand(args []string) {
+	flags := flag.NewFlagSet("manifest generate", flag.ExitOnError)
+	syncFlags := newSyncFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatalln("Usage: ./fssync manifest generate [options] <src> <manifest>")
+	}
+	src, path := flags.Arg(0), flags.Arg(1)
+
+	m, err := fssync.New(syncFlags.options()...).GenerateTreeManifest(src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	content, err := json.Marshal(m)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if path == "-" {
+		_, err = os.Stdout.Write(content)
+	} else {
+		err = os.WriteFile(path, content, 0644)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// applyManifestCommand syncs dst from the tree manifest file, the content of
+// the files is read from the content directory
+func applyManifestCommand(args []string) {
+	flags := flag.NewFlagSet("manifest apply", flag.ExitOnError)
+	syncFlags := newSyncFlags(flags)
+	flags.Parse(args)
+
+	if flags.NArg() != 3 {
+		log.Fatalln("Usage: ./fssync manifest apply [options] <manifest> <content-dir> <dst>")
+	}
+	path, contentDir, dst := flags.Arg(0), flags.Arg(1), flags.Arg(2)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var m fssync.TreeManifest
+	err = json.Unmarshal(content, &m)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	syncer := fssync.New(syncFlags.options()...)
+	syncFlags.switchUser(syncer)
+	report, err := syncer.SyncFromTreeManifest(dst, m, fssync.DirContentSource(contentDir))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	printReport(report)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// ownershipOverrides is the value of the -ownership-override flag, which can
+// be repeated with pattern=uid:gid values
+type ownershipOverrides map[string]fssync.Owner
+
+func (o ownershipOverrides) String() string {
+	values := []string{}
+	for pattern, owner := range o {
+		values = append(values, fmt.Sprintf("%s=%d:%d", pattern, owner.UID, owner.GID))
+	}
+	return strings.Join(values, ",")
+}
+
+func (o ownershipOverrides) Set(value string) error {
+	pattern, ids, ok := strings.Cut(value, "=")
+	if !ok || pattern == "" {
+		return errors.Errorf("invalid override %v, must be pattern=uid:gid", value)
+	}
+	uid, gid, ok := strings.Cut(ids, ":")
+	if !ok {
+		return errors.Errorf("invalid override %v, must be pattern=uid:gid", value)
+	}
+	owner := fssync.Owner{}
+	var err error
+	owner.UID, err = strconv.Atoi(uid)
+	if err != nil {
+		return errors.Wrapf(err, "invalid uid in %v", value)
+	}
+	owner.GID, err = strconv.Atoi(gid)
+	if err != nil {
+		return errors.Wrapf(err, "invalid gid in %v", value)
+	}
+	o[pattern] = owner
+	return nil
+}
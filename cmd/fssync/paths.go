@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// readPathList reads the paths listed one per line in the file at path, or in
+// the standard input if path is -. Empty lines and lines starting with # are
+// ignored. With nul, the paths are separated by NUL characters instead, like
+// the output of find -print0, and only the empty ones are ignored.
+func readPathList(path string, nul bool) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		fd, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		r = fd
+	}
+
+	paths := []string{}
+	scanner := bufio.NewScanner(r)
+	if nul {
+		scanner.Split(scanNul)
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if nul {
+			if line != "" {
+				paths = append(paths, line)
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "fail to read the paths of %v", path)
+	}
+	return paths, nil
+}
+
+// scanNul is a bufio.SplitFunc returning the NUL separated tokens of the input
+func scanNul(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
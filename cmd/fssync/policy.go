@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// comparePolicyNames are the names of the policies of the -policy flag
+var comparePolicyNames = map[string]fssync.ComparePolicy{
+	"default":   fssync.CompareDefault,
+	"size-only": fssync.CompareSizeOnly,
+	"checksum":  fssync.CompareChecksum,
+	"exclude":   fssync.CompareExclude,
+}
+
+// patternPolicies is the value of the -policy flag, which can be repeated
+// with pattern=policy values
+type patternPolicies map[string]fssync.ComparePolicy
+
+func (p patternPolicies) String() string {
+	values := []string{}
+	for pattern, policy := range p {
+		for name, namedPolicy := range comparePolicyNames {
+			if namedPolicy == policy {
+				values = append(values, fmt.Sprintf("%s=%s", pattern, name))
+			}
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func (p patternPolicies) Set(value string) error {
+	pattern, name, ok := strings.Cut(value, "=")
+	if !ok || pattern == "" {
+		return errors.Errorf("invalid policy %v, must be pattern=policy", value)
+	}
+	policy, ok := comparePolicyNames[name]
+	if !ok {
+		return errors.Errorf("invalid policy %v, must be default, size-only, checksum or exclude", name)
+	}
+	p[pattern] = policy
+	return nil
+}
@@ -0,0 +1,156 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/Scalingo/go-fssync"
+	"github.com/pkg/errors"
+)
+
+// dropPrivileges switches the process to the user named or identified by
+// username and its groups. It's definitive: the privileges of the initial
+// user can't be recovered.
+func dropPrivileges(username string) error {
+	uid, gid, gids, err := lookupUser(username)
+	if err != nil {
+		return err
+	}
+
+	// Groups must be changed first, the user would not be allowed to change
+	// them anymore
+	err = syscall.Setgroups(gids)
+	if err != nil {
+		return errors.Wrapf(err, "fail to set groups to %v", gids)
+	}
+	err = syscall.Setgid(gid)
+	if err != nil {
+		return errors.Wrapf(err, "fail to set gid to %v", gid)
+	}
+	err = syscall.Setuid(uid)
+	if err != nil {
+		return errors.Wrapf(err, "fail to set uid to %v", uid)
+	}
+	return nil
+}
+
+// syncReadingAsUser syncs src to dst with syncer, the source being read by a
+// child process running as the user named or identified by username and its
+// groups: the child writes the source as a tar stream, applied onto dst with
+// SyncFromTar. The source is read with the permissions of the user, while the
+// ownership options are applied with the privileges of the current process.
+func syncReadingAsUser(syncer *fssync.FsSyncer, username, dst, src string) (fssync.SyncReport, error) {
+	uid, gid, gids, err := lookupUser(username)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]uint32, 0, len(gids))
+	for _, gid := range gids {
+		groups = append(groups, uint32(gid))
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to get path of the executable")
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), runAsChildEnv+"=1")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups},
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to get output of the reader of the source")
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to read %v as %v", src, username)
+	}
+
+	stream := &readerOutput{r: stdout, cmd: cmd}
+	report, err := syncer.SyncFromTar(stream, dst)
+	if err != nil {
+		cmd.Process.Kill()
+	}
+	waitErr := stream.wait()
+	if err != nil {
+		return report, err
+	}
+	if waitErr != nil {
+		return report, errors.Wrapf(waitErr, "fail to read %v as %v", src, username)
+	}
+	return report, nil
+}
+
+// readerOutput is the tar stream written by the reader of syncReadingAsUser.
+// A reader failing between two entries ends the stream like a complete one:
+// its exit status is checked once the stream ends to not apply a partial
+// source, whose missing entries would be deleted from the destination.
+type readerOutput struct {
+	r       io.Reader
+	cmd     *exec.Cmd
+	waited  bool
+	waitErr error
+}
+
+func (o *readerOutput) Read(p []byte) (int, error) {
+	n, err := o.r.Read(p)
+	if err == io.EOF {
+		waitErr := o.wait()
+		if waitErr != nil {
+			return n, errors.Wrap(waitErr, "reader of the source failed")
+		}
+	}
+	return n, err
+}
+
+// wait waits for the end of the reader, once
+func (o *readerOutput) wait() error {
+	if !o.waited {
+		o.waited = true
+		o.waitErr = o.cmd.Wait()
+	}
+	return o.waitErr
+}
+
+// lookupUser returns the uid, the gid and the groups of the user named or
+// identified by username
+func lookupUser(username string) (int, int, []int, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		var lookupIDErr error
+		u, lookupIDErr = user.LookupId(username)
+		if lookupIDErr != nil {
+			return -1, -1, nil, errors.Wrapf(err, "fail to find user %v", username)
+		}
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, -1, nil, errors.Wrapf(err, "invalid uid of user %v", username)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return -1, -1, nil, errors.Wrapf(err, "invalid gid of user %v", username)
+	}
+
+	groupIDs, err := u.GroupIds()
+	if err != nil {
+		return -1, -1, nil, errors.Wrapf(err, "fail to get groups of user %v", username)
+	}
+	gids := make([]int, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		gid, err := strconv.Atoi(groupID)
+		if err != nil {
+			return -1, -1, nil, errors.Wrapf(err, "invalid group id %v of user %v", groupID, username)
+		}
+		gids = append(gids, gid)
+	}
+	return uid, gid, gids, nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/Scalingo/go-fssync"
+	"github.com/pkg/errors"
+)
+
+// dropPrivileges is not supported, Windows has no setuid
+func dropPrivileges(username string) error {
+	return errors.Errorf("fail to run as %v, switching user is not supported on Windows", username)
+}
+
+// syncReadingAsUser is not supported, Windows has no setuid
+func syncReadingAsUser(syncer *fssync.FsSyncer, username, dst, src string) (fssync.SyncReport, error) {
+	return nil, errors.Errorf("fail to read %v as %v, switching user is not supported on Windows", src, username)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// progressDisplay displays the progress of the sync on the standard error
+// with -progress and keeps the last one for the -stats summary
+type progressDisplay struct {
+	show  bool
+	start time.Time
+	last  fssync.Progress
+}
+
+func (d *progressDisplay) update(progress fssync.Progress) {
+	d.last = progress
+	if !d.show {
+		return
+	}
+	line := fmt.Sprintf("%d scanned, %d copied, %d deleted, %.1fMB (%s)",
+		progress.ScannedEntries, progress.CreatedEntries+progress.UpdatedEntries, progress.DeletedEntries,
+		float64(progress.CopiedBytes)/1e6, formatThroughput(progress.CopiedBytes, time.Since(d.start)),
+	)
+	if progress.CurrentPath != "" {
+		line += " " + truncatePath(progress.CurrentPath, 50)
+	}
+	// The line is cleared before being written again
+	fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+	if progress.Done {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// printStats prints the summary of the sync with -stats
+func (d *progressDisplay) printStats() {
+	elapsed := time.Since(d.start)
+	fmt.Printf("files scanned: %d\n", d.last.ScannedEntries)
+	fmt.Printf("files copied: %d (%d created, %d updated)\n",
+		d.last.CreatedEntries+d.last.UpdatedEntries, d.last.CreatedEntries, d.last.UpdatedEntries)
+	fmt.Printf("files deleted: %d\n", d.last.DeletedEntries)
+	fmt.Printf("bytes written: %d\n", d.last.CopiedBytes)
+	fmt.Printf("throughput: %s\n", formatThroughput(d.last.CopiedBytes, elapsed))
+	fmt.Printf("elapsed: %s\n", elapsed.Round(time.Millisecond))
+}
+
+// truncatePath keeps the end of path, the most specific part, within width
+// characters
+func truncatePath(path string, width int) string {
+	runes := []rune(path)
+	if len(runes) <= width {
+		return path
+	}
+	return "..." + string(runes[len(runes)-width+3:])
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// jsonReport is the report of a sync run written with -report-json
+type jsonReport struct {
+	Time     time.Time     `json:"time"`
+	Src      string        `json:"src"`
+	Dst      string        `json:"dst"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	// Changes of the destination, listed once the sync succeeded
+	Changes          []fssync.Change        `json:"changes"`
+	CopiedBytes      int64                  `json:"copied_bytes"`
+	PendingDeletions []string               `json:"pending_deletions,omitempty"`
+	Warnings         []string               `json:"warnings,omitempty"`
+	UnreadableFiles  []string               `json:"unreadable_files,omitempty"`
+	UnsafeSymlinks   []string               `json:"unsafe_symlinks,omitempty"`
+	RenamedPaths     map[string]string      `json:"renamed_paths,omitempty"`
+	DeletionFailures []jsonDeletionFailure  `json:"deletion_failures,omitempty"`
+	ChownFailures    []jsonChownFailure     `json:"chown_failures,omitempty"`
+	Usage            []fssync.ResourceUsage `json:"usage,omitempty"`
+}
+
+type jsonDeletionFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type jsonChownFailure struct {
+	Path  string `json:"path"`
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+	Error string `json:"error"`
+}
+
+// changesCollector is the Publisher gathering the changes of the sync for the
+// JSON report
+type changesCollector struct {
+	changes []fssync.Change
+}
+
+func (c *changesCollector) Publish(event fssync.SyncEvent) error {
+	c.changes = append(c.changes, event.Changes...)
+	return nil
+}
+
+func newJSONReport(start time.Time, dst, src string, changes []fssync.Change, report fssync.SyncReport, err error) jsonReport {
+	r := jsonReport{
+		Time: start, Src: src, Dst: dst,
+		Duration:         time.Since(start),
+		Changes:          changes,
+		CopiedBytes:      report.CopiedBytes(),
+		PendingDeletions: report.PendingDeletions(),
+		Warnings:         report.Warnings(),
+		UnreadableFiles:  report.UnreadableFiles(),
+		UnsafeSymlinks:   report.UnsafeSymlinks(),
+		RenamedPaths:     report.RenamedPaths(),
+		Usage:            report.ResourceUsage(),
+	}
+	if r.Changes == nil {
+		r.Changes = []fssync.Change{}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	for _, failure := range report.DeletionFailures() {
+		r.DeletionFailures = append(r.DeletionFailures, jsonDeletionFailure{Path: failure.Path, Error: failure.Err.Error()})
+	}
+	for _, failure := range report.OwnershipFailures() {
+		r.ChownFailures = append(r.ChownFailures, jsonChownFailure{
+			Path: failure.Path, UID: failure.Owner.UID, GID: failure.Owner.GID, Error: failure.Err.Error(),
+		})
+	}
+	return r
+}
+
+// writeJSONReport writes the report to the file at path, or to the standard
+// output if path is -
+func writeJSONReport(path string, report jsonReport) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		fd, err := os.Create(path)
+		if err != nil {
+			return errors.Wrapf(err, "fail to create report file %v", path)
+		}
+		defer fd.Close()
+		w = fd
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(report)
+	if err != nil {
+		return errors.Wrapf(err, "fail to write report to %v", path)
+	}
+	return nil
+}
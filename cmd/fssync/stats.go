@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// runStats is the summary of a sync run, appended as a JSON line to the stats
+// file given with -stats-file
+type runStats struct {
+	Time     time.Time     `json:"time"`
+	Src      string        `json:"src"`
+	Dst      string        `json:"dst"`
+	Files    int           `json:"files"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	// Usage is the resource usage of each stage with -resource-usage
+	Usage []fssync.ResourceUsage `json:"usage,omitempty"`
+}
+
+func appendRunStats(path string, stats runStats) error {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "fail to open stats file %v", path)
+	}
+	defer fd.Close()
+
+	err = json.NewEncoder(fd).Encode(stats)
+	if err != nil {
+		return errors.Wrapf(err, "fail to write stats to %v", path)
+	}
+	return nil
+}
+
+func readRunStats(path string) ([]runStats, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open stats file %v", path)
+	}
+	defer fd.Close()
+
+	runs := []runStats{}
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var run runStats
+		err := json.Unmarshal(scanner.Bytes(), &run)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid line in stats file %v", path)
+		}
+		runs = append(runs, run)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "fail to read stats file %v", path)
+	}
+	return runs, nil
+}
+
+// statsCommand displays the runs recorded in a stats file and how the
+// duration and throughput of the most recent runs compare to the older ones
+func statsCommand(args []string) {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	statsFile := flags.String("stats-file", "", "file where the run summaries have been appended")
+	last := flags.Int("last", 20, "number of runs to display")
+	flags.Parse(args)
+
+	if *statsFile == "" {
+		log.Fatalln("Usage: ./fssync stats -stats-file <file> [-last=20]")
+	}
+	runs, err := readRunStats(*statsFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if len(runs) == 0 {
+		fmt.Println("no run recorded")
+		return
+	}
+
+	displayed := runs
+	if *last > 0 && len(displayed) > *last {
+		displayed = displayed[len(displayed)-*last:]
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tFILES\tBYTES\tDURATION\tTHROUGHPUT\tCPU\tMAX RSS\tERROR")
+	for _, run := range displayed {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			run.Time.Format(time.RFC3339), run.Files, run.Bytes,
+			run.Duration.Round(time.Millisecond), formatThroughput(run.Bytes, run.Duration),
+			formatCPUTime(run.Usage), formatMaxRSS(run.Usage), run.Error,
+		)
+	}
+	w.Flush()
+
+	failures := 0
+	for _, run := range runs {
+		if run.Error != "" {
+			failures++
+		}
+	}
+	fmt.Printf("\n%d runs, %d failed\n", len(runs), failures)
+
+	// Compare the most recent half of the runs with the oldest one
+	if len(runs) < 2 {
+		return
+	}
+	older, recent := averages(runs[:len(runs)/2]), averages(runs[len(runs)/2:])
+	fmt.Printf("average duration: %s -> %s (%s)\n",
+		older.duration.Round(time.Millisecond), recent.duration.Round(time.Millisecond),
+		formatTrend(float64(older.duration), float64(recent.duration)),
+	)
+	fmt.Printf("average bytes: %d -> %d (%s)\n",
+		older.bytes, recent.bytes, formatTrend(float64(older.bytes), float64(recent.bytes)),
+	)
+}
+
+type runAverages struct {
+	duration time.Duration
+	bytes    int64
+}
+
+func averages(runs []runStats) runAverages {
+	var avg runAverages
+	for _, run := range runs {
+		avg.duration += run.Duration
+		avg.bytes += run.Bytes
+	}
+	avg.duration /= time.Duration(len(runs))
+	avg.bytes /= int64(len(runs))
+	return avg
+}
+
+func formatThroughput(bytes int64, duration time.Duration) string {
+	if duration <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1fMB/s", float64(bytes)/duration.Seconds()/1e6)
+}
+
+// formatCPUTime returns the user and system time of all the stages of usage
+func formatCPUTime(usage []fssync.ResourceUsage) string {
+	if len(usage) == 0 {
+		return "-"
+	}
+	var cpu time.Duration
+	for _, stage := range usage {
+		cpu += stage.UserTime + stage.SystemTime
+	}
+	return cpu.Round(time.Millisecond).String()
+}
+
+// formatMaxRSS returns the peak resident set size of the stages of usage
+func formatMaxRSS(usage []fssync.ResourceUsage) string {
+	if len(usage) == 0 {
+		return "-"
+	}
+	var rss int64
+	for _, stage := range usage {
+		rss = max(rss, stage.MaxRSS)
+	}
+	return fmt.Sprintf("%.1fMB", float64(rss)/1e6)
+}
+
+func formatTrend(before, after float64) string {
+	if before == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", (after-before)/before*100)
+}
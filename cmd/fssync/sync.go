@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// syncCommand syncs src to dst, from or to a tar stream with -from-tar and
+// -tar
+func syncCommand(args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	syncFlags := newSyncFlags(flags)
+	eventsFile := flags.String("events-file", "", "append the changes of the destination to this file as JSON lines, - for the standard output")
+	resourceUsage := flags.Bool("resource-usage", false, "measure the CPU time, memory, I/O and system calls of each stage of the sync, displayed and recorded to the -stats-file")
+	showProgress := flags.Bool("progress", false, "display the progress of the sync on the standard error: entries, bytes and current file")
+	showStats := flags.Bool("stats", false, "display a summary of the sync: entries scanned, copied and deleted, bytes written, throughput and elapsed time")
+	reportJSON := flags.String("report-json", "", "write the report of the sync, with the change of each entry, to this file as JSON, - for the standard output")
+	statsFile := flags.String("stats-file", "", "append a summary of the run to this file, displayed with ./fssync stats")
+	filesFrom := flags.String("files-from", "", "only sync the paths relative to the source listed one per line in this file, - for the standard input")
+	from0 := flags.Bool("from0", false, "with -files-from, the listed paths are separated by NUL characters instead of newlines, like the output of find -print0")
+	dryRun := flags.Bool("dry-run", false, "itemize the changes like rsync without modifying the destination, the exit status is 1 if any")
+	tarInput := flags.Bool("from-tar", false, "apply the <src> tar file, - for the standard input, onto the destination")
+	tarOutput := flags.Bool("tar", false, "write the source as a tar stream to the <dst> file, - for the standard output")
+	preCmd := flags.String("pre-cmd", "", "shell command run before the sync, which is aborted if it fails, with the FSSYNC_SRC and FSSYNC_DST environment variables")
+	postCmd := flags.String("post-cmd", "", "shell command run after the sync, even if it failed, with its result in the FSSYNC_STATUS, FSSYNC_ERROR, FSSYNC_CHANGES, FSSYNC_COPIED_BYTES, FSSYNC_WARNINGS and FSSYNC_DURATION environment variables")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatalln("Usage: ./fssync [sync] [options] <src> <dst>")
+	}
+	src, dst := flags.Arg(0), flags.Arg(1)
+	if os.Getenv(runAsChildEnv) != "" {
+		// Reader of the source of syncReadingAsUser
+		tarCommand(fssync.New(syncFlags.readerOptions()...), "-", src)
+		return
+	}
+
+	options := syncFlags.options()
+	if *resourceUsage {
+		options = append(options, fssync.MeasureResourceUsage)
+	}
+	publishers := []fssync.Publisher{}
+	if *eventsFile != "" {
+		publisher, closeEvents := eventsFilePublisher(*eventsFile)
+		defer closeEvents()
+		publishers = append(publishers, publisher)
+	}
+	display := &progressDisplay{show: *showProgress}
+	if *showProgress || *showStats {
+		options = append(options, fssync.WithProgress(200*time.Millisecond, display.update))
+	}
+	changes := &changesCollector{}
+	if *reportJSON != "" {
+		publishers = append(publishers, changes)
+	}
+	if len(publishers) > 0 {
+		options = append(options, fssync.WithEventPublisher(fssync.PublisherFunc(func(event fssync.SyncEvent) error {
+			for _, publisher := range publishers {
+				err := publisher.Publish(event)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})))
+	}
+	syncer := fssync.New(options...)
+	readAsUser := syncFlags.splitsPrivileges()
+	if readAsUser {
+		if *filesFrom != "" || *dryRun || *tarInput || *tarOutput || *syncFlags.trailingSlash {
+			log.Fatalln("-run-as with the ownership options can't be used with -files-from, -dry-run, -from-tar, -tar or -trailing-slash")
+		}
+	} else {
+		syncFlags.switchUser(syncer)
+	}
+
+	if *reportJSON != "" && (*filesFrom != "" || *dryRun || *tarInput || *tarOutput) {
+		log.Fatalln("-report-json can't be used with -files-from, -dry-run, -from-tar or -tar")
+	}
+	if (*showProgress || *showStats) && (*filesFrom != "" || *dryRun || *tarInput || *tarOutput) {
+		log.Fatalln("-progress and -stats can't be used with -files-from, -dry-run, -from-tar or -tar")
+	}
+	if (*preCmd != "" || *postCmd != "") && (*dryRun || *tarInput || *tarOutput) {
+		log.Fatalln("-pre-cmd and -post-cmd can't be used with -dry-run, -from-tar or -tar")
+	}
+	if *from0 && *filesFrom == "" {
+		log.Fatalln("-from0 requires -files-from")
+	}
+	if *filesFrom != "" && (*dryRun || *tarInput || *tarOutput) {
+		log.Fatalln("-files-from can't be used with -dry-run, -from-tar or -tar")
+	}
+	if *dryRun {
+		if *tarInput || *tarOutput {
+			log.Fatalln("-dry-run can't be used with -from-tar or -tar")
+		}
+		dryRunCommand(syncer, dst, src)
+		return
+	}
+	if *tarInput {
+		if *tarOutput {
+			log.Fatalln("-from-tar can't be used with -tar")
+		}
+		fromTarCommand(syncer, dst, src)
+		return
+	}
+	if *tarOutput {
+		tarCommand(syncer, dst, src)
+		return
+	}
+
+	if *preCmd != "" {
+		err := runHookCommand(*preCmd, syncEnv(src, dst))
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	start := time.Now()
+	display.start = start
+	var report fssync.SyncReport
+	var err error
+	if *filesFrom != "" {
+		paths, readErr := readPathList(*filesFrom, *from0)
+		if readErr != nil {
+			log.Fatalln(readErr)
+		}
+		report, err = syncer.SyncPaths(dst, src, paths)
+	} else if readAsUser {
+		report, err = syncReadingAsUser(syncer, *syncFlags.runAs, dst, src)
+	} else {
+		report, err = syncer.Sync(dst, src)
+	}
+	var postErr error
+	if *postCmd != "" {
+		postErr = runHookCommand(*postCmd, append(syncEnv(src, dst), reportEnv(report, time.Since(start), err)...))
+	}
+	if *statsFile != "" {
+		stats := runStats{
+			Time: start, Src: src, Dst: dst,
+			Files:    report.ChangeCount(),
+			Bytes:    report.CopiedBytes(),
+			Duration: time.Since(start),
+			Usage:    report.ResourceUsage(),
+		}
+		if err != nil {
+			stats.Error = err.Error()
+		}
+		statsErr := appendRunStats(*statsFile, stats)
+		if statsErr != nil {
+			log.Println(statsErr)
+		}
+	}
+	if *reportJSON != "" {
+		reportErr := writeJSONReport(*reportJSON, newJSONReport(start, dst, src, changes.changes, report, err))
+		if reportErr != nil {
+			log.Println(reportErr)
+		}
+	}
+	if err != nil {
+		if postErr != nil {
+			log.Println(postErr)
+		}
+		log.Fatalln(err)
+	}
+	printReport(report)
+	for _, path := range report.PendingDeletions() {
+		fmt.Println("would delete", path)
+	}
+	if *showStats {
+		display.printStats()
+	}
+	for _, usage := range report.ResourceUsage() {
+		log.Printf("usage: %s in %s, user %s, system %s, max rss %.1fMB, %d blocks in, %d blocks out, %d read and %d write syscalls",
+			usage.Stage, usage.Duration.Round(time.Millisecond),
+			usage.UserTime.Round(time.Millisecond), usage.SystemTime.Round(time.Millisecond), float64(usage.MaxRSS)/1e6,
+			usage.InBlocks, usage.OutBlocks, usage.ReadSyscalls, usage.WriteSyscalls,
+		)
+	}
+	if postErr != nil {
+		log.Fatalln(postErr)
+	}
+}
+
+// eventsFilePublisher returns the publisher appending the events to the file
+// at path, or writing them to the standard output if path is -, and the
+// function closing the file
+func eventsFilePublisher(path string) (fssync.Publisher, func()) {
+	if path == "-" {
+		return fssync.JSONPublisher(os.Stdout), func() {}
+	}
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	return fssync.JSONPublisher(fd), func() { fd.Close() }
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// syncFlags are the flags configuring the syncer, shared by the commands
+// syncing or comparing a source and a destination
+type syncFlags struct {
+	withChecksum       *bool
+	hashName           *string
+	preserveOwnership  *bool
+	ownershipByName    *bool
+	bestEffortOwner    *bool
+	overrides          ownershipOverrides
+	uidMapping         idMapping
+	gidMapping         idMapping
+	noCache            *bool
+	readahead          *bool
+	dirFd              *bool
+	sandbox            *bool
+	noDelete           *bool
+	noPerms            *bool
+	chmod              chmodClauses
+	fileMode           octalMode
+	dirMode            octalMode
+	noHardlinks        *bool
+	overlayWhiteouts   *bool
+	minSize            *int64
+	maxSize            *int64
+	modifiedSince      sinceTime
+	filterRules        []fssync.FilterRule
+	policies           patternPolicies
+	oneFileSystem      *bool
+	clone              *bool
+	linkDest           *string
+	partialDir         *string
+	tempDir            *string
+	appendMode         *bool
+	dedupe             *bool
+	manifest           *string
+	trustManifest      *bool
+	protected          stringList
+	destinationPrefix  *string
+	trailingSlash      *bool
+	symlinks           *string
+	noSymlinkRewrite   *bool
+	relativeSymlinks   *bool
+	safeLinks          *bool
+	deleteTiming       *string
+	deleteDryRun       *bool
+	cleanDestination   *bool
+	clockSkew          *string
+	modTimeWindow      *time.Duration
+	noDirTimes         *bool
+	detectCapabilities *bool
+	continueOnError    *bool
+	retry              *int
+	retryBackoff       *time.Duration
+	runAs              *string
+	bwLimit            *int64
+	maxOps             *int
+	maxDepth           *int
+	maxEntriesPerDir   *int
+	bufferSize         *int64
+	timesConcurrency   *int
+	deterministicOrder *bool
+	memoryLimit        *int64
+	logLevel           *string
+}
+
+func newSyncFlags(flags *flag.FlagSet) *syncFlags {
+	f := &syncFlags{
+		overrides:  ownershipOverrides{},
+		uidMapping: idMapping{},
+		gidMapping: idMapping{},
+		policies:   patternPolicies{},
+	}
+	f.withChecksum = flags.Bool("checksum", false, "compare files with checksum")
+	f.hashName = flags.String("hash", fssync.HashSHA1, "checksum algorithm: sha1, sha256, xxhash64 or blake3")
+	f.preserveOwnership = flags.Bool("preserve-ownership", false, "preservice ownership of source")
+	f.bestEffortOwner = flags.Bool("best-effort-ownership", false, "keep the current owner of the destination entries which can't be chowned instead of failing, like rsync run as non-root")
+	f.ownershipByName = flags.Bool("ownership-by-name", false, "preserve ownership of source translated by user and group names")
+	flags.Var(f.overrides, "ownership-override", "force the ownership of a subtree of the source, as pattern=uid:gid, can be repeated")
+	flags.Var(f.uidMapping, "uid-map", "with -preserve-ownership, give the destination user ID to the source one, as src:dst, can be repeated")
+	flags.Var(f.gidMapping, "gid-map", "with -preserve-ownership, give the destination group ID to the source one, as src:dst, can be repeated")
+	f.noCache = flags.Bool("no-cache", false, "don't cache read/write content")
+	f.dirFd = flags.Bool("dirfd", false, "walk and read the source through the descriptors of its directories, robust to the renames of its ancestors")
+	f.sandbox = flags.Bool("sandbox", false, "resolve the destination entries with openat2 without following symlinks nor leaving the destination (Linux 5.6+)")
+	f.readahead = flags.Bool("readahead", false, "advise the kernel to read ahead the source files, to speed up the copy of large files on spinning disks")
+	f.noDelete = flags.Bool("no-delete", false, "keep the files of the destination which are not present in the source")
+	f.noPerms = flags.Bool("no-perms", false, "create the new entries with the default modes masked by the umask instead of the modes of the source")
+	flags.Var(&f.chmod, "chmod", "adjust the modes of the destination entries with symbolic chmod clauses, like u+rw,go-w")
+	flags.Var(&f.fileMode, "file-mode", "create the new files with this octal mode, like 0644")
+	flags.Var(&f.dirMode, "dir-mode", "create the new directories with this octal mode, like 0755")
+	f.noHardlinks = flags.Bool("no-hardlinks", false, "copy hardlinked files independently instead of linking them together")
+	f.overlayWhiteouts = flags.Bool("overlay-whiteouts", false, "apply the overlayfs and OCI whiteouts and opaque directories of the source layer to the destination")
+	f.minSize = flags.Int64("min-size", 0, "ignore the files smaller than this size in bytes")
+	f.maxSize = flags.Int64("max-size", 0, "ignore the files larger than this size in bytes")
+	flags.Var(&f.modifiedSince, "modified-since", "ignore the files modified before this RFC 3339 date or duration ago, like 24h")
+	flags.Var(filterRuleFlag{rules: &f.filterRules}, "exclude", "exclude the entries matching this rsync pattern, neither copied nor deleted, can be repeated")
+	flags.Var(filterRuleFlag{rules: &f.filterRules, include: true}, "include", "include the entries matching this rsync pattern even if excluded by a later -exclude, can be repeated")
+	flags.Var(f.policies, "policy", "compare the files whose name matches a pattern with a policy: default, size-only, checksum or exclude, as pattern=policy, can be repeated")
+	f.oneFileSystem = flags.Bool("one-file-system", false, "don't sync the content of the directories located on another filesystem than the source, like mount points")
+	f.clone = flags.Bool("clone", false, "copy the source without comparing it to the destination, which must be empty or disposable")
+	f.linkDest = flags.String("link-dest", "", "hardlink the files identical in this directory, like a previous snapshot, instead of copying them")
+	f.appendMode = flags.Bool("append", false, "append the tail of the source to the destination files which are a prefix of it, like growing log files")
+	f.tempDir = flags.String("temp-dir", "", "create the temporary files replacing the destination entries in this directory, on the filesystem of the destination")
+	f.partialDir = flags.String("partial-dir", "", "copy the files through partial files of this directory, relative to the destination, to resume the interrupted copies")
+	f.dedupe = flags.Bool("dedupe", false, "hardlink together the files of the destination with identical content")
+	f.manifest = flags.String("manifest", "", "record the state of the synced files to this file")
+	f.trustManifest = flags.Bool("trust-manifest", false, "compare the source to the -manifest file instead of the destination")
+	flags.Var(&f.protected, "protect", "path of the destination which must not be deleted nor overwritten, can be repeated")
+	f.destinationPrefix = flags.String("destination-prefix", "", "sync to this subdirectory of the destination, deletions are scoped to it")
+	f.trailingSlash = flags.Bool("trailing-slash", false, "like rsync, sync a source without trailing slash to the directory of the destination named like it, only the contents of a source with a trailing slash are synced into the destination")
+	f.symlinks = flags.String("symlinks", "preserve", "how symlinks are synced: preserve, dereference, follow or skip")
+	f.noSymlinkRewrite = flags.Bool("no-symlink-rewrite", false, "copy symlink targets verbatim instead of rewriting the ones located in the source")
+	f.relativeSymlinks = flags.Bool("relative-symlinks", false, "rewrite the symlink targets located in the source relatively to the symlinks")
+	f.safeLinks = flags.Bool("safe-links", false, "skip the symlinks whose target is outside of the source")
+	f.deleteTiming = flags.String("delete-timing", "after", "when extraneous files are deleted: before, during or after the copy")
+	f.deleteDryRun = flags.Bool("delete-dry-run", false, "copy files but only list the extraneous files which would be deleted")
+	f.cleanDestination = flags.Bool("clean-destination", false, "delete everything in the destination before syncing")
+	f.clockSkew = flags.String("clock-skew", "ignore", "how skewed modification times of the destination are compared: ignore, compensate or checksum")
+	f.modTimeWindow = flags.Duration("mod-time-window", 0, "consider equal the modification times which differ by at most this duration, like 2s for FAT destinations")
+	f.noDirTimes = flags.Bool("no-dir-times", false, "don't preserve the times of the directories, only the ones of the files")
+	f.detectCapabilities = flags.Bool("detect-capabilities", false, "probe the destination filesystem and degrade instead of failing on unsupported features")
+	f.retry = flags.Int("retry", 0, "retry the operations failing with transient errors like the ESTALE errors of NFS this number of times")
+	f.retryBackoff = flags.Duration("retry-backoff", 100*time.Millisecond, "wait this duration before the first retry of -retry, doubled before each next one")
+	f.continueOnError = flags.Bool("continue-on-error", false, "skip the source files which can't be read and the destination files which can't be deleted instead of failing")
+	f.runAs = flags.String("run-as", "", "user (name or uid) to switch to before syncing when started as root, only to read the source with the ownership options")
+	f.bwLimit = flags.Int64("bwlimit", 0, "limit the rate of the copy of the file contents to this number of bytes per second")
+	f.maxDepth = flags.Int("max-depth", 0, "only sync the entries located at most this number of levels below the source")
+	f.maxEntriesPerDir = flags.Int("max-entries-per-dir", 0, "fail as soon as a directory has more than this number of entries")
+	f.maxOps = flags.Int("max-ops", 0, "limit the rate of the metadata operations (stat, open, unlink) to this number per second, for network filesystems")
+	f.bufferSize = flags.Int64("buffer-size", 0, "size of the buffer to use during the copy (512kB by default)")
+	f.deterministicOrder = flags.Bool("deterministic-order", false, "process the entries in lexical order, for two runs over the same trees to log and report the same lines")
+	f.timesConcurrency = flags.Int("times-concurrency", 0, "number of workers setting the times of the destination entries (8 by default)")
+	f.memoryLimit = flags.Int64("memory-limit", 0, "bytes of memory used to track the synced files beyond which they are moved to a temporary file (unlimited by default)")
+	f.logLevel = flags.String("log-level", "", "log the activity of the sync on the standard error from this level: debug, info, warn or error")
+	return f
+}
+
+// options returns the options of the syncer set by the flags, the process
+// exits if they are invalid
+func (f *syncFlags) options() []func(*fssync.FsSyncer) {
+	options := []func(s *fssync.FsSyncer){}
+	if *f.withChecksum {
+		options = append(options, fssync.WithChecksum)
+	}
+	newHash, err := fssync.HashByName(*f.hashName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	options = append(options, fssync.WithHash(newHash))
+	if *f.preserveOwnership {
+		options = append(options, fssync.PreserveOwnership)
+	}
+	if *f.ownershipByName {
+		options = append(options, fssync.WithNameBasedOwnership(nil))
+	}
+	if *f.bestEffortOwner {
+		options = append(options, fssync.BestEffortOwnership)
+	}
+	if len(f.overrides) > 0 {
+		options = append(options, fssync.WithOwnershipOverride(f.overrides))
+	}
+	if len(f.uidMapping) > 0 || len(f.gidMapping) > 0 {
+		options = append(options, fssync.WithOwnershipMapping(f.uidMapping, f.gidMapping))
+	}
+	if *f.noCache {
+		options = append(options, fssync.NoCache)
+	}
+	if *f.readahead {
+		if *f.noCache {
+			log.Fatalln("-readahead can't be used with -no-cache")
+		}
+		options = append(options, fssync.WithReadahead)
+	}
+	if *f.dirFd {
+		options = append(options, fssync.DirFdTraversal)
+	}
+	if *f.sandbox {
+		options = append(options, fssync.Sandboxed)
+	}
+	if *f.noDelete {
+		options = append(options, fssync.NoDelete)
+	}
+	if *f.noPerms {
+		options = append(options, fssync.NoPerms)
+	}
+	if f.chmod.value != "" {
+		options = append(options, fssync.WithChmod(f.chmod.set, f.chmod.clear))
+	}
+	if f.fileMode.FileMode != 0 {
+		options = append(options, fssync.WithFileMode(f.fileMode.FileMode))
+	}
+	if f.dirMode.FileMode != 0 {
+		options = append(options, fssync.WithDirMode(f.dirMode.FileMode))
+	}
+	if *f.noHardlinks {
+		options = append(options, fssync.NoHardlinks)
+	}
+	if *f.overlayWhiteouts {
+		options = append(options, fssync.OverlayWhiteouts)
+	}
+	if *f.oneFileSystem {
+		options = append(options, fssync.OneFileSystem)
+	}
+	if *f.minSize != 0 {
+		options = append(options, fssync.WithMinSize(*f.minSize))
+	}
+	if *f.maxSize != 0 {
+		options = append(options, fssync.WithMaxSize(*f.maxSize))
+	}
+	if !f.modifiedSince.IsZero() {
+		options = append(options, fssync.WithModifiedSince(f.modifiedSince.Time))
+	}
+	if len(f.filterRules) > 0 {
+		options = append(options, fssync.WithFilterRules(f.filterRules...))
+	}
+	if len(f.policies) > 0 {
+		options = append(options, fssync.WithPolicyByPattern(f.policies))
+	}
+	if *f.clone {
+		options = append(options, fssync.CloneMode)
+	}
+	if *f.linkDest != "" {
+		options = append(options, fssync.WithLinkDest(*f.linkDest))
+	}
+	if *f.appendMode {
+		options = append(options, fssync.AppendMode)
+	}
+	if *f.tempDir != "" {
+		options = append(options, fssync.WithTempDir(*f.tempDir))
+	}
+	if *f.partialDir != "" {
+		options = append(options, fssync.WithPartialDir(*f.partialDir))
+	}
+	if *f.dedupe {
+		options = append(options, fssync.WithDedupe)
+	}
+	if *f.manifest != "" {
+		options = append(options, fssync.WithManifest(*f.manifest))
+	}
+	if *f.trustManifest {
+		if *f.manifest == "" {
+			log.Fatalln("-trust-manifest requires -manifest")
+		}
+		options = append(options, fssync.TrustManifest)
+	}
+	if len(f.protected) > 0 {
+		options = append(options, fssync.WithProtectedPaths(f.protected...))
+	}
+	if *f.destinationPrefix != "" {
+		options = append(options, fssync.WithDestinationPrefix(*f.destinationPrefix))
+	}
+	if *f.trailingSlash {
+		options = append(options, fssync.TrailingSlashSemantics)
+	}
+	switch *f.symlinks {
+	case "dereference":
+		options = append(options, fssync.WithSymlinkMode(fssync.SymlinkDereference))
+	case "follow":
+		options = append(options, fssync.WithSymlinkMode(fssync.SymlinkFollow))
+	case "skip":
+		options = append(options, fssync.WithSymlinkMode(fssync.SymlinkSkip))
+	case "preserve":
+	default:
+		log.Fatalln("invalid -symlinks, must be one of preserve, dereference, follow or skip")
+	}
+	if *f.noSymlinkRewrite {
+		options = append(options, fssync.NoSymlinkRewrite)
+	}
+	if *f.relativeSymlinks {
+		options = append(options, fssync.RelativeSymlinks)
+	}
+	if *f.safeLinks {
+		options = append(options, fssync.SafeLinks)
+	}
+	switch *f.deleteTiming {
+	case "before":
+		options = append(options, fssync.WithDeleteTiming(fssync.DeleteBefore))
+	case "during":
+		options = append(options, fssync.WithDeleteTiming(fssync.DeleteDuring))
+	case "after":
+	default:
+		log.Fatalln("invalid -delete-timing, must be one of before, during or after")
+	}
+	if *f.deleteDryRun {
+		options = append(options, fssync.DeleteDryRun)
+	}
+	if *f.cleanDestination {
+		options = append(options, fssync.WithCleanDestination)
+	}
+	switch *f.clockSkew {
+	case "compensate":
+		options = append(options, fssync.WithClockSkewPolicy(fssync.ClockSkewCompensate))
+	case "checksum":
+		options = append(options, fssync.WithClockSkewPolicy(fssync.ClockSkewChecksum))
+	case "ignore":
+	default:
+		log.Fatalln("invalid -clock-skew, must be one of ignore, compensate or checksum")
+	}
+	if *f.modTimeWindow != 0 {
+		options = append(options, fssync.WithModTimeWindow(*f.modTimeWindow))
+	}
+	if *f.noDirTimes {
+		options = append(options, fssync.PreserveDirTimes(false))
+	}
+	if *f.detectCapabilities {
+		options = append(options, fssync.DetectCapabilities)
+	}
+	if *f.continueOnError {
+		options = append(options, fssync.ContinueOnError)
+	}
+	if *f.retry != 0 {
+		options = append(options, fssync.WithRetry(*f.retry, *f.retryBackoff))
+	}
+	if *f.bwLimit != 0 {
+		options = append(options, fssync.WithBandwidthLimit(*f.bwLimit))
+	}
+	if *f.maxOps != 0 {
+		options = append(options, fssync.WithMaxOpsPerSecond(*f.maxOps))
+	}
+	if *f.maxDepth != 0 {
+		options = append(options, fssync.WithMaxDepth(*f.maxDepth))
+	}
+	if *f.maxEntriesPerDir != 0 {
+		options = append(options, fssync.WithMaxEntriesPerDir(*f.maxEntriesPerDir))
+	}
+	if *f.bufferSize != 0 {
+		options = append(options, fssync.WithBufferSize(*f.bufferSize))
+	}
+	if *f.timesConcurrency != 0 {
+		options = append(options, fssync.WithTimesConcurrency(*f.timesConcurrency))
+	}
+	if *f.deterministicOrder {
+		options = append(options, fssync.WithDeterministicOrder)
+	}
+	if *f.memoryLimit != 0 {
+		options = append(options, fssync.WithMemoryLimit(*f.memoryLimit))
+	}
+	if *f.logLevel != "" {
+		var level slog.Level
+		err := level.UnmarshalText([]byte(*f.logLevel))
+		if err != nil {
+			log.Fatalln("invalid -log-level, must be one of debug, info, warn or error")
+		}
+		logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+		options = append(options, fssync.WithLogger(logger))
+	}
+	return options
+}
+
+// runAsChildEnv is set in the environment of the child process reading the
+// source as the -run-as user, see syncReadingAsUser
+const runAsChildEnv = "FSSYNC_RUN_AS_CHILD"
+
+// switchUser drops the root privileges for the -run-as user, if any, and
+// warns about the missing privileges required by the options of syncer
+func (f *syncFlags) switchUser(syncer *fssync.FsSyncer) {
+	if *f.runAs != "" {
+		if f.splitsPrivileges() {
+			log.Fatalln("-run-as can only be used with -preserve-ownership, -ownership-by-name or -ownership-override by the sync command")
+		}
+		err := dropPrivileges(*f.runAs)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	missingPrivileges, err := syncer.MissingPrivileges()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, privilege := range missingPrivileges {
+		log.Printf("warning: missing %s, %s", privilege.Capability, privilege.Feature)
+	}
+}
+
+// splitsPrivileges returns true if the source must be read as the -run-as user
+// while the ownership options, which require root privileges, are applied by
+// the current process, see syncReadingAsUser
+func (f *syncFlags) splitsPrivileges() bool {
+	return *f.runAs != "" && (*f.preserveOwnership || *f.ownershipByName || len(f.overrides) > 0)
+}
+
+// readerOptions returns the options of the child process reading the source
+// as the -run-as user: the ownership of the source is written as is to the
+// tar stream, the ownership options and the destination prefix are applied by
+// the process syncing the stream
+func (f *syncFlags) readerOptions() []func(*fssync.FsSyncer) {
+	reader := *f
+	noOwnershipByName, noPrefix := false, ""
+	reader.ownershipByName = &noOwnershipByName
+	reader.destinationPrefix = &noPrefix
+	reader.overrides = ownershipOverrides{}
+	reader.uidMapping, reader.gidMapping = idMapping{}, idMapping{}
+	return append(reader.options(), fssync.PreserveOwnership)
+}
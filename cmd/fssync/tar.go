@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// tarCommand writes src as a tar stream to the dst file, or to the standard
+// output if dst is -
+func tarCommand(syncer *fssync.FsSyncer, dst, src string) {
+	var w io.Writer = os.Stdout
+	if dst != "-" {
+		fd, err := os.Create(dst)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer fd.Close()
+		w = fd
+	}
+
+	report, err := syncer.SyncToTar(w, src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	printReport(report)
+}
+
+// fromTarCommand applies the src tar file, or the standard input if src is -,
+// onto dst
+func fromTarCommand(syncer *fssync.FsSyncer, dst, src string) {
+	var r io.Reader = os.Stdin
+	if src != "-" {
+		fd, err := os.Open(src)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer fd.Close()
+		r = fd
+	}
+
+	report, err := syncer.SyncFromTar(r, dst)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	printReport(report)
+	for _, path := range report.PendingDeletions() {
+		fmt.Println("would delete", path)
+	}
+}
+
+func printReport(report fssync.SyncReport) {
+	for _, warning := range report.Warnings() {
+		log.Println("warning:", warning)
+	}
+	for _, path := range report.UnreadableFiles() {
+		log.Println("unreadable:", path)
+	}
+	for _, path := range report.UnsafeSymlinks() {
+		log.Println("unsafe symlink skipped:", path)
+	}
+	for _, failure := range report.DeletionFailures() {
+		log.Println("not deleted:", failure.Err)
+	}
+	for _, failure := range report.OwnershipFailures() {
+		log.Println("ownership not changed:", failure.Path, failure.Err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// verifyCommand checks that dst matches src and lists the mismatches, the
+// exit status is 1 if any
+func verifyCommand(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	withChecksum := flags.Bool("checksum", false, "compare file contents with checksum")
+	hashName := flags.String("hash", fssync.HashSHA1, "checksum algorithm: sha1, sha256, xxhash64 or blake3")
+	preserveOwnership := flags.Bool("preserve-ownership", false, "check that the ownership of the source is preserved")
+	noDelete := flags.Bool("no-delete", false, "ignore the files of the destination which are not present in the source")
+	noPerms := flags.Bool("no-perms", false, "don't check that the modes of the source are replicated")
+	noHardlinks := flags.Bool("no-hardlinks", false, "don't check that hardlinked files are linked together")
+	oneFileSystem := flags.Bool("one-file-system", false, "don't check the content of the directories located on another filesystem than the source")
+	modTimeWindow := flags.Duration("mod-time-window", 0, "consider equal the modification times which differ by at most this duration")
+	noDirTimes := flags.Bool("no-dir-times", false, "don't compare the times of the directories")
+	var filterRules []fssync.FilterRule
+	flags.Var(filterRuleFlag{rules: &filterRules}, "exclude", "don't check the entries matching this rsync pattern, can be repeated")
+	flags.Var(filterRuleFlag{rules: &filterRules, include: true}, "include", "check the entries matching this rsync pattern even if excluded by a later -exclude, can be repeated")
+	policies := patternPolicies{}
+	flags.Var(policies, "policy", "check the files whose name matches a pattern with a policy: default, size-only, checksum or exclude, as pattern=policy, can be repeated")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatalln("Usage: ./fssync verify [options] <src> <dst>")
+	}
+	src, dst := flags.Arg(0), flags.Arg(1)
+
+	newHash, err := fssync.HashByName(*hashName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	options := []func(*fssync.FsSyncer){fssync.WithHash(newHash)}
+	if *withChecksum {
+		options = append(options, fssync.WithChecksum)
+	}
+	if *preserveOwnership {
+		options = append(options, fssync.PreserveOwnership)
+	}
+	if *noDelete {
+		options = append(options, fssync.NoDelete)
+	}
+	if *noPerms {
+		options = append(options, fssync.NoPerms)
+	}
+	if *noHardlinks {
+		options = append(options, fssync.NoHardlinks)
+	}
+	if *oneFileSystem {
+		options = append(options, fssync.OneFileSystem)
+	}
+	if *modTimeWindow != 0 {
+		options = append(options, fssync.WithModTimeWindow(*modTimeWindow))
+	}
+	if *noDirTimes {
+		options = append(options, fssync.PreserveDirTimes(false))
+	}
+	if len(filterRules) > 0 {
+		options = append(options, fssync.WithFilterRules(filterRules...))
+	}
+	if len(policies) > 0 {
+		options = append(options, fssync.WithPolicyByPattern(policies))
+	}
+
+	report, err := fssync.New(options...).Verify(dst, src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, mismatch := range report.Mismatches {
+		switch mismatch.Kind {
+		case fssync.MismatchMissing, fssync.MismatchExtraneous, fssync.MismatchHardlink:
+			fmt.Println(mismatch.Kind, mismatch.Path)
+		default:
+			fmt.Printf("%v %v: %v != %v\n", mismatch.Kind, mismatch.Path, mismatch.Src, mismatch.Dst)
+		}
+	}
+	if !report.Matches() {
+		os.Exit(1)
+	}
+}
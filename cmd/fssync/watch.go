@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// watchCommand syncs the changes of src to dst until the process is
+// interrupted
+func watchCommand(args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	syncFlags := newSyncFlags(flags)
+	eventsFile := flags.String("events-file", "", "append the changes of the destination to this file as JSON lines, - for the standard output")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatalln("Usage: ./fssync watch [options] <src> <dst>")
+	}
+	src, dst := flags.Arg(0), flags.Arg(1)
+
+	options := syncFlags.options()
+	if *eventsFile != "" {
+		publisher, closeEvents := eventsFilePublisher(*eventsFile)
+		defer closeEvents()
+		options = append(options, fssync.WithEventPublisher(publisher))
+	}
+	syncFlags.switchUser(fssync.New(options...))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watcher := fssync.NewWatcher(options...)
+	watcher.OnSync = func(report fssync.SyncReport, err error) {
+		if err != nil {
+			log.Println("sync error:", err)
+			return
+		}
+		if report.ChangeCount() > 0 {
+			log.Printf("synced %d changes (%d bytes)", report.ChangeCount(), report.CopiedBytes())
+		}
+		for _, warning := range report.Warnings() {
+			log.Println("warning:", warning)
+		}
+	}
+	err := watcher.Watch(ctx, dst, src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,63 @@
+package fssync
+
+import (
+	"io"
+	"os"
+)
+
+// fileCopier is the default Copier. With NoCache, the content read and
+// written is discarded from the page cache with dropCache as the copy goes,
+// to not evict the cache of the other processes when syncing large trees.
+// With WithBandwidthLimit, the limiter delays the copy after each buffer. With
+// WithReadahead, the source is advised to be read sequentially before the
+// copy.
+// Inspired from https://github.com/coreutils/coreutils/blob/master/src/dd.c
+type fileCopier struct {
+	bufferSize int64
+	noCache    bool
+	readahead  bool
+	limiter    *rateLimiter
+}
+
+func (c fileCopier) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	srcFile, _ := src.(*os.File)
+	dstFile, _ := dst.(*os.File)
+	if c.readahead && srcFile != nil {
+		adviseSequential(srcFile)
+	}
+	bufferSize := c.bufferSize
+	if bufferSize <= 0 {
+		bufferSize = 32 * 1024
+	}
+	var written int64
+	buf := make([]byte, bufferSize)
+	for {
+		nr, er := src.Read(buf)
+		if nr > 0 {
+			if c.noCache && srcFile != nil {
+				dropCache(srcFile, written, int64(nr))
+			}
+			nw, ew := dst.Write(buf[0:nr])
+			if nw > 0 {
+				if c.noCache && dstFile != nil {
+					dropCache(dstFile, written, int64(nw))
+				}
+				written += int64(nw)
+				if c.limiter != nil {
+					c.limiter.wait(int64(nw))
+				}
+			}
+			if ew != nil {
+				return written, ew
+			}
+			if nr != nw {
+				return written, io.ErrShortWrite
+			}
+		}
+		if er == io.EOF {
+			return written, nil
+		} else if er != nil {
+			return written, er
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package fssync
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// WithDedupe option: files written to the destination whose content is
+// identical to a file of the destination synced before them are hardlinked to
+// it instead of being copied, even if the source files are not hardlinked
+// together. As hardlinked files share their metadata, the files must also
+// match the mode, the modification time and the managed ownership. The
+// checksums are only computed for the files matching the size and the metadata
+// of another file, empty files are not deduplicated.
+func WithDedupe(s *FsSyncer) {
+	s.dedupe = true
+}
+
+// dedupeKey groups the destination files which can be hardlinked together if
+// their content is identical
+type dedupeKey struct {
+	size         int64
+	mode         os.FileMode
+	mtime        int64
+	owner        Owner
+	ownerManaged bool
+}
+
+// dedupeCandidate is a destination file to which other files can be
+// hardlinked, its checksum is computed on first comparison
+type dedupeCandidate struct {
+	path     string
+	checksum []byte
+	// full is true if the file has the maximum number of links of the
+	// destination filesystem
+	full bool
+}
+
+func (s *FsSyncer) dedupeKey(state syncState, src syncInfo) dedupeKey {
+	owner, managed := s.destinationOwner(state, src.base, src.path, src.stat)
+	return dedupeKey{
+		size:         src.fileInfo.Size(),
+		mode:         s.destinationMode(src.fileInfo),
+		mtime:        src.fileInfo.ModTime().UnixNano(),
+		owner:        owner,
+		ownerManaged: managed,
+	}
+}
+
+// isDedupable returns true if the file synced from src can be hardlinked to
+// an identical destination file
+func (s *FsSyncer) isDedupable(src syncInfo) bool {
+	return s.dedupe && src.fileInfo.Mode().IsRegular() && src.fileInfo.Size() > 0
+}
+
+// addDedupeCandidate registers the destination file at dstPath, synced from
+// src, as a file to which the next identical files are hardlinked
+func (s *FsSyncer) addDedupeCandidate(state syncState, src syncInfo, dstPath string) {
+	if !s.isDedupable(src) {
+		return
+	}
+	key := s.dedupeKey(state, src)
+	state.dedupeCandidates[key] = append(state.dedupeCandidates[key], &dedupeCandidate{path: dstPath})
+}
+
+// linkDuplicate hardlinks the destination file to an already synced file of
+// the destination with the same content and metadata, it returns true if the
+// link has been created
+func (s *FsSyncer) linkDuplicate(src, dst syncInfo, state syncState) (bool, error) {
+	if !s.isDedupable(src) {
+		return false, nil
+	}
+	candidates := state.dedupeCandidates[s.dedupeKey(state, src)]
+	if len(candidates) == 0 || !s.supports(state, dst.path, hardlinksCapability) {
+		return false, nil
+	}
+
+	srcChecksum, err := src.checksum(s.newHash)
+	if err != nil {
+		err = sourceReadError(errors.Cause(err))
+		return false, errors.Wrapf(err, "fail to compute checksum of %v", src.path)
+	}
+	for _, candidate := range candidates {
+		if candidate.full {
+			continue
+		}
+		if candidate.checksum == nil {
+			candidate.checksum, err = syncInfo{path: candidate.path}.checksum(s.newHash)
+			if err != nil {
+				return false, errors.Wrapf(err, "fail to compute checksum of %v", candidate.path)
+			}
+		}
+		if !bytes.Equal(srcChecksum, candidate.checksum) {
+			continue
+		}
+		err = s.linkInDestination(state, candidate.path, dst.path)
+		if errors.Is(err, syscall.EMLINK) {
+			// The file is copied if no other duplicate can have more links and
+			// becomes a candidate for the next duplicates
+			state.report.warn("%v has the maximum number of links of the destination filesystem", candidate.path)
+			candidate.full = true
+			continue
+		} else if err != nil {
+			return false, errors.Wrapf(err, "fail to link %v to its duplicate %v", dst.path, candidate.path)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// isDedupedLink returns true if the existing dst file is hardlinked by
+// WithDedupe while the times or the ownership of its source have changed:
+// updating them in place would modify the other links, the file must be
+// replaced
+func (s *FsSyncer) isDedupedLink(state syncState, src, dst syncInfo) bool {
+	if !s.isDedupable(src) || dst.stat.Nlink < 2 || (!s.noHardlinks && src.stat.Nlink > 1) {
+		return false
+	}
+	if !s.mtimesEqual(state, dst.path, src.times.mtime, dst.times.mtime) {
+		return true
+	}
+	owner, ok := s.destinationOwner(state, src.base, src.path, src.stat)
+	return ok && !owner.matches(dst.stat)
+}
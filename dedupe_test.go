@@ -0,0 +1,83 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_Dedupe(t *testing.T) {
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	setup := func(t *testing.T) (string, string, string) {
+		tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		src := filepath.Join(tmp, "src")
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+		files := map[string]string{
+			"a": "asset", "dir/a": "asset", "b": "asset", "other": "other", "empty": "", "dir/empty": "",
+		}
+		for name, content := range files {
+			path := filepath.Join(src, name)
+			assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+			assert.NoError(t, os.Chtimes(path, mtime, mtime))
+		}
+		// Same content but a different modification time
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "b"), mtime.Add(time.Hour), mtime.Add(time.Hour)))
+		return tmp, src, filepath.Join(tmp, "dst")
+	}
+	sameFile := func(t *testing.T, a, b string) bool {
+		aInfo, err := os.Stat(a)
+		assert.NoError(t, err)
+		bInfo, err := os.Stat(b)
+		assert.NoError(t, err)
+		return os.SameFile(aInfo, bInfo)
+	}
+
+	t.Run("it should hardlink the files with identical content and metadata", func(t *testing.T) {
+		tmp, src, dst := setup(t)
+		defer os.RemoveAll(tmp)
+
+		report, err := New(WithDedupe).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len("asset")*2+len("other")), report.CopiedBytes())
+		assert.True(t, sameFile(t, filepath.Join(dst, "a"), filepath.Join(dst, "dir/a")))
+		assert.False(t, sameFile(t, filepath.Join(dst, "a"), filepath.Join(dst, "b")))
+		assert.False(t, sameFile(t, filepath.Join(dst, "empty"), filepath.Join(dst, "dir/empty")))
+		assert.True(t, mtime.Equal(modTime(t, filepath.Join(dst, "dir/a"))))
+
+		// Files added later are linked to the unchanged files walked before them
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "other-copy"), []byte("other"), 0644))
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "other-copy"), mtime, mtime))
+		report, err = New(WithDedupe).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), report.CopiedBytes())
+		assert.True(t, sameFile(t, filepath.Join(dst, "other"), filepath.Join(dst, "other-copy")))
+	})
+
+	t.Run("it should replace a linked file whose times changed without modifying the other links", func(t *testing.T) {
+		tmp, src, dst := setup(t)
+		defer os.RemoveAll(tmp)
+		_, err := New(WithDedupe).Sync(dst, src)
+		assert.NoError(t, err)
+
+		newMtime := mtime.Add(2 * time.Hour)
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "dir/a"), newMtime, newMtime))
+		_, err = New(WithDedupe, WithChecksum).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.False(t, sameFile(t, filepath.Join(dst, "a"), filepath.Join(dst, "dir/a")))
+		assert.True(t, mtime.Equal(modTime(t, filepath.Join(dst, "a"))))
+		assert.True(t, newMtime.Equal(modTime(t, filepath.Join(dst, "dir/a"))))
+	})
+
+	t.Run("it should not link the files without the option", func(t *testing.T) {
+		tmp, src, dst := setup(t)
+		defer os.RemoveAll(tmp)
+
+		_, err := New().Sync(dst, src)
+		assert.NoError(t, err)
+		assert.False(t, sameFile(t, filepath.Join(dst, "a"), filepath.Join(dst, "dir/a")))
+	})
+}
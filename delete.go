@@ -0,0 +1,519 @@
+package fssync
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DeleteTiming defines when the extraneous files of the destination are
+// deleted relatively to the copy of the source files
+type DeleteTiming int
+
+const (
+	// DeleteAfter deletes the extraneous files once all the source files have
+	// been copied. This is the default.
+	DeleteAfter DeleteTiming = iota
+	// DeleteBefore deletes the extraneous files before copying anything, to
+	// free space on the destination when the tree is largely replaced
+	DeleteBefore
+	// DeleteDuring deletes the extraneous files of each directory when the
+	// copy enters it
+	DeleteDuring
+)
+
+// WithDeleteTiming option: lets you configure when the extraneous files of
+// the destination are deleted
+// Default is DeleteAfter
+func WithDeleteTiming(timing DeleteTiming) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.deleteTiming = timing
+	}
+}
+
+// WithCleanDestination option: everything in the destination is deleted
+// before syncing, in place of `rm -rf dst/*`, and the deletions are reported.
+// Protected paths are kept and symlinks are deleted without being followed.
+func WithCleanDestination(s *FsSyncer) {
+	s.cleanDestination = true
+}
+
+// cleanDestinationEntries deletes the entries of dst, see
+// WithCleanDestination
+func (s *FsSyncer) cleanDestinationEntries(state syncState, dst, src string) error {
+	fd, err := os.Open(dst)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "fail to open %v", dst)
+	}
+	defer fd.Close()
+	names, err := fd.Readdirnames(-1)
+	if err != nil {
+		return errors.Wrapf(err, "fail to list %v", dst)
+	}
+
+	for _, name := range names {
+		removed, err := s.deleteTree(state, filepath.Join(dst, name))
+		if err != nil {
+			return err
+		}
+		if removed {
+			s.trackDeletionParent(state, dst, src)
+		}
+	}
+	return nil
+}
+
+// deleteExtraneousFiles deletes the files of dst which are not present in src
+func (s *FsSyncer) deleteExtraneousFiles(state syncState, dst, src string) error {
+	type syncedDir struct {
+		dst, src string
+		// entries of the source directory by destination name
+		entries map[string]string
+	}
+	// Directories of dst present in src, from the root to the parent of the
+	// walked path: extraneous directories are not walked so the parent of a
+	// walked path is always in the stack
+	stack := []syncedDir{}
+
+	err := filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+		s.throttleOp()
+		if path == dst && os.IsNotExist(err) {
+			// The destination is created by the copy, nothing to delete
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s.isProtected(state, path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if s.isExcluded(state.dstRoot, path, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if s.isFiltered(info) {
+			// Kept by deleteTree, its parent is not modified
+			return nil
+		}
+		srcPath := src
+		if path != dst {
+			for stack[len(stack)-1].dst != filepath.Dir(path) {
+				stack = stack[:len(stack)-1]
+			}
+			parent := stack[len(stack)-1]
+			srcName, ok := parent.entries[info.Name()]
+			if !ok {
+				removed, err := s.deleteTree(state, path)
+				if err != nil {
+					return err
+				}
+				if removed {
+					s.trackDeletionParent(state, parent.dst, parent.src)
+				}
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			srcPath = filepath.Join(parent.src, srcName)
+		}
+		if !info.IsDir() {
+			return nil
+		}
+
+		entries, err := s.sourceEntries(state, srcPath)
+		if os.IsPermission(err) {
+			// Without knowing the source entries, nothing can be deleted
+			return filepath.SkipDir
+		} else if err != nil {
+			return err
+		}
+		stack = append(stack, syncedDir{dst: path, src: srcPath, entries: entries})
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to walk %v", dst)
+	}
+
+	return nil
+}
+
+// deleteExtraneousEntries deletes the entries of the dstDir directory which
+// are not present in srcDir, without looking into the directories present in
+// both. With DeleteAfter, they are queued to be deleted by
+// deleteQueuedEntries once the source is walked instead.
+func (s *FsSyncer) deleteExtraneousEntries(state syncState, dstDir, srcDir string) error {
+	entries, err := s.sourceEntries(state, srcDir)
+	if os.IsPermission(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	names, err := readDirNames(dstDir, s.dirListLimit())
+	if err != nil {
+		return errors.Wrapf(err, "fail to list %v", dstDir)
+	}
+	err = s.checkEntriesCount(dstDir, len(names))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if _, ok := entries[name]; ok {
+			continue
+		}
+		path := filepath.Join(dstDir, name)
+		s.throttleOp()
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to stat %v", path)
+		}
+		// Kept by deleteTree, their parent is not modified
+		if s.isProtected(state, path) || s.isExcluded(state.dstRoot, path, info.IsDir()) || s.isFiltered(info) {
+			continue
+		}
+		if s.deleteTiming == DeleteAfter && state.extraneous != nil {
+			state.extraneous.add(extraneousEntry{path: path, dstDir: dstDir, srcDir: srcDir})
+			continue
+		}
+		removed, err := s.deleteTree(state, path)
+		if err != nil {
+			return err
+		}
+		if removed {
+			s.trackDeletionParent(state, dstDir, srcDir)
+		}
+	}
+	return nil
+}
+
+// deletesExtraneousEntries returns true if the extraneous entries of the
+// destination directory of the dir directory of the source are deleted while
+// walking the source: their deletion is not done by the DeleteBefore pass, or
+// dir is opaque
+func (s *FsSyncer) deletesExtraneousEntries(state syncState, dir string) bool {
+	if state.deleteFromDst {
+		return s.deleteTiming != DeleteBefore
+	}
+	return !s.cloneMode && !state.manifest.isTrusted() && s.isOpaqueDir(dir)
+}
+
+// deleteUnwalkedExtraneousEntries deletes the extraneous entries of the
+// destination dstDir of the source directory srcDir which is not walked, as it
+// only differs by its case from another one for instance. With DeleteAfter,
+// dstDir is queued to be compared once the source is walked instead.
+func (s *FsSyncer) deleteUnwalkedExtraneousEntries(state syncState, dstDir, srcDir string) error {
+	info, err := os.Lstat(dstDir)
+	if os.IsNotExist(err) || (err == nil && !info.IsDir()) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "fail to stat %v", dstDir)
+	}
+	if s.deleteTiming == DeleteAfter && state.extraneous != nil {
+		state.extraneous.add(extraneousEntry{path: dstDir, srcDir: srcDir, unwalked: true})
+		return nil
+	}
+	return s.deleteExtraneousFiles(state, dstDir, srcDir)
+}
+
+// extraneousEntry is an entry of the destination, located in the dstDir
+// directory, which is not present in the srcDir directory of the source. If
+// unwalked is true, path is a directory present in the source as srcDir,
+// whose content has not been compared, see deleteUnwalkedExtraneousEntries.
+type extraneousEntry struct {
+	path     string
+	dstDir   string
+	srcDir   string
+	unwalked bool
+}
+
+// extraneousQueue is the list of the extraneous entries found while walking
+// the source with DeleteAfter, see deleteExtraneousEntries
+type extraneousQueue struct {
+	entries []extraneousEntry
+	queued  map[string]bool
+}
+
+func newExtraneousQueue() *extraneousQueue {
+	return &extraneousQueue{queued: map[string]bool{}}
+}
+
+// add queues entry, unless it's already queued as a directory can be walked
+// twice with WithPriorityPaths
+func (q *extraneousQueue) add(entry extraneousEntry) {
+	if q.queued[entry.path] {
+		return
+	}
+	q.queued[entry.path] = true
+	q.entries = append(q.entries, entry)
+}
+
+// deleteQueuedEntries deletes the extraneous entries queued while walking the
+// source, the destination is not walked again
+func (s *FsSyncer) deleteQueuedEntries(state syncState) error {
+	for _, entry := range state.extraneous.entries {
+		if entry.unwalked {
+			err := s.deleteExtraneousFiles(state, entry.path, entry.srcDir)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, err := os.Lstat(entry.path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to stat %v", entry.path)
+		}
+		removed, err := s.deleteTree(state, entry.path)
+		if err != nil {
+			return err
+		}
+		if removed {
+			s.trackDeletionParent(state, entry.dstDir, entry.srcDir)
+		}
+	}
+	return nil
+}
+
+// trackDeletionParent records that an entry of the dstDir directory has been
+// deleted, which changed its modification time, see restoreDeletionParentTimes
+func (s *FsSyncer) trackDeletionParent(state syncState, dstDir, srcDir string) {
+	if s.deleteDryRun {
+		return
+	}
+	state.deletionParents[dstDir] = srcDir
+}
+
+// restoreDeletionParentTimes schedules the times of the destination
+// directories modified by deletions to be set to the times of their source
+// directories, unless the walk of the source already did it
+func (s *FsSyncer) restoreDeletionParentTimes(state syncState) error {
+	if s.noDirTimes {
+		return nil
+	}
+	dstDirs := make([]string, 0, len(state.deletionParents))
+	for dstDir := range state.deletionParents {
+		dstDirs = append(dstDirs, dstDir)
+	}
+	if s.deterministicOrder {
+		sort.Strings(dstDirs)
+	}
+	for _, dstDir := range dstDirs {
+		srcDir := state.deletionParents[dstDir]
+		if state.timesMap.has(dstDir) {
+			continue
+		}
+		info, err := os.Stat(srcDir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to stat %v", srcDir)
+		}
+		stat, ok := fileStat(info)
+		if !ok {
+			return errors.Errorf("fail to get detailed stat info for %s", srcDir)
+		}
+		state.timesMap.set(dstDir, statTimes{
+			atime: statAtime(stat),
+			mtime: statMtime(stat),
+		})
+	}
+	return nil
+}
+
+// sourceEntries lists the entries of the srcDir directory, by the name they
+// have on the destination. The list is empty if srcDir does not exist, is not
+// a directory or is located on another filesystem with OneFileSystem.
+func (s *FsSyncer) sourceEntries(state syncState, srcDir string) (map[string]string, error) {
+	if state.listing != nil && state.listing.dir == srcDir {
+		if s.isOtherFileSystem(state.srcDevice, state.listing.info) {
+			return map[string]string{}, nil
+		}
+		return s.destinationEntries(state.listing.names), nil
+	}
+
+	fd, err := os.Open(srcDir)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	if s.oneFileSystem {
+		info, err := fd.Stat()
+		if err != nil {
+			return nil, errors.Wrapf(err, "fail to stat %v", srcDir)
+		}
+		if s.isOtherFileSystem(state.srcDevice, info) {
+			return map[string]string{}, nil
+		}
+	}
+
+	names, err := fd.Readdirnames(-1)
+	if errors.Is(err, syscall.ENOTDIR) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "fail to list %v", srcDir)
+	}
+	return s.destinationEntries(names), nil
+}
+
+// destinationEntries returns the names of the entries of a source directory
+// by the name they have on the destination
+func (s *FsSyncer) destinationEntries(names []string) map[string]string {
+	entries := make(map[string]string, len(names))
+	for _, name := range names {
+		entries[s.destinationName(name)] = name
+	}
+	return entries
+}
+
+// deleteTree deletes path and its content if it's a directory, every deleted
+// entry is reported. Protected and filtered entries are kept with their
+// parents. It returns true if root has been removed, modifying its parent.
+func (s *FsSyncer) deleteTree(state syncState, root string) (bool, error) {
+	return s.deleteTreeAttempt(state, root, true)
+}
+
+// deleteTreeAttempt is deleteTree, the directories which are not empty once
+// their walked content is deleted, because entries have been created in them
+// meanwhile, are deleted again once if retry is true
+func (s *FsSyncer) deleteTreeAttempt(state syncState, root string, retry bool) (bool, error) {
+	deleted := []string{}
+	dirsToRemove := []string{}
+	// entries which could not be deleted and directories containing protected,
+	// filtered or not deleted entries
+	kept := map[string]bool{}
+	keepParents := func(path string) {
+		for p := path; p != root; {
+			p = filepath.Dir(p)
+			kept[p] = true
+		}
+	}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if s.isProtected(state, path) || s.isFiltered(info) || s.isExcluded(state.dstRoot, path, info.IsDir()) {
+			keepParents(path)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		deleted = append(deleted, path)
+		if s.deleteDryRun {
+			return nil
+		}
+		if info.IsDir() {
+			// Do not delete directory straight we want to tag all files
+			// recursively before deleting empty dirs
+			dirsToRemove = append(dirsToRemove, path)
+			return nil
+		}
+		s.throttleOp()
+		err = s.retry(path, func() error {
+			return s.inDestination(state, path, os.Remove)
+		})
+		if err != nil {
+			err = s.deletionFailed(state, path, err)
+			kept[path] = true
+			keepParents(path)
+		}
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// The deepest directories are removed first so that their parents are
+	// empty when removed
+	sort.SliceStable(dirsToRemove, func(i, j int) bool {
+		return pathDepth(dirsToRemove[i]) > pathDepth(dirsToRemove[j])
+	})
+	for _, dir := range dirsToRemove {
+		if kept[dir] {
+			continue
+		}
+		s.throttleOp()
+		err := s.retry(dir, func() error {
+			return s.inDestination(state, dir, os.Remove)
+		})
+		if errors.Is(err, syscall.ENOTEMPTY) && retry {
+			_, err = s.deleteTreeAttempt(state, dir, false)
+			if err != nil {
+				return false, err
+			}
+			// Entries which could not be deleted are left in the directory
+			if _, err := os.Lstat(dir); err == nil {
+				kept[dir] = true
+				keepParents(dir)
+			}
+			continue
+		}
+		if err != nil && !os.IsNotExist(err) {
+			err = s.deletionFailed(state, dir, err)
+			if err != nil {
+				return false, err
+			}
+			kept[dir] = true
+			keepParents(dir)
+		}
+	}
+
+	for _, path := range deleted {
+		if kept[path] {
+			continue
+		}
+		if s.deleteDryRun {
+			state.report.pendingDeletions = append(state.report.pendingDeletions, path)
+		} else {
+			state.report.fileChanges.add(path)
+			s.recordChange(state, ChangeDelete, path, "")
+		}
+	}
+	removed := !s.deleteDryRun && len(deleted) > 0 && deleted[0] == root && !kept[root]
+	return removed, nil
+}
+
+// DeletionFailure is an extraneous entry of the destination which could not
+// be deleted with ContinueOnError, Err is the error of its removal
+type DeletionFailure struct {
+	Path string
+	Err  error
+}
+
+// deletionFailed returns the error of the deletion of path, which is recorded
+// in the report instead with ContinueOnError
+func (s *FsSyncer) deletionFailed(state syncState, path string, err error) error {
+	s.log(slog.LevelError, "deletion failed", "dst", path, "error", err)
+	if !s.continueOnError {
+		return errors.Wrapf(err, "fail to delete %v", path)
+	}
+	state.report.deletionFailures = append(state.report.deletionFailures, DeletionFailure{Path: path, Err: err})
+	if s.hooks.OnError != nil {
+		s.hooks.OnError(path, err)
+	}
+	return nil
+}
+
+// pathDepth returns the number of components of path
+func pathDepth(path string) int {
+	return strings.Count(filepath.Clean(path), string(filepath.Separator))
+}
@@ -0,0 +1,228 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_restoreDeletionParentTimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	srcDir := filepath.Join(tmp, "src")
+	assert.NoError(t, os.Mkdir(srcDir, 0755))
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(srcDir, mtime, mtime))
+
+	walkedTimes := statTimes{atime: time.Now(), mtime: time.Now()}
+	state := syncState{
+		timesMap: newSpillTimes(nil),
+		deletionParents: map[string]string{
+			"dst/untracked": srcDir,
+			"dst/walked":    srcDir,
+			"dst/missing":   filepath.Join(tmp, "missing"),
+		},
+	}
+	state.timesMap.set("dst/walked", walkedTimes)
+
+	err = New().restoreDeletionParentTimes(state)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, state.timesMap.len())
+	untrackedTimes, _ := state.timesMap.get("dst/untracked")
+	assert.True(t, mtime.Equal(untrackedTimes.mtime))
+	times, _ := state.timesMap.get("dst/walked")
+	assert.True(t, walkedTimes.mtime.Equal(times.mtime))
+}
+
+func TestFsSyncer_Sync_DeletionParentTimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// The dir directory is skipped by the walk as it only differs by its case
+	// from Dir, but the extraneous file of the destination is deleted in it
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "Dir"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "dir", "extraneous"), []byte("a"), 0644))
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(src, "dir"), mtime, mtime))
+
+	_, err = New(WithCaseCollisionPolicy(CaseCollisionFirstWins)).Sync(dst, src)
+	assert.NoError(t, err)
+
+	assert.NoFileExists(t, filepath.Join(dst, "dir", "extraneous"))
+	info, err := os.Stat(filepath.Join(dst, "dir"))
+	assert.NoError(t, err)
+	assert.True(t, mtime.Equal(info.ModTime()))
+}
+
+func TestFsSyncer_Sync_CleanDestination(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	outside := filepath.Join(tmp, "outside")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "dir"), 0755))
+	assert.NoError(t, os.MkdirAll(outside, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(outside, "kept"), []byte("kept"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "dir", "old"), []byte("old"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "protected"), []byte("protected"), 0644))
+	absOutside, err := filepath.Abs(outside)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Symlink(absOutside, filepath.Join(dst, "link")))
+
+	report, err := New(WithCleanDestination, NoDelete, WithProtectedPaths("protected")).Sync(dst, src)
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(dst)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"file", "protected"}, names)
+	assert.FileExists(t, filepath.Join(outside, "kept"))
+	assert.True(t, report.HasChanged(filepath.Join(dst, "dir", "old")))
+	assert.True(t, report.HasChanged(filepath.Join(dst, "link")))
+
+	report, err = New(WithCleanDestination, DeleteDryRun).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dst, "file"), filepath.Join(dst, "protected")}, report.PendingDeletions())
+	assert.FileExists(t, filepath.Join(dst, "file"))
+}
+
+func TestFsSyncer_Sync_NestedEmptyDirectories(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "kept"), 0755))
+	// Names sorting before and after their siblings' children
+	dirs := []string{"a/b/c/d", "a/b-c/d", "a/b.c", "a-b/c", "a.b", "kept/a/b", "kept/a-b/c/d"}
+	for _, dir := range dirs {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, dir), 0755))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "protected", "a", "b"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "protected", "a", "file"), []byte("a"), 0644))
+
+	for _, timing := range []DeleteTiming{DeleteBefore, DeleteDuring, DeleteAfter} {
+		_, err = New(WithDeleteTiming(timing), WithProtectedPaths("protected/a/file")).Sync(dst, src)
+		assert.NoError(t, err)
+		entries, err := os.ReadDir(dst)
+		assert.NoError(t, err)
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		assert.Equal(t, []string{"kept", "protected"}, names)
+		entries, err = os.ReadDir(filepath.Join(dst, "kept"))
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+		// The directories containing the protected file are kept
+		assert.FileExists(t, filepath.Join(dst, "protected", "a", "file"))
+		assert.NoDirExists(t, filepath.Join(dst, "protected", "a", "b"))
+
+		for _, dir := range dirs {
+			assert.NoError(t, os.MkdirAll(filepath.Join(dst, dir), 0755))
+		}
+	}
+}
+
+func TestFsSyncer_Sync_KeptExtraneousDirectory(t *testing.T) {
+	cases := map[string]struct {
+		option func(*FsSyncer)
+		path   string
+	}{
+		"protected path":  {option: WithProtectedPaths("x/keep"), path: "keep"},
+		"exclude pattern": {option: WithFilterRules(ExcludePattern("*.log")), path: "file.log"},
+		"max depth":       {option: WithMaxDepth(1), path: "deep"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(tmp)
+
+			src := filepath.Join(tmp, "src")
+			dst := filepath.Join(tmp, "dst")
+			assert.NoError(t, os.MkdirAll(src, 0755))
+			assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("a"), 0644))
+			assert.NoError(t, os.MkdirAll(filepath.Join(dst, "x"), 0755))
+			assert.NoError(t, os.WriteFile(filepath.Join(dst, "x", c.path), []byte("a"), 0644))
+
+			syncer := New(c.option)
+			_, err = syncer.Sync(dst, src)
+			assert.NoError(t, err)
+			assert.FileExists(t, filepath.Join(dst, "x", c.path))
+
+			// The kept directory doesn't modify its parent on the next syncs
+			report, err := syncer.Sync(dst, src)
+			assert.NoError(t, err)
+			assert.True(t, report.Unchanged())
+		})
+	}
+}
+
+func TestFsSyncer_Sync_DeleteBeforeMissingDestination(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("a"), 0644))
+
+	_, err = New(WithDeleteTiming(DeleteBefore)).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "dir", "file"))
+}
+
+func TestFsSyncer_Sync_DeletionFailures(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	mnt := filepath.Join(dst, "dir", "mnt")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(mnt, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "dir", "file"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "other"), []byte("a"), 0644))
+	// Removing a mount point fails with EBUSY
+	err = mountTmpfs(mnt)
+	if err != nil {
+		t.Skip("mounting a filesystem requires root privileges")
+	}
+	defer unmount(mnt)
+
+	_, err = New().Sync(dst, src)
+	assert.ErrorIs(t, err, syscall.EBUSY)
+
+	report, err := New(ContinueOnError).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Len(t, report.DeletionFailures(), 1)
+	assert.Equal(t, mnt, report.DeletionFailures()[0].Path)
+	assert.ErrorIs(t, report.DeletionFailures()[0].Err, syscall.EBUSY)
+	assert.DirExists(t, mnt)
+	assert.NoFileExists(t, filepath.Join(dst, "dir", "file"))
+	assert.NoFileExists(t, filepath.Join(dst, "other"))
+	// The directories which are kept are not reported as deleted
+	assert.False(t, report.HasChanged(filepath.Join(dst, "dir")))
+	assert.True(t, report.HasChanged(filepath.Join(dst, "other")))
+}
@@ -0,0 +1,211 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ErrOutdatedPlan is returned by Apply when the source or the destination
+// have changed since the plan was computed
+var ErrOutdatedPlan = errors.New("the source or the destination have changed since the plan was computed")
+
+// ChangeType is the type of a change of a ChangePlan
+type ChangeType int
+
+const (
+	// ChangeCreate creates an entry missing from the destination
+	ChangeCreate ChangeType = iota
+	// ChangeUpdate replaces an entry of the destination whose content differs
+	ChangeUpdate
+	// ChangeDelete deletes an extraneous entry of the destination
+	ChangeDelete
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeCreate:
+		return "create"
+	case ChangeUpdate:
+		return "update"
+	case ChangeDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the type with its name, in the JSON events of
+// JSONPublisher for instance
+func (t ChangeType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Change is a change of the destination planned by Diff or published by
+// WithEventPublisher
+type Change struct {
+	Type ChangeType `json:"type"`
+	// Path of the changed destination entry
+	Path string `json:"path"`
+	// SrcPath is the path of the source entry, empty for deletions
+	SrcPath string `json:"src_path,omitempty"`
+}
+
+// ChangePlan lists the changes a sync of Src to Dst would make, see Diff
+type ChangePlan struct {
+	Dst     string
+	Src     string
+	Changes []Change
+}
+
+// Diff computes the entries of dst that a sync of src would create, update and
+// delete, without modifying dst. Metadata only changes (times, mode,
+// ownership) are not listed. The plan can then be applied with Apply, to
+// confirm the changes before applying them.
+func (s *FsSyncer) Diff(dst, src string) (ChangePlan, error) {
+	plan := ChangePlan{Dst: dst, Src: src, Changes: []Change{}}
+	syncPlan := s.NewSyncPlan(dst, src)
+	err := syncPlan.Scan()
+	if err != nil {
+		return plan, err
+	}
+	state := syncPlan.state
+	dst, src = syncPlan.dst, syncPlan.src
+
+	err = s.walkSource(state, src, s.skipOtherFileSystems(state, src, s.diffWalkFunc(state, &plan, dst, src)))
+	if err != nil {
+		return plan, errors.Wrapf(err, "fail to walk %v", src)
+	}
+
+	// Deletions are listed by the deletion functions in dry run mode
+	dryRun := *s
+	dryRun.deleteDryRun = true
+	if s.cleanDestination {
+		err = dryRun.cleanDestinationEntries(state, dst, src)
+	} else if state.deleteFromDst {
+		err = dryRun.deleteExtraneousFiles(state, dst, src)
+	} else if !s.noDelete && state.manifest.isTrusted() {
+		err = dryRun.deleteManifestExtraneousFiles(state, dst)
+	}
+	if err != nil {
+		return plan, err
+	}
+	deleted := map[string]bool{}
+	for _, path := range state.report.pendingDeletions {
+		if deleted[path] {
+			continue
+		}
+		deleted[path] = true
+		plan.Changes = append(plan.Changes, Change{Type: ChangeDelete, Path: path})
+	}
+	return plan, nil
+}
+
+// Apply syncs the source of the plan to its destination. ErrOutdatedPlan is
+// returned without modifying the destination if the changes differ from the
+// ones of the plan. Like Sync, the report is returned even on error, empty if
+// nothing has been applied.
+func (s *FsSyncer) Apply(plan ChangePlan) (SyncReport, error) {
+	current, err := s.Diff(plan.Dst, plan.Src)
+	if err != nil {
+		return s.newSyncState().report, err
+	}
+	if !reflect.DeepEqual(current.Changes, plan.Changes) {
+		return s.newSyncState().report, ErrOutdatedPlan
+	}
+	return s.Sync(plan.Dst, plan.Src)
+}
+
+func (s *FsSyncer) diffWalkFunc(state syncState, plan *ChangePlan, dst, src string) filepath.WalkFunc {
+	report := state.report
+	walkError := func(path string, err error) error {
+		if os.IsNotExist(err) && s.ignoreNotFound {
+			return nil
+		}
+		if os.IsPermission(err) && s.continueOnError {
+			report.unreadableFiles = append(report.unreadableFiles, path)
+			state.manifest.keep(dst, s.destinationPath(dst, src, path, report))
+			return nil
+		}
+		return err
+	}
+	return func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return walkError(path, err)
+		}
+		skip, err := s.checkCaseCollision(state, path, info)
+		if skip || err != nil {
+			return err
+		}
+		info, skip, err = s.resolveSymlink(src, path, info, report)
+		if skip || err != nil {
+			return err
+		}
+		dstPath := s.destinationPath(dst, src, path, report)
+		if path != src && s.isProtected(state, dstPath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if s.isExcluded(src, path, info.IsDir()) {
+			state.manifest.keep(dst, dstPath)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err = statEntry(info)
+		if err != nil {
+			return walkError(path, err)
+		}
+		if s.isFiltered(info) {
+			state.manifest.keep(dst, dstPath)
+			return nil
+		}
+
+		srcSysStat, ok := fileStat(info)
+		if !ok {
+			return errors.Errorf("fail to get detailed stat info for %s", path)
+		}
+		srcInfo := syncInfo{base: src, path: path, fileInfo: info, stat: srcSysStat}
+		manifestEntry := newManifestEntry(info, srcSysStat)
+		synced, err := s.syncFromManifest(state, dst, dstPath, srcInfo, manifestEntry)
+		if synced || err != nil {
+			return err
+		}
+		state.manifest.record(dst, dstPath, path, manifestEntry)
+
+		dstStat, err := s.lstatDestination(dstPath)
+		// ENOTDIR when a parent directory replaces a file of the destination
+		if os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR) {
+			plan.Changes = append(plan.Changes, Change{Type: ChangeCreate, Path: dstPath, SrcPath: path})
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to stat %v", dstPath)
+		}
+		dstSysStat, ok := fileStat(dstStat)
+		if !ok {
+			return errors.Errorf("fail to get detailed stat info for %s", dstPath)
+		}
+		res, err := s.compareExistingFile(srcInfo, syncInfo{
+			base:     dst,
+			path:     dstPath,
+			fileInfo: dstStat,
+			stat:     dstSysStat,
+		}, state)
+		if isUnreadableSource(err) && s.continueOnError {
+			report.unreadableFiles = append(report.unreadableFiles, path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if res.hasContentChanged {
+			plan.Changes = append(plan.Changes, Change{Type: ChangeUpdate, Path: dstPath, SrcPath: path})
+		}
+		return nil
+	}
+}
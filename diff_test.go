@@ -0,0 +1,120 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Diff(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "unchanged"), []byte("unchanged"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "updated"), []byte("v1"), 0644))
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "updated"), []byte("version 2"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "created"), []byte("created"), 0644))
+	// A directory of the source replacing a file of the destination
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "replaced"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "replaced", "file"), []byte("file"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "replaced"), []byte("replaced"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "extraneous"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous", "file"), []byte("file"), 0644))
+
+	syncer := New()
+	plan, err := syncer.Diff(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Type: ChangeCreate, Path: filepath.Join(dst, "dir", "created"), SrcPath: filepath.Join(src, "dir", "created")},
+		{Type: ChangeUpdate, Path: filepath.Join(dst, "replaced"), SrcPath: filepath.Join(src, "replaced")},
+		{Type: ChangeCreate, Path: filepath.Join(dst, "replaced", "file"), SrcPath: filepath.Join(src, "replaced", "file")},
+		{Type: ChangeUpdate, Path: filepath.Join(dst, "updated"), SrcPath: filepath.Join(src, "updated")},
+		{Type: ChangeDelete, Path: filepath.Join(dst, "extraneous")},
+		{Type: ChangeDelete, Path: filepath.Join(dst, "extraneous", "file")},
+	}, plan.Changes)
+	// Nothing has been applied
+	assert.DirExists(t, filepath.Join(dst, "extraneous"))
+	assert.NoFileExists(t, filepath.Join(dst, "dir", "created"))
+
+	report, err := syncer.Apply(plan)
+	assert.NoError(t, err)
+	for _, change := range plan.Changes {
+		assert.True(t, report.HasChanged(change.Path), change.Path)
+	}
+	assert.NoDirExists(t, filepath.Join(dst, "extraneous"))
+
+	plan, err = syncer.Diff(dst, src)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Changes)
+
+	// The plan is outdated once the source changes
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "late"), []byte("late"), 0644))
+	report, err = syncer.Apply(plan)
+	assert.Equal(t, ErrOutdatedPlan, err)
+	assert.NoFileExists(t, filepath.Join(dst, "late"))
+	assert.NotNil(t, report)
+	assert.True(t, report.Unchanged())
+}
+
+func TestFsSyncer_Diff_MissingDestination(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+
+	syncer := New()
+	plan, err := syncer.Diff(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Type: ChangeCreate, Path: dst, SrcPath: src},
+		{Type: ChangeCreate, Path: filepath.Join(dst, "file"), SrcPath: filepath.Join(src, "file")},
+	}, plan.Changes)
+	assert.NoDirExists(t, dst)
+
+	_, err = syncer.Apply(plan)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "file"))
+}
+
+func TestFsSyncer_Apply_OutdatedPlan(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous"), []byte("extraneous"), 0644))
+
+	syncer := New()
+	plan, err := syncer.Diff(dst, src)
+	assert.NoError(t, err)
+	// The destination changes after the plan is computed
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "late"), []byte("late"), 0644))
+
+	report, err := syncer.Apply(plan)
+	assert.Equal(t, ErrOutdatedPlan, err)
+	assert.Equal(t, 0, report.ChangeCount())
+	entries, err := os.ReadDir(dst)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"extraneous", "late"}, names)
+	content, err := os.ReadFile(filepath.Join(dst, "extraneous"))
+	assert.NoError(t, err)
+	assert.Equal(t, "extraneous", string(content))
+}
@@ -0,0 +1,34 @@
+package fssync
+
+import (
+	"os"
+)
+
+// unreadableSourceError wraps the errors due to a source entry which can't be
+// read by the current user
+type unreadableSourceError struct {
+	error
+}
+
+// sourceReadError marks err as an unreadable source error if it's due to a
+// lack of permission
+func sourceReadError(err error) error {
+	if os.IsPermission(err) {
+		return unreadableSourceError{err}
+	}
+	return err
+}
+
+func isUnreadableSource(err error) bool {
+	for err != nil {
+		if _, ok := err.(unreadableSourceError); ok {
+			return true
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = cause.Cause()
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnreadableSource(t *testing.T) {
+	permissionErr := &os.PathError{Op: "open", Path: "a", Err: syscall.EACCES}
+	notFoundErr := &os.PathError{Op: "open", Path: "a", Err: syscall.ENOENT}
+
+	assert.True(t, isUnreadableSource(errors.Wrap(sourceReadError(permissionErr), "fail to copy")))
+	assert.False(t, isUnreadableSource(errors.Wrap(sourceReadError(notFoundErr), "fail to copy")))
+	assert.False(t, isUnreadableSource(errors.Wrap(permissionErr, "fail to copy")))
+	assert.False(t, isUnreadableSource(nil))
+}
+
+func TestFsSyncer_Sync_ContinueOnError(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	src, err := os.MkdirTemp("./.tmp", "fssync-test-src")
+	assert.NoError(t, err)
+	defer os.RemoveAll(src)
+	dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "readable"), []byte("new"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "unreadable"), []byte("new"), 0000))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "unreadable"), []byte("old copy"), 0644))
+
+	t.Run("it should fail without ContinueOnError", func(t *testing.T) {
+		_, err := New().Sync(dst, src)
+		assert.Error(t, err)
+	})
+
+	t.Run("it should skip unreadable files with ContinueOnError", func(t *testing.T) {
+		report, err := New(ContinueOnError).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(src, "unreadable")}, report.UnreadableFiles())
+
+		content, err := os.ReadFile(filepath.Join(dst, "unreadable"))
+		assert.NoError(t, err)
+		assert.Equal(t, "old copy", string(content))
+		assert.FileExists(t, filepath.Join(dst, "readable"))
+	})
+}
@@ -0,0 +1,106 @@
+package fssync
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Publisher receives the changes made to the destination by a sync, to let
+// downstream systems like caches or search indexes react to them without
+// polling the destination, see WithEventPublisher
+type Publisher interface {
+	Publish(event SyncEvent) error
+}
+
+// PublisherFunc is a function implementing Publisher
+type PublisherFunc func(event SyncEvent) error
+
+func (f PublisherFunc) Publish(event SyncEvent) error {
+	return f(event)
+}
+
+// SyncEvent is the batch of changes made to Dst by a sync of Src
+type SyncEvent struct {
+	Dst string `json:"dst"`
+	Src string `json:"src"`
+	// Changes are the created, updated and deleted entries of the destination
+	// sorted by path, metadata only changes are not listed
+	Changes     []Change `json:"changes"`
+	CopiedBytes int64    `json:"copied_bytes"`
+}
+
+// WithEventPublisher option: publisher is called with the changes made to the
+// destination at the end of Sync, or of the Finalize stage of a SyncPlan, if
+// any. The changed paths are tracked during the sync, within WithMemoryLimit.
+// An error of publisher is returned once the destination is synced. SyncPaths
+// and the partial syncs of Watch don't publish, see Watcher.OnSync.
+func WithEventPublisher(publisher Publisher) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.publisher = publisher
+	}
+}
+
+// JSONPublisher returns a Publisher writing each event to w as a line of
+// JSON, to pipe them to a message bus client for instance
+func JSONPublisher(w io.Writer) Publisher {
+	m := &sync.Mutex{}
+	encoder := json.NewEncoder(w)
+	return PublisherFunc(func(event SyncEvent) error {
+		m.Lock()
+		defer m.Unlock()
+		err := encoder.Encode(event)
+		if err != nil {
+			return errors.Wrapf(err, "fail to write event")
+		}
+		return nil
+	})
+}
+
+// ChannelPublisher returns a Publisher sending the events to ch, the sync
+// waits for them to be received
+func ChannelPublisher(ch chan<- SyncEvent) Publisher {
+	return PublisherFunc(func(event SyncEvent) error {
+		ch <- event
+		return nil
+	})
+}
+
+// recordChange records the change of the destination entry dstPath for the
+// publisher of WithEventPublisher, the last change of a path wins, counts it
+// for WithProgress, logs it for WithLogger and calls the hooks of WithHooks
+func (s *FsSyncer) recordChange(state syncState, changeType ChangeType, dstPath, srcPath string) {
+	s.trackChange(state, changeType, dstPath)
+	s.logChange(changeType, dstPath, srcPath)
+	s.hookChange(changeType, dstPath, srcPath)
+	if state.changes == nil {
+		return
+	}
+	state.changes.set(dstPath, append([]byte{byte(changeType)}, srcPath...))
+}
+
+// publishChanges publishes the changes recorded by recordChange, if any
+func (s *FsSyncer) publishChanges(state syncState, dst, src string) error {
+	if state.changes == nil || state.changes.empty() {
+		return nil
+	}
+	event := SyncEvent{Dst: dst, Src: src, CopiedBytes: state.report.copiedBytes}
+	err := state.changes.each(func(path string, value []byte) error {
+		event.Changes = append(event.Changes, Change{Type: ChangeType(value[0]), Path: path, SrcPath: string(value[1:])})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(event.Changes, func(i, j int) bool {
+		return event.Changes[i].Path < event.Changes[j].Path
+	})
+	err = s.publisher.Publish(event)
+	if err != nil {
+		return errors.Wrapf(err, "fail to publish the changes of %v", dst)
+	}
+	return nil
+}
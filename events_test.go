@@ -0,0 +1,74 @@
+package fssync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_EventPublisher(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "updated"), []byte("old"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "deleted"), []byte("deleted"), 0644))
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "updated"), []byte("new content"), 0644))
+	assert.NoError(t, os.Remove(filepath.Join(src, "deleted")))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "created"), []byte("created"), 0644))
+
+	events := []SyncEvent{}
+	syncer := New(WithEventPublisher(PublisherFunc(func(event SyncEvent) error {
+		events = append(events, event)
+		return nil
+	})))
+	_, err = syncer.Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, []SyncEvent{{
+		Dst: dst,
+		Src: src,
+		Changes: []Change{
+			{Type: ChangeDelete, Path: filepath.Join(dst, "deleted")},
+			{Type: ChangeCreate, Path: filepath.Join(dst, "dir", "created"), SrcPath: filepath.Join(src, "dir", "created")},
+			{Type: ChangeUpdate, Path: filepath.Join(dst, "updated"), SrcPath: filepath.Join(src, "updated")},
+		},
+		CopiedBytes: int64(len("created") + len("new content")),
+	}}, events)
+
+	t.Run("it should not publish unchanged syncs", func(t *testing.T) {
+		events = nil
+		_, err = syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("it should return the errors of the publisher once synced", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "updated"), []byte("newer content"), 0644))
+		_, err := New(WithEventPublisher(PublisherFunc(func(event SyncEvent) error {
+			return errors.New("bus unavailable")
+		}))).Sync(dst, src)
+		assert.ErrorContains(t, err, "bus unavailable")
+		content, err := os.ReadFile(filepath.Join(dst, "updated"))
+		assert.NoError(t, err)
+		assert.Equal(t, "newer content", string(content))
+	})
+
+	t.Run("it should write the events as JSON lines with JSONPublisher", func(t *testing.T) {
+		assert.NoError(t, os.Remove(filepath.Join(src, "updated")))
+		out := &bytes.Buffer{}
+		_, err := New(WithEventPublisher(JSONPublisher(out))).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"dst":"`+dst+`","src":"`+src+`","changes":[{"type":"delete","path":"`+filepath.Join(dst, "updated")+`"}],"copied_bytes":0}`, out.String())
+	})
+}
@@ -0,0 +1,108 @@
+package fssync
+
+import (
+	"os"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// fsIocFiemap is FS_IOC_FIEMAP, _IOWR('f', 11, struct fiemap)
+	fsIocFiemap = 0xC020660B
+
+	fiemapFlagSync = 0x1
+
+	fiemapExtentLast = 0x1
+	// flags of the extents whose physical location can't be compared:
+	// unknown, delayed allocation, encoded, encrypted, inline or unaligned
+	fiemapExtentOpaque = 0x2 | 0x4 | 0x8 | 0x80 | 0x100 | 0x200 | 0x400
+
+	// fiemapBatchSize is the number of extents read by ioctl
+	fiemapBatchSize = 64
+)
+
+// fiemapExtent is struct fiemap_extent of linux/fiemap.h
+type fiemapExtent struct {
+	logical  uint64
+	physical uint64
+	length   uint64
+	_        [2]uint64
+	flags    uint32
+	_        [3]uint32
+}
+
+// fiemap is struct fiemap of linux/fiemap.h followed by its extents
+type fiemap struct {
+	start         uint64
+	length        uint64
+	flags         uint32
+	mappedExtents uint32
+	extentCount   uint32
+	_             uint32
+	extents       [fiemapBatchSize]fiemapExtent
+}
+
+// fileExtent is an extent of a file: length bytes at the logical offset of
+// the file stored at the physical offset of its filesystem
+type fileExtent struct {
+	logical, physical, length uint64
+}
+
+// fileExtents returns the extents of the file at path with the FIEMAP ioctl,
+// ok is false if one of them has no comparable physical location
+func fileExtents(path string) (extents []fileExtent, ok bool, err error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "fail to open %v", path)
+	}
+	defer fd.Close()
+
+	request := fiemap{}
+	for {
+		request.length = ^uint64(0) - request.start
+		// Pending writes are flushed to get the final physical locations
+		request.flags = fiemapFlagSync
+		request.extentCount = fiemapBatchSize
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, fd.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&request)))
+		if errno != 0 {
+			return nil, false, errors.Wrapf(errno, "fail to get extents of %v", path)
+		}
+		if request.mappedExtents == 0 {
+			return extents, true, nil
+		}
+		for _, extent := range request.extents[:request.mappedExtents] {
+			if extent.flags&fiemapExtentOpaque != 0 {
+				return nil, false, nil
+			}
+			extents = append(extents, fileExtent{logical: extent.logical, physical: extent.physical, length: extent.length})
+			if extent.flags&fiemapExtentLast != 0 {
+				return extents, true, nil
+			}
+		}
+		last := request.extents[request.mappedExtents-1]
+		request.start = last.logical + last.length
+	}
+}
+
+// sharesExtents returns true if the files at dstPath and srcPath, located on
+// the same filesystem, store each of their bytes in the same physical blocks,
+// like a file and its reflink clone which have not been modified since. Any
+// error is considered as a difference.
+func sharesExtents(dstPath, srcPath string) bool {
+	srcExtents, ok, err := fileExtents(srcPath)
+	if err != nil || !ok || len(srcExtents) == 0 {
+		return false
+	}
+	dstExtents, ok, err := fileExtents(dstPath)
+	if err != nil || !ok || len(dstExtents) != len(srcExtents) {
+		return false
+	}
+	for i := range srcExtents {
+		if srcExtents[i] != dstExtents[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharesExtents(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	file := filepath.Join(tmp, "file")
+	assert.NoError(t, os.WriteFile(file, []byte("content"), 0644))
+	if _, _, err := fileExtents(file); err != nil {
+		t.Skipf("the filesystem does not support FIEMAP: %v", err)
+	}
+	// A hardlink has the extents of its file like an unmodified clone
+	link := filepath.Join(tmp, "link")
+	assert.NoError(t, os.Link(file, link))
+	copied := filepath.Join(tmp, "copy")
+	assert.NoError(t, os.WriteFile(copied, []byte("content"), 0644))
+	empty := filepath.Join(tmp, "empty")
+	assert.NoError(t, os.WriteFile(empty, nil, 0644))
+
+	assert.True(t, sharesExtents(link, file))
+	assert.False(t, sharesExtents(copied, file))
+	assert.False(t, sharesExtents(empty, empty))
+	assert.False(t, sharesExtents(filepath.Join(tmp, "missing"), file))
+
+	syncInfoOf := func(path string) syncInfo {
+		info, err := os.Lstat(path)
+		assert.NoError(t, err)
+		stat, _ := fileStat(info)
+		return syncInfo{path: path, fileInfo: info, stat: stat}
+	}
+	assert.True(t, isClone(syncInfoOf(file), syncInfoOf(link)))
+	assert.False(t, isClone(syncInfoOf(file), syncInfoOf(copied)))
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package fssync
+
+// sharesExtents is not implemented, FIEMAP is specific to Linux: the files
+// are always compared by content
+func sharesExtents(dstPath, srcPath string) bool {
+	return false
+}
@@ -0,0 +1,44 @@
+package fssync
+
+import (
+	"os"
+	"time"
+)
+
+// WithMinSize option: regular files smaller than size bytes are ignored, they
+// are neither copied nor deleted from the destination
+func WithMinSize(size int64) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.minSize = size
+	}
+}
+
+// WithMaxSize option: regular files larger than size bytes are ignored, they
+// are neither copied nor deleted from the destination
+func WithMaxSize(size int64) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.maxSize = size
+	}
+}
+
+// WithModifiedSince option: regular files modified before t are ignored, they
+// are neither copied nor deleted from the destination
+func WithModifiedSince(t time.Time) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.modifiedSince = t
+	}
+}
+
+// isFiltered returns true if info is a regular file outside of the bounds of
+// WithMinSize, WithMaxSize and WithModifiedSince, or excluded by
+// WithPolicyByPattern. Directories, symlinks and special files are never
+// filtered.
+func (s *FsSyncer) isFiltered(info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	return info.Size() < s.minSize ||
+		(s.maxSize > 0 && info.Size() > s.maxSize) ||
+		info.ModTime().Before(s.modifiedSince) ||
+		s.comparePolicy(info) == CompareExclude
+}
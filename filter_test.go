@@ -0,0 +1,71 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_Filters(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	setup := func(t *testing.T) (string, string, string) {
+		tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, "extraneous"), 0755))
+		files := map[string]string{
+			"src/small": "s", "src/medium": "medium", "src/large": "large content", "src/dir/old": "old",
+			"dst/extraneous/large": "large content", "dst/extraneous/medium": "medium",
+		}
+		for name, content := range files {
+			assert.NoError(t, os.WriteFile(filepath.Join(tmp, name), []byte(content), 0644))
+		}
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "dir/old"), old, old))
+		return tmp, src, dst
+	}
+
+	tests := map[string]struct {
+		syncOptions []func(*FsSyncer)
+		expected    []string
+		missing     []string
+	}{
+		"it should ignore the files outside of the size bounds": {
+			syncOptions: []func(*FsSyncer){WithMinSize(2), WithMaxSize(10)},
+			expected:    []string{"medium", "dir/old", "extraneous/large"},
+			missing:     []string{"small", "large", "extraneous/medium"},
+		},
+		"it should ignore the files modified before the date": {
+			syncOptions: []func(*FsSyncer){WithModifiedSince(now.Add(-24 * time.Hour))},
+			expected:    []string{"small", "medium", "large", "dir"},
+			missing:     []string{"dir/old", "extraneous"},
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			tmp, src, dst := setup(t)
+			defer os.RemoveAll(tmp)
+
+			_, err := New(test.syncOptions...).Sync(dst, src)
+			assert.NoError(t, err)
+			for _, name := range test.expected {
+				_, err := os.Lstat(filepath.Join(dst, name))
+				assert.NoError(t, err, name)
+			}
+			for _, name := range test.missing {
+				_, err := os.Lstat(filepath.Join(dst, name))
+				assert.True(t, os.IsNotExist(err), name)
+			}
+
+			report, err := New(test.syncOptions...).Verify(dst, src)
+			assert.NoError(t, err)
+			assert.True(t, report.Matches())
+		})
+	}
+}
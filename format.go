@@ -0,0 +1,96 @@
+package fssync
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupportedFormat is returned when a file has been written by a newer
+// version of fssync in a format this version can't read
+var ErrUnsupportedFormat = errors.New("unsupported file format version")
+
+// fileFormat describes a format of the files persisted by fssync, like the
+// manifests. They are written in an envelope naming the format and its
+// version so that they survive upgrades and downgrades of fssync:
+//
+//   - A version adding optional fields is read by the older versions, which
+//     ignore the unknown fields: compat is left unchanged.
+//   - A version which can't be read by the older ones raises compat to itself,
+//     the older versions then fail with ErrUnsupportedFormat.
+//   - The files of an older version are upgraded by the migrations when read,
+//     they are written in the current version at the next write.
+type fileFormat struct {
+	name    string
+	version int
+	// compat is the oldest version able to read the current one
+	compat int
+	// migrations upgrade the data of a version to the next one, by version.
+	// The version 0 is the data written without envelope.
+	migrations map[int]func(json.RawMessage) (json.RawMessage, error)
+}
+
+// formatEnvelope is the self-describing header of the persisted files
+type formatEnvelope struct {
+	Format  string          `json:"format"`
+	Version int             `json:"version"`
+	Compat  int             `json:"compat"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// unchangedData is the migration of a version whose data has the same
+// structure as the next one
+func unchangedData(data json.RawMessage) (json.RawMessage, error) {
+	return data, nil
+}
+
+// encode serializes v in the envelope of the current version
+func (f fileFormat) encode(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to encode %v", f.name)
+	}
+	content, err := json.Marshal(formatEnvelope{Format: f.name, Version: f.version, Compat: f.compat, Data: data})
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to encode %v envelope", f.name)
+	}
+	return content, nil
+}
+
+// decode deserializes the content of any version readable by the current one
+// into v, migrating the data of older versions
+func (f fileFormat) decode(content []byte, v interface{}) error {
+	var envelope formatEnvelope
+	err := json.Unmarshal(content, &envelope)
+	if err != nil {
+		return errors.Wrapf(err, "fail to decode %v", f.name)
+	}
+	if envelope.Format == "" {
+		// Written before the envelopes
+		envelope = formatEnvelope{Format: f.name, Data: bytes.TrimSpace(content)}
+	}
+	if envelope.Format != f.name {
+		return errors.Errorf("invalid format %v, expected %v", envelope.Format, f.name)
+	}
+	if envelope.Compat > f.version {
+		return errors.Wrapf(ErrUnsupportedFormat, "%v version %v requires version %v, only %v is supported", f.name, envelope.Version, envelope.Compat, f.version)
+	}
+
+	data := envelope.Data
+	for version := envelope.Version; version < f.version; version++ {
+		migrate, ok := f.migrations[version]
+		if !ok {
+			return errors.Errorf("no migration of %v from version %v", f.name, version)
+		}
+		data, err = migrate(data)
+		if err != nil {
+			return errors.Wrapf(err, "fail to migrate %v from version %v", f.name, version)
+		}
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return errors.Wrapf(err, "fail to decode %v", f.name)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package fssync
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileFormat(t *testing.T) {
+	type data struct {
+		Name string `json:"name"`
+	}
+	format := fileFormat{
+		name: "test", version: 2, compat: 1,
+		migrations: map[int]func(json.RawMessage) (json.RawMessage, error){
+			0: unchangedData,
+			// The version 1 named the field title
+			1: func(data json.RawMessage) (json.RawMessage, error) {
+				var v1 struct {
+					Title string `json:"title"`
+				}
+				err := json.Unmarshal(data, &v1)
+				if err != nil {
+					return nil, err
+				}
+				return json.Marshal(map[string]string{"name": v1.Title})
+			},
+		},
+	}
+
+	t.Run("it should decode the current version", func(t *testing.T) {
+		content, err := format.encode(data{Name: "a"})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"format":"test","version":2,"compat":1,"data":{"name":"a"}}`, string(content))
+
+		var decoded data
+		assert.NoError(t, format.decode(content, &decoded))
+		assert.Equal(t, data{Name: "a"}, decoded)
+	})
+
+	t.Run("it should migrate the older versions", func(t *testing.T) {
+		var decoded data
+		assert.NoError(t, format.decode([]byte(`{"format":"test","version":1,"compat":1,"data":{"title":"a"}}`), &decoded))
+		assert.Equal(t, data{Name: "a"}, decoded)
+
+		decoded = data{}
+		assert.NoError(t, format.decode([]byte(`{"title":"b"}`), &decoded))
+		assert.Equal(t, data{Name: "b"}, decoded)
+	})
+
+	t.Run("it should read the newer compatible versions", func(t *testing.T) {
+		var decoded data
+		err := format.decode([]byte(`{"format":"test","version":3,"compat":2,"data":{"name":"a","added":true}}`), &decoded)
+		assert.NoError(t, err)
+		assert.Equal(t, data{Name: "a"}, decoded)
+	})
+
+	t.Run("it should fail on the newer incompatible versions", func(t *testing.T) {
+		var decoded data
+		err := format.decode([]byte(`{"format":"test","version":3,"compat":3,"data":{}}`), &decoded)
+		assert.Equal(t, ErrUnsupportedFormat, errors.Cause(err))
+	})
+
+	t.Run("it should fail on another format", func(t *testing.T) {
+		var decoded data
+		err := format.decode([]byte(`{"format":"other","version":1,"compat":1,"data":{}}`), &decoded)
+		assert.Error(t, err)
+	})
+}
+
+func TestTreeManifest_UnmarshalJSON(t *testing.T) {
+	legacy := `{"entries":[{"path":"a","type":"file","mode":420,"uid":0,"gid":0,"mtime":1,"size":1}]}`
+	var m TreeManifest
+	assert.NoError(t, json.Unmarshal([]byte(legacy), &m))
+	assert.Len(t, m.Entries, 1)
+	assert.Equal(t, "a", m.Entries[0].Path)
+
+	content, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"format":"fssync-tree-manifest"`)
+	var decoded TreeManifest
+	assert.NoError(t, json.Unmarshal(content, &decoded))
+	assert.Equal(t, m, decoded)
+}
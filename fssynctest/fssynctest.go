@@ -0,0 +1,37 @@
+// Package fssynctest provides helpers to test code using fssync
+package fssynctest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+// AssertIdempotent syncs src to a temporary directory twice with the given
+// options and asserts that the second sync did not change anything. It
+// catches comparison bugs making the files being copied again on every sync,
+// like a loss of precision of the modification times.
+func AssertIdempotent(t testing.TB, src string, opts ...func(*fssync.FsSyncer)) bool {
+	t.Helper()
+
+	dst, err := os.MkdirTemp("", "fssynctest")
+	if !assert.NoError(t, err) {
+		return false
+	}
+	defer os.RemoveAll(dst)
+
+	syncer := fssync.New(opts...)
+	_, err = syncer.Sync(dst, src)
+	if !assert.NoError(t, err, "first sync of %v", src) {
+		return false
+	}
+	report, err := syncer.Sync(dst, src)
+	if !assert.NoError(t, err, "second sync of %v", src) {
+		return false
+	}
+	return assert.True(t, report.Unchanged(),
+		"second sync of %v is not idempotent: %d files changed", src, report.ChangeCount())
+}
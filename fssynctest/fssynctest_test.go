@@ -0,0 +1,28 @@
+package fssynctest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Scalingo/go-fssync"
+)
+
+func TestAssertIdempotent(t *testing.T) {
+	fixtures := []string{"file", "dir", "symlink", "local-symlink", "relative-symlink", "long-names"}
+	for _, fixture := range fixtures {
+		t.Run("with fixture "+fixture, func(t *testing.T) {
+			src := filepath.Join("..", "test-fixtures", "src", fixture)
+			AssertIdempotent(t, src)
+			AssertIdempotent(t, src, fssync.WithChecksum)
+		})
+	}
+
+	t.Run("it should fail if the second sync changes files", func(t *testing.T) {
+		fakeT := &testing.T{}
+		// The source can't be synced twice as the second sync fails
+		ok := AssertIdempotent(fakeT, filepath.Join("..", "test-fixtures", "src", "missing"))
+		if ok || !fakeT.Failed() {
+			t.Error("expected the assertion to fail")
+		}
+	})
+}
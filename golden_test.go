@@ -0,0 +1,133 @@
+package fssync
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden reports of test-fixtures/golden with the current reports")
+
+// goldenReport is the serialized report of a sync, with the paths relative to
+// the source and the destination, compared to a golden JSON file to prove
+// that refactors take the same decisions
+type goldenReport struct {
+	Changes          []Change          `json:"changes"`
+	PendingDeletions []string          `json:"pending_deletions,omitempty"`
+	CopiedBytes      int64             `json:"copied_bytes"`
+	Unchanged        bool              `json:"unchanged"`
+	Warnings         []string          `json:"warnings,omitempty"`
+	UnreadableFiles  []string          `json:"unreadable_files,omitempty"`
+	UnsafeSymlinks   []string          `json:"unsafe_symlinks,omitempty"`
+	RenamedPaths     map[string]string `json:"renamed_paths,omitempty"`
+	// Resync is the report of a second sync, which must be unchanged
+	Resync *goldenReport `json:"resync,omitempty"`
+}
+
+func TestFsSyncer_Sync_GoldenReports(t *testing.T) {
+	tests := map[string]struct {
+		fixtureSrc  string
+		fixtureDst  string
+		syncOptions []func(*FsSyncer)
+	}{
+		"copy-tree":             {fixtureSrc: "src"},
+		"checksum-same-content": {fixtureSrc: "src/file", fixtureDst: "dst/cp-file", syncOptions: []func(*FsSyncer){WithChecksum}},
+		"checksum-same-size":    {fixtureSrc: "src/file", fixtureDst: "dst/same-size", syncOptions: []func(*FsSyncer){WithChecksum}},
+		"same-size-and-mtime":   {fixtureSrc: "src/file", fixtureDst: "dst/rsync-file"},
+		"same-mtime":            {fixtureSrc: "src/file", fixtureDst: "dst/mtime-file"},
+		"replace-file-by-dir":   {fixtureSrc: "src/dir", fixtureDst: "dst/replace-dir"},
+		"replace-dir-by-file":   {fixtureSrc: "src/file", fixtureDst: "dst/replace-file"},
+		"delete-after":          {fixtureSrc: "src/file", fixtureDst: "dst/extraneous-files"},
+		"delete-before":         {fixtureSrc: "src/file", fixtureDst: "dst/extraneous-files", syncOptions: []func(*FsSyncer){WithDeleteTiming(DeleteBefore)}},
+		"delete-during":         {fixtureSrc: "src/file", fixtureDst: "dst/extraneous-files", syncOptions: []func(*FsSyncer){WithDeleteTiming(DeleteDuring)}},
+		"delete-dry-run":        {fixtureSrc: "src/file", fixtureDst: "dst/extraneous-files", syncOptions: []func(*FsSyncer){DeleteDryRun}},
+		"no-delete":             {fixtureSrc: "src/file", fixtureDst: "dst/extraneous-files", syncOptions: []func(*FsSyncer){NoDelete}},
+		"long-names":            {fixtureSrc: "src/long-names", syncOptions: []func(*FsSyncer){WithMaxNameLength(32, LongNameHash)}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dst)
+			if test.fixtureDst != "" {
+				_, err := New().Sync(dst, filepath.Join("test-fixtures", test.fixtureDst))
+				assert.NoError(t, err)
+			}
+			src := filepath.Join("test-fixtures", test.fixtureSrc)
+
+			report := syncGoldenReport(t, dst, src, test.syncOptions)
+			report.Resync = syncGoldenReport(t, dst, src, test.syncOptions)
+
+			actual, err := json.MarshalIndent(report, "", "  ")
+			assert.NoError(t, err)
+			actual = append(actual, '\n')
+			path := filepath.Join("test-fixtures", "golden", name+".json")
+			if *updateGolden {
+				assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+				assert.NoError(t, os.WriteFile(path, actual, 0644))
+				return
+			}
+			expected, err := os.ReadFile(path)
+			assert.NoError(t, err, "run the tests with -update-golden to create it")
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+// syncGoldenReport syncs src to dst and returns the golden report of the sync
+func syncGoldenReport(t *testing.T, dst, src string, options []func(*FsSyncer)) *goldenReport {
+	changes := []Change{}
+	options = append(options[:len(options):len(options)], WithEventPublisher(PublisherFunc(func(event SyncEvent) error {
+		changes = append(changes, event.Changes...)
+		return nil
+	})))
+	report, err := New(options...).Sync(dst, src)
+	assert.NoError(t, err)
+
+	// The reported paths are cleaned
+	dst, src = filepath.Clean(dst), filepath.Clean(src)
+	relative := func(path string) string {
+		path = strings.ReplaceAll(path, dst, "$DST")
+		return strings.ReplaceAll(path, src, "$SRC")
+	}
+	relativeAll := func(paths []string) []string {
+		if len(paths) == 0 {
+			return nil
+		}
+		rel := []string{}
+		for _, path := range paths {
+			rel = append(rel, relative(path))
+		}
+		sort.Strings(rel)
+		return rel
+	}
+
+	golden := &goldenReport{
+		Changes:          []Change{},
+		PendingDeletions: relativeAll(report.PendingDeletions()),
+		CopiedBytes:      report.CopiedBytes(),
+		Unchanged:        report.Unchanged(),
+		Warnings:         relativeAll(report.Warnings()),
+		UnreadableFiles:  relativeAll(report.UnreadableFiles()),
+		UnsafeSymlinks:   relativeAll(report.UnsafeSymlinks()),
+	}
+	for _, change := range changes {
+		change.Path = relative(change.Path)
+		change.SrcPath = relative(change.SrcPath)
+		golden.Changes = append(golden.Changes, change)
+	}
+	if len(report.RenamedPaths()) > 0 {
+		golden.RenamedPaths = map[string]string{}
+		for path, renamed := range report.RenamedPaths() {
+			golden.RenamedPaths[relative(path)] = relative(renamed)
+		}
+	}
+	return golden
+}
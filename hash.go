@@ -0,0 +1,55 @@
+package fssync
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Scalingo/go-fssync/internal/blake3"
+	"github.com/Scalingo/go-fssync/internal/xxhash64"
+)
+
+// Names of the checksum algorithms which can be given to HashByName
+const (
+	HashSHA1     = "sha1"
+	HashSHA256   = "sha256"
+	HashXXHash64 = "xxhash64"
+	HashBLAKE3   = "blake3"
+)
+
+var hashes = map[string]func() hash.Hash{
+	HashSHA1:   sha1.New,
+	HashSHA256: sha256.New,
+	HashXXHash64: func() hash.Hash {
+		return xxhash64.New()
+	},
+	HashBLAKE3: blake3.New,
+}
+
+// HashByName returns the constructor of the checksum algorithm named name, to
+// be given to WithHash. Supported names are sha1, sha256, xxhash64 and blake3.
+func HashByName(name string) (func() hash.Hash, error) {
+	h, ok := hashes[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(hashes))
+		for name := range hashes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, errors.Errorf("unknown hash algorithm %v, must be one of %v", name, strings.Join(names, ", "))
+	}
+	return h, nil
+}
+
+// WithHash option: lets you configure the algorithm used to compute the
+// checksum of files when WithChecksum is enabled
+// Default is SHA1
+func WithHash(h func() hash.Hash) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.newHash = h
+	}
+}
@@ -0,0 +1,68 @@
+package fssync
+
+import (
+	"log/slog"
+)
+
+// WithHooks option: the callbacks of hooks are called as the entries are
+// synced, to react to each of them, like invalidating a cache, without
+// walking the destination afterwards
+func WithHooks(hooks Hooks) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.hooks = hooks
+	}
+}
+
+// Hooks are the callbacks of WithHooks, the nil ones are ignored. They are
+// called by the goroutine of the sync, which waits for them to return.
+type Hooks struct {
+	// OnFileStart is called before the source entry src is synced to dst
+	OnFileStart func(dst, src string)
+	// OnFileSynced is called once the destination entry of the change has
+	// been created or updated
+	OnFileSynced func(change Change)
+	// OnFileDeleted is called once the extraneous destination entry dst has
+	// been deleted
+	OnFileDeleted func(dst string)
+	// OnError is called with the entries skipped with ContinueOnError, the
+	// unreadable source entries and the destination entries which can't be
+	// deleted. The error failing a sync is given to OnComplete.
+	OnError func(path string, err error)
+	// OnComplete is called at the end of Sync and SyncPaths with their
+	// result
+	OnComplete func(report SyncReport, err error)
+}
+
+// hookFileStart calls the OnFileStart hook
+func (s *FsSyncer) hookFileStart(dstPath, srcPath string) {
+	if s.hooks.OnFileStart != nil {
+		s.hooks.OnFileStart(dstPath, srcPath)
+	}
+}
+
+// hookChange calls the OnFileSynced or OnFileDeleted hook of the change
+func (s *FsSyncer) hookChange(changeType ChangeType, dstPath, srcPath string) {
+	if changeType == ChangeDelete {
+		if s.hooks.OnFileDeleted != nil {
+			s.hooks.OnFileDeleted(dstPath)
+		}
+	} else if s.hooks.OnFileSynced != nil {
+		s.hooks.OnFileSynced(Change{Type: changeType, Path: dstPath, SrcPath: srcPath})
+	}
+}
+
+// unreadableSkipped logs the unreadable source path skipped with
+// ContinueOnError and calls the OnError hook
+func (s *FsSyncer) unreadableSkipped(path string, err error) {
+	s.log(slog.LevelWarn, "unreadable entry skipped", "src", path, "error", err)
+	if s.hooks.OnError != nil {
+		s.hooks.OnError(path, err)
+	}
+}
+
+// hookComplete calls the OnComplete hook
+func (s *FsSyncer) hookComplete(report SyncReport, err error) {
+	if s.hooks.OnComplete != nil {
+		s.hooks.OnComplete(report, err)
+	}
+}
@@ -0,0 +1,76 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_WithHooks(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "b"), []byte("new b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "b"), []byte("b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "c"), []byte("c"), 0644))
+
+	started := []string{}
+	synced := []Change{}
+	deleted := []string{}
+	completed := 0
+	report, err := New(WithHooks(Hooks{
+		OnFileStart: func(dst, src string) {
+			started = append(started, src)
+		},
+		OnFileSynced: func(change Change) {
+			synced = append(synced, change)
+		},
+		OnFileDeleted: func(dst string) {
+			deleted = append(deleted, dst)
+		},
+		OnComplete: func(report SyncReport, err error) {
+			assert.NoError(t, err)
+			assert.Equal(t, 3, report.ChangeCount())
+			completed++
+		},
+	})).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.ChangeCount())
+
+	assert.Equal(t, []string{src, filepath.Join(src, "a"), filepath.Join(src, "b")}, started)
+	assert.Equal(t, []Change{
+		{Type: ChangeCreate, Path: filepath.Join(dst, "a"), SrcPath: filepath.Join(src, "a")},
+		{Type: ChangeUpdate, Path: filepath.Join(dst, "b"), SrcPath: filepath.Join(src, "b")},
+	}, synced)
+	assert.Equal(t, []string{filepath.Join(dst, "c")}, deleted)
+	assert.Equal(t, 1, completed)
+}
+
+func TestFsSyncer_SyncPaths_WithHooks(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "a"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "b"), []byte("b"), 0644))
+
+	completed := 0
+	_, err = New(WithHooks(Hooks{
+		OnComplete: func(report SyncReport, err error) {
+			assert.NoError(t, err)
+			completed++
+		},
+	})).SyncPaths(dst, src, []string{"dir", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, completed)
+}
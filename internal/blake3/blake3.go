@@ -0,0 +1,244 @@
+// Package blake3 implements the BLAKE3 cryptographic hash function in its
+// default hashing mode with a 256-bit output, following the reference
+// implementation from https://github.com/BLAKE3-team/BLAKE3
+package blake3
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// Size of a BLAKE3 checksum in bytes
+const Size = 32
+
+// BlockSize of BLAKE3 in bytes
+const BlockSize = 64
+
+const chunkLen = 1024
+
+const (
+	flagChunkStart uint32 = 1 << iota
+	flagChunkEnd
+	flagParent
+	flagRoot
+)
+
+var iv = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+	0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+var msgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func g(state *[16]uint32, a, b, c, d int, mx, my uint32) {
+	state[a] = state[a] + state[b] + mx
+	state[d] = bits.RotateLeft32(state[d]^state[a], -16)
+	state[c] = state[c] + state[d]
+	state[b] = bits.RotateLeft32(state[b]^state[c], -12)
+	state[a] = state[a] + state[b] + my
+	state[d] = bits.RotateLeft32(state[d]^state[a], -8)
+	state[c] = state[c] + state[d]
+	state[b] = bits.RotateLeft32(state[b]^state[c], -7)
+}
+
+func round(state *[16]uint32, m *[16]uint32) {
+	// Mix the columns
+	g(state, 0, 4, 8, 12, m[0], m[1])
+	g(state, 1, 5, 9, 13, m[2], m[3])
+	g(state, 2, 6, 10, 14, m[4], m[5])
+	g(state, 3, 7, 11, 15, m[6], m[7])
+	// Mix the diagonals
+	g(state, 0, 5, 10, 15, m[8], m[9])
+	g(state, 1, 6, 11, 12, m[10], m[11])
+	g(state, 2, 7, 8, 13, m[12], m[13])
+	g(state, 3, 4, 9, 14, m[14], m[15])
+}
+
+func permute(m *[16]uint32) {
+	var permuted [16]uint32
+	for i := range permuted {
+		permuted[i] = m[msgPermutation[i]]
+	}
+	*m = permuted
+}
+
+func compress(cv [8]uint32, block [16]uint32, counter uint64, blockLen uint32, flags uint32) [16]uint32 {
+	state := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	for i := 0; i < 7; i++ {
+		round(&state, &block)
+		if i < 6 {
+			permute(&block)
+		}
+	}
+	for i := 0; i < 8; i++ {
+		state[i] ^= state[i+8]
+		state[i+8] ^= cv[i]
+	}
+	return state
+}
+
+func first8(words [16]uint32) [8]uint32 {
+	var cv [8]uint32
+	copy(cv[:], words[:8])
+	return cv
+}
+
+func wordsFromBytes(b []byte) [16]uint32 {
+	var block [BlockSize]byte
+	copy(block[:], b)
+	var words [16]uint32
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(block[i*4:])
+	}
+	return words
+}
+
+// output is the state just prior to the last compression of a chunk or a
+// parent node, whose result is either a chaining value or the root hash
+type output struct {
+	inputCV    [8]uint32
+	blockWords [16]uint32
+	counter    uint64
+	blockLen   uint32
+	flags      uint32
+}
+
+func (o output) chainingValue() [8]uint32 {
+	return first8(compress(o.inputCV, o.blockWords, o.counter, o.blockLen, o.flags))
+}
+
+func (o output) rootBytes(b []byte) []byte {
+	words := compress(o.inputCV, o.blockWords, 0, o.blockLen, o.flags|flagRoot)
+	for _, w := range words[:Size/4] {
+		b = binary.LittleEndian.AppendUint32(b, w)
+	}
+	return b
+}
+
+type chunkState struct {
+	cv               [8]uint32
+	chunkCounter     uint64
+	block            [BlockSize]byte
+	blockLen         int
+	blocksCompressed int
+}
+
+func newChunkState(chunkCounter uint64) chunkState {
+	return chunkState{cv: iv, chunkCounter: chunkCounter}
+}
+
+func (c *chunkState) len() int {
+	return BlockSize*c.blocksCompressed + c.blockLen
+}
+
+func (c *chunkState) startFlag() uint32 {
+	if c.blocksCompressed == 0 {
+		return flagChunkStart
+	}
+	return 0
+}
+
+func (c *chunkState) update(input []byte) {
+	for len(input) > 0 {
+		// Only compress a full block once more input is available: the last
+		// block of the chunk has to be compressed with the chunk end flag
+		if c.blockLen == BlockSize {
+			c.cv = first8(compress(c.cv, wordsFromBytes(c.block[:]), c.chunkCounter, BlockSize, c.startFlag()))
+			c.blocksCompressed++
+			c.block = [BlockSize]byte{}
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], input)
+		c.blockLen += n
+		input = input[n:]
+	}
+}
+
+func (c *chunkState) output() output {
+	return output{
+		inputCV:    c.cv,
+		blockWords: wordsFromBytes(c.block[:c.blockLen]),
+		counter:    c.chunkCounter,
+		blockLen:   uint32(c.blockLen),
+		flags:      c.startFlag() | flagChunkEnd,
+	}
+}
+
+func parentOutput(left, right [8]uint32) output {
+	var block [16]uint32
+	copy(block[:8], left[:])
+	copy(block[8:], right[:])
+	return output{
+		inputCV:    iv,
+		blockWords: block,
+		counter:    0,
+		blockLen:   BlockSize,
+		flags:      flagParent,
+	}
+}
+
+type digest struct {
+	chunk   chunkState
+	cvStack [][8]uint32
+}
+
+// New returns a new hash.Hash computing the BLAKE3 checksum
+func New() hash.Hash {
+	return &digest{chunk: newChunkState(0)}
+}
+
+func (d *digest) Reset() {
+	d.chunk = newChunkState(0)
+	d.cvStack = d.cvStack[:0]
+}
+
+func (d *digest) Size() int {
+	return Size
+}
+
+func (d *digest) BlockSize() int {
+	return BlockSize
+}
+
+// addChunkChainingValue merges the completed subtrees of the stack: the
+// number of trailing zero bits of the total number of chunks is the number
+// of subtrees which are complete
+func (d *digest) addChunkChainingValue(cv [8]uint32, totalChunks uint64) {
+	for totalChunks&1 == 0 {
+		left := d.cvStack[len(d.cvStack)-1]
+		d.cvStack = d.cvStack[:len(d.cvStack)-1]
+		cv = parentOutput(left, cv).chainingValue()
+		totalChunks >>= 1
+	}
+	d.cvStack = append(d.cvStack, cv)
+}
+
+func (d *digest) Write(input []byte) (int, error) {
+	n := len(input)
+	for len(input) > 0 {
+		if d.chunk.len() == chunkLen {
+			cv := d.chunk.output().chainingValue()
+			totalChunks := d.chunk.chunkCounter + 1
+			d.addChunkChainingValue(cv, totalChunks)
+			d.chunk = newChunkState(totalChunks)
+		}
+		want := chunkLen - d.chunk.len()
+		take := min(want, len(input))
+		d.chunk.update(input[:take])
+		input = input[take:]
+	}
+	return n, nil
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	out := d.chunk.output()
+	for i := len(d.cvStack) - 1; i >= 0; i-- {
+		out = parentOutput(d.cvStack[i], out.chainingValue())
+	}
+	return out.rootBytes(b)
+}
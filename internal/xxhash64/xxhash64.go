@@ -0,0 +1,144 @@
+// Package xxhash64 implements the 64-bit xxHash non-cryptographic hash
+// algorithm with a seed of 0, as specified in
+// https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+package xxhash64
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// Declared as variables so that the wrapping arithmetic of the seed
+// initialization is performed at runtime
+var (
+	prime1 uint64 = 11400714785074694791
+	prime2 uint64 = 14029467366897019727
+	prime3 uint64 = 1609587929392839161
+	prime4 uint64 = 9650029242287828579
+	prime5 uint64 = 2870177450012600261
+)
+
+// Size of an xxHash64 checksum in bytes
+const Size = 8
+
+// BlockSize of xxHash64 in bytes
+const BlockSize = 32
+
+type digest struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	mem            [BlockSize]byte
+	n              int
+}
+
+// New returns a new hash.Hash64 computing the xxHash64 checksum
+func New() hash.Hash64 {
+	d := &digest{}
+	d.Reset()
+	return d
+}
+
+func (d *digest) Reset() {
+	d.v1 = prime1 + prime2
+	d.v2 = prime2
+	d.v3 = 0
+	d.v4 = -prime1
+	d.total = 0
+	d.n = 0
+}
+
+func (d *digest) Size() int {
+	return Size
+}
+
+func (d *digest) BlockSize() int {
+	return BlockSize
+}
+
+func (d *digest) Write(b []byte) (int, error) {
+	n := len(b)
+	d.total += uint64(n)
+
+	if d.n+len(b) < BlockSize {
+		d.n += copy(d.mem[d.n:], b)
+		return n, nil
+	}
+
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], b)
+		d.consume(d.mem[:])
+		b = b[c:]
+		d.n = 0
+	}
+
+	for len(b) >= BlockSize {
+		d.consume(b[:BlockSize])
+		b = b[BlockSize:]
+	}
+	d.n = copy(d.mem[:], b)
+
+	return n, nil
+}
+
+func (d *digest) consume(b []byte) {
+	d.v1 = round(d.v1, binary.LittleEndian.Uint64(b[0:8]))
+	d.v2 = round(d.v2, binary.LittleEndian.Uint64(b[8:16]))
+	d.v3 = round(d.v3, binary.LittleEndian.Uint64(b[16:24]))
+	d.v4 = round(d.v4, binary.LittleEndian.Uint64(b[24:32]))
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	s := d.Sum64()
+	return binary.BigEndian.AppendUint64(b, s)
+}
+
+func (d *digest) Sum64() uint64 {
+	var h uint64
+	if d.total >= BlockSize {
+		h = bits.RotateLeft64(d.v1, 1) + bits.RotateLeft64(d.v2, 7) +
+			bits.RotateLeft64(d.v3, 12) + bits.RotateLeft64(d.v4, 18)
+		h = mergeRound(h, d.v1)
+		h = mergeRound(h, d.v2)
+		h = mergeRound(h, d.v3)
+		h = mergeRound(h, d.v4)
+	} else {
+		h = d.v3 + prime5
+	}
+	h += d.total
+
+	b := d.mem[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		k := round(0, binary.LittleEndian.Uint64(b[:8]))
+		h ^= k
+		h = bits.RotateLeft64(h, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b[:4])) * prime1
+		h = bits.RotateLeft64(h, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * prime5
+		h = bits.RotateLeft64(h, 11) * prime1
+	}
+
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
+
+func round(acc, input uint64) uint64 {
+	acc += input * prime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * prime1
+}
+
+func mergeRound(acc, val uint64) uint64 {
+	val = round(0, val)
+	acc ^= val
+	return acc*prime1 + prime4
+}
@@ -0,0 +1,67 @@
+package xxhash64
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Expected values come from the reference implementation of xxHash
+func TestNew(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected uint64
+	}{
+		"empty input": {
+			input:    "",
+			expected: 0xef46db3751d8e999,
+		},
+		"single byte": {
+			input:    "a",
+			expected: 0xd24ec4f1a98c6e5b,
+		},
+		"short input": {
+			input:    "abc",
+			expected: 0x44bc2cf5ad770999,
+		},
+		"input of one stripe": {
+			input:    "0123456789abcdef0123456789abcdef",
+			expected: 0x642a94958e71e6c5,
+		},
+		"input of one stripe and a tail": {
+			input:    "0123456789abcdef0123456789abcdef0",
+			expected: 0xe87684f08d6d0816,
+		},
+		"input of several stripes": {
+			input:    strings.Repeat("0123456789", 10),
+			expected: 0xf80e7b96315afffa,
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			h := New()
+			_, err := h.Write([]byte(test.input))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, h.Sum64())
+			assert.Equal(t, fmt.Sprintf("%016x", test.expected), fmt.Sprintf("%x", h.Sum(nil)))
+		})
+	}
+
+	t.Run("it should not depend on how the input is split", func(t *testing.T) {
+		input := []byte(strings.Repeat("0123456789abcdef", 20) + "tail")
+		whole := New()
+		whole.Write(input)
+
+		for _, chunkSize := range []int{1, 3, 7, 31, 32, 33, 100} {
+			chunked := New()
+			for i := 0; i < len(input); i += chunkSize {
+				end := min(i+chunkSize, len(input))
+				chunked.Write(input[i:end])
+			}
+			assert.Equal(t, whole.Sum64(), chunked.Sum64(), "chunk size %d", chunkSize)
+		}
+	})
+}
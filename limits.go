@@ -0,0 +1,54 @@
+package fssync
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrTooManyEntries is returned when a directory has more entries than
+// allowed by WithMaxEntriesPerDir
+var ErrTooManyEntries = errors.New("too many entries in directory")
+
+// WithMaxDepth option: only sync the entries located at most n levels below
+// the source, 1 syncs the entries of the source without the content of its
+// directories. The deeper entries of the destination are kept like the
+// excluded ones, see WithFilterRules. Unlimited by default.
+func WithMaxDepth(n int) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.maxDepth = n
+	}
+}
+
+// WithMaxEntriesPerDir option: fail with ErrTooManyEntries as soon as a
+// directory of the source or of the destination listed by the sync has more
+// than n entries, to stop the syncs of runaway trees before they last for
+// hours. Unlimited by default.
+func WithMaxEntriesPerDir(n int) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.maxEntriesPerDir = n
+	}
+}
+
+// isTooDeep returns true if the rel path, relative to the root of the sync,
+// is deeper than WithMaxDepth
+func (s *FsSyncer) isTooDeep(rel string) bool {
+	return s.maxDepth > 0 && pathDepth(rel)+1 > s.maxDepth
+}
+
+// checkEntriesCount returns ErrTooManyEntries if the dir directory has more
+// than count entries, according to WithMaxEntriesPerDir
+func (s *FsSyncer) checkEntriesCount(dir string, count int) error {
+	if s.maxEntriesPerDir > 0 && count > s.maxEntriesPerDir {
+		return errors.Wrapf(ErrTooManyEntries, "%v has more than %d entries", dir, s.maxEntriesPerDir)
+	}
+	return nil
+}
+
+// dirListLimit is the number of entries to read from a directory, -1 for all
+// of them, one more than WithMaxEntriesPerDir to detect the directories
+// having too many of them without reading them all
+func (s *FsSyncer) dirListLimit() int {
+	if s.maxEntriesPerDir > 0 {
+		return s.maxEntriesPerDir + 1
+	}
+	return -1
+}
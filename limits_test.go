@@ -0,0 +1,69 @@
+package fssync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_WithMaxDepth(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "a", "b", "c"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a", "file"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a", "b", "file"), []byte("b"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "a", "b"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "a", "b", "kept"), []byte("kept"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "a", "extraneous"), []byte("extraneous"), 0644))
+
+	_, err = New(WithMaxDepth(2)).Sync(dst, src)
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(dst, "a", "file"))
+	assert.DirExists(t, filepath.Join(dst, "a", "b"))
+	assert.NoFileExists(t, filepath.Join(dst, "a", "extraneous"))
+	// The entries deeper than 2 levels are neither synced nor deleted
+	assert.NoFileExists(t, filepath.Join(dst, "a", "b", "file"))
+	assert.NoDirExists(t, filepath.Join(dst, "a", "b", "c"))
+	assert.FileExists(t, filepath.Join(dst, "a", "b", "kept"))
+}
+
+func TestFsSyncer_Sync_WithMaxEntriesPerDir(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", fmt.Sprintf("file-%d", i)), nil, 0644))
+	}
+
+	t.Run("it should sync the directories having at most n entries", func(t *testing.T) {
+		_, err := New(WithMaxEntriesPerDir(3)).Sync(dst, src)
+		assert.NoError(t, err)
+	})
+
+	t.Run("it should fail on a source directory having more than n entries", func(t *testing.T) {
+		_, err := New(WithMaxEntriesPerDir(2)).Sync(dst, src)
+		assert.Equal(t, ErrTooManyEntries, errors.Cause(err))
+		assert.Contains(t, err.Error(), filepath.Join(src, "dir"))
+	})
+
+	t.Run("it should fail on a destination directory having more than n entries", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, os.WriteFile(filepath.Join(dst, fmt.Sprintf("extraneous-%d", i)), nil, 0644))
+		}
+		_, err := New(WithMaxEntriesPerDir(3)).Sync(dst, src)
+		assert.Equal(t, ErrTooManyEntries, errors.Cause(err))
+		assert.Contains(t, err.Error(), dst)
+	})
+}
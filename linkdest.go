@@ -0,0 +1,81 @@
+package fssync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// WithLinkDest option: files missing from the destination which are
+// identical in the referenceDir directory are hardlinked from it instead of
+// being copied, like rsync --link-dest. referenceDir is typically the previous
+// snapshot of a rotating backup. Reference files must match the size, the
+// modification time, the mode and the managed ownership of the source files,
+// and their checksum with WithChecksum.
+func WithLinkDest(referenceDir string) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.linkDest = filepath.Clean(referenceDir)
+	}
+}
+
+// linkFromReference hardlinks the destination file from the reference
+// directory of WithLinkDest if it contains an identical file, it returns true
+// if the link has been created
+func (s *FsSyncer) linkFromReference(src, dst syncInfo, state syncState) (bool, error) {
+	rel, err := filepath.Rel(dst.base, dst.path)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to get path of %v in reference directory", dst.path)
+	}
+	ref := syncInfo{path: filepath.Join(s.linkDest, rel)}
+
+	ref.fileInfo, err = os.Lstat(ref.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "fail to stat reference file %v", ref.path)
+	}
+	// The times are shared with the reference file so they must match even
+	// when the content is compared by checksum
+	if !ref.fileInfo.Mode().IsRegular() || ref.fileInfo.Mode() != s.destinationMode(src.fileInfo) ||
+		ref.fileInfo.Size() != src.fileInfo.Size() || !ref.fileInfo.ModTime().Equal(src.fileInfo.ModTime()) {
+		return false, nil
+	}
+	ref.stat, _ = fileStat(ref.fileInfo)
+	if ref.stat == nil {
+		return false, nil
+	}
+	if owner, ok := s.destinationOwner(state, src.base, src.path, src.stat); ok && !owner.matches(ref.stat) {
+		return false, nil
+	}
+
+	if s.checkChecksum {
+		srcChecksum, err := src.checksum(s.newHash)
+		if err != nil {
+			err = sourceReadError(errors.Cause(err))
+			return false, errors.Wrapf(err, "fail to compute checksum of %v", src.path)
+		}
+		refChecksum, err := ref.checksum(s.newHash)
+		if err != nil {
+			return false, errors.Wrapf(err, "fail to compute checksum of %v", ref.path)
+		}
+		if !bytes.Equal(srcChecksum, refChecksum) {
+			return false, nil
+		}
+	}
+
+	err = s.inDestination(state, dst.path, func(path string) error {
+		return createAtomicallyIn(s.tmpDirOf(path), path, func(tmpPath string) error {
+			return os.Link(ref.path, tmpPath)
+		})
+	})
+	if errors.Is(err, syscall.EMLINK) {
+		state.report.warn("%v has the maximum number of links of the destination filesystem, %v is a copy", ref.path, dst.path)
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "fail to link %v from %v", dst.path, ref.path)
+	}
+	return true, nil
+}
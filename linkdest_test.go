@@ -0,0 +1,110 @@
+package fssync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_LinkDest(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	for _, name := range []string{"unchanged", "modified", "dir/unchanged"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, name), []byte("content"), 0644))
+	}
+	reference := filepath.Join(tmp, "snapshot.1")
+	_, err = New().Sync(reference, src)
+	assert.NoError(t, err)
+
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "modified"), []byte("changed"), 0644))
+	assert.NoError(t, os.Chtimes(filepath.Join(src, "modified"), mtime, mtime))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "new"), []byte("new"), 0644))
+
+	tests := map[string]struct {
+		syncOptions []func(*FsSyncer)
+	}{
+		"it should link unchanged files from the reference": {},
+		"it should link unchanged files from the reference with checksum checks": {
+			syncOptions: []func(*FsSyncer){WithChecksum},
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			dst, err := os.MkdirTemp(tmp, "snapshot")
+			assert.NoError(t, err)
+
+			report, err := New(append(test.syncOptions, WithLinkDest(reference))...).Sync(dst, src)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len("changed")+len("new")), report.CopiedBytes())
+
+			expectedLinks := map[string]bool{
+				"unchanged": true, "dir/unchanged": true, "modified": false, "new": false,
+			}
+			for name, expectedLink := range expectedLinks {
+				dstInfo, err := os.Stat(filepath.Join(dst, name))
+				assert.NoError(t, err)
+				refInfo, err := os.Stat(filepath.Join(reference, name))
+				if os.IsNotExist(err) {
+					assert.False(t, expectedLink)
+					continue
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, expectedLink, os.SameFile(dstInfo, refInfo), name)
+			}
+			content, err := os.ReadFile(filepath.Join(dst, "modified"))
+			assert.NoError(t, err)
+			assert.Equal(t, "changed", string(content))
+			content, err = os.ReadFile(filepath.Join(reference, "modified"))
+			assert.NoError(t, err)
+			assert.Equal(t, "content", string(content))
+		})
+	}
+}
+
+func TestFsSyncer_Sync_LinkDestMaxLinks(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("content"), 0644))
+	reference := filepath.Join(tmp, "snapshot.1")
+	_, err = New().Sync(reference, src)
+	assert.NoError(t, err)
+
+	// Fill the links of the reference file up to the limit of the filesystem
+	links := filepath.Join(tmp, "links")
+	assert.NoError(t, os.Mkdir(links, 0755))
+	for i := 0; ; i++ {
+		if i == 100000 {
+			t.Skip("the filesystem has no low limit of links per inode")
+		}
+		err := os.Link(filepath.Join(reference, "file"), filepath.Join(links, strconv.Itoa(i)))
+		if errors.Is(err, syscall.EMLINK) {
+			break
+		}
+		assert.NoError(t, err)
+	}
+
+	dst := filepath.Join(tmp, "snapshot.2")
+	report, err := New(WithLinkDest(reference)).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Len(t, report.Warnings(), 1)
+	assert.Equal(t, int64(len("content")), report.CopiedBytes())
+	content, err := os.ReadFile(filepath.Join(dst, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+}
@@ -0,0 +1,43 @@
+package fssync
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithLogger option: logger receives the activity of the sync, silent by
+// default. The created, updated and deleted entries of the destination are
+// logged at the info level, the skipped ones and the copies at the debug
+// level, the warnings of the report and the unreadable source files at the
+// warn level and the failed chowns and deletions at the error level. The
+// attributes are the paths of the entries, dst and src.
+func WithLogger(logger *slog.Logger) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.logger = logger
+	}
+}
+
+// log logs msg with the logger of WithLogger, if any
+func (s *FsSyncer) log(level slog.Level, msg string, args ...any) {
+	if s.logger == nil {
+		return
+	}
+	s.logger.Log(context.Background(), level, msg, args...)
+}
+
+// logChange logs the change of the destination entry dstPath
+func (s *FsSyncer) logChange(changeType ChangeType, dstPath, srcPath string) {
+	switch changeType {
+	case ChangeCreate:
+		s.log(slog.LevelInfo, "entry created", "dst", dstPath, "src", srcPath)
+	case ChangeUpdate:
+		s.log(slog.LevelInfo, "entry updated", "dst", dstPath, "src", srcPath)
+	case ChangeDelete:
+		s.log(slog.LevelInfo, "entry deleted", "dst", dstPath)
+	}
+}
+
+// logSkip logs the source entry path which is not synced for reason
+func (s *FsSyncer) logSkip(path, reason string) {
+	s.log(slog.LevelDebug, "entry skipped", "src", path, "reason", reason)
+}
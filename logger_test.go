@@ -0,0 +1,52 @@
+package fssync
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_WithLogger(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "b"), []byte("new b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "c.tmp"), []byte("c"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "b"), []byte("b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "d"), []byte("d"), 0644))
+
+	buffer := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buffer, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, err = New(WithLogger(logger), WithFilterRules(FilterRule{Pattern: "*.tmp"})).Sync(dst, src)
+	assert.NoError(t, err)
+
+	type logLine struct {
+		Level  string
+		Msg    string
+		Dst    string
+		Src    string
+		Reason string
+	}
+	lines := []logLine{}
+	decoder := json.NewDecoder(buffer)
+	for decoder.More() {
+		var line logLine
+		assert.NoError(t, decoder.Decode(&line))
+		lines = append(lines, line)
+	}
+	assert.Contains(t, lines, logLine{Level: "INFO", Msg: "entry created", Dst: filepath.Join(dst, "a"), Src: filepath.Join(src, "a")})
+	assert.Contains(t, lines, logLine{Level: "INFO", Msg: "entry updated", Dst: filepath.Join(dst, "b"), Src: filepath.Join(src, "b")})
+	assert.Contains(t, lines, logLine{Level: "INFO", Msg: "entry deleted", Dst: filepath.Join(dst, "d")})
+	assert.Contains(t, lines, logLine{Level: "DEBUG", Msg: "entry skipped", Src: filepath.Join(src, "c.tmp"), Reason: "excluded"})
+	assert.Contains(t, lines, logLine{Level: "DEBUG", Msg: "file copied", Src: filepath.Join(src, "a")})
+}
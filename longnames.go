@@ -0,0 +1,145 @@
+package fssync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// LongNamePolicy defines how source names longer than the maximal length
+// configured with WithMaxNameLength are handled
+type LongNamePolicy int
+
+const (
+	// LongNameFail makes the sync fail with a *LongNamesError listing all the
+	// offending paths before anything is synced
+	LongNameFail LongNamePolicy = iota
+	// LongNameHash truncates the names and appends a hash of the original name
+	// to keep them unique, the translations are listed in the report
+	LongNameHash
+)
+
+// LongNamesError is returned with the LongNameFail policy when some source
+// names are longer than the configured maximal length
+type LongNamesError struct {
+	MaxLength int
+	Paths     []string
+}
+
+func (e *LongNamesError) Error() string {
+	return fmt.Sprintf("%d names longer than %d bytes: %v", len(e.Paths), e.MaxLength, strings.Join(e.Paths, ", "))
+}
+
+// WithMaxNameLength option: names of the destination must not be longer than
+// max bytes (255 on most filesystems, 143 on eCryptfs), longer source names
+// are handled according to the policy. max should be at least 32 for the
+// LongNameHash policy to keep part of the original names.
+func WithMaxNameLength(max int, policy LongNamePolicy) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.maxNameLength = max
+		s.longNamePolicy = policy
+	}
+}
+
+// checkLongNames lists the source paths whose name is too long, only used with
+// the LongNameFail policy
+func (s *FsSyncer) checkLongNames(src string) error {
+	if s.maxNameLength == 0 || s.longNamePolicy != LongNameFail {
+		return nil
+	}
+	paths := []string{}
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && s.ignoreNotFound {
+				return nil
+			}
+			return err
+		}
+		if len(info.Name()) > s.maxNameLength {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to walk %v", src)
+	}
+	if len(paths) > 0 {
+		return &LongNamesError{MaxLength: s.maxNameLength, Paths: paths}
+	}
+	return nil
+}
+
+// destinationPath returns the path of the destination where the source path
+// is synced, translating the names which are too long with the LongNameHash
+// policy
+func (s *FsSyncer) destinationPath(dst, src, path string, report *fsSyncReport) string {
+	if s.maxNameLength == 0 || s.longNamePolicy != LongNameHash {
+		return relocatePath(path, src, dst)
+	}
+	dstPath := mapRenamedPath(path, src, dst, report.renamedPaths)
+	name := filepath.Base(path)
+	if len(name) <= s.maxNameLength || path == src {
+		return dstPath
+	}
+	dstPath = filepath.Join(filepath.Dir(dstPath), s.destinationName(name))
+	report.renamedPaths[path] = dstPath
+	return dstPath
+}
+
+// destinationName returns the name of a source entry on the destination
+func (s *FsSyncer) destinationName(name string) string {
+	if s.maxNameLength == 0 || s.longNamePolicy != LongNameHash || len(name) <= s.maxNameLength {
+		return name
+	}
+	return translateName(name, s.maxNameLength)
+}
+
+// mapRenamedPath maps path from the from tree to the to tree, using the
+// closest renamed ancestor of path
+func mapRenamedPath(path, from, to string, renamed map[string]string) string {
+	for p := path; p != from && p != filepath.Dir(p); p = filepath.Dir(p) {
+		if renamedPath, ok := renamed[p]; ok {
+			return renamedPath + path[len(p):]
+		}
+	}
+	return relocatePath(path, from, to)
+}
+
+// relocatePath returns the path located in the to directory at the place of
+// path in the from directory. path is compared to from by path elements, the
+// paths which are not cleaned or whose names contain from are mapped
+// correctly.
+func relocatePath(path, from, to string) string {
+	rel, err := filepath.Rel(from, path)
+	if err != nil {
+		// Only happens if one of them is absolute and the other is not
+		return filepath.Join(to, path)
+	}
+	return filepath.Join(to, rel)
+}
+
+// translateName truncates name to max bytes, keeping its extension if it's
+// short, and makes it unique with a hash of the whole name
+func translateName(name string, max int) string {
+	sum := sha256.Sum256([]byte(name))
+	suffix := "~" + hex.EncodeToString(sum[:6])
+	ext := filepath.Ext(name)
+	if len(ext) > max/4 {
+		ext = ""
+	}
+	keep := max - len(suffix) - len(ext)
+	if keep < 0 {
+		keep = 0
+	}
+	prefix := name[:keep]
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix + suffix + ext
+}
@@ -0,0 +1,90 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_LongNames(t *testing.T) {
+	src := filepath.Join("test-fixtures", "src", "long-names")
+
+	t.Run("it should fail up front with LongNameFail", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+
+		_, err = New(WithMaxNameLength(32, LongNameFail)).Sync(dst, src)
+		longNamesErr, ok := errors.Cause(err).(*LongNamesError)
+		if assert.True(t, ok) {
+			assert.Len(t, longNamesErr.Paths, 2)
+		}
+		entries, err := os.ReadDir(dst)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("it should translate the names with LongNameHash", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+		syncer := New(WithMaxNameLength(32, LongNameHash))
+
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Len(t, report.RenamedPaths(), 2)
+		for srcPath, dstPath := range report.RenamedPaths() {
+			assert.LessOrEqual(t, len(filepath.Base(dstPath)), 32)
+			assert.Equal(t, filepath.Ext(srcPath), filepath.Ext(dstPath))
+			_, err := os.Lstat(dstPath)
+			assert.NoError(t, err)
+		}
+
+		t.Run("it should not change anything on the next sync", func(t *testing.T) {
+			report, err := syncer.Sync(dst, src)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, report.ChangeCount())
+		})
+
+		t.Run("it should not delete the translated names before copying", func(t *testing.T) {
+			syncer := New(WithMaxNameLength(32, LongNameHash), WithDeleteTiming(DeleteBefore))
+			report, err := syncer.Sync(dst, src)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, report.ChangeCount())
+		})
+	})
+}
+
+func TestFsSyncer_destinationPath(t *testing.T) {
+	tests := map[string]struct {
+		dst, src, path string
+		expected       string
+	}{
+		"it should map a path of the source": {
+			dst: "dst", src: "src", path: "src/dir/file", expected: "dst/dir/file",
+		},
+		"it should map the source itself": {
+			dst: "dst", src: "src", path: "src", expected: "dst",
+		},
+		"it should map a source which is not cleaned": {
+			dst: "dst/", src: "./src/", path: "src/file", expected: "dst/file",
+		},
+		"it should keep the names containing the source": {
+			dst: "/backup", src: "/data/a", path: "/data/a/data/a.txt", expected: "/backup/data/a.txt",
+		},
+		"it should map a path relatively to an empty destination": {
+			dst: "", src: "/data", path: "/data/dir/file", expected: "dir/file",
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			s := New()
+			report := s.newSyncState().report
+			assert.Equal(t, test.expected, s.destinationPath(test.dst, test.src, test.path, report))
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package fssync
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// WithManifest option: the state of the synced files (size, modification
+// time, mode, ownership and checksum when computed) is recorded to the
+// manifest file at path after each successful sync, see TrustManifest.
+// Manifests are not written with DeleteDryRun.
+func WithManifest(path string) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.manifestPath = path
+	}
+}
+
+// TrustManifest option: the source is compared to the manifest recorded by
+// WithManifest instead of the destination, which is not read for the files
+// unchanged since the last sync. It's useful when the destination is on slow
+// storage, but the destination must not be modified between syncs. The
+// extraneous files deleted are the ones of the previous manifest not present
+// in the source anymore, after the copy whatever WithDeleteTiming.
+func TrustManifest(s *FsSyncer) {
+	s.trustManifest = true
+}
+
+// manifestFormat is the format of the manifest files, see fileFormat
+var manifestFormat = fileFormat{
+	name: "fssync-manifest", version: 1, compat: 1,
+	migrations: map[int]func(json.RawMessage) (json.RawMessage, error){0: unchangedData},
+}
+
+// manifest is the state of the destination after a successful sync
+type manifest struct {
+	Dst string `json:"dst"`
+	// Entries by path relative to the destination
+	Entries map[string]manifestEntry `json:"entries"`
+}
+
+type manifestEntry struct {
+	Size     int64       `json:"size"`
+	Mtime    int64       `json:"mtime"`
+	Mode     os.FileMode `json:"mode"`
+	UID      uint32      `json:"uid"`
+	GID      uint32      `json:"gid"`
+	Checksum []byte      `json:"checksum,omitempty"`
+	// UnstableRuns counts the consecutive syncs which copied again the file
+	// while it didn't change, see checkUnstableMtime
+	UnstableRuns int `json:"unstable_runs,omitempty"`
+}
+
+func newManifestEntry(info os.FileInfo, stat *sysStat) manifestEntry {
+	return manifestEntry{
+		Size:  info.Size(),
+		Mtime: info.ModTime().UnixNano(),
+		Mode:  info.Mode(),
+		UID:   stat.Uid,
+		GID:   stat.Gid,
+	}
+}
+
+// unchanged returns true if the source file described by current did not
+// change since the entry has been recorded
+func (e manifestEntry) unchanged(current manifestEntry) bool {
+	return e.Size == current.Size && e.Mtime == current.Mtime && e.Mode == current.Mode &&
+		e.UID == current.UID && e.GID == current.GID
+}
+
+// manifestState is the manifest read before a sync and the one recorded
+// during the sync, it's nil if WithManifest is not used
+type manifestState struct {
+	previous manifest
+	current  manifest
+	// trusted is true with TrustManifest when a previous manifest is available
+	trusted bool
+	// source directories synced by destination path, to restore their times
+	// after deletions
+	dirs map[string]string
+}
+
+// openManifest reads the manifest of the previous sync of dst
+func (s *FsSyncer) openManifest(dst string, report *fsSyncReport) (*manifestState, error) {
+	if s.manifestPath == "" {
+		return nil, nil
+	}
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get absolute path of %v", dst)
+	}
+	previous, err := readManifest(s.manifestPath, absDst, report)
+	if err != nil {
+		return nil, err
+	}
+	return &manifestState{
+		previous: previous,
+		current:  manifest{Dst: absDst, Entries: map[string]manifestEntry{}},
+		// In clone mode or with a cleaned destination, the destination doesn't
+		// match the previous manifest
+		trusted: s.trustManifest && !s.cloneMode && !s.cleanDestination && len(previous.Entries) > 0,
+		dirs:    map[string]string{},
+	}, nil
+}
+
+// isTrusted returns true if the source is compared to the previous manifest
+// instead of the destination
+func (m *manifestState) isTrusted() bool {
+	return m != nil && m.trusted
+}
+
+// record adds the synced source path to the current manifest
+func (m *manifestState) record(dst, dstPath, path string, entry manifestEntry) {
+	if m == nil {
+		return
+	}
+	m.current.Entries[manifestKey(dst, dstPath)] = entry
+	if entry.Mode.IsDir() {
+		m.dirs[dstPath] = path
+	}
+}
+
+// keep copies the entries of the previous manifest for dstPath and its
+// content to the current manifest, for source paths which couldn't be read
+func (m *manifestState) keep(dst, dstPath string) {
+	if m == nil {
+		return
+	}
+	key := manifestKey(dst, dstPath)
+	for previousKey, entry := range m.previous.Entries {
+		if _, ok := trimPathPrefix(previousKey, key); ok || key == "." {
+			m.current.Entries[previousKey] = entry
+		}
+	}
+}
+
+// syncFromManifest syncs the source path without reading the destination if
+// the previous manifest proves that it did not change since the last sync. It
+// returns true if the path has been synced.
+func (s *FsSyncer) syncFromManifest(state syncState, dst, dstPath string, src syncInfo, entry manifestEntry) (bool, error) {
+	if !state.manifest.isTrusted() {
+		return false, nil
+	}
+	previous, ok := state.manifest.previous.Entries[manifestKey(dst, dstPath)]
+	if !ok {
+		return false, nil
+	}
+	if previous.unchanged(entry) {
+		entry.Checksum = previous.Checksum
+		state.manifest.record(dst, dstPath, src.path, entry)
+		if entry.Mode.IsDir() && !s.noDirTimes {
+			// Set again if entries are created or deleted in the directory
+			state.unchangedTimes.set(dstPath, src.times)
+		}
+		return true, nil
+	}
+
+	// Only the times changed if the content has the same checksum, the
+	// destination content doesn't have to be read to compare it
+	if !s.checkChecksum || previous.Checksum == nil || !entry.Mode.IsRegular() ||
+		previous.Size != entry.Size || previous.Mode != entry.Mode ||
+		previous.UID != entry.UID || previous.GID != entry.GID {
+		return false, nil
+	}
+	checksum, err := src.checksum(s.newHash)
+	if err != nil {
+		err = sourceReadError(errors.Cause(err))
+		return false, errors.Wrapf(err, "fail to compute checksum of %v", src.path)
+	}
+	if !bytes.Equal(checksum, previous.Checksum) {
+		return false, nil
+	}
+	state.timesMap.set(dstPath, src.times)
+	entry.Checksum = checksum
+	state.manifest.record(dst, dstPath, src.path, entry)
+	return true, nil
+}
+
+// readManifest reads the manifest of the dst directory at path, it's empty if
+// the manifest does not exist or has been recorded for another destination
+func readManifest(path, dst string, report *fsSyncReport) (manifest, error) {
+	m := manifest{Dst: dst, Entries: map[string]manifestEntry{}}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	} else if err != nil {
+		return m, errors.Wrapf(err, "fail to read manifest %v", path)
+	}
+
+	var previous manifest
+	err = manifestFormat.decode(content, &previous)
+	if err != nil {
+		report.warn("invalid manifest %v, ignored: %v", path, err)
+		return m, nil
+	}
+	if previous.Dst != dst {
+		report.warn("manifest %v has been recorded for %v, ignored", path, previous.Dst)
+		return m, nil
+	}
+	if previous.Entries != nil {
+		m.Entries = previous.Entries
+	}
+	return m, nil
+}
+
+// writeManifest atomically replaces the manifest at path
+func writeManifest(path string, m manifest) error {
+	content, err := manifestFormat.encode(m)
+	if err != nil {
+		return err
+	}
+	err = createAtomically(path, func(tmpPath string) error {
+		fd, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		_, err = fd.Write(content)
+		if err != nil {
+			return err
+		}
+		return fd.Close()
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to write manifest %v", path)
+	}
+	return nil
+}
+
+// manifestKey returns the key of the dstPath entry in the manifest
+func manifestKey(dst, dstPath string) string {
+	key, err := filepath.Rel(dst, dstPath)
+	if err != nil {
+		return dstPath
+	}
+	return key
+}
+
+// deleteManifestExtraneousFiles deletes the entries of the previous manifest
+// which have not been synced again, see TrustManifest
+func (s *FsSyncer) deleteManifestExtraneousFiles(state syncState, dst string) error {
+	keys := []string{}
+	for key := range state.manifest.previous.Entries {
+		if _, ok := state.manifest.current.Entries[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	// Directories are deleted with their content, which is listed after them
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := filepath.Join(dst, key)
+		_, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to stat %v", path)
+		}
+		removed, err := s.deleteTree(state, path)
+		if err != nil {
+			return err
+		}
+		if srcDir, ok := state.manifest.dirs[filepath.Dir(path)]; ok && removed {
+			s.trackDeletionParent(state, filepath.Dir(path), srcDir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package fssync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_Manifest(t *testing.T) {
+	setup := func(t *testing.T) (string, string, string) {
+		tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		src := filepath.Join(tmp, "src")
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+		for _, name := range []string{"a", "b", "dir/c"} {
+			assert.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(name), 0644))
+		}
+		return tmp, src, filepath.Join(tmp, "dst")
+	}
+
+	t.Run("it should record the synced files", func(t *testing.T) {
+		tmp, src, dst := setup(t)
+		defer os.RemoveAll(tmp)
+		manifestPath := filepath.Join(tmp, "manifest.json")
+
+		_, err := New(WithManifest(manifestPath), WithChecksum).Sync(dst, src)
+		assert.NoError(t, err)
+		absDst, err := filepath.Abs(dst)
+		assert.NoError(t, err)
+		m, err := readManifest(manifestPath, absDst, &fsSyncReport{})
+		assert.NoError(t, err)
+		assert.Len(t, m.Entries, 5)
+		assert.Equal(t, int64(len("dir/c")), m.Entries["dir/c"].Size)
+		assert.True(t, m.Entries["dir"].Mode.IsDir())
+
+		// Checksums are recorded when they're computed
+		_, err = New(WithManifest(manifestPath), WithChecksum).Sync(dst, src)
+		assert.NoError(t, err)
+		m, err = readManifest(manifestPath, absDst, &fsSyncReport{})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, m.Entries["a"].Checksum)
+	})
+
+	t.Run("it should not read the destination with a trusted manifest", func(t *testing.T) {
+		tmp, src, dst := setup(t)
+		defer os.RemoveAll(tmp)
+		syncer := New(WithManifest(filepath.Join(tmp, "manifest.json")), TrustManifest)
+		_, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+
+		// Changes of the destination are not detected
+		assert.NoError(t, os.Remove(filepath.Join(dst, "a")))
+		// Changes of the source are synced
+		assert.NoError(t, os.Remove(filepath.Join(src, "dir", "c")))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "b"), []byte("new b"), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "d"), []byte("d"), 0644))
+
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.NoFileExists(t, filepath.Join(dst, "a"))
+		assert.NoFileExists(t, filepath.Join(dst, "dir", "c"))
+		assert.FileExists(t, filepath.Join(dst, "d"))
+		content, err := os.ReadFile(filepath.Join(dst, "b"))
+		assert.NoError(t, err)
+		assert.Equal(t, "new b", string(content))
+		assert.True(t, report.HasChanged(filepath.Join(dst, "dir", "c")))
+
+		srcInfo, err := os.Stat(filepath.Join(src, "dir"))
+		assert.NoError(t, err)
+		dstInfo, err := os.Stat(filepath.Join(dst, "dir"))
+		assert.NoError(t, err)
+		assert.Equal(t, srcInfo.ModTime(), dstInfo.ModTime())
+
+		report, err = syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, report.Unchanged())
+	})
+
+	t.Run("it should only update times when the checksum recorded is the same", func(t *testing.T) {
+		tmp, src, dst := setup(t)
+		defer os.RemoveAll(tmp)
+		syncer := New(WithManifest(filepath.Join(tmp, "manifest.json")), TrustManifest, WithChecksum)
+		_, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		// Record the checksums
+		_, err = New(WithManifest(filepath.Join(tmp, "manifest.json")), WithChecksum).Sync(dst, src)
+		assert.NoError(t, err)
+
+		mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		assert.NoError(t, os.Chtimes(filepath.Join(src, "a"), mtime, mtime))
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, report.ChangeCount())
+		info, err := os.Stat(filepath.Join(dst, "a"))
+		assert.NoError(t, err)
+		assert.True(t, mtime.Equal(info.ModTime()))
+	})
+
+	t.Run("it should read the manifests written without envelope", func(t *testing.T) {
+		tmp, src, dst := setup(t)
+		defer os.RemoveAll(tmp)
+		manifestPath := filepath.Join(tmp, "manifest.json")
+		_, err := New(WithManifest(manifestPath)).Sync(dst, src)
+		assert.NoError(t, err)
+		absDst, err := filepath.Abs(dst)
+		assert.NoError(t, err)
+		m, err := readManifest(manifestPath, absDst, &fsSyncReport{})
+		assert.NoError(t, err)
+		legacy, err := json.Marshal(m)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(manifestPath, legacy, 0644))
+
+		report := &fsSyncReport{}
+		migrated, err := readManifest(manifestPath, absDst, report)
+		assert.NoError(t, err)
+		assert.Empty(t, report.Warnings())
+		assert.Equal(t, m, migrated)
+	})
+
+	t.Run("it should ignore the manifest of another destination", func(t *testing.T) {
+		tmp, src, dst := setup(t)
+		defer os.RemoveAll(tmp)
+		manifestPath := filepath.Join(tmp, "manifest.json")
+		_, err := New(WithManifest(manifestPath)).Sync(dst, src)
+		assert.NoError(t, err)
+
+		report, err := New(WithManifest(manifestPath), TrustManifest).Sync(filepath.Join(tmp, "other"), src)
+		assert.NoError(t, err)
+		assert.Len(t, report.Warnings(), 1)
+		assert.FileExists(t, filepath.Join(tmp, "other", "a"))
+	})
+}
+
+func TestFsSyncer_Sync_UnstableMtimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	manifestPath := filepath.Join(tmp, "manifest.json")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0644))
+	dstFile := filepath.Join(dst, "dir", "file")
+
+	syncer := New(WithManifest(manifestPath))
+	_, err = syncer.Sync(dst, src)
+	assert.NoError(t, err)
+
+	// The destination doesn't keep the modification times which are set
+	for i := 0; i < unstableMtimeRuns; i++ {
+		now := time.Now()
+		assert.NoError(t, os.Chtimes(dstFile, now, now))
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, report.HasChanged(dstFile))
+		assert.Empty(t, report.Warnings())
+	}
+
+	for i := 0; i < 2; i++ {
+		now := time.Now()
+		assert.NoError(t, os.Chtimes(dstFile, now, now))
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.False(t, report.HasChanged(dstFile))
+		assert.Len(t, report.Warnings(), 1)
+	}
+
+	// A modified file is still copied
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("modified"), 0644))
+	report, err := syncer.Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.HasChanged(dstFile))
+}
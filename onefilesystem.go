@@ -0,0 +1,84 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// OneFileSystem option: the walk of the source does not descend into the
+// directories located on another filesystem than the source directory, like
+// bind mounts and network mounts when syncing a root filesystem. Their mount
+// points are synced as empty directories and their content on the destination
+// is deleted as extraneous, like rsync --one-file-system.
+func OneFileSystem(s *FsSyncer) {
+	s.oneFileSystem = true
+}
+
+// sourceDevice returns the device ID of the filesystem of the src directory,
+// to which the walk is restricted with OneFileSystem
+func (s *FsSyncer) sourceDevice(src string) (uint64, error) {
+	if !s.oneFileSystem {
+		return 0, nil
+	}
+	info, err := os.Lstat(src)
+	if os.IsNotExist(err) {
+		// The walk reports the missing source
+		return 0, nil
+	} else if err != nil {
+		return 0, errors.Wrapf(err, "fail to stat %v", src)
+	}
+	stat, ok := fileStat(info)
+	if !ok {
+		return 0, errors.Errorf("fail to get detailed stat info for %s", src)
+	}
+	return uint64(stat.Dev), nil
+}
+
+// isOtherFileSystem returns true if info is a directory whose content must not
+// be synced as it's located on another filesystem than the source one,
+// identified by srcDevice
+func (s *FsSyncer) isOtherFileSystem(srcDevice uint64, info os.FileInfo) bool {
+	if !s.oneFileSystem || !info.IsDir() {
+		return false
+	}
+	stat, ok := fileStat(info)
+	return ok && uint64(stat.Dev) != srcDevice
+}
+
+// skipOtherFileSystems returns a walk function calling walk on each entry and
+// not descending into the directories located on another filesystem than src
+func (s *FsSyncer) skipOtherFileSystems(state syncState, src string, walk filepath.WalkFunc) filepath.WalkFunc {
+	if !s.oneFileSystem {
+		return walk
+	}
+	return func(path string, info os.FileInfo, err error) error {
+		err = walk(path, info, err)
+		if err == nil && info != nil && path != src && s.isOtherFileSystem(state.srcDevice, info) {
+			return filepath.SkipDir
+		}
+		return err
+	}
+}
+
+// isInOtherFileSystem returns true if path, located in src, is a directory on
+// another filesystem than src or is located in such a directory, its content
+// is not synced with OneFileSystem
+func (s *FsSyncer) isInOtherFileSystem(src, path string, info os.FileInfo) (bool, error) {
+	if !s.oneFileSystem {
+		return false, nil
+	}
+	srcDevice, err := s.sourceDevice(src)
+	if err != nil {
+		return false, err
+	}
+	if s.isOtherFileSystem(srcDevice, info) {
+		return true, nil
+	}
+	parentInfo, err := os.Lstat(filepath.Dir(path))
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to stat %v", filepath.Dir(path))
+	}
+	return s.isOtherFileSystem(srcDevice, parentInfo), nil
+}
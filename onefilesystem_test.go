@@ -0,0 +1,54 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_OneFileSystem(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	mnt := filepath.Join(src, "mnt")
+	assert.NoError(t, os.MkdirAll(mnt, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	err = mountTmpfs(mnt)
+	if err != nil {
+		t.Skip("mounting a filesystem requires root privileges")
+	}
+	defer unmount(mnt)
+	assert.NoError(t, os.MkdirAll(filepath.Join(mnt, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(mnt, "dir", "mounted"), []byte("mounted"), 0644))
+
+	t.Run("it should sync the mount points as empty directories", func(t *testing.T) {
+		dst := filepath.Join(tmp, "dst")
+		defer os.RemoveAll(dst)
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, "mnt"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "mnt", "stale"), []byte("stale"), 0644))
+
+		_, err := New(OneFileSystem).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dst, "file"))
+		entries, err := os.ReadDir(filepath.Join(dst, "mnt"))
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		report, err := New(OneFileSystem).Verify(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, report.Matches())
+	})
+
+	t.Run("it should sync the content of the mount points without the option", func(t *testing.T) {
+		dst := filepath.Join(tmp, "dst")
+		defer os.RemoveAll(dst)
+
+		_, err := New().Sync(dst, src)
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dst, "mnt", "dir", "mounted"))
+	})
+}
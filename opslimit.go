@@ -0,0 +1,21 @@
+package fssync
+
+// WithMaxOpsPerSecond option: bound to n per second the rate of the metadata
+// operations of the sync: the stat of the walked source and destination
+// entries, the opening of the copied files and the removal of the extraneous
+// entries, to not overload the servers of network filesystems like NFS when
+// syncing huge trees. WithBandwidthLimit only bounds the copied content.
+func WithMaxOpsPerSecond(n int) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.maxOpsPerSecond = n
+	}
+}
+
+// throttleOp waits for the next metadata operation to fit in the limit of
+// WithMaxOpsPerSecond, if any
+func (s *FsSyncer) throttleOp() {
+	if s.opsLimiter == nil {
+		return
+	}
+	s.opsLimiter.wait(1)
+}
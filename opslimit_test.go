@@ -0,0 +1,41 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_WithMaxOpsPerSecond(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	for _, name := range []string{"a", "b", "c"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(name), 0644))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "d"), []byte("d"), 0644))
+
+	syncer := New(WithMaxOpsPerSecond(10))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var slept time.Duration
+	syncer.opsLimiter.now = func() time.Time { return now }
+	syncer.opsLimiter.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+	_, err = syncer.Sync(dst, src)
+	assert.NoError(t, err)
+
+	// 4 walked source entries, 4 stated destinations, 3 copies, 1 stated
+	// extraneous entry and 1 removal
+	assert.Equal(t, 13*100*time.Millisecond, slept)
+	_, err = os.Stat(filepath.Join(dst, "d"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,13 @@
+package fssync
+
+// WithDeterministicOrder option: process the entries in a stable lexical
+// order, for two syncs of the same trees to produce identical logs, hooks,
+// events and reports, for reproducible audit trails. The source and the
+// destination, including for the deletions, are always walked in lexical
+// order: this option also sets the times of the destination entries one at a
+// time in lexical order, deepest first, instead of with the concurrent
+// workers of WithTimesConcurrency. The paths of each depth are then held in
+// memory.
+func WithDeterministicOrder(s *FsSyncer) {
+	s.deterministicOrder = true
+}
@@ -0,0 +1,80 @@
+package fssync
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_applyTimes_DeterministicOrder(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	s := New(WithDeterministicOrder)
+	state := s.newSyncState()
+	mtime := time.Unix(1.5e9, 0)
+	for i := 0; i < 2*timesBatchSize; i++ {
+		path := filepath.Join(tmp, fmt.Sprintf("file-%03d", i))
+		if i%100 != 50 {
+			assert.NoError(t, os.WriteFile(path, []byte("file"), 0644))
+		}
+		state.timesMap.set(path, statTimes{atime: mtime, mtime: mtime})
+	}
+
+	// The first missing path in lexical order fails
+	for i := 0; i < 3; i++ {
+		err = s.applyTimes(state)
+		assert.True(t, os.IsNotExist(errors.Cause(err)))
+		assert.Contains(t, err.Error(), "file-050")
+	}
+
+	s.ignoreNotFound = true
+	assert.NoError(t, s.applyTimes(state))
+	assert.True(t, mtime.Equal(lstatTimes(t, filepath.Join(tmp, "file-511")).mtime))
+}
+
+func TestFsSyncer_Sync_DeterministicOrder(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	for _, dir := range []string{"b", "a/c", "a/b"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, dir), 0755))
+		for _, name := range []string{"z", "y", "x"} {
+			assert.NoError(t, os.WriteFile(filepath.Join(src, dir, name), []byte(name), 0644))
+		}
+	}
+
+	// Two syncs of the same trees log the same lines
+	logs := []string{}
+	for i := 0; i < 2; i++ {
+		dst := filepath.Join(tmp, "dst")
+		assert.NoError(t, os.RemoveAll(dst))
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, "b", "extraneous"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous"), nil, 0644))
+
+		buffer := &bytes.Buffer{}
+		logger := slog.New(slog.NewTextHandler(buffer, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+			ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+				if attr.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return attr
+			},
+		}))
+		_, err := New(WithDeterministicOrder, WithLogger(logger)).Sync(dst, src)
+		assert.NoError(t, err)
+		logs = append(logs, buffer.String())
+	}
+	assert.NotEmpty(t, logs[0])
+	assert.Equal(t, logs[0], logs[1])
+}
@@ -0,0 +1,95 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ErrOverlappingPaths is returned when the source and the destination are the
+// same directory or when one of them is located in the other, the walk would
+// recurse into its own output
+var ErrOverlappingPaths = errors.New("the source and the destination overlap")
+
+// checkOverlap returns ErrOverlappingPaths if dst and src overlap. Symlinks
+// are resolved and the directories are compared by inode, to detect the ones
+// reached through different paths such as bind mounts. dst may not exist yet.
+func checkOverlap(dst, src string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return errors.Wrapf(err, "fail to stat %v", src)
+	}
+	realSrc, err := realPath(src)
+	if err != nil {
+		return err
+	}
+
+	// The deepest existing directory of dst is the one which could be src
+	// or located in it
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return errors.Wrapf(err, "fail to get absolute path of %v", dst)
+	}
+	dstDir := absDst
+	dstInfo, err := os.Stat(dstDir)
+	for os.IsNotExist(err) && dstDir != filepath.Dir(dstDir) {
+		dstDir = filepath.Dir(dstDir)
+		dstInfo, err = os.Stat(dstDir)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to stat %v", dstDir)
+	}
+	realDst, err := realPath(dstDir)
+	if err != nil {
+		return err
+	}
+
+	overlap, err := isSameOrInside(realDst, srcInfo)
+	if err != nil {
+		return err
+	}
+	// src can only be located in dst if it exists
+	if !overlap && dstDir == absDst {
+		overlap, err = isSameOrInside(realSrc, dstInfo)
+		if err != nil {
+			return err
+		}
+	}
+	if overlap {
+		return errors.Wrapf(ErrOverlappingPaths, "fail to sync %v to %v", src, dst)
+	}
+	return nil
+}
+
+// isSameOrInside returns true if path or one of its parents is the directory
+// of dirInfo
+func isSameOrInside(path string, dirInfo os.FileInfo) (bool, error) {
+	for {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, errors.Wrapf(err, "fail to stat %v", path)
+		}
+		if os.SameFile(info, dirInfo) {
+			return true, nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return false, nil
+		}
+		path = parent
+	}
+}
+
+// realPath returns the absolute path of path with its symlinks resolved
+func realPath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to resolve %v", path)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to get absolute path of %v", path)
+	}
+	return resolved, nil
+}
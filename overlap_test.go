@@ -0,0 +1,74 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_OverlappingPaths(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	assert.NoError(t, os.Symlink("src", filepath.Join(tmp, "link")))
+
+	tests := map[string]struct {
+		dst, src    string
+		overlapping bool
+	}{
+		"it should refuse the same path": {
+			dst: src, src: src, overlapping: true,
+		},
+		"it should refuse a destination located in the source": {
+			dst: filepath.Join(src, "dir"), src: src, overlapping: true,
+		},
+		"it should refuse a missing destination located in the source": {
+			dst: filepath.Join(src, "missing", "dst"), src: src, overlapping: true,
+		},
+		"it should refuse a source located in the destination": {
+			dst: tmp, src: src, overlapping: true,
+		},
+		"it should refuse a destination reached through a symlink": {
+			dst: filepath.Join(tmp, "link", "dir"), src: src, overlapping: true,
+		},
+		"it should accept a sibling whose name starts with the source one": {
+			dst: filepath.Join(tmp, "src2"), src: src,
+		},
+	}
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			_, err := New().Sync(test.dst, test.src)
+			if test.overlapping {
+				assert.ErrorIs(t, err, ErrOverlappingPaths)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			_, err = New().SyncPaths(test.dst, test.src, []string{"file"})
+			if test.overlapping {
+				assert.ErrorIs(t, err, ErrOverlappingPaths)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	t.Run("it should refuse a destination which is the source bind mounted", func(t *testing.T) {
+		mnt := filepath.Join(tmp, "mnt")
+		assert.NoError(t, os.MkdirAll(mnt, 0755))
+		err := bindMount(src, mnt)
+		if err != nil {
+			t.Skip("mounting a filesystem requires root privileges")
+		}
+		defer unmount(mnt)
+
+		_, err = New().Sync(filepath.Join(mnt, "dir"), src)
+		assert.ErrorIs(t, err, ErrOverlappingPaths)
+	})
+}
@@ -0,0 +1,102 @@
+package fssync
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// whiteoutPrefix prefixes the names of the whiteout files of the OCI image
+	// layers, .wh.name hides the name entry of the lower layers
+	whiteoutPrefix = ".wh."
+	// opaqueWhiteout is the name of the OCI whiteout file making its directory
+	// opaque
+	opaqueWhiteout = ".wh..wh..opq"
+)
+
+// opaqueXattrs are the extended attributes set to "y" by overlayfs on the
+// opaque directories, the user namespace is used by the unprivileged mounts
+var opaqueXattrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+// OverlayWhiteouts option: the source is a layer of a container image, an
+// overlayfs upper directory or an extracted OCI layer, synced over the
+// destination assembled from the lower layers. The whiteouts of the source,
+// character devices with the 0:0 device number or .wh.<name> files, delete
+// their entry from the destination instead of being copied. The extraneous
+// entries of the destination directories whose source is opaque, with the
+// trusted.overlay.opaque or user.overlay.opaque extended attribute or a
+// .wh..wh..opq file, are deleted even with NoDelete.
+func OverlayWhiteouts(s *FsSyncer) {
+	s.overlayWhiteouts = true
+}
+
+// whiteoutName returns the name of the entry hidden by the whiteout info of
+// the source, false if info is not a whiteout
+func (s *FsSyncer) whiteoutName(info os.FileInfo) (string, bool) {
+	if !s.overlayWhiteouts || info.IsDir() {
+		return "", false
+	}
+	name := info.Name()
+	if isWhiteoutDevice(info) {
+		return name, true
+	}
+	if name == opaqueWhiteout {
+		// Only marks its directory as opaque, see isOpaqueDir
+		return "", true
+	}
+	if strings.HasPrefix(name, whiteoutPrefix) {
+		return strings.TrimPrefix(name, whiteoutPrefix), true
+	}
+	return "", false
+}
+
+// applyWhiteout deletes the entry of the destination hidden by the whiteout
+// at path in the source, dstPath is the destination path of the whiteout
+func (s *FsSyncer) applyWhiteout(state syncState, path, dstPath, name string) error {
+	if name == "" {
+		return nil
+	}
+	dstDir := filepath.Dir(dstPath)
+	hidden := filepath.Join(dstDir, s.destinationName(name))
+	s.throttleOp()
+	_, err := os.Lstat(hidden)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "fail to stat %v", hidden)
+	}
+	if s.isProtected(state, hidden) {
+		state.report.warn("%v is protected on the destination, whiteout %v skipped", hidden, path)
+		return nil
+	}
+	s.log(slog.LevelDebug, "whiteout", "src", path, "dst", hidden)
+	removed, err := s.deleteTree(state, hidden)
+	if err != nil {
+		return err
+	}
+	if removed {
+		s.trackDeletionParent(state, dstDir, filepath.Dir(path))
+	}
+	return nil
+}
+
+// isOpaqueDir returns true if the dir directory of the source is an opaque
+// directory of an overlay layer, hiding the content of the lower layers
+func (s *FsSyncer) isOpaqueDir(dir string) bool {
+	if !s.overlayWhiteouts {
+		return false
+	}
+	value := make([]byte, 1)
+	for _, name := range opaqueXattrs {
+		n, err := lgetxattr(dir, name, value)
+		if err == nil && n == 1 && value[0] == 'y' {
+			return true
+		}
+	}
+	_, err := os.Lstat(filepath.Join(dir, opaqueWhiteout))
+	return err == nil
+}
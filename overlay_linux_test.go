@@ -0,0 +1,40 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestFsSyncer_Sync_OverlayfsWhiteouts(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating whiteout devices requires root privileges")
+	}
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "opaque"), 0755))
+	for _, file := range []string{"hidden", "opaque/lower"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, file), []byte(file), 0644))
+	}
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "opaque"), 0755))
+	assert.NoError(t, mknod(filepath.Join(src, "hidden"), unix.S_IFCHR|0644, 0))
+	opaque := lsetxattr(filepath.Join(src, "opaque"), "trusted.overlay.opaque", []byte("y")) == nil
+
+	_, err = New(NoDelete, OverlayWhiteouts).Sync(dst, src)
+	assert.NoError(t, err)
+
+	_, err = os.Lstat(filepath.Join(dst, "hidden"))
+	assert.True(t, os.IsNotExist(err))
+	if opaque {
+		_, err = os.Lstat(filepath.Join(dst, "opaque", "lower"))
+		assert.True(t, os.IsNotExist(err))
+	}
+}
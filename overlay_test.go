@@ -0,0 +1,40 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_OverlayWhiteouts(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	dst := filepath.Join(tmp, "dst")
+	for _, dir := range []string{"hidden-dir", "opaque"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, dir), 0755))
+	}
+	for _, file := range []string{"hidden", "hidden-dir/file", "opaque/lower", "other"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, file), []byte(file), 0644))
+	}
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "opaque"), 0755))
+	for _, file := range []string{".wh.hidden", ".wh.hidden-dir", ".wh.missing", "opaque/.wh..wh..opq"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, file), nil, 0644))
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "opaque", "upper"), []byte("upper"), 0644))
+
+	_, err = New(NoDelete, OverlayWhiteouts).Sync(dst, src)
+	assert.NoError(t, err)
+
+	for _, path := range []string{"hidden", "hidden-dir", ".wh.hidden", ".wh.missing", "opaque/lower", "opaque/.wh..wh..opq"} {
+		_, err := os.Lstat(filepath.Join(dst, path))
+		assert.True(t, os.IsNotExist(err), path)
+	}
+	assert.FileExists(t, filepath.Join(dst, "opaque", "upper"))
+	assert.FileExists(t, filepath.Join(dst, "other"))
+}
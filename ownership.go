@@ -0,0 +1,339 @@
+package fssync
+
+import (
+	"bufio"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// OwnerLookup resolves the user and group IDs of the source to their names
+type OwnerLookup interface {
+	UserName(uid int) (string, error)
+	GroupName(gid int) (string, error)
+}
+
+// WithNameBasedOwnership option: preserve ownership by name rather than by
+// ID, for sources coming from a host whose IDs differ from the current host.
+// Source IDs are resolved to names with lookup, or with the users and groups
+// of the current host if lookup is nil, then to the IDs of the current host.
+// IDs which can't be resolved are kept as is with a warning in the report.
+func WithNameBasedOwnership(lookup OwnerLookup) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		if lookup == nil {
+			lookup = osOwnerLookup{}
+		}
+		s.preserveOwnership = true
+		s.ownerLookup = lookup
+	}
+}
+
+type osOwnerLookup struct{}
+
+func (osOwnerLookup) UserName(uid int) (string, error) {
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+func (osOwnerLookup) GroupName(gid int) (string, error) {
+	g, err := user.LookupGroupId(strconv.Itoa(gid))
+	if err != nil {
+		return "", err
+	}
+	return g.Name, nil
+}
+
+// passwdOwnerLookup resolves IDs from files in the passwd(5) and group(5)
+// formats
+type passwdOwnerLookup struct {
+	users  map[int]string
+	groups map[int]string
+}
+
+// NewPasswdOwnerLookup returns an OwnerLookup reading the users and groups of
+// the source host from copies of its /etc/passwd and /etc/group files
+func NewPasswdOwnerLookup(passwdPath, groupPath string) (OwnerLookup, error) {
+	users, err := readIDNames(passwdPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to read users from %v", passwdPath)
+	}
+	groups, err := readIDNames(groupPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to read groups from %v", groupPath)
+	}
+	return passwdOwnerLookup{users: users, groups: groups}, nil
+}
+
+// readIDNames reads the name and ID of each line of a passwd or group file,
+// which are the first and third fields of both formats
+func readIDNames(path string) (map[int]string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	names := map[int]string{}
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			continue
+		}
+		id, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		names[id] = fields[0]
+	}
+	return names, scanner.Err()
+}
+
+func (l passwdOwnerLookup) UserName(uid int) (string, error) {
+	name, ok := l.users[uid]
+	if !ok {
+		return "", errors.Errorf("unknown uid %d", uid)
+	}
+	return name, nil
+}
+
+func (l passwdOwnerLookup) GroupName(gid int) (string, error) {
+	name, ok := l.groups[gid]
+	if !ok {
+		return "", errors.Errorf("unknown gid %d", gid)
+	}
+	return name, nil
+}
+
+type ownerKey struct {
+	group bool
+	id    int
+}
+
+// Owner is the ownership forced by WithOwnershipOverride, an ID of -1 keeps
+// the one of the destination file
+type Owner struct {
+	UID int
+	GID int
+}
+
+type ownershipOverride struct {
+	pattern string
+	owner   Owner
+}
+
+// WithOwnershipOverride option: force the ownership of the paths matching the
+// patterns, relative to the source directory with the syntax of
+// filepath.Match. A pattern matching a directory applies to its whole subtree
+// and the deepest match wins. The other paths keep their ownership, or the
+// one of the source with PreserveOwnership.
+func WithOwnershipOverride(overrides map[string]Owner) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.ownershipOverrides = nil
+		for pattern, owner := range overrides {
+			s.ownershipOverrides = append(s.ownershipOverrides, ownershipOverride{
+				pattern: strings.TrimSuffix(pattern, "/"),
+				owner:   owner,
+			})
+		}
+		sort.Slice(s.ownershipOverrides, func(i, j int) bool {
+			return s.ownershipOverrides[i].pattern < s.ownershipOverrides[j].pattern
+		})
+	}
+}
+
+// WithOwnershipMapping option: with PreserveOwnership, the source user and
+// group IDs present in uids and gids are replaced by their value on the
+// destination, the other IDs are kept. See WithOwnershipMapper to shift whole
+// ranges of IDs.
+func WithOwnershipMapping(uids, gids map[int]int) func(*FsSyncer) {
+	return WithOwnershipMapper(func(group bool, id int) int {
+		ids := uids
+		if group {
+			ids = gids
+		}
+		if mapped, ok := ids[id]; ok {
+			return mapped
+		}
+		return id
+	})
+}
+
+// WithOwnershipMapper option: with PreserveOwnership, mapper returns the ID to
+// give on the destination to each source user or group ID, after their
+// translation by WithNameBasedOwnership. It lets shift the IDs by the
+// subuid/subgid offset of a user-namespaced container for instance. The IDs
+// forced by WithOwnershipOverride are not mapped.
+func WithOwnershipMapper(mapper func(group bool, id int) int) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.ownerMapper = mapper
+	}
+}
+
+// chown gives the destination path the ownership of the source path, or the
+// one forced by WithOwnershipOverride. Nothing is written if the current
+// ownership of the destination, when known, already matches.
+func (s *FsSyncer) chown(state syncState, src, path, dstPath string, srcStat, dstStat *sysStat) error {
+	owner, ok := s.destinationOwner(state, src, path, srcStat)
+	if !ok {
+		return nil
+	}
+	if dstStat != nil && owner.matches(dstStat) {
+		return nil
+	}
+	// Lchown changes the ownership of symlinks instead of their target
+	err := s.inDestination(state, dstPath, func(path string) error {
+		return os.Lchown(path, owner.UID, owner.GID)
+	})
+	if err != nil {
+		return s.ownershipFailed(state, dstPath, owner, err)
+	}
+	state.report.metadataChanged = true
+	return nil
+}
+
+// BestEffortOwnership option: the destination entries whose ownership can't
+// be changed because the process lacks the CAP_CHOWN capability, or because
+// the owner is not mapped in the user namespace of the destination mount,
+// keep their current owner instead of failing the sync, like rsync run as
+// non-root. The failures are listed with OwnershipFailures.
+func BestEffortOwnership(s *FsSyncer) {
+	s.bestEffortOwnership = true
+}
+
+// OwnershipFailure is an entry of the destination whose ownership could not
+// be changed to Owner with BestEffortOwnership, Err is the error of chown
+type OwnershipFailure struct {
+	Path  string
+	Owner Owner
+	Err   error
+}
+
+// ownershipFailed returns the error of the chown of path to owner, which is
+// recorded in the report instead with BestEffortOwnership if chown is denied
+func (s *FsSyncer) ownershipFailed(state syncState, path string, owner Owner, err error) error {
+	s.log(slog.LevelError, "chown failed", "dst", path, "uid", owner.UID, "gid", owner.GID, "error", err)
+	// EINVAL is returned for the IDs which are not mapped in the user
+	// namespace of the destination
+	if !s.bestEffortOwnership || !(errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL)) {
+		return errors.Wrapf(err, "fail to chown %v", path)
+	}
+	state.report.ownershipFailures = append(state.report.ownershipFailures, OwnershipFailure{Path: path, Owner: owner, Err: err})
+	return nil
+}
+
+// destinationOwner returns the ownership to give on the destination to the
+// source path, false if the ownership is not managed
+func (s *FsSyncer) destinationOwner(state syncState, src, path string, srcStat *sysStat) (Owner, bool) {
+	owner, ok := s.ownershipOverride(src, path)
+	if ok {
+		return owner, true
+	}
+	if !s.preserveOwnership {
+		return Owner{}, false
+	}
+	return Owner{
+		UID: s.destinationOwnerID(state, false, int(srcStat.Uid)),
+		GID: s.destinationOwnerID(state, true, int(srcStat.Gid)),
+	}, true
+}
+
+// matches returns true if a file with stat already has the ownership
+func (o Owner) matches(stat *sysStat) bool {
+	return (o.UID == -1 || o.UID == int(stat.Uid)) &&
+		(o.GID == -1 || o.GID == int(stat.Gid))
+}
+
+// ownershipOverride returns the ownership forced for the source path by the
+// pattern matching its deepest ancestor
+func (s *FsSyncer) ownershipOverride(src, path string) (Owner, bool) {
+	if len(s.ownershipOverrides) == 0 {
+		return Owner{}, false
+	}
+	rel, err := filepath.Rel(src, path)
+	if err != nil {
+		return Owner{}, false
+	}
+	for rel != "." && rel != "/" {
+		for _, override := range s.ownershipOverrides {
+			if ok, _ := filepath.Match(override.pattern, rel); ok {
+				return override.owner, true
+			}
+		}
+		rel = filepath.Dir(rel)
+	}
+	return Owner{}, false
+}
+
+// destinationOwnerID returns the ID to give on the destination to the owner of
+// a source file, translated by name with WithNameBasedOwnership and mapped with
+// WithOwnershipMapper
+func (s *FsSyncer) destinationOwnerID(state syncState, group bool, id int) int {
+	return s.mapOwnerID(group, s.translatedOwnerID(state, group, id))
+}
+
+// mapOwnerID returns the ID given by WithOwnershipMapper to id
+func (s *FsSyncer) mapOwnerID(group bool, id int) int {
+	if s.ownerMapper == nil {
+		return id
+	}
+	return s.ownerMapper(group, id)
+}
+
+// translatedOwnerID returns the ID of the current host of the owner of a
+// source file with WithNameBasedOwnership, id otherwise
+func (s *FsSyncer) translatedOwnerID(state syncState, group bool, id int) int {
+	if s.ownerLookup == nil {
+		return id
+	}
+	key := ownerKey{group: group, id: id}
+	if dstID, ok := state.ownerIDs[key]; ok {
+		return dstID
+	}
+
+	dstID, err := s.translateOwnerID(group, id)
+	if err != nil {
+		state.report.warn("fail to translate ownership by name, %v is kept: %v", id, err)
+		dstID = id
+	}
+	state.ownerIDs[key] = dstID
+	return dstID
+}
+
+func (s *FsSyncer) translateOwnerID(group bool, id int) (int, error) {
+	if group {
+		name, err := s.ownerLookup.GroupName(id)
+		if err != nil {
+			return -1, errors.Wrapf(err, "fail to get name of source group %v", id)
+		}
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return -1, errors.Wrapf(err, "fail to find group %v", name)
+		}
+		return strconv.Atoi(g.Gid)
+	}
+
+	name, err := s.ownerLookup.UserName(id)
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to get name of source user %v", id)
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to find user %v", name)
+	}
+	return strconv.Atoi(u.Uid)
+}
@@ -0,0 +1,268 @@
+package fssync
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPasswdOwnerLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	passwdPath := filepath.Join(dir, "passwd")
+	groupPath := filepath.Join(dir, "group")
+	assert.NoError(t, ioutil.WriteFile(passwdPath, []byte("# users\nroot:x:0:0::/root:/bin/sh\napp:x:1000:1000::/home/app:/bin/sh\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(groupPath, []byte("root:x:0:\napp:x:1000:\n"), 0600))
+
+	lookup, err := NewPasswdOwnerLookup(passwdPath, groupPath)
+	assert.NoError(t, err)
+
+	name, err := lookup.UserName(1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", name)
+	name, err = lookup.GroupName(0)
+	assert.NoError(t, err)
+	assert.Equal(t, "root", name)
+	_, err = lookup.UserName(42)
+	assert.Error(t, err)
+
+	_, err = NewPasswdOwnerLookup(filepath.Join(dir, "missing"), groupPath)
+	assert.Error(t, err)
+}
+
+type fakeOwnerLookup struct {
+	users  map[int]string
+	groups map[int]string
+}
+
+func (l fakeOwnerLookup) UserName(uid int) (string, error) {
+	return l.users[uid], nil
+}
+
+func (l fakeOwnerLookup) GroupName(gid int) (string, error) {
+	return l.groups[gid], nil
+}
+
+func TestFsSyncer_Sync_NameBasedOwnership(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership requires root privileges")
+	}
+
+	tests := map[string]struct {
+		lookup           fakeOwnerLookup
+		expectedUID      uint32
+		expectedWarnings int
+	}{
+		"it should translate the owner by name": {
+			lookup: fakeOwnerLookup{
+				users:  map[int]string{0: "nobody"},
+				groups: map[int]string{0: "nogroup"},
+			},
+			expectedUID: 65534,
+		},
+		"it should keep the owner ID if the name doesn't exist locally": {
+			lookup: fakeOwnerLookup{
+				users:  map[int]string{0: "fssync-unknown"},
+				groups: map[int]string{0: "fssync-unknown"},
+			},
+			expectedUID:      0,
+			expectedWarnings: 2,
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			dst, err := ioutil.TempDir("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dst)
+
+			src := filepath.Join(dst, "src")
+			assert.NoError(t, os.Mkdir(src, 0755))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+			assert.NoError(t, os.Chown(filepath.Join(src, "a"), 0, 0))
+
+			dst = filepath.Join(dst, "dst")
+			report, err := New(WithNameBasedOwnership(test.lookup)).Sync(dst, src)
+			assert.NoError(t, err)
+			assert.Len(t, report.Warnings(), test.expectedWarnings)
+
+			info, err := os.Stat(filepath.Join(dst, "a"))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedUID, sysStatOf(t, info).Uid)
+		})
+	}
+}
+
+func TestFsSyncer_ownershipOverride(t *testing.T) {
+	syncer := New(WithOwnershipOverride(map[string]Owner{
+		"storage/":         {UID: 1000, GID: 1000},
+		"storage/cache":    {UID: 1001, GID: -1},
+		"*.log":            {UID: 1002, GID: 1002},
+		"public/[ab]*.txt": {UID: 1003, GID: 1003},
+	}))
+
+	tests := map[string]struct {
+		path          string
+		expectedOwner Owner
+		expectedOk    bool
+	}{
+		"it should not override the source directory": {
+			path: "src",
+		},
+		"it should not override unmatched paths": {
+			path: "src/app/main.go",
+		},
+		"it should override a matching directory": {
+			path:          "src/storage",
+			expectedOwner: Owner{UID: 1000, GID: 1000},
+			expectedOk:    true,
+		},
+		"it should override the subtree of a matching directory": {
+			path:          "src/storage/uploads/a.png",
+			expectedOwner: Owner{UID: 1000, GID: 1000},
+			expectedOk:    true,
+		},
+		"it should use the deepest match": {
+			path:          "src/storage/cache/a",
+			expectedOwner: Owner{UID: 1001, GID: -1},
+			expectedOk:    true,
+		},
+		"it should match glob patterns": {
+			path:          "src/public/a.txt",
+			expectedOwner: Owner{UID: 1003, GID: 1003},
+			expectedOk:    true,
+		},
+		"it should match glob patterns at the root only": {
+			path: "src/logs/app.log",
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			owner, ok := syncer.ownershipOverride("src", test.path)
+			assert.Equal(t, test.expectedOk, ok)
+			assert.Equal(t, test.expectedOwner, owner)
+		})
+	}
+}
+
+func TestFsSyncer_Sync_OwnershipOverride(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership requires root privileges")
+	}
+
+	dst, err := ioutil.TempDir("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	src := filepath.Join(dst, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "storage"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "storage", "b"), []byte("b"), 0644))
+
+	dst = filepath.Join(dst, "dst")
+	_, err = New(PreserveOwnership, WithOwnershipOverride(map[string]Owner{
+		"storage": {UID: 65534, GID: 65534},
+	})).Sync(dst, src)
+	assert.NoError(t, err)
+
+	expectedUIDs := map[string]uint32{"a": 0, "storage": 65534, "storage/b": 65534}
+	for path, expectedUID := range expectedUIDs {
+		info, err := os.Stat(filepath.Join(dst, path))
+		assert.NoError(t, err)
+		assert.Equal(t, expectedUID, sysStatOf(t, info).Uid, path)
+	}
+}
+
+func TestFsSyncer_Sync_OwnershipMapping(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership requires root privileges")
+	}
+
+	tests := map[string]struct {
+		syncOptions []func(*FsSyncer)
+		expectedUID uint32
+		expectedGID uint32
+	}{
+		"it should replace the mapped IDs": {
+			syncOptions: []func(*FsSyncer){WithOwnershipMapping(map[int]int{1000: 2000}, map[int]int{1001: 2001})},
+			expectedUID: 2000,
+			expectedGID: 2001,
+		},
+		"it should keep the IDs which are not mapped": {
+			syncOptions: []func(*FsSyncer){WithOwnershipMapping(map[int]int{0: 2000}, nil)},
+			expectedUID: 1000,
+			expectedGID: 1001,
+		},
+		"it should shift the IDs with the mapper": {
+			syncOptions: []func(*FsSyncer){WithOwnershipMapper(func(group bool, id int) int {
+				return id + 100000
+			})},
+			expectedUID: 101000,
+			expectedGID: 101001,
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(tmp)
+
+			src := filepath.Join(tmp, "src")
+			assert.NoError(t, os.Mkdir(src, 0755))
+			assert.NoError(t, os.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+			assert.NoError(t, os.Chown(filepath.Join(src, "a"), 1000, 1001))
+
+			dst := filepath.Join(tmp, "dst")
+			syncer := New(append(test.syncOptions, PreserveOwnership)...)
+			_, err = syncer.Sync(dst, src)
+			assert.NoError(t, err)
+
+			info, err := os.Stat(filepath.Join(dst, "a"))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedUID, sysStatOf(t, info).Uid)
+			assert.Equal(t, test.expectedGID, sysStatOf(t, info).Gid)
+
+			report, err := syncer.Sync(dst, src)
+			assert.NoError(t, err)
+			assert.True(t, report.Unchanged())
+			verifyReport, err := syncer.Verify(dst, src)
+			assert.NoError(t, err)
+			assert.True(t, verifyReport.Matches())
+		})
+	}
+}
+
+func TestFsSyncer_ownershipFailed(t *testing.T) {
+	owner := Owner{UID: 1000, GID: 1000}
+	denied := &os.PathError{Op: "lchown", Path: "file", Err: syscall.EPERM}
+
+	t.Run("it should record the denied chown with BestEffortOwnership", func(t *testing.T) {
+		s := New(PreserveOwnership, BestEffortOwnership)
+		state := s.newSyncState()
+		assert.NoError(t, s.ownershipFailed(state, "file", owner, denied))
+		assert.Equal(t, []OwnershipFailure{{Path: "file", Owner: owner, Err: denied}}, state.report.OwnershipFailures())
+	})
+
+	t.Run("it should fail on the other errors with BestEffortOwnership", func(t *testing.T) {
+		s := New(PreserveOwnership, BestEffortOwnership)
+		state := s.newSyncState()
+		err := s.ownershipFailed(state, "file", owner, &os.PathError{Op: "lchown", Path: "file", Err: syscall.EIO})
+		assert.ErrorIs(t, err, syscall.EIO)
+		assert.Empty(t, state.report.OwnershipFailures())
+	})
+
+	t.Run("it should fail without BestEffortOwnership", func(t *testing.T) {
+		s := New(PreserveOwnership)
+		state := s.newSyncState()
+		assert.ErrorIs(t, s.ownershipFailed(state, "file", owner, denied), syscall.EPERM)
+		assert.Empty(t, state.report.OwnershipFailures())
+	})
+}
@@ -0,0 +1,242 @@
+package fssync
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// WithPartialDir option: the regular files are copied to a partial file of
+// the dir directory, renamed to their destination path once complete. A copy
+// interrupted by an error, a crash or a timeout leaves its partial file in
+// dir: the next sync checks that its content is the prefix of the source
+// file, with the checksum of the WithHash algorithm, and resumes the copy
+// from its end instead of copying the whole file again. A relative dir is
+// located in the destination, and is protected like with WithProtectedPaths.
+// dir must be on the same filesystem as the destination to be renamed. The
+// partial directories must be owned by the syncer and a partial file which is
+// a symlink is not followed, the sync fails with ErrUnsafeDestination
+// otherwise. With Sandboxed, they are opened beneath the destination, or
+// beneath dir if it's located outside of it.
+func WithPartialDir(dir string) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.partialDir = filepath.Clean(dir)
+	}
+}
+
+// partialDirectory returns the partial directory of the dst destination, see
+// WithPartialDir
+func (s *FsSyncer) partialDirectory(dst string) string {
+	if filepath.IsAbs(s.partialDir) {
+		return s.partialDir
+	}
+	return filepath.Join(dst, s.partialDir)
+}
+
+// partialPath returns the path of the partial file of the path destination
+// file, which has the same path relative to the partial directory as path
+// relative to the destination
+func (s *FsSyncer) partialPath(state syncState, path string) (string, error) {
+	rel, err := filepath.Rel(state.dstRoot, path)
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to get path of %v relative to %v", path, state.dstRoot)
+	}
+	return filepath.Join(s.partialDirectory(state.dstRoot), rel), nil
+}
+
+// copyFileWithPartial copies the src file to the path destination file
+// through its partial file, resuming the copy of a previous sync if the
+// partial file is a prefix of src. It returns the number of bytes copied by
+// this sync.
+func (s *FsSyncer) copyFileWithPartial(state syncState, src syncInfo, path string, mode os.FileMode) (int64, error) {
+	partial, err := s.partialPath(state, path)
+	if err != nil {
+		return -1, err
+	}
+	root, err := s.partialRoot(state)
+	if err != nil {
+		return -1, err
+	}
+	partialDir := s.partialDirectory(state.dstRoot)
+	err = s.mkdirAllBeneath(root, filepath.Dir(partial), 0700, func(path, dir string) error {
+		if path != partialDir && !strings.HasPrefix(path, partialDir+string(filepath.Separator)) {
+			// Parent of the partial directory in the destination
+			return nil
+		}
+		info, err := os.Lstat(dir)
+		if err != nil {
+			return err
+		}
+		return checkPartialDir(path, info)
+	})
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to create partial directory of %v", path)
+	}
+	var fd *os.File
+	err = s.beneath(root, partial, func(partial string) error {
+		var err error
+		fd, err = openNoFollow(partial, os.O_CREATE|os.O_RDWR, mode)
+		return err
+	})
+	if errors.Is(err, syscall.ELOOP) {
+		err = errors.Wrapf(ErrUnsafeDestination, "partial file %v is a symlink", partial)
+	}
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to open partial file %v", partial)
+	}
+	defer fd.Close()
+	err = checkPartialFile(partial, fd)
+	if err != nil {
+		return -1, err
+	}
+	if s.forcesModes() {
+		err = fd.Chmod(mode)
+		if err != nil {
+			return -1, errors.Wrapf(err, "fail to chmod partial file %v", partial)
+		}
+	}
+
+	s.throttleOp()
+	sfd, err := openSource(src.path, src.fileInfo)
+	if err != nil {
+		err = sourceReadError(err)
+		return -1, errors.Wrapf(err, "fail to open src %v", src.path)
+	}
+	defer sfd.Close()
+
+	offset, err := s.resumeOffset(sfd, fd)
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to compare partial file %v to %v", partial, src.path)
+	}
+	if offset > 0 {
+		s.log(slog.LevelDebug, "copy resumed", "src", src.path, "partial", partial, "offset", offset)
+	}
+	n, err := s.copier.Copy(fd, sfd)
+	if err != nil {
+		// The partial file is kept to resume the copy on the next sync
+		return -1, errors.Wrapf(err, "fail to copy data")
+	}
+	err = fd.Close()
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to close partial file %v", partial)
+	}
+
+	err = s.beneath(root, partial, func(partial string) error {
+		return s.inDestination(state, path, func(path string) error {
+			return os.Rename(partial, path)
+		})
+	})
+	if err != nil {
+		return -1, errors.Wrapf(err, "fail to mv partial file on original file %v -> %v", partial, path)
+	}
+	s.removeEmptyPartialDirs(state, root, filepath.Dir(partial))
+	s.log(slog.LevelDebug, "file copied", "src", src.path, "bytes", n)
+	return n, nil
+}
+
+// resumeOffset positions the src and partial files at the end of the content
+// of partial if it's a prefix of src, and returns its size. partial is
+// truncated otherwise and 0 is returned.
+func (s *FsSyncer) resumeOffset(src, partial *os.File) (int64, error) {
+	partialInfo, err := partial.Stat()
+	if err != nil {
+		return -1, err
+	}
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return -1, sourceReadError(err)
+	}
+	size := partialInfo.Size()
+	if size > 0 && size <= srcInfo.Size() {
+		isPrefix, err := s.isPrefix(src, partial, size)
+		if err != nil {
+			return -1, err
+		}
+		if isPrefix {
+			return size, nil
+		}
+		_, err = src.Seek(0, io.SeekStart)
+		if err != nil {
+			return -1, sourceReadError(err)
+		}
+	}
+	if size > 0 {
+		err = partial.Truncate(0)
+		if err != nil {
+			return -1, err
+		}
+	}
+	_, err = partial.Seek(0, io.SeekStart)
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// removeEmptyPartialDirs removes dir and its parents once they're empty, up
+// to the partial directory which is only removed if it's located in the
+// destination, beneath the root directory returned by partialRoot. The errors
+// are ignored, the directories are left for the next partial files.
+func (s *FsSyncer) removeEmptyPartialDirs(state syncState, root, dir string) {
+	partialDir := s.partialDirectory(state.dstRoot)
+	for p := dir; p != filepath.Dir(p); p = filepath.Dir(p) {
+		if p == root {
+			return
+		}
+		if s.beneath(root, p, os.Remove) != nil || p == partialDir {
+			return
+		}
+	}
+}
+
+// partialRoot returns the directory the partial files are opened beneath:
+// the destination for a partial directory located in it, the partial
+// directory itself otherwise, which is created if missing
+func (s *FsSyncer) partialRoot(state syncState) (string, error) {
+	if !filepath.IsAbs(s.partialDir) && filepath.IsLocal(s.partialDir) {
+		return state.dstRoot, nil
+	}
+	partialDir := s.partialDirectory(state.dstRoot)
+	err := os.MkdirAll(partialDir, 0700)
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to create partial directory %v", partialDir)
+	}
+	info, err := os.Lstat(partialDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "fail to stat partial directory %v", partialDir)
+	}
+	err = checkPartialDir(partialDir, info)
+	if err != nil {
+		return "", err
+	}
+	return partialDir, nil
+}
+
+// checkPartialDir returns ErrUnsafeDestination if the path partial directory
+// is not a directory owned by the syncer: partial files written in a symlink
+// or in a directory of another user could be redirected
+func checkPartialDir(path string, info os.FileInfo) error {
+	if !info.IsDir() || !isOwnedByProcess(info) {
+		return errors.Wrapf(ErrUnsafeDestination, "partial directory %v is not a directory owned by the syncer", path)
+	}
+	return nil
+}
+
+// checkPartialFile returns ErrUnsafeDestination if the opened fd partial file
+// is not a regular file owned by the syncer, or is linked to other paths
+func checkPartialFile(path string, fd *os.File) error {
+	info, err := fd.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "fail to stat partial file %v", path)
+	}
+	stat, ok := fileStat(info)
+	if !info.Mode().IsRegular() || !isOwnedByProcess(info) || !ok || stat.Nlink > 1 {
+		return errors.Wrapf(ErrUnsafeDestination, "partial file %v is not a regular file owned by the syncer", path)
+	}
+	return nil
+}
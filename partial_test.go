@@ -0,0 +1,145 @@
+package fssync
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// interruptedCopier copies n bytes then fails, like a sync interrupted in
+// the middle of a copy
+type interruptedCopier struct {
+	n int64
+}
+
+func (c interruptedCopier) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	n, err := io.CopyN(dst, src, c.n)
+	if err != nil {
+		return n, err
+	}
+	return n, errors.New("interrupted")
+}
+
+func TestFsSyncer_Sync_PartialDir(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	content := []byte("0123456789abcdefghij")
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), content, 0644))
+
+	t.Run("it should resume an interrupted copy", func(t *testing.T) {
+		dst := filepath.Join(tmp, "resumed")
+		syncer := New(WithPartialDir(".partial"))
+		syncer.copier = interruptedCopier{n: 8}
+		_, err := syncer.Sync(dst, src)
+		assert.Error(t, err)
+		assert.NoFileExists(t, filepath.Join(dst, "dir", "file"))
+		partial, err := os.ReadFile(filepath.Join(dst, ".partial", "dir", "file"))
+		assert.NoError(t, err)
+		assert.Equal(t, content[:8], partial)
+
+		report, err := New(WithPartialDir(".partial")).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content)-8), report.CopiedBytes())
+		synced, err := os.ReadFile(filepath.Join(dst, "dir", "file"))
+		assert.NoError(t, err)
+		assert.Equal(t, content, synced)
+		assert.NoDirExists(t, filepath.Join(dst, ".partial"))
+	})
+
+	t.Run("it should restart the copy if the partial file is not a prefix of the source", func(t *testing.T) {
+		dst := filepath.Join(tmp, "restarted")
+		partialDir, err := filepath.Abs(filepath.Join(tmp, "partial"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.MkdirAll(filepath.Join(partialDir, "dir"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(partialDir, "dir", "file"), []byte("01234xyz"), 0644))
+
+		report, err := New(WithPartialDir(partialDir)).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(content)), report.CopiedBytes())
+		synced, err := os.ReadFile(filepath.Join(dst, "dir", "file"))
+		assert.NoError(t, err)
+		assert.Equal(t, content, synced)
+		assert.DirExists(t, partialDir)
+		assert.NoFileExists(t, filepath.Join(partialDir, "dir", "file"))
+	})
+
+	t.Run("it should not delete the partial directory of the destination", func(t *testing.T) {
+		dst := filepath.Join(tmp, "protected")
+		assert.NoError(t, os.MkdirAll(filepath.Join(dst, ".partial"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, ".partial", "other"), nil, 0644))
+
+		_, err := New(WithPartialDir(".partial")).Sync(dst, src)
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dst, ".partial", "other"))
+	})
+}
+
+func TestFsSyncer_Sync_PartialDirSymlink(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0644))
+
+	tests := map[string]struct {
+		// plant creates the symlinks of the dst destination redirecting the
+		// partial files to the outside directory
+		plant func(t *testing.T, dst, outside string)
+	}{
+		"it should not write through a symlinked partial directory": {
+			plant: func(t *testing.T, dst, outside string) {
+				assert.NoError(t, os.Symlink(outside, filepath.Join(dst, ".partial")))
+			},
+		},
+		"it should not write through a symlinked partial file": {
+			plant: func(t *testing.T, dst, outside string) {
+				assert.NoError(t, os.MkdirAll(filepath.Join(dst, ".partial", "dir"), 0700))
+				assert.NoError(t, os.Symlink(filepath.Join(outside, "target"), filepath.Join(dst, ".partial", "dir", "file")))
+			},
+		},
+	}
+
+	for msg, test := range tests {
+		for _, sandboxed := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%v, sandboxed: %v", msg, sandboxed), func(t *testing.T) {
+				options := []func(*FsSyncer){WithPartialDir(".partial")}
+				if sandboxed {
+					if !sandboxSupported() {
+						t.Skip("openat2 is not supported")
+					}
+					options = append(options, Sandboxed)
+				}
+				dir, err := os.MkdirTemp(tmp, "dst")
+				assert.NoError(t, err)
+				dir, err = filepath.Abs(dir)
+				assert.NoError(t, err)
+				dst := filepath.Join(dir, "dst")
+				outside := filepath.Join(dir, "outside")
+				assert.NoError(t, os.Mkdir(dst, 0755))
+				assert.NoError(t, os.Mkdir(outside, 0755))
+				assert.NoError(t, os.WriteFile(filepath.Join(outside, "target"), []byte("target"), 0644))
+				test.plant(t, dst, outside)
+
+				_, err = New(options...).Sync(dst, src)
+				assert.Equal(t, ErrUnsafeDestination, errors.Cause(err))
+				entries, err := os.ReadDir(outside)
+				assert.NoError(t, err)
+				assert.Len(t, entries, 1)
+				content, err := os.ReadFile(filepath.Join(outside, "target"))
+				assert.NoError(t, err)
+				assert.Equal(t, "target", string(content))
+			})
+		}
+	}
+}
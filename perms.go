@@ -0,0 +1,140 @@
+package fssync
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// modeBits are the bits of a mode which can be changed with chmod(2)
+const modeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// NoPerms option: the modes of the source are not replicated, new entries are
+// created with the default modes masked by the umask of the process: 0777 for
+// directories and executable files, 0666 for the other files. The modes of the
+// existing entries of the destination are kept.
+func NoPerms(s *FsSyncer) {
+	s.noPerms = true
+}
+
+// WithChmod option: the bits of clear are removed from the modes given to the
+// destination entries and the bits of set are added, for instance set=0600
+// and clear=0022 like chmod u+rw,go-w. Existing entries of the destination are
+// adjusted the same way, clearing os.ModePerm forces the permissions.
+// Symlinks are not affected.
+func WithChmod(set, clear os.FileMode) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.chmodSet = set & modeBits
+		s.chmodClear = clear & modeBits
+	}
+}
+
+// WithFileMode option: new regular files are created with mode instead of the
+// mode of their source, regardless of the umask. Existing files keep theirs.
+func WithFileMode(mode os.FileMode) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.fileMode = mode & modeBits
+	}
+}
+
+// WithDirMode option: new directories are created with mode instead of the
+// mode of their source, regardless of the umask. Existing directories keep
+// theirs.
+func WithDirMode(mode os.FileMode) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.dirMode = mode & modeBits
+	}
+}
+
+// destinationMode returns the mode of the entry created on the destination
+// for the source entry info, according to NoPerms, WithFileMode, WithDirMode
+// and WithChmod
+func (s *FsSyncer) destinationMode(info os.FileInfo) os.FileMode {
+	mode := info.Mode()
+	switch {
+	case mode.IsRegular() && s.fileMode != 0:
+		mode = s.fileMode
+	case mode.IsDir() && s.dirMode != 0:
+		mode = os.ModeDir | s.dirMode
+	case s.noPerms:
+		perm := os.FileMode(0666)
+		if mode.IsDir() || mode&0111 != 0 {
+			perm = 0777
+		}
+		mode = mode.Type() | perm&^s.umask
+	}
+	return mode&^s.chmodClear | s.chmodSet
+}
+
+// forcesModes returns true if the modes given by destinationMode must be set
+// explicitly as the umask of the process would alter them on creation
+func (s *FsSyncer) forcesModes() bool {
+	return s.fileMode != 0 || s.dirMode != 0 || s.chmodSet != 0 || s.chmodClear != 0
+}
+
+// replicatesModes returns true if the modes of the destination entries are
+// expected to be the ones of their source, they are not compared otherwise
+func (s *FsSyncer) replicatesModes() bool {
+	return !s.noPerms && !s.forcesModes()
+}
+
+// chmodCreated sets the mode of the entry created at path when it is forced
+func (s *FsSyncer) chmodCreated(state syncState, path string, mode os.FileMode) error {
+	if !s.forcesModes() {
+		return nil
+	}
+	err := s.onDestinationEntry(state, path, func(path string) error {
+		return os.Chmod(path, mode)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to chmod %v", path)
+	}
+	return nil
+}
+
+// adjustMode applies WithChmod to the existing entry of the destination at
+// dstPath. Nothing is written if its mode already matches.
+func (s *FsSyncer) adjustMode(state syncState, dstPath string, dstInfo os.FileInfo) error {
+	if s.chmodSet == 0 && s.chmodClear == 0 || isSymlink(dstInfo) {
+		return nil
+	}
+	mode := dstInfo.Mode()&^s.chmodClear | s.chmodSet
+	if mode == dstInfo.Mode() {
+		return nil
+	}
+	err := s.onDestinationEntry(state, dstPath, func(path string) error {
+		return os.Chmod(path, mode)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to chmod %v", dstPath)
+	}
+	state.report.metadataChanged = true
+	return nil
+}
+
+// processUmask returns the umask of the process, read from /proc as umask(2)
+// can't read it without changing it for the other goroutines
+func processUmask() os.FileMode {
+	fd, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0022
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "Umask:")
+		if !ok {
+			continue
+		}
+		umask, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+		if err != nil {
+			break
+		}
+		return os.FileMode(umask)
+	}
+	return 0022
+}
@@ -0,0 +1,83 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_Modes(t *testing.T) {
+	setup := func(t *testing.T) (string, string, string) {
+		tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0700))
+		assert.NoError(t, os.MkdirAll(dst, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0600))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "script"), []byte("script"), 0700))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "existing"), []byte("existing"), 0600))
+		assert.NoError(t, os.Chmod(filepath.Join(src, "dir"), 0700))
+		assert.NoError(t, os.Chmod(filepath.Join(src, "file"), 0600))
+		assert.NoError(t, os.Chmod(filepath.Join(src, "script"), 0700))
+		assert.NoError(t, os.Chmod(filepath.Join(src, "existing"), 0600))
+		_, err = New().Sync(dst, src)
+		assert.NoError(t, err)
+		// Only the existing file is kept
+		for _, name := range []string{"dir", "file", "script"} {
+			assert.NoError(t, os.RemoveAll(filepath.Join(dst, name)))
+		}
+		assert.NoError(t, os.Chmod(filepath.Join(dst, "existing"), 0666))
+		return tmp, src, dst
+	}
+	umask := processUmask()
+
+	tests := map[string]struct {
+		syncOptions []func(*FsSyncer)
+		expected    map[string]os.FileMode
+	}{
+		"it should create the entries with the default modes with NoPerms": {
+			syncOptions: []func(*FsSyncer){NoPerms},
+			expected: map[string]os.FileMode{
+				"dir": os.ModeDir | 0777&^umask, "file": 0666 &^ umask, "script": 0777 &^ umask, "existing": 0666,
+			},
+		},
+		"it should create the entries with the modes of WithFileMode and WithDirMode": {
+			syncOptions: []func(*FsSyncer){WithFileMode(0664), WithDirMode(0775)},
+			expected: map[string]os.FileMode{
+				"dir": os.ModeDir | 0775, "file": 0664, "script": 0664, "existing": 0666,
+			},
+		},
+		"it should adjust the modes of all the entries with WithChmod": {
+			syncOptions: []func(*FsSyncer){WithChmod(0044, 0002)},
+			expected: map[string]os.FileMode{
+				"dir": os.ModeDir | 0744, "file": 0644, "script": 0744, "existing": 0664,
+			},
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			tmp, src, dst := setup(t)
+			defer os.RemoveAll(tmp)
+
+			_, err := New(test.syncOptions...).Sync(dst, src)
+			assert.NoError(t, err)
+			for name, mode := range test.expected {
+				info, err := os.Lstat(filepath.Join(dst, name))
+				assert.NoError(t, err)
+				assert.Equal(t, mode, info.Mode(), name)
+			}
+
+			report, err := New(test.syncOptions...).Sync(dst, src)
+			assert.NoError(t, err)
+			assert.True(t, report.Unchanged())
+
+			verifyReport, err := New(test.syncOptions...).Verify(dst, src)
+			assert.NoError(t, err)
+			assert.True(t, verifyReport.Matches())
+		})
+	}
+}
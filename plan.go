@@ -0,0 +1,264 @@
+package fssync
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStageOrder is returned when the stages of a SyncPlan are not run in
+// order
+var ErrStageOrder = errors.New("sync stages must be run in order: Scan, Transfer, Delete, Finalize")
+
+type syncStage int
+
+const (
+	stageNew syncStage = iota
+	stageScanned
+	stageTransferred
+	stageDeleted
+	stageFinalized
+)
+
+// SyncPlan is a sync split in stages, to let orchestrators run their own steps
+// (health checks, traffic switches, etc.) between them. The stages must be
+// run in order, Sync runs all of them.
+type SyncPlan struct {
+	syncer   *FsSyncer
+	dst, src string
+	state    syncState
+	stage    syncStage
+	// true once the resource usage failed to be measured, see
+	// MeasureResourceUsage
+	usageUnavailable bool
+}
+
+// NewSyncPlan returns the plan of the sync of src to dst
+func (s *FsSyncer) NewSyncPlan(dst, src string) *SyncPlan {
+	return &SyncPlan{
+		syncer: s,
+		dst:    dst,
+		src:    src,
+		state:  s.newSyncState(),
+	}
+}
+
+func (s *FsSyncer) newSyncState() syncState {
+	memory := newMemoryBudget(s.memoryLimit)
+	var changes *spillMap
+	if s.publisher != nil {
+		changes = newSpillMap(memory)
+	}
+	var progress *progressTracker
+	if s.progressFunc != nil {
+		progress = &progressTracker{}
+	}
+	return syncState{
+		timesMap:          newSpillTimes(memory),
+		inoMap:            newSpillLinks(memory),
+		capabilities:      map[uint64]Capabilities{},
+		caseFolded:        map[string]string{},
+		ownerIDs:          map[ownerKey]int{},
+		deletionParents:   map[string]string{},
+		unchangedTimes:    newSpillTimes(memory),
+		checksumPaths:     map[string]bool{},
+		unstableMtimeDirs: map[string]bool{},
+		dedupeCandidates:  map[dedupeKey][]*dedupeCandidate{},
+		memory:            memory,
+		changes:           changes,
+		progress:          progress,
+		listing:           &dirListing{},
+		extraneous:        newExtraneousQueue(),
+		report: &fsSyncReport{
+			fileChanges:  newSpillSet(memory),
+			renamedPaths: map[string]string{},
+			logger:       s.logger,
+		},
+	}
+}
+
+// Report returns the report of the stages run so far
+func (p *SyncPlan) Report() SyncReport {
+	return p.state.report
+}
+
+func (p *SyncPlan) startStage(previous syncStage) error {
+	if p.stage != previous {
+		return ErrStageOrder
+	}
+	p.stage++
+	return nil
+}
+
+// Scan checks the source and the destination and reads the manifest of the
+// previous sync, nothing is written to the destination
+func (p *SyncPlan) Scan() error {
+	err := p.startStage(stageNew)
+	if err != nil {
+		return err
+	}
+	defer p.measureStage("scan")()
+	p.syncer = p.syncer.forSource(p.src)
+	s := p.syncer
+	err = s.checkSandbox()
+	if err != nil {
+		return err
+	}
+
+	p.src = filepath.Clean(p.src)
+	p.dst, err = s.prefixedDestination(filepath.Clean(p.dst))
+	if err != nil {
+		return err
+	}
+	err = checkOverlap(p.dst, p.src)
+	if err != nil {
+		return err
+	}
+	err = s.checkTempDir(p.dst)
+	if err != nil {
+		return err
+	}
+	p.state.protected = s.protectedDestinationPaths(p.dst)
+	p.state.dstRoot = p.dst
+	p.state.srcRoot = p.src
+
+	err = s.checkLongNames(p.src)
+	if err != nil {
+		return err
+	}
+	p.state.srcDevice, err = s.sourceDevice(p.src)
+	if err != nil {
+		return err
+	}
+
+	p.state.manifest, err = s.openManifest(p.dst, p.state.report)
+	if err != nil {
+		return err
+	}
+	// With a trusted manifest, deletions are based on the manifest instead of
+	// the destination. A cleaned destination has no extraneous files.
+	p.state.deleteFromDst = !s.noDelete && !s.cloneMode && !s.cleanDestination && !p.state.manifest.isTrusted()
+	return nil
+}
+
+// Transfer copies the source files to the destination. The destination is
+// emptied before with WithCleanDestination, extraneous files are deleted
+// before with DeleteBefore and during with DeleteDuring.
+func (p *SyncPlan) Transfer() error {
+	err := p.startStage(stageScanned)
+	if err != nil {
+		return err
+	}
+	defer p.measureStage("transfer")()
+	s, state := p.syncer, p.state
+
+	err = s.createPrefixParents(p.dst)
+	if err != nil {
+		return err
+	}
+	if s.cleanDestination {
+		err = s.cleanDestinationEntries(state, p.dst, p.src)
+		if err != nil {
+			return err
+		}
+	}
+	if state.deleteFromDst && s.deleteTiming == DeleteBefore {
+		deleteState, span := s.startSpan(state, SpanDelete)
+		err = s.deleteExtraneousFiles(deleteState, p.dst, p.src)
+		span.End(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.syncPriorityPaths(state, p.dst, p.src)
+	if err != nil {
+		return err
+	}
+
+	walkState, span := s.startSpan(state, SpanWalk)
+	span.SetAttribute("src", p.src)
+	err = s.walkSource(walkState, p.src, s.skipOtherFileSystems(walkState, p.src, s.syncWalkFunc(walkState, p.dst, p.src)))
+	span.End(err)
+	if err != nil {
+		return errors.Wrapf(err, "fail to walk %v", p.src)
+	}
+	return nil
+}
+
+// Delete deletes the extraneous files of the destination, unless they have
+// already been deleted by Transfer
+func (p *SyncPlan) Delete() error {
+	err := p.startStage(stageTransferred)
+	if err != nil {
+		return err
+	}
+	defer p.measureStage("delete")()
+	s, state := p.syncer, p.state
+
+	// The opaque directories of OverlayWhiteouts queue their extraneous entries
+	// without deleteFromDst
+	if s.deleteTiming == DeleteAfter && (state.deleteFromDst || len(state.extraneous.entries) > 0) {
+		state, span := s.startSpan(state, SpanDelete)
+		err = s.deleteQueuedEntries(state)
+		span.End(err)
+		return err
+	} else if !s.noDelete && state.manifest.isTrusted() {
+		state, span := s.startSpan(state, SpanDelete)
+		err = s.deleteManifestExtraneousFiles(state, p.dst)
+		span.End(err)
+		return err
+	}
+	return nil
+}
+
+// Finalize sets the times of the synced files, records the manifest and
+// publishes the changes, see WithEventPublisher
+func (p *SyncPlan) Finalize() error {
+	err := p.startStage(stageDeleted)
+	if err != nil {
+		return err
+	}
+	defer p.measureStage("finalize")()
+	s, state, report := p.syncer, p.state, p.state.report
+
+	// Creating or deleting entries changes the times of their parent
+	// directories, whose times have to be set again even if they were
+	// matching the source
+	if !report.Unchanged() {
+		state.unchangedTimes.each(func(file string, times statTimes) error {
+			state.timesMap.set(file, times)
+			return nil
+		})
+	}
+
+	err = s.restoreDeletionParentTimes(state)
+	if err != nil {
+		return err
+	}
+
+	// Change times after removing entries as removing a file
+	// changes the mtime at the os level. Symlinks get their own times instead
+	// of the ones of their target.
+	timesState, span := s.startSpan(state, SpanTimes)
+	err = s.applyTimes(timesState)
+	span.End(err)
+	if err != nil {
+		return err
+	}
+	if !state.timesMap.empty() {
+		report.metadataChanged = true
+	}
+	if state.memory.err != nil {
+		return state.memory.err
+	}
+
+	if state.manifest != nil && !s.deleteDryRun {
+		err = writeManifest(s.manifestPath, state.manifest.current)
+		if err != nil {
+			return err
+		}
+	}
+	s.reportProgress(state, true)
+	return s.publishChanges(state, p.dst, p.src)
+}
@@ -0,0 +1,43 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncPlan_Stages(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous"), []byte("extraneous"), 0644))
+
+	plan := New().NewSyncPlan(dst, src)
+	assert.Equal(t, ErrStageOrder, plan.Transfer())
+
+	assert.NoError(t, plan.Scan())
+	assert.NoFileExists(t, filepath.Join(dst, "file"))
+
+	assert.NoError(t, plan.Transfer())
+	assert.FileExists(t, filepath.Join(dst, "file"))
+	assert.FileExists(t, filepath.Join(dst, "extraneous"))
+	assert.Equal(t, ErrStageOrder, plan.Scan())
+
+	assert.NoError(t, plan.Delete())
+	assert.NoFileExists(t, filepath.Join(dst, "extraneous"))
+
+	assert.NoError(t, plan.Finalize())
+	assert.Equal(t, ErrStageOrder, plan.Finalize())
+	assert.Equal(t, 2, plan.Report().ChangeCount())
+
+	report, err := New().Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+}
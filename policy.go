@@ -0,0 +1,62 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ComparePolicy defines how the regular files matching a pattern of
+// WithPolicyByPattern are compared to their destination
+type ComparePolicy int
+
+const (
+	// CompareDefault compares the files like the others: by size and
+	// modification time, or by checksum with WithChecksum
+	CompareDefault ComparePolicy = iota
+	// CompareSizeOnly considers the files of the same size as identical,
+	// whatever their modification times. Their times are still set to the
+	// ones of the source.
+	CompareSizeOnly
+	// CompareChecksum compares the files by checksum
+	CompareChecksum
+	// CompareExclude ignores the files, they are neither copied nor deleted
+	// from the destination
+	CompareExclude
+)
+
+type patternPolicy struct {
+	pattern string
+	policy  ComparePolicy
+}
+
+// WithPolicyByPattern option: the regular files whose name matches a pattern,
+// with the syntax of filepath.Match, are compared with its policy, for
+// instance {"*.log": CompareSizeOnly, "*.bin": CompareChecksum, "*.tmp":
+// CompareExclude}. The patterns are tried in lexical order, the first
+// matching one applies.
+func WithPolicyByPattern(policies map[string]ComparePolicy) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.patternPolicies = nil
+		for pattern, policy := range policies {
+			s.patternPolicies = append(s.patternPolicies, patternPolicy{pattern: pattern, policy: policy})
+		}
+		sort.Slice(s.patternPolicies, func(i, j int) bool {
+			return s.patternPolicies[i].pattern < s.patternPolicies[j].pattern
+		})
+	}
+}
+
+// comparePolicy returns the policy of WithPolicyByPattern applying to the
+// entry info, CompareDefault if it's not a regular file or if none matches
+func (s *FsSyncer) comparePolicy(info os.FileInfo) ComparePolicy {
+	if len(s.patternPolicies) == 0 || !info.Mode().IsRegular() {
+		return CompareDefault
+	}
+	for _, p := range s.patternPolicies {
+		if ok, _ := filepath.Match(p.pattern, info.Name()); ok {
+			return p.policy
+		}
+	}
+	return CompareDefault
+}
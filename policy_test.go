@@ -0,0 +1,84 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_PolicyByPattern(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	for _, name := range []string{"app.log", "data.bin", "file.txt"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, name), []byte("source"), 0644))
+	}
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+
+	// Same size, different modification time
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "app.log"), []byte("rotate"), 0644))
+	// Same size and modification time, different content
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "data.bin"), []byte("stale!"), 0644))
+	srcTimes := lstatTimes(t, filepath.Join(src, "data.bin"))
+	assert.NoError(t, lutimes(filepath.Join(dst, "data.bin"), srcTimes.atime, srcTimes.mtime))
+	// Neither copied nor deleted
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "new.tmp"), []byte("new"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "old.tmp"), []byte("old"), 0644))
+
+	syncer := New(WithPolicyByPattern(map[string]ComparePolicy{
+		"*.log": CompareSizeOnly,
+		"*.bin": CompareChecksum,
+		"*.tmp": CompareExclude,
+	}))
+	report, err := syncer.Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.ChangeCount())
+
+	content, err := os.ReadFile(filepath.Join(dst, "app.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, "rotate", string(content))
+	srcMtime := lstatTimes(t, filepath.Join(src, "app.log")).mtime
+	assert.True(t, srcMtime.Equal(lstatTimes(t, filepath.Join(dst, "app.log")).mtime))
+
+	content, err = os.ReadFile(filepath.Join(dst, "data.bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, "source", string(content))
+
+	_, err = os.Lstat(filepath.Join(dst, "new.tmp"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(filepath.Join(dst, "old.tmp"))
+	assert.NoError(t, err)
+
+	report, err = syncer.Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+
+	verifyReport, err := syncer.Verify(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, verifyReport.Matches(), verifyReport.Mismatches)
+}
+
+func TestFsSyncer_comparePolicy(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "app.log"), []byte("log"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(tmp, "dir.log"), 0755))
+
+	s := New(WithPolicyByPattern(map[string]ComparePolicy{"*.log": CompareExclude, "app.*": CompareChecksum}))
+	info, err := os.Lstat(filepath.Join(tmp, "app.log"))
+	assert.NoError(t, err)
+	// Patterns are tried in lexical order
+	assert.Equal(t, CompareExclude, s.comparePolicy(info))
+
+	info, err = os.Lstat(filepath.Join(tmp, "dir.log"))
+	assert.NoError(t, err)
+	assert.Equal(t, CompareDefault, s.comparePolicy(info))
+}
@@ -0,0 +1,99 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WithDestinationPrefix option: the source is synced to the rel subdirectory
+// of the destination given to Sync, to mirror several sources into disjoint
+// subdirectories of a shared destination. Deletions are strictly scoped to the
+// prefix: rel must be a relative path inside the destination, and none of its
+// existing components may be a symlink.
+func WithDestinationPrefix(rel string) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.destinationPrefix = rel
+	}
+}
+
+// TrailingSlashSemantics option: like rsync, a source path without a trailing
+// slash is synced to the directory of the destination named like it, dst/src
+// for Sync(dst, "path/to/src"), while the contents of a source path with a
+// trailing slash are synced into dst. The name is added to the destination
+// prefix, deletions are scoped to it. Source paths ending with "." or ".."
+// are always synced as contents.
+func TrailingSlashSemantics(s *FsSyncer) {
+	s.trailingSlash = true
+}
+
+// ContentsOnly option: the contents of the source are synced into the
+// destination whether its path has a trailing slash or not, it's the default
+// behavior and cancels TrailingSlashSemantics
+func ContentsOnly(s *FsSyncer) {
+	s.trailingSlash = false
+}
+
+// forSource returns the syncer of the source path src: with
+// TrailingSlashSemantics, the name of a source without a trailing slash is
+// appended to the destination prefix. The returned syncer syncs contents
+// only, as the cleaned source is given to the nested syncs.
+func (s *FsSyncer) forSource(src string) *FsSyncer {
+	if !s.trailingSlash {
+		return s
+	}
+	syncer := *s
+	syncer.trailingSlash = false
+	if src == "" || os.IsPathSeparator(src[len(src)-1]) {
+		return &syncer
+	}
+	last := filepath.Base(src)
+	if last == "." || last == ".." || os.IsPathSeparator(last[0]) {
+		return &syncer
+	}
+	syncer.destinationPrefix = filepath.Join(s.destinationPrefix, filepath.Base(filepath.Clean(src)))
+	return &syncer
+}
+
+// prefixedDestination returns the directory of dst in which the source is
+// synced according to WithDestinationPrefix, see createPrefixParents
+func (s *FsSyncer) prefixedDestination(dst string) (string, error) {
+	if s.destinationPrefix == "" {
+		return dst, nil
+	}
+	rel := filepath.Clean(s.destinationPrefix)
+	if filepath.IsAbs(rel) || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errors.Errorf("invalid destination prefix %v, must be a relative path inside the destination", s.destinationPrefix)
+	}
+
+	path := dst
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, name)
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return "", errors.Wrapf(err, "fail to stat %v", path)
+		}
+		if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+			return "", errors.Errorf("invalid destination prefix %v, %v is a symlink", s.destinationPrefix, path)
+		}
+	}
+
+	return filepath.Join(dst, rel), nil
+}
+
+// createPrefixParents creates the missing parents of the prefixed destination
+// returned by prefixedDestination
+func (s *FsSyncer) createPrefixParents(prefixed string) error {
+	if s.destinationPrefix == "" {
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(prefixed), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "fail to create parents of %v", prefixed)
+	}
+	return nil
+}
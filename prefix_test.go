@@ -0,0 +1,97 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_DestinationPrefix(t *testing.T) {
+	t.Run("it should sync sources to disjoint subdirectories", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "other"), []byte("other"), 0644))
+
+		_, err = New(WithDestinationPrefix("apps/file")).Sync(dst, filepath.Join("test-fixtures", "src", "file"))
+		assert.NoError(t, err)
+		_, err = New(WithDestinationPrefix("apps/dir")).Sync(dst, filepath.Join("test-fixtures", "src", "dir"))
+		assert.NoError(t, err)
+
+		assert.FileExists(t, filepath.Join(dst, "other"))
+		assert.FileExists(t, filepath.Join(dst, "apps", "file", "a"))
+		assert.FileExists(t, filepath.Join(dst, "apps", "dir", "dir1", "file"))
+	})
+
+	tests := map[string]struct {
+		prefix string
+	}{
+		"it should refuse an absolute prefix":          {prefix: "/tmp"},
+		"it should refuse a prefix outside of dst":     {prefix: "apps/../../tmp"},
+		"it should refuse the destination itself":      {prefix: "apps/.."},
+		"it should refuse a prefix through a symlink":  {prefix: "link/app"},
+		"it should refuse a prefix which is a symlink": {prefix: "link"},
+	}
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dst)
+			assert.NoError(t, os.Symlink("/tmp", filepath.Join(dst, "link")))
+
+			_, err = New(WithDestinationPrefix(test.prefix)).Sync(dst, filepath.Join("test-fixtures", "src", "file"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFsSyncer_Sync_TrailingSlashSemantics(t *testing.T) {
+	src := filepath.Join("test-fixtures", "src", "file")
+	tests := map[string]struct {
+		src          string
+		syncOptions  []func(*FsSyncer)
+		expectedFile string
+	}{
+		"it should sync the contents of src by default": {
+			src: src, expectedFile: "a",
+		},
+		"it should sync src as a directory without trailing slash": {
+			src: src, syncOptions: []func(*FsSyncer){TrailingSlashSemantics}, expectedFile: filepath.Join("file", "a"),
+		},
+		"it should sync the contents of src with a trailing slash": {
+			src: src + "/", syncOptions: []func(*FsSyncer){TrailingSlashSemantics}, expectedFile: "a",
+		},
+		"it should sync the contents of src ending with a dot": {
+			src: src + "/.", syncOptions: []func(*FsSyncer){TrailingSlashSemantics}, expectedFile: "a",
+		},
+		"it should sync the contents of src with ContentsOnly": {
+			src: src, syncOptions: []func(*FsSyncer){TrailingSlashSemantics, ContentsOnly}, expectedFile: "a",
+		},
+		"it should add the name of src to the destination prefix": {
+			src: src, syncOptions: []func(*FsSyncer){TrailingSlashSemantics, WithDestinationPrefix("apps")}, expectedFile: filepath.Join("apps", "file", "a"),
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dst)
+			assert.NoError(t, os.WriteFile(filepath.Join(dst, "other"), []byte("other"), 0644))
+
+			_, err = New(test.syncOptions...).Sync(dst, test.src)
+			assert.NoError(t, err)
+			assert.FileExists(t, filepath.Join(dst, test.expectedFile))
+			if test.expectedFile != "a" {
+				// Deletions are scoped to the directory of src
+				assert.FileExists(t, filepath.Join(dst, "other"))
+			}
+
+			report, err := New(test.syncOptions...).SyncPaths(dst, test.src, []string{"."})
+			assert.NoError(t, err)
+			assert.True(t, report.Unchanged())
+		})
+	}
+}
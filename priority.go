@@ -0,0 +1,81 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// WithPriorityPaths option: the paths, relative to the source, are synced in
+// order before the rest of the source, then ready is called if not nil, so
+// that dependent processes can start while the rest of the source is synced.
+// Directories are synced with their content, missing paths are reported as
+// warnings.
+func WithPriorityPaths(paths []string, ready func()) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.priorityPaths = paths
+		s.priorityReady = ready
+	}
+}
+
+// syncPriorityPaths syncs the paths of WithPriorityPaths with their parents
+func (s *FsSyncer) syncPriorityPaths(state syncState, dst, src string) error {
+	if len(s.priorityPaths) == 0 && s.priorityReady == nil {
+		return nil
+	}
+	walkFunc := s.skipOtherFileSystems(state, src, s.syncWalkFunc(state, dst, src))
+	syncedParents := map[string]bool{}
+
+	for _, rel := range s.priorityPaths {
+		path := filepath.Join(src, rel)
+		if _, ok := trimPathPrefix(path, src); !ok || path == src {
+			state.report.warn("priority path %v is not in the source, ignored", rel)
+			continue
+		}
+		_, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			state.report.warn("priority path %v does not exist, ignored", rel)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to stat %v", path)
+		}
+
+		// Parents are synced first so that they're created with their mode
+		parents := []string{}
+		for parent := filepath.Dir(path); !syncedParents[parent]; parent = filepath.Dir(parent) {
+			parents = append([]string{parent}, parents...)
+			if parent == src {
+				break
+			}
+		}
+		skipped := false
+		for _, parent := range parents {
+			info, err := os.Lstat(parent)
+			if err != nil {
+				return errors.Wrapf(err, "fail to stat %v", parent)
+			}
+			err = walkFunc(parent, info, nil)
+			if err == filepath.SkipDir {
+				skipped = true
+				break
+			} else if err != nil {
+				return errors.Wrapf(err, "fail to sync %v", parent)
+			}
+			syncedParents[parent] = true
+		}
+		if skipped {
+			continue
+		}
+
+		err = s.walkSource(state, path, walkFunc)
+		if err != nil {
+			return errors.Wrapf(err, "fail to sync priority path %v", rel)
+		}
+	}
+
+	if s.priorityReady != nil {
+		s.priorityReady()
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_PriorityPaths(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "bin"), 0700))
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "assets"), 0755))
+	for _, path := range []string{"Procfile", "bin/app", "assets/a.css"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, path), []byte(path), 0644))
+	}
+
+	readyCalls := 0
+	ready := func() {
+		readyCalls++
+		assert.FileExists(t, filepath.Join(dst, "Procfile"))
+		assert.FileExists(t, filepath.Join(dst, "bin", "app"))
+		assert.NoDirExists(t, filepath.Join(dst, "assets"))
+	}
+	syncer := New(WithPriorityPaths([]string{"Procfile", "bin/app", "missing", "../outside"}, ready))
+	report, err := syncer.Sync(dst, src)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, readyCalls)
+	assert.Len(t, report.Warnings(), 2)
+	assert.FileExists(t, filepath.Join(dst, "assets", "a.css"))
+	info, err := os.Stat(filepath.Join(dst, "bin"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0700, info.Mode())
+	assert.Equal(t, 6, report.ChangeCount())
+}
@@ -0,0 +1,42 @@
+package fssync
+
+// MissingPrivilege is a Linux capability the process lacks, degrading a
+// feature of the syncer
+type MissingPrivilege struct {
+	Capability string
+	Feature    string
+}
+
+// MissingPrivileges lists the capabilities required by the enabled options
+// which are missing from the effective set of the process. Instead of running
+// as root, the process can be granted only CAP_CHOWN, CAP_DAC_READ_SEARCH and
+// CAP_FOWNER, for instance with setcap or systemd AmbientCapabilities. BSD
+// has no capabilities, they are all missing unless running as root.
+func (s *FsSyncer) MissingPrivileges() ([]MissingPrivilege, error) {
+	has, err := effectiveCapabilities()
+	if err != nil {
+		return nil, err
+	}
+
+	missing := []MissingPrivilege{}
+	if !has("CAP_DAC_READ_SEARCH") {
+		feature := "source files not readable by the current user make the sync fail"
+		if s.continueOnError {
+			feature = "source files not readable by the current user are skipped"
+		}
+		missing = append(missing, MissingPrivilege{Capability: "CAP_DAC_READ_SEARCH", Feature: feature})
+	}
+	if s.preserveOwnership || len(s.ownershipOverrides) > 0 {
+		if !has("CAP_CHOWN") {
+			missing = append(missing, MissingPrivilege{
+				Capability: "CAP_CHOWN", Feature: "ownership can't be preserved",
+			})
+		}
+		if !has("CAP_FOWNER") {
+			missing = append(missing, MissingPrivilege{
+				Capability: "CAP_FOWNER", Feature: "times can't be preserved on files owned by another user",
+			})
+		}
+	}
+	return missing, nil
+}
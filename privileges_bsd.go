@@ -0,0 +1,14 @@
+//go:build freebsd || openbsd
+
+package fssync
+
+import "os"
+
+// effectiveCapabilities returns a function telling if the process has the
+// privileges of the named Linux capability, which only root has on BSD
+func effectiveCapabilities() (func(capability string) bool, error) {
+	root := os.Geteuid() == 0
+	return func(string) bool {
+		return root
+	}, nil
+}
@@ -0,0 +1,27 @@
+package fssync
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+var capabilityNumbers = map[string]int{
+	"CAP_CHOWN":           unix.CAP_CHOWN,
+	"CAP_DAC_READ_SEARCH": unix.CAP_DAC_READ_SEARCH,
+	"CAP_FOWNER":          unix.CAP_FOWNER,
+}
+
+// effectiveCapabilities returns a function telling if the named capability is
+// in the effective set of the process
+func effectiveCapabilities() (func(capability string) bool, error) {
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{}
+	err := unix.Capget(&header, &data[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to get the capabilities of the process")
+	}
+	return func(capability string) bool {
+		n := capabilityNumbers[capability]
+		return data[n/32].Effective&(1<<uint(n%32)) != 0
+	}, nil
+}
@@ -0,0 +1,24 @@
+package fssync
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_MissingPrivileges(t *testing.T) {
+	missing, err := New(PreserveOwnership).MissingPrivileges()
+	assert.NoError(t, err)
+
+	capabilities := []string{}
+	for _, privilege := range missing {
+		capabilities = append(capabilities, privilege.Capability)
+	}
+	if os.Geteuid() == 0 {
+		assert.Empty(t, capabilities)
+	} else {
+		assert.Contains(t, capabilities, "CAP_CHOWN")
+		assert.Contains(t, capabilities, "CAP_DAC_READ_SEARCH")
+	}
+}
@@ -0,0 +1,90 @@
+package fssync
+
+import (
+	"time"
+)
+
+// WithProgress option: fn is called with the progress of the sync at most
+// once per interval while the source is walked and the extraneous files are
+// deleted, and once at the end of Sync, or of the Finalize stage of a
+// SyncPlan, to display it during long syncs. The bytes of a file are counted
+// once it is copied. SyncPaths and the partial syncs of Watch don't report
+// their progress.
+func WithProgress(interval time.Duration, fn func(Progress)) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.progressInterval = interval
+		s.progressFunc = fn
+	}
+}
+
+// Progress is the progress of a sync, see WithProgress
+type Progress struct {
+	// ScannedEntries is the number of source entries compared to the
+	// destination
+	ScannedEntries int
+	// CreatedEntries, UpdatedEntries and DeletedEntries are the number of
+	// entries of the destination created, replaced and deleted
+	CreatedEntries int
+	UpdatedEntries int
+	DeletedEntries int
+	CopiedBytes    int64
+	// CurrentPath is the source path being synced, or the destination path
+	// being deleted
+	CurrentPath string
+	// Done is true for the last call, at the end of the sync
+	Done bool
+}
+
+// progressTracker counts the progress of a sync, it's nil without
+// WithProgress
+type progressTracker struct {
+	progress Progress
+	reported time.Time
+}
+
+// trackScan counts the source path being synced
+func (s *FsSyncer) trackScan(state syncState, path string) {
+	if state.progress == nil {
+		return
+	}
+	state.progress.progress.ScannedEntries++
+	state.progress.progress.CurrentPath = path
+	s.reportProgress(state, false)
+}
+
+// trackChange counts the change of the destination entry dstPath
+func (s *FsSyncer) trackChange(state syncState, changeType ChangeType, dstPath string) {
+	if state.progress == nil {
+		return
+	}
+	switch changeType {
+	case ChangeCreate:
+		state.progress.progress.CreatedEntries++
+	case ChangeUpdate:
+		state.progress.progress.UpdatedEntries++
+	case ChangeDelete:
+		state.progress.progress.DeletedEntries++
+		state.progress.progress.CurrentPath = dstPath
+	}
+	s.reportProgress(state, false)
+}
+
+// reportProgress calls the function of WithProgress if the interval elapsed
+// since the previous call, or if done is true
+func (s *FsSyncer) reportProgress(state syncState, done bool) {
+	if state.progress == nil {
+		return
+	}
+	now := time.Now()
+	if !done && now.Sub(state.progress.reported) < s.progressInterval {
+		return
+	}
+	state.progress.reported = now
+	progress := state.progress.progress
+	progress.CopiedBytes = state.report.copiedBytes
+	progress.Done = done
+	if done {
+		progress.CurrentPath = ""
+	}
+	s.progressFunc(progress)
+}
@@ -0,0 +1,44 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_WithProgress(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "a"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "b"), []byte("new b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "b"), []byte("b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "c"), []byte("c"), 0644))
+
+	progresses := []Progress{}
+	_, err = New(WithProgress(0, func(progress Progress) {
+		progresses = append(progresses, progress)
+	})).Sync(dst, src)
+	assert.NoError(t, err)
+
+	if assert.NotEmpty(t, progresses) {
+		assert.Equal(t, Progress{
+			ScannedEntries: 4,
+			CreatedEntries: 2,
+			UpdatedEntries: 1,
+			DeletedEntries: 1,
+			CopiedBytes:    int64(len("a") + len("new b")),
+			Done:           true,
+		}, progresses[len(progresses)-1])
+		for _, progress := range progresses[:len(progresses)-1] {
+			assert.False(t, progress.Done)
+			assert.NotEmpty(t, progress.CurrentPath)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package fssync
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// WithProtectedPaths option: paths relative to the destination which are
+// owned by other tools (journals, locks, etc.). They are never deleted nor
+// overwritten, the source entries with the same path are skipped. Protecting
+// a directory protects its content. The temporary files of the syncer, the
+// manifest of WithManifest and the partial and temporary directories of
+// WithPartialDir and WithTempDir are always protected.
+func WithProtectedPaths(paths ...string) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		for _, path := range paths {
+			s.protectedPaths = append(s.protectedPaths, filepath.Clean(path))
+		}
+	}
+}
+
+// protectedDestinationPaths returns the set of protected paths of the dst
+// directory
+func (s *FsSyncer) protectedDestinationPaths(dst string) map[string]bool {
+	protected := map[string]bool{}
+	for _, path := range s.protectedPaths {
+		protected[filepath.Join(dst, path)] = true
+	}
+	// The manifest and the partial and temporary directories may be located in
+	// the destination
+	protectInDestination := func(path string) {
+		absDst, dstErr := filepath.Abs(dst)
+		absPath, pathErr := filepath.Abs(path)
+		if dstErr == nil && pathErr == nil {
+			if rel, ok := trimPathPrefix(absPath, absDst); ok {
+				protected[dst+rel] = true
+			}
+		}
+	}
+	if s.manifestPath != "" {
+		protectInDestination(s.manifestPath)
+	}
+	if s.partialDir != "" {
+		protectInDestination(s.partialDirectory(dst))
+	}
+	if s.tempDir != "" {
+		protectInDestination(s.tempDir)
+	}
+	return protected
+}
+
+// isProtected returns true if the destination path must not be deleted nor
+// overwritten, see WithProtectedPaths
+func (s *FsSyncer) isProtected(state syncState, path string) bool {
+	if isTmpFileName(filepath.Base(path)) {
+		return true
+	}
+	if len(state.protected) == 0 {
+		return false
+	}
+	for p := path; ; p = filepath.Dir(p) {
+		if state.protected[p] {
+			return true
+		}
+		if p == filepath.Dir(p) {
+			return false
+		}
+	}
+}
+
+// isTmpFileName returns true if name has been generated by tmpFileName
+func isTmpFileName(name string) bool {
+	const suffixLen = len("-123456789")
+	if !strings.HasPrefix(name, ".") || len(name) <= suffixLen+1 || name[len(name)-suffixLen] != '-' {
+		return false
+	}
+	for _, c := range name[len(name)-suffixLen+1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// rebaseProtectedPaths returns the protected paths of the syncer relative to
+// the rel subdirectory of the destination, to sync it on its own
+func (s *FsSyncer) rebaseProtectedPaths(rel string) []string {
+	rebased := []string{}
+	for _, path := range s.protectedPaths {
+		if sub, ok := trimPathPrefix(path, rel); ok {
+			rebased = append(rebased, "."+sub)
+		}
+	}
+	return rebased
+}
@@ -0,0 +1,65 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTmpFileName(t *testing.T) {
+	assert.True(t, isTmpFileName(filepath.Base(tmpFileName("dir", "file"))))
+	assert.True(t, isTmpFileName(".a-123456789"))
+	assert.False(t, isTmpFileName("a-123456789"))
+	assert.False(t, isTmpFileName(".a-12345678"))
+	assert.False(t, isTmpFileName(".a_123456789"))
+	assert.False(t, isTmpFileName(".-123456789"))
+}
+
+func TestFsSyncer_Sync_ProtectedPaths(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	files := map[string]string{
+		"src/a":                "a",
+		"src/journal":          "source journal",
+		"dst/journal":          "destination journal",
+		"dst/locks/a.lock":     "lock",
+		"dst/cache/keep":       "keep",
+		"dst/cache/extraneous": "extraneous",
+		"dst/.a-123456789":     "temporary file",
+		"dst/extraneous":       "extraneous",
+	}
+	for path, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmp, path)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmp, path), []byte(content), 0644))
+	}
+
+	report, err := New(
+		WithProtectedPaths("journal", "locks/", "cache/keep"),
+		WithManifest(filepath.Join(dst, "manifest.json")),
+	).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Len(t, report.Warnings(), 1)
+
+	content, err := os.ReadFile(filepath.Join(dst, "journal"))
+	assert.NoError(t, err)
+	assert.Equal(t, "destination journal", string(content))
+	for _, path := range []string{"a", "locks/a.lock", "cache/keep", ".a-123456789", "manifest.json"} {
+		assert.FileExists(t, filepath.Join(dst, path))
+	}
+	for _, path := range []string{"cache/extraneous", "extraneous"} {
+		assert.NoFileExists(t, filepath.Join(dst, path))
+		assert.True(t, report.HasChanged(filepath.Join(dst, path)))
+	}
+	assert.False(t, report.HasChanged(filepath.Join(dst, "cache")))
+}
+
+func TestFsSyncer_rebaseProtectedPaths(t *testing.T) {
+	s := New(WithProtectedPaths("app/journal", "app/tmp/", "other"))
+	assert.Equal(t, []string{"./journal", "./tmp"}, s.rebaseProtectedPaths("app"))
+	assert.Equal(t, []string{"."}, s.rebaseProtectedPaths("other"))
+}
@@ -0,0 +1,67 @@
+package fssync
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithRetry option: the operations on an entry failing with a transient
+// error (EINTR, EAGAIN, ESTALE or EBUSY), like the intermittent ESTALE errors
+// of NFS, are retried up to attempts times, waiting backoff before the first
+// retry and doubling it before each next one. The sync of a source entry, the
+// removal of an extraneous entry and the update of the times of an entry are
+// retried independently. The other errors fail the sync right away.
+func WithRetry(attempts int, backoff time.Duration) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.retryAttempts = attempts
+		s.retryBackoff = backoff
+	}
+}
+
+// isTransientError returns true if err may not happen again if the operation
+// is retried, see WithRetry
+func isTransientError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EINTR, syscall.EAGAIN, syscall.ESTALE, syscall.EBUSY} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// retry calls op until it succeeds, fails with an error which is not
+// transient or has been retried the number of attempts of WithRetry. path is
+// the entry op is applied to, for the logs.
+func (s *FsSyncer) retry(path string, op func() error) error {
+	backoff := s.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt > s.retryAttempts || !isTransientError(err) {
+			return err
+		}
+		s.log(slog.LevelWarn, "transient error, retrying", "path", path, "attempt", attempt, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// retryWalkFunc returns a walk function calling walk on each entry, retried
+// with WithRetry. The walk errors given to walk are not retried.
+func (s *FsSyncer) retryWalkFunc(walk filepath.WalkFunc) filepath.WalkFunc {
+	if s.retryAttempts <= 0 {
+		return walk
+	}
+	return func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return walk(path, info, err)
+		}
+		return s.retry(path, func() error {
+			return walk(path, info, nil)
+		})
+	}
+}
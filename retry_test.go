@@ -0,0 +1,58 @@
+package fssync
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_retry(t *testing.T) {
+	transient := errors.Wrap(&os.PathError{Op: "open", Path: "file", Err: syscall.ESTALE}, "fail to open src")
+
+	t.Run("it should retry the transient errors", func(t *testing.T) {
+		calls := 0
+		err := New(WithRetry(3, time.Millisecond)).retry("file", func() error {
+			calls++
+			if calls < 3 {
+				return transient
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("it should give up after the attempts", func(t *testing.T) {
+		calls := 0
+		err := New(WithRetry(2, time.Millisecond)).retry("file", func() error {
+			calls++
+			return transient
+		})
+		assert.ErrorIs(t, err, syscall.ESTALE)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("it should not retry the other errors", func(t *testing.T) {
+		calls := 0
+		err := New(WithRetry(2, time.Millisecond)).retry("file", func() error {
+			calls++
+			return os.ErrPermission
+		})
+		assert.ErrorIs(t, err, os.ErrPermission)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("it should not retry without WithRetry", func(t *testing.T) {
+		calls := 0
+		err := New().retry("file", func() error {
+			calls++
+			return transient
+		})
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
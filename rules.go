@@ -0,0 +1,174 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FilterRule is an include or exclude pattern of WithFilterRules
+type FilterRule struct {
+	// Include is true for the rules including the matching entries, false for
+	// the ones excluding them
+	Include bool
+	Pattern string
+}
+
+// IncludePattern returns the rule including the entries matching pattern
+func IncludePattern(pattern string) FilterRule {
+	return FilterRule{Include: true, Pattern: pattern}
+}
+
+// ExcludePattern returns the rule excluding the entries matching pattern
+func ExcludePattern(pattern string) FilterRule {
+	return FilterRule{Pattern: pattern}
+}
+
+// WithFilterRules option: the entries excluded by rules are neither copied
+// nor deleted from the destination and excluded directories are not walked,
+// like the --include and --exclude options of rsync. The rules are tried in
+// order on the path of each entry relative to the source, or to the
+// destination for the extraneous entries, the first matching rule applies and
+// the entries matching no rule are included. The patterns follow rsync:
+//
+//   - a pattern without slash matches the name of the entries at any depth
+//   - a pattern starting with a slash is anchored to the root of the sync,
+//     other patterns containing a slash match the end of the path
+//   - a pattern ending with a slash only matches directories
+//   - * matches any sequence of characters but slashes, ** any sequence, ?
+//     any character but a slash and [...] a character class
+//
+// Entries are included by default, so including "*.go" and excluding "*" only
+// syncs the .go files located at the root, as the directories are excluded
+// too unless "*/" is included first.
+func WithFilterRules(rules ...FilterRule) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.filterRules = nil
+		for _, rule := range rules {
+			s.filterRules = append(s.filterRules, compileFilterRule(rule))
+		}
+	}
+}
+
+type filterRule struct {
+	include bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+func compileFilterRule(rule FilterRule) filterRule {
+	pattern := rule.Pattern
+	compiled := filterRule{include: rule.Include}
+	if strings.HasSuffix(pattern, "/") {
+		compiled.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	prefix := "(^|/)"
+	if strings.HasPrefix(pattern, "/") {
+		prefix = "^"
+		pattern = strings.TrimLeft(pattern, "/")
+	}
+	re, err := regexp.Compile(prefix + globRegexp(pattern) + "$")
+	if err != nil {
+		// Invalid character classes, like [z-a], are matched literally
+		re = regexp.MustCompile(prefix + regexp.QuoteMeta(pattern) + "$")
+	}
+	compiled.re = re
+	return compiled
+}
+
+// globRegexp translates the wildcards of the rsync pattern to a regular
+// expression
+func globRegexp(pattern string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(pattern):
+			b.WriteString(regexp.QuoteMeta(pattern[i+1 : i+2]))
+			i++
+		case c == '[' && classEnd(pattern, i) > 0:
+			end := classEnd(pattern, i)
+			class := pattern[i+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// classEnd returns the index of the bracket closing the character class
+// opened at start in pattern, -1 if it's not closed
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	// A leading closing bracket is a member of the class
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		if pattern[i] == ']' {
+			return i
+		}
+	}
+	return -1
+}
+
+// isExcluded returns true if the entry at path, located in the root of the
+// sync, is excluded by WithFilterRules or deeper than WithMaxDepth
+func (s *FsSyncer) isExcluded(root, path string, isDir bool) bool {
+	if len(s.filterRules) == 0 && s.maxDepth == 0 || root == "" || path == root {
+		return false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	if s.isTooDeep(rel) {
+		return true
+	}
+	rel = filepath.ToSlash(filepath.Join(s.filterPrefix, rel))
+	for _, rule := range s.filterRules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(rel) {
+			return !rule.include
+		}
+	}
+	return false
+}
+
+// isExcludedPath returns true if path or one of its parent directories up to
+// root is excluded, for the paths synced without walking root. path is
+// stated to know if it's a directory.
+func (s *FsSyncer) isExcludedPath(root, path string) bool {
+	if len(s.filterRules) == 0 && s.maxDepth == 0 {
+		return false
+	}
+	info, err := os.Lstat(path)
+	if s.isExcluded(root, path, err == nil && info.IsDir()) {
+		return true
+	}
+	for p := filepath.Dir(path); p != root && p != filepath.Dir(p); p = filepath.Dir(p) {
+		if s.isExcluded(root, p, true) {
+			return true
+		}
+	}
+	return false
+}
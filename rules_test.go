@@ -0,0 +1,112 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_isExcluded(t *testing.T) {
+	tests := map[string]struct {
+		rules    []FilterRule
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		"it should match the name at any depth": {
+			rules: []FilterRule{ExcludePattern("*.log")}, path: "a/b/app.log", excluded: true,
+		},
+		"it should not match a wildcard across slashes": {
+			rules: []FilterRule{ExcludePattern("a*.log")}, path: "a/b.log",
+		},
+		"it should anchor the patterns starting with a slash": {
+			rules: []FilterRule{ExcludePattern("/cache")}, path: "app/cache",
+		},
+		"it should match an anchored pattern at the root": {
+			rules: []FilterRule{ExcludePattern("/cache")}, path: "cache", isDir: true, excluded: true,
+		},
+		"it should match the end of the path with a slash in the pattern": {
+			rules: []FilterRule{ExcludePattern("build/out")}, path: "app/build/out", excluded: true,
+		},
+		"it should only match directories with a trailing slash": {
+			rules: []FilterRule{ExcludePattern("tmp/")}, path: "tmp",
+		},
+		"it should match directories with a trailing slash": {
+			rules: []FilterRule{ExcludePattern("tmp/")}, path: "app/tmp", isDir: true, excluded: true,
+		},
+		"it should match across slashes with a double star": {
+			rules: []FilterRule{ExcludePattern("/app/**/*.o")}, path: "app/src/lib/main.o", excluded: true,
+		},
+		"it should match character classes": {
+			rules: []FilterRule{ExcludePattern("file[!0-4]")}, path: "file7", excluded: true,
+		},
+		"it should apply the first matching rule": {
+			rules: []FilterRule{IncludePattern("*.go"), ExcludePattern("*")}, path: "main.go",
+		},
+		"it should exclude the entries matching a later rule only": {
+			rules: []FilterRule{IncludePattern("*.go"), ExcludePattern("*")}, path: "README", excluded: true,
+		},
+		"it should match invalid classes literally": {
+			rules: []FilterRule{ExcludePattern("[z-a]")}, path: "[z-a]", excluded: true,
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			s := New(WithFilterRules(test.rules...))
+			root := "root"
+			assert.Equal(t, test.excluded, s.isExcluded(root, filepath.Join(root, test.path), test.isDir))
+		})
+	}
+}
+
+func TestFsSyncer_Sync_FilterRules(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	for _, path := range []string{"main.go", "README", "lib/lib.go", "lib/notes.txt", "cache/data.go"} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(src, path)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, path), []byte(path), 0644))
+	}
+	for _, path := range []string{"old.txt", "lib/old.go", "cache/local"} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dst, path)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, path), []byte(path), 0644))
+	}
+
+	syncer := New(WithFilterRules(ExcludePattern("/cache/"), IncludePattern("*/"), IncludePattern("*.go"), ExcludePattern("*")))
+	_, err = syncer.Sync(dst, src)
+	assert.NoError(t, err)
+
+	assert.FileExists(t, filepath.Join(dst, "main.go"))
+	assert.FileExists(t, filepath.Join(dst, "lib", "lib.go"))
+	assert.NoFileExists(t, filepath.Join(dst, "README"))
+	assert.NoFileExists(t, filepath.Join(dst, "lib", "notes.txt"))
+	assert.NoFileExists(t, filepath.Join(dst, "cache", "data.go"))
+	// Excluded extraneous entries are kept
+	assert.FileExists(t, filepath.Join(dst, "old.txt"))
+	assert.FileExists(t, filepath.Join(dst, "cache", "local"))
+	assert.NoFileExists(t, filepath.Join(dst, "lib", "old.go"))
+
+	report, err := syncer.Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+	verifyReport, err := syncer.Verify(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, verifyReport.Matches(), verifyReport.Mismatches)
+
+	t.Run("it should apply the rules to the paths of SyncPaths", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "lib", "new.go"), []byte("new"), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "lib", "new.txt"), []byte("new"), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "cache", "new.go"), []byte("new"), 0644))
+		_, err := syncer.SyncPaths(dst, src, []string{"lib", "cache/new.go"})
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dst, "lib", "new.go"))
+		assert.NoFileExists(t, filepath.Join(dst, "lib", "new.txt"))
+		assert.NoFileExists(t, filepath.Join(dst, "cache", "new.go"))
+	})
+}
@@ -0,0 +1,127 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrSandboxUnsupported is returned by the syncs with Sandboxed on the
+	// platforms without openat2(2), available since Linux 5.6
+	ErrSandboxUnsupported = errors.New("sandboxed syncs require openat2, available since Linux 5.6")
+	// ErrUnsafeDestination is returned with Sandboxed when a destination
+	// entry is located outside of the destination or behind a symlink, and
+	// with WithPartialDir when a partial directory or file is a symlink or is
+	// not owned by the syncer
+	ErrUnsafeDestination = errors.New("destination entry outside of the destination or behind a symlink")
+)
+
+// Sandboxed option: resolve the destination entries with openat2(2)
+// RESOLVE_BENEATH and RESOLVE_NO_SYMLINKS before writing them: their parent
+// directory is opened beneath the destination without following any symlink
+// and the entries are written relatively to it, a hostile or racing
+// destination tree can't redirect the writes outside of the destination by
+// swapping a directory with a symlink. The sync fails with
+// ErrUnsafeDestination if a destination directory is replaced by a symlink.
+// It also applies to SyncFromTreeManifest. It requires Linux 5.6 and /proc, the syncs fail with ErrSandboxUnsupported
+// otherwise.
+func Sandboxed(s *FsSyncer) {
+	s.sandboxed = true
+}
+
+// checkSandbox returns ErrSandboxUnsupported with Sandboxed if the writes to
+// the destination can't be sandboxed
+func (s *FsSyncer) checkSandbox() error {
+	if s.sandboxed && !sandboxSupported() {
+		return ErrSandboxUnsupported
+	}
+	return nil
+}
+
+// inDestination calls op with the path to write the destination entry located
+// at path. With Sandboxed, the parent directory of the entry is opened beneath
+// the destination and op gets a path relative to it in /proc. op must not
+// follow the entry itself if it's a symlink, see onDestinationEntry.
+func (s *FsSyncer) inDestination(state syncState, path string, op func(path string) error) error {
+	return s.beneath(state.dstRoot, path, op)
+}
+
+// beneath is inDestination for the entry located at path in the root
+// directory, which may not be the destination
+func (s *FsSyncer) beneath(root, path string, op func(path string) error) error {
+	if !s.sandboxed || path == root {
+		return op(path)
+	}
+	dir, err := openBeneath(root, filepath.Dir(path), true)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return op(filepath.Join(fdPath(dir.Fd()), filepath.Base(path)))
+}
+
+// onDestinationEntry calls op with the path to write the destination entry
+// located at path, for the operations following symlinks like chmod(2). With
+// Sandboxed, the entry itself is opened beneath the destination, a symlink
+// fails with ErrUnsafeDestination.
+func (s *FsSyncer) onDestinationEntry(state syncState, path string, op func(path string) error) error {
+	if !s.sandboxed || path == state.dstRoot {
+		return op(path)
+	}
+	entry, err := openBeneath(state.dstRoot, path, false)
+	if err != nil {
+		return err
+	}
+	defer entry.Close()
+	return op(fdPath(entry.Fd()))
+}
+
+// mkdirAllInDestination creates the path directory of the destination and its
+// missing parents like os.MkdirAll, each of them is created with
+// inDestination: with Sandboxed, an existing parent which is a symlink fails
+// with ErrUnsafeDestination instead of being followed.
+func (s *FsSyncer) mkdirAllInDestination(state syncState, path string, perm os.FileMode) error {
+	if !s.sandboxed {
+		return os.MkdirAll(path, perm)
+	}
+	return s.mkdirAllBeneath(state.dstRoot, path, perm, nil)
+}
+
+// mkdirAllBeneath creates the path directory located in the root directory
+// and its missing parents up to root, each of them with beneath. check, if
+// not nil, is called for each directory, created or not, with its path and
+// the path to access it once opened beneath root.
+func (s *FsSyncer) mkdirAllBeneath(root, path string, perm os.FileMode, check func(path, dir string) error) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return errors.Wrapf(ErrUnsafeDestination, "%v is not located in %v", path, root)
+	}
+	path = root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, name)
+		err := s.beneath(root, path, func(dir string) error {
+			err := os.Mkdir(dir, perm)
+			if err != nil && !os.IsExist(err) {
+				return err
+			}
+			if check == nil {
+				return nil
+			}
+			return check(path, dir)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fdPath is the path of the fd file descriptor in /proc, which resolves to the
+// entry it has been opened on
+func fdPath(fd uintptr) string {
+	return "/proc/self/fd/" + strconv.Itoa(int(fd))
+}
@@ -0,0 +1,56 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// sandboxSupported returns true if the kernel supports openat2(2)
+func sandboxSupported() bool {
+	fd, err := unix.Openat2(unix.AT_FDCWD, ".", &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH,
+	})
+	if err != nil {
+		return false
+	}
+	unix.Close(fd)
+	return true
+}
+
+// openBeneath opens path, located in the root directory, with O_PATH and
+// without resolving any symlink nor leaving root. If dir is true, path must be
+// a directory.
+func openBeneath(root, path string, dir bool) (*os.File, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, errors.Wrapf(ErrUnsafeDestination, "%v is not located in %v", path, root)
+	}
+	rootFd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open %v", root)
+	}
+	defer unix.Close(rootFd)
+
+	// Without O_NOFOLLOW, RESOLVE_NO_SYMLINKS also refuses path if it's a
+	// symlink: its /proc path would otherwise be followed by chmod
+	flags := uint64(unix.O_PATH | unix.O_CLOEXEC)
+	if dir {
+		flags |= unix.O_DIRECTORY
+	}
+	fd, err := unix.Openat2(rootFd, rel, &unix.OpenHow{
+		Flags:   flags,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	// ELOOP for the symlinks, EXDEV for the paths leaving root
+	if err == unix.ELOOP || err == unix.EXDEV {
+		return nil, errors.Wrapf(ErrUnsafeDestination, "fail to open %v", path)
+	} else if err != nil {
+		return nil, &os.PathError{Op: "openat2", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
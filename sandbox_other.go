@@ -0,0 +1,16 @@
+//go:build !linux
+
+package fssync
+
+import "os"
+
+// sandboxSupported returns false, openat2(2) is specific to Linux
+func sandboxSupported() bool {
+	return false
+}
+
+// openBeneath is not implemented, the syncs with Sandboxed fail with
+// ErrSandboxUnsupported
+func openBeneath(root, path string, dir bool) (*os.File, error) {
+	return nil, ErrSandboxUnsupported
+}
@@ -0,0 +1,56 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_Sandboxed(t *testing.T) {
+	if !sandboxSupported() {
+		_, err := New(Sandboxed).Sync("dst", "src")
+		assert.Equal(t, ErrSandboxUnsupported, err)
+		t.Skip("openat2 is not supported")
+	}
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	outside := filepath.Join(tmp, "outside")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "dir"), 0755))
+	assert.NoError(t, os.Mkdir(outside, 0755))
+
+	t.Run("it should sync the source", func(t *testing.T) {
+		other := filepath.Join(tmp, "other")
+		_, err := New(Sandboxed).Sync(other, src)
+		assert.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(other, "dir", "file"))
+		assert.NoError(t, err)
+		assert.Equal(t, "file", string(content))
+	})
+
+	t.Run("it should not write outside of the destination through a swapped symlink", func(t *testing.T) {
+		// The directory of the destination is replaced by a symlink once
+		// compared to the source
+		syncer := New(Sandboxed, WithHooks(Hooks{
+			OnFileStart: func(dstPath, srcPath string) {
+				if filepath.Base(dstPath) != "file" {
+					return
+				}
+				assert.NoError(t, os.Remove(filepath.Join(dst, "dir")))
+				assert.NoError(t, os.Symlink("../outside", filepath.Join(dst, "dir")))
+			},
+		}))
+		_, err := syncer.Sync(dst, src)
+		assert.Equal(t, ErrUnsafeDestination, errors.Cause(err))
+		entries, err := os.ReadDir(outside)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
@@ -0,0 +1,370 @@
+package fssync
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WithMemoryLimit option: bound to limit bytes the memory used to track the
+// synced files (times to set, hardlinks and changed files of the report).
+// Beyond it the tracked entries are moved to a temporary file, removed once
+// the sync and its report are released, at the cost of slower lookups. It is
+// meant to sync arbitrarily large trees in small containers. The state of the
+// other options (manifest, deduplication, case collisions) and the entries of
+// the directory being walked are still held in memory.
+func WithMemoryLimit(limit int64) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.memoryLimit = limit
+	}
+}
+
+const (
+	// spillBuckets is the number of buckets by which spilled entries are
+	// grouped in the temporary file, iterating over a spilled map loads one
+	// bucket at a time
+	spillBuckets = 256
+	// spillEntryOverhead is the estimated memory used by a map entry in
+	// addition to its key and value
+	spillEntryOverhead = 64
+)
+
+// memoryBudget is the memory shared by the spill maps of a sync, the largest
+// map is spilled to disk when the limit is exceeded
+type memoryBudget struct {
+	limit int64
+	used  int64
+	maps  []*spillMap
+	// first error encountered while reading or writing the temporary files,
+	// the sync fails with it once done
+	err error
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{limit: limit}
+}
+
+// reserve accounts n more bytes, which may be negative, and spills maps to
+// disk until the limit is respected
+func (b *memoryBudget) reserve(n int64) {
+	b.used += n
+	for b.limit > 0 && b.used > b.limit {
+		var largest *spillMap
+		for _, m := range b.maps {
+			if largest == nil || m.used > largest.used {
+				largest = m
+			}
+		}
+		if largest == nil || largest.used == 0 {
+			return
+		}
+		err := largest.spill()
+		if err != nil {
+			b.fail(err)
+			return
+		}
+	}
+}
+
+func (b *memoryBudget) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// spillRegion is the part of the temporary file where the entries of a bucket
+// have been written by a spill
+type spillRegion struct {
+	offset int64
+	size   int64
+}
+
+// spillMap is a string map whose entries are moved to a temporary file when
+// its memory budget is exceeded. Entries of the file are never rewritten, the
+// most recently set value of a key wins.
+type spillMap struct {
+	budget  *memoryBudget
+	entries map[string][]byte
+	used    int64
+	// file is removed from the filesystem once created, its content is freed
+	// when it is closed or garbage collected
+	file     *os.File
+	fileSize int64
+	// regions of each bucket written by each spill, oldest first
+	spills [][spillBuckets]spillRegion
+}
+
+// newSpillMap returns a map accounted in budget, a nil budget is unlimited
+func newSpillMap(budget *memoryBudget) *spillMap {
+	if budget == nil {
+		budget = newMemoryBudget(0)
+	}
+	m := &spillMap{budget: budget, entries: map[string][]byte{}}
+	budget.maps = append(budget.maps, m)
+	return m
+}
+
+func spillBucket(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % spillBuckets)
+}
+
+func (m *spillMap) set(key string, value []byte) {
+	cost := int64(len(key) + len(value) + spillEntryOverhead)
+	if previous, ok := m.entries[key]; ok {
+		cost = int64(len(value) - len(previous))
+	}
+	m.entries[key] = value
+	m.used += cost
+	m.budget.reserve(cost)
+}
+
+func (m *spillMap) get(key string) ([]byte, bool) {
+	if value, ok := m.entries[key]; ok {
+		return value, true
+	}
+	bucket := spillBucket(key)
+	for i := len(m.spills) - 1; i >= 0; i-- {
+		var found []byte
+		ok := false
+		err := m.readRegion(m.spills[i][bucket], func(k string, v []byte) {
+			if k == key {
+				found, ok = v, true
+			}
+		})
+		if err != nil {
+			m.budget.fail(err)
+			return nil, false
+		}
+		if ok {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+func (m *spillMap) has(key string) bool {
+	_, ok := m.get(key)
+	return ok
+}
+
+// empty returns true if no entry has been set
+func (m *spillMap) empty() bool {
+	return len(m.entries) == 0 && len(m.spills) == 0
+}
+
+// len returns the number of distinct keys
+func (m *spillMap) len() int {
+	if len(m.spills) == 0 {
+		return len(m.entries)
+	}
+	n := 0
+	m.each(func(string, []byte) error {
+		n++
+		return nil
+	})
+	return n
+}
+
+// each calls fn with the current value of each key until it returns an error.
+// The entries of a spilled map are loaded one bucket at a time. Entries set by
+// fn may not be iterated.
+func (m *spillMap) each(fn func(key string, value []byte) error) error {
+	// fn may make the map spill, which replaces its entries
+	current, spills := m.entries, m.spills
+	if len(spills) == 0 {
+		for key, value := range current {
+			err := fn(key, value)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	inMemory := make([][]string, spillBuckets)
+	for key := range current {
+		bucket := spillBucket(key)
+		inMemory[bucket] = append(inMemory[bucket], key)
+	}
+	for bucket := 0; bucket < spillBuckets; bucket++ {
+		entries := map[string][]byte{}
+		for _, spill := range spills {
+			err := m.readRegion(spill[bucket], func(k string, v []byte) {
+				entries[k] = v
+			})
+			if err != nil {
+				m.budget.fail(err)
+				return err
+			}
+		}
+		for _, key := range inMemory[bucket] {
+			entries[key] = current[key]
+		}
+		for key, value := range entries {
+			err := fn(key, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spill appends the entries held in memory to the temporary file, grouped by
+// bucket, and frees them
+func (m *spillMap) spill() error {
+	if m.file == nil {
+		fd, err := os.CreateTemp("", "fssync-spill")
+		if err != nil {
+			return errors.Wrapf(err, "fail to create temporary file to spill memory")
+		}
+		err = os.Remove(fd.Name())
+		if err != nil {
+			fd.Close()
+			return errors.Wrapf(err, "fail to remove temporary file %v", fd.Name())
+		}
+		m.file = fd
+	}
+
+	buckets := make([][]string, spillBuckets)
+	for key := range m.entries {
+		bucket := spillBucket(key)
+		buckets[bucket] = append(buckets[bucket], key)
+	}
+	var regions [spillBuckets]spillRegion
+	w := bufio.NewWriter(io.NewOffsetWriter(m.file, m.fileSize))
+	buf := make([]byte, binary.MaxVarintLen64)
+	for bucket, keys := range buckets {
+		regions[bucket].offset = m.fileSize
+		for _, key := range keys {
+			value := m.entries[key]
+			for _, field := range [][]byte{[]byte(key), value} {
+				n := binary.PutUvarint(buf, uint64(len(field)))
+				w.Write(buf[:n])
+				w.Write(field)
+				m.fileSize += int64(n + len(field))
+			}
+		}
+		regions[bucket].size = m.fileSize - regions[bucket].offset
+	}
+	err := w.Flush()
+	if err != nil {
+		return errors.Wrapf(err, "fail to spill memory to temporary file")
+	}
+
+	m.spills = append(m.spills, regions)
+	m.entries = map[string][]byte{}
+	m.budget.used -= m.used
+	m.used = 0
+	return nil
+}
+
+// readRegion calls fn with each entry written in the region of the temporary
+// file
+func (m *spillMap) readRegion(region spillRegion, fn func(key string, value []byte)) error {
+	if region.size == 0 {
+		return nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(m.file, region.offset, region.size))
+	readField := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		field := make([]byte, n)
+		_, err = io.ReadFull(r, field)
+		return field, err
+	}
+	for {
+		key, err := readField()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to read spilled memory from temporary file")
+		}
+		value, err := readField()
+		if err != nil {
+			return errors.Wrapf(err, "fail to read spilled memory from temporary file")
+		}
+		fn(string(key), value)
+	}
+}
+
+// spillTimes maps destination paths to the times to give them
+type spillTimes struct {
+	*spillMap
+}
+
+func newSpillTimes(budget *memoryBudget) spillTimes {
+	return spillTimes{newSpillMap(budget)}
+}
+
+func (m spillTimes) set(path string, times statTimes) {
+	value := make([]byte, 16)
+	binary.LittleEndian.PutUint64(value, uint64(times.atime.UnixNano()))
+	binary.LittleEndian.PutUint64(value[8:], uint64(times.mtime.UnixNano()))
+	m.spillMap.set(path, value)
+}
+
+func decodeSpillTimes(value []byte) statTimes {
+	return statTimes{
+		atime: time.Unix(0, int64(binary.LittleEndian.Uint64(value))),
+		mtime: time.Unix(0, int64(binary.LittleEndian.Uint64(value[8:]))),
+	}
+}
+
+func (m spillTimes) get(path string) (statTimes, bool) {
+	value, ok := m.spillMap.get(path)
+	if !ok {
+		return statTimes{}, false
+	}
+	return decodeSpillTimes(value), true
+}
+
+func (m spillTimes) each(fn func(path string, times statTimes) error) error {
+	return m.spillMap.each(func(path string, value []byte) error {
+		return fn(path, decodeSpillTimes(value))
+	})
+}
+
+// spillLinks maps source inodes to the first path they have been synced to
+type spillLinks struct {
+	*spillMap
+}
+
+func newSpillLinks(budget *memoryBudget) spillLinks {
+	return spillLinks{newSpillMap(budget)}
+}
+
+func (m spillLinks) set(ino uint64, path string) {
+	m.spillMap.set(strconv.FormatUint(ino, 10), []byte(path))
+}
+
+func (m spillLinks) get(ino uint64) (string, bool) {
+	value, ok := m.spillMap.get(strconv.FormatUint(ino, 10))
+	return string(value), ok
+}
+
+// spillSet is a set of paths
+type spillSet struct {
+	*spillMap
+}
+
+func newSpillSet(budget *memoryBudget) spillSet {
+	return spillSet{newSpillMap(budget)}
+}
+
+func (m spillSet) add(path string) {
+	if _, ok := m.entries[path]; ok {
+		return
+	}
+	m.spillMap.set(path, []byte{})
+}
@@ -0,0 +1,90 @@
+package fssync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpillMap(t *testing.T) {
+	budget := newMemoryBudget(1024)
+	m := newSpillMap(budget)
+	other := newSpillMap(budget)
+	for i := 0; i < 100; i++ {
+		m.set(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	// Values set again override the spilled ones
+	for i := 0; i < 100; i += 10 {
+		m.set(fmt.Sprintf("key-%d", i), []byte("updated"))
+	}
+	other.set("other", []byte("value"))
+	assert.NoError(t, budget.err)
+	assert.NotEmpty(t, m.spills)
+	assert.LessOrEqual(t, budget.used, budget.limit)
+
+	value, ok := m.get("key-42")
+	assert.True(t, ok)
+	assert.Equal(t, "value-42", string(value))
+	value, ok = m.get("key-30")
+	assert.True(t, ok)
+	assert.Equal(t, "updated", string(value))
+	_, ok = m.get("missing")
+	assert.False(t, ok)
+	assert.True(t, other.has("other"))
+
+	assert.Equal(t, 100, m.len())
+	entries := map[string]string{}
+	assert.NoError(t, m.each(func(key string, value []byte) error {
+		entries[key] = string(value)
+		return nil
+	}))
+	assert.Len(t, entries, 100)
+	assert.Equal(t, "updated", entries["key-90"])
+	assert.Equal(t, "value-91", entries["key-91"])
+}
+
+func TestFsSyncer_Sync_MemoryLimit(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(src, fmt.Sprintf("dir-%d", i))
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+		for j := 0; j < 10; j++ {
+			path := filepath.Join(dir, fmt.Sprintf("file-%d", j))
+			assert.NoError(t, os.WriteFile(path, []byte(path), 0644))
+			assert.NoError(t, os.Chtimes(path, mtime, mtime))
+		}
+		assert.NoError(t, os.Link(filepath.Join(dir, "file-0"), filepath.Join(dir, "link")))
+		assert.NoError(t, os.Chtimes(dir, mtime, mtime))
+	}
+
+	dst := filepath.Join(tmp, "dst")
+	report, err := New(WithMemoryLimit(4096)).Sync(dst, src)
+	assert.NoError(t, err)
+	// The destination directory, the 20 directories and their 11 entries
+	assert.Equal(t, 1+20*12, report.ChangeCount())
+	assert.True(t, report.HasChanged(filepath.Join(dst, "dir-7", "file-3")))
+
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(dst, fmt.Sprintf("dir-%d", i))
+		assert.True(t, mtime.Equal(modTime(t, dir)))
+		assert.True(t, mtime.Equal(modTime(t, filepath.Join(dir, "file-9"))))
+		fileInfo, err := os.Stat(filepath.Join(dir, "file-0"))
+		assert.NoError(t, err)
+		linkInfo, err := os.Stat(filepath.Join(dir, "link"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(fileInfo, linkInfo))
+	}
+
+	report, err = New(WithMemoryLimit(4096)).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+}
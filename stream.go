@@ -0,0 +1,35 @@
+package fssync
+
+// SyncStream syncs src to dst like Sync in a new goroutine and sends each
+// change of the destination to the changes channel as soon as it is made,
+// for the consumers forwarding them to a message bus without holding all of
+// them, unlike WithEventPublisher. The sync waits for each change to be
+// received: changes must be read until it is closed, at the end of the sync.
+// The error of the sync, nil if it succeeded, is then sent to errs.
+func (s *FsSyncer) SyncStream(dst, src string) (<-chan Change, <-chan error) {
+	changes := make(chan Change)
+	errs := make(chan error, 1)
+
+	syncer := *s
+	hooks := s.hooks
+	syncer.hooks.OnFileSynced = func(change Change) {
+		if hooks.OnFileSynced != nil {
+			hooks.OnFileSynced(change)
+		}
+		changes <- change
+	}
+	syncer.hooks.OnFileDeleted = func(path string) {
+		if hooks.OnFileDeleted != nil {
+			hooks.OnFileDeleted(path)
+		}
+		changes <- Change{Type: ChangeDelete, Path: path}
+	}
+
+	go func() {
+		_, err := syncer.Sync(dst, src)
+		close(changes)
+		errs <- err
+		close(errs)
+	}()
+	return changes, errs
+}
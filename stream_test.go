@@ -0,0 +1,49 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_SyncStream(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous"), []byte("extraneous"), 0644))
+
+	t.Run("it should stream the changes then the result of the sync", func(t *testing.T) {
+		synced := []string{}
+		changes, errs := New(WithHooks(Hooks{
+			OnFileSynced: func(change Change) {
+				synced = append(synced, change.Path)
+			},
+		})).SyncStream(dst, src)
+
+		received := []Change{}
+		for change := range changes {
+			received = append(received, change)
+		}
+		assert.NoError(t, <-errs)
+		assert.Equal(t, []Change{
+			{Type: ChangeCreate, Path: filepath.Join(dst, "file"), SrcPath: filepath.Join(src, "file")},
+			{Type: ChangeDelete, Path: filepath.Join(dst, "extraneous")},
+		}, received)
+		// The hooks of the syncer are still called
+		assert.Equal(t, []string{filepath.Join(dst, "file")}, synced)
+	})
+
+	t.Run("it should send the error of the sync", func(t *testing.T) {
+		changes, errs := New().SyncStream(dst, filepath.Join(tmp, "missing"))
+		for range changes {
+		}
+		assert.Error(t, <-errs)
+	})
+}
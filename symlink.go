@@ -0,0 +1,246 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// SymlinkMode defines how the symlinks of the source are synced
+type SymlinkMode int
+
+const (
+	// SymlinkPreserve recreates the symlinks on the destination, targets
+	// containing the source path are rewritten to the destination path. This
+	// is the default.
+	SymlinkPreserve SymlinkMode = iota
+	// SymlinkDereference copies the content of the files targeted by the
+	// symlinks, symlinks to directories are preserved
+	SymlinkDereference
+	// SymlinkSkip ignores the symlinks
+	SymlinkSkip
+	// SymlinkFollow copies the content of the files and of the directories
+	// targeted by the symlinks, like cp -L, for the destinations not
+	// supporting symlinks. The symlinks targeting one of their parent
+	// directories are skipped with a warning. Verify and SyncToTar dereference
+	// the symlinks to files only.
+	SymlinkFollow
+)
+
+// WithSymlinkMode option: lets you configure how the symlinks of the source
+// are synced
+// Default is SymlinkPreserve
+func WithSymlinkMode(mode SymlinkMode) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.symlinkMode = mode
+	}
+}
+
+// NoSymlinkRewrite option: targets of the preserved symlinks are copied
+// verbatim, by default the targets located in the source are rewritten to
+// target the destination
+func NoSymlinkRewrite(s *FsSyncer) {
+	s.noSymlinkRewrite = true
+}
+
+// RelativeSymlinks option: targets of the preserved symlinks containing the
+// source path are rewritten relatively to the symlink instead of targeting the
+// destination path, so that the destination remains valid when it is moved or
+// bind-mounted elsewhere. Other targets are copied verbatim.
+func RelativeSymlinks(s *FsSyncer) {
+	s.relativeSymlinks = true
+}
+
+// SafeLinks option: symlinks of the source whose target resolves outside of
+// the source directory are skipped and listed with UnsafeSymlinks in the
+// report, like rsync --safe-links. It prevents untrusted sources from
+// planting links to files of the host such as /etc/shadow.
+func SafeLinks(s *FsSyncer) {
+	s.safeLinks = true
+}
+
+// resolveSymlink returns the info of the source entry at path to sync
+// according to the symlink mode, skip is true if the entry must not be synced
+func (s *FsSyncer) resolveSymlink(src, path string, info os.FileInfo, report *fsSyncReport) (os.FileInfo, bool, error) {
+	if info.Mode()&os.ModeSymlink != os.ModeSymlink {
+		return info, false, nil
+	}
+	if s.symlinkMode == SymlinkSkip {
+		return info, true, nil
+	}
+	if s.safeLinks && !isSafeSymlink(src, path) {
+		report.unsafeSymlinks = append(report.unsafeSymlinks, path)
+		return info, true, nil
+	}
+	switch s.symlinkMode {
+	case SymlinkDereference, SymlinkFollow:
+		targetInfo, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			report.warn("target of symlink %v does not exist, skipped", path)
+			return info, true, nil
+		} else if err != nil {
+			return info, false, errors.Wrapf(err, "fail to stat target of symlink %v", path)
+		}
+		if targetInfo.IsDir() && s.symlinkMode == SymlinkDereference {
+			return info, false, nil
+		}
+		return targetInfo, false, nil
+	}
+	return info, false, nil
+}
+
+func isSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink == os.ModeSymlink
+}
+
+// symlinkTarget returns the target to give to the destination symlink of the
+// src symlink
+func (s *FsSyncer) symlinkTarget(src, dst syncInfo) (string, error) {
+	target, err := os.Readlink(src.path)
+	if err != nil {
+		err = sourceReadError(err)
+		return "", errors.Wrapf(err, "fail to get link destination of src %v", src.path)
+	}
+	if s.noSymlinkRewrite {
+		return target, nil
+	}
+	if s.relativeSymlinks {
+		return relativeSymlinkTarget(target, src.base, src.path), nil
+	}
+	return rewriteSymlinkTarget(target, src.base, dst.base), nil
+}
+
+// linkSymlink hardlinks the symlink synced from src to dst to existingLink,
+// the destination symlink of another link of the same source inode. Hardlinks
+// share their target, so the symlink is linked only if its destination target
+// is the one of existingLink, which may differ when targets are rewritten
+// relatively to the symlinks. false is returned if the symlink must be
+// recreated instead, including when the filesystem refuses to link symlinks.
+func (s *FsSyncer) linkSymlink(state syncState, src, dst syncInfo, existingLink string) (bool, error) {
+	target, err := s.symlinkTarget(src, dst)
+	if err != nil {
+		return false, err
+	}
+	existingTarget, err := os.Readlink(existingLink)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to get link destination of %v", existingLink)
+	}
+	if target != existingTarget {
+		return false, nil
+	}
+	err = s.linkInDestination(state, existingLink, dst.path)
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EMLINK) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "fail to create link from %v to %v", existingLink, dst.path)
+	}
+	return true, nil
+}
+
+// isSafeSymlink returns true if the target of the symlink at path resolves in
+// the src directory. The target is resolved with the symlinks it goes through,
+// dangling targets are resolved lexically from the resolved link directory.
+func isSafeSymlink(src, path string) bool {
+	root, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return false
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if os.IsNotExist(err) {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false
+		}
+		dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return false
+		}
+		resolved = target
+		if !filepath.IsAbs(target) {
+			resolved = filepath.Join(dir, target)
+		}
+	} else if err != nil {
+		// Symlink loops are considered unsafe
+		return false
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return false
+	}
+
+	_, ok := trimPathPrefix(resolved, root)
+	return ok
+}
+
+// rewriteSymlinkTarget rewrites a symlink target located in the srcBase
+// directory to target the same path in the dstBase directory. Absolute
+// targets are also compared to the absolute path of srcBase.
+func rewriteSymlinkTarget(target, srcBase, dstBase string) string {
+	if rel, ok := trimPathPrefix(target, srcBase); ok {
+		return dstBase + rel
+	}
+	if filepath.IsAbs(target) && !filepath.IsAbs(srcBase) {
+		absSrcBase, err := filepath.Abs(srcBase)
+		if err != nil {
+			return target
+		}
+		absDstBase, err := filepath.Abs(dstBase)
+		if err != nil {
+			return target
+		}
+		if rel, ok := trimPathPrefix(target, absSrcBase); ok {
+			return absDstBase + rel
+		}
+	}
+	return target
+}
+
+// relativeSymlinkTarget rewrites the target of the symlink at path, located in
+// the srcBase directory, relatively to the symlink when it contains the
+// srcBase path, like rewriteSymlinkTarget. Absolute targets are also compared
+// to the absolute path of srcBase.
+func relativeSymlinkTarget(target, srcBase, path string) string {
+	if _, ok := trimPathPrefix(target, srcBase); !ok {
+		if !filepath.IsAbs(target) {
+			return target
+		}
+		absSrcBase, err := filepath.Abs(srcBase)
+		if err != nil {
+			return target
+		}
+		if _, ok := trimPathPrefix(target, absSrcBase); !ok {
+			return target
+		}
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return target
+		}
+	}
+	rel, err := filepath.Rel(filepath.Dir(path), target)
+	if err != nil {
+		return target
+	}
+	return rel
+}
+
+// trimPathPrefix removes the prefix directory from path if path is prefix or
+// is located in prefix, unlike strings.TrimPrefix which would also match a
+// partial name
+func trimPathPrefix(path, prefix string) (string, bool) {
+	if path == prefix {
+		return "", true
+	}
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	if strings.HasPrefix(path, dir) {
+		return path[len(dir)-1:], true
+	}
+	return "", false
+}
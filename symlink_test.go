@@ -0,0 +1,364 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_SymlinkMode(t *testing.T) {
+	src := filepath.Join("test-fixtures", "src", "relative-symlink")
+
+	t.Run("it should preserve symlinks by default", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+
+		_, err = New().Sync(dst, src)
+		assert.NoError(t, err)
+		target, err := os.Readlink(filepath.Join(dst, "symlink"))
+		assert.NoError(t, err)
+		assert.Equal(t, "./a", target)
+	})
+
+	t.Run("it should copy the target content with SymlinkDereference", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+		syncer := New(WithSymlinkMode(SymlinkDereference))
+
+		_, err = syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		info, err := os.Lstat(filepath.Join(dst, "symlink"))
+		assert.NoError(t, err)
+		assert.True(t, info.Mode().IsRegular())
+		expected, err := os.ReadFile(filepath.Join(src, "a"))
+		assert.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(dst, "symlink"))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, content)
+
+		t.Run("it should not change anything on the next sync", func(t *testing.T) {
+			report, err := syncer.Sync(dst, src)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, report.ChangeCount())
+		})
+	})
+
+	t.Run("it should copy the target verbatim with NoSymlinkRewrite", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+		src := filepath.Join("test-fixtures", "src", "local-symlink")
+
+		_, err = New(NoSymlinkRewrite).Sync(dst, src)
+		assert.NoError(t, err)
+		target, err := os.Readlink(filepath.Join(dst, "symlink"))
+		assert.NoError(t, err)
+		assert.Equal(t, "test-fixtures/src/local-symlink/a", target)
+	})
+
+	t.Run("it should skip dangling symlinks with SymlinkDereference", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+
+		report, err := New(WithSymlinkMode(SymlinkDereference)).Sync(dst, filepath.Join("test-fixtures", "src", "local-symlink"))
+		assert.NoError(t, err)
+		assert.Len(t, report.Warnings(), 1)
+		assert.NoFileExists(t, filepath.Join(dst, "symlink"))
+	})
+
+	t.Run("it should ignore symlinks with SymlinkSkip", func(t *testing.T) {
+		dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dst)
+
+		_, err = New(WithSymlinkMode(SymlinkSkip)).Sync(dst, src)
+		assert.NoError(t, err)
+		_, err = os.Lstat(filepath.Join(dst, "symlink"))
+		assert.True(t, os.IsNotExist(err))
+		assert.FileExists(t, filepath.Join(dst, "a"))
+	})
+}
+
+func TestRewriteSymlinkTarget(t *testing.T) {
+	tests := map[string]struct {
+		target   string
+		expected string
+	}{
+		"a target in the source": {
+			target:   "/data/src/a",
+			expected: "/data/dst/a",
+		},
+		"the source itself": {
+			target:   "/data/src",
+			expected: "/data/dst",
+		},
+		"a target sharing a prefix with the source": {
+			target:   "/data/src-backup/a",
+			expected: "/data/src-backup/a",
+		},
+		"a target containing the source": {
+			target:   "/mnt/data/src/a",
+			expected: "/mnt/data/src/a",
+		},
+		"a relative target": {
+			target:   "../a",
+			expected: "../a",
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			assert.Equal(t, test.expected, rewriteSymlinkTarget(test.target, "/data/src", "/data/dst"))
+		})
+	}
+
+	t.Run("it should rewrite every absolute target when syncing the root", func(t *testing.T) {
+		assert.Equal(t, "/data/dst/etc/hosts", rewriteSymlinkTarget("/etc/hosts", "/", "/data/dst"))
+	})
+}
+
+func TestFsSyncer_Sync_SafeLinks(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.Mkdir(src, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+	links := map[string]string{
+		"safe":          "a",
+		"safe-dangling": "missing",
+		"dir":           ".",
+		"parent":        "..",
+		"absolute":      "/etc/passwd",
+		"dangling":      "../../missing",
+		"through-dir":   "dir/..",
+	}
+	for name, target := range links {
+		assert.NoError(t, os.Symlink(target, filepath.Join(src, name)))
+	}
+
+	dst := filepath.Join(tmp, "dst")
+	report, err := New(SafeLinks).Sync(dst, src)
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{
+		filepath.Join(src, "parent"),
+		filepath.Join(src, "absolute"),
+		filepath.Join(src, "dangling"),
+		filepath.Join(src, "through-dir"),
+	}, report.UnsafeSymlinks())
+	for _, name := range []string{"safe", "safe-dangling", "dir"} {
+		_, err := os.Lstat(filepath.Join(dst, name))
+		assert.NoError(t, err, name)
+	}
+	for _, name := range []string{"parent", "absolute", "dangling", "through-dir"} {
+		_, err := os.Lstat(filepath.Join(dst, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestFsSyncer_Sync_RelativeSymlinks(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	absFile, err := filepath.Abs(filepath.Join(src, "file"))
+	assert.NoError(t, err)
+	links := map[string]string{
+		"dir/absolute": absFile,
+		"dir/source":   filepath.Join(src, "file"),
+		"dir/relative": "../file",
+		"dir/outside":  "/etc/hostname",
+	}
+	for name, target := range links {
+		assert.NoError(t, os.Symlink(target, filepath.Join(src, name)))
+	}
+
+	dst := filepath.Join(tmp, "dst")
+	syncer := New(RelativeSymlinks)
+	_, err = syncer.Sync(dst, src)
+	assert.NoError(t, err)
+
+	expected := map[string]string{
+		"dir/absolute": "../file",
+		"dir/source":   "../file",
+		"dir/relative": "../file",
+		"dir/outside":  "/etc/hostname",
+	}
+	for name, expectedTarget := range expected {
+		target, err := os.Readlink(filepath.Join(dst, name))
+		assert.NoError(t, err)
+		assert.Equal(t, expectedTarget, target, name)
+	}
+
+	// The links remain valid once the destination is moved
+	moved := filepath.Join(tmp, "moved")
+	assert.NoError(t, os.Rename(dst, moved))
+	content, err := os.ReadFile(filepath.Join(moved, "dir", "absolute"))
+	assert.NoError(t, err)
+	assert.Equal(t, "file", string(content))
+
+	report, err := syncer.Sync(moved, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+}
+
+func TestFsSyncer_Sync_HardlinkedSymlinks(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	absFile, err := filepath.Abs(filepath.Join(src, "file"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Symlink("file", filepath.Join(src, "link")))
+	assert.NoError(t, os.Symlink(absFile, filepath.Join(src, "absolute")))
+	// os.Link doesn't follow symlinks, the symlink inodes are linked
+	assert.NoError(t, os.Link(filepath.Join(src, "link"), filepath.Join(src, "link-2")))
+	assert.NoError(t, os.Link(filepath.Join(src, "absolute"), filepath.Join(src, "dir", "absolute-2")))
+
+	sameFile := func(t *testing.T, path1, path2 string) bool {
+		info1, err := os.Lstat(path1)
+		assert.NoError(t, err)
+		info2, err := os.Lstat(path2)
+		assert.NoError(t, err)
+		return os.SameFile(info1, info2)
+	}
+
+	t.Run("it should link the symlinks with the same target together", func(t *testing.T) {
+		dst := filepath.Join(tmp, "dst")
+		defer os.RemoveAll(dst)
+
+		syncer := New(NoSymlinkRewrite)
+		_, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, sameFile(t, filepath.Join(dst, "link"), filepath.Join(dst, "link-2")))
+		assert.True(t, sameFile(t, filepath.Join(dst, "absolute"), filepath.Join(dst, "dir", "absolute-2")))
+		target, err := os.Readlink(filepath.Join(dst, "link-2"))
+		assert.NoError(t, err)
+		assert.Equal(t, "file", target)
+
+		report, err := syncer.Verify(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, report.Matches())
+	})
+
+	t.Run("it should recreate the symlinks rewritten to different targets", func(t *testing.T) {
+		dst := filepath.Join(tmp, "dst")
+		defer os.RemoveAll(dst)
+
+		syncer := New(RelativeSymlinks)
+		_, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, sameFile(t, filepath.Join(dst, "link"), filepath.Join(dst, "link-2")))
+		assert.False(t, sameFile(t, filepath.Join(dst, "absolute"), filepath.Join(dst, "dir", "absolute-2")))
+		expected := map[string]string{"absolute": "file", "dir/absolute-2": "../file"}
+		for name, expectedTarget := range expected {
+			target, err := os.Readlink(filepath.Join(dst, name))
+			assert.NoError(t, err)
+			assert.Equal(t, expectedTarget, target, name)
+		}
+
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, report.Unchanged())
+		verifyReport, err := syncer.Verify(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, verifyReport.Matches())
+	})
+}
+
+func TestFsSyncer_Sync_SymlinkMetadata(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing ownership requires root privileges")
+	}
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("file"), 0644))
+	link := filepath.Join(src, "link")
+	assert.NoError(t, os.Symlink("file", link))
+	assert.NoError(t, os.Lchown(link, 1000, 1001))
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, lutimes(link, mtime, mtime))
+
+	dst := filepath.Join(tmp, "dst")
+	syncer := New(PreserveOwnership)
+	_, err = syncer.Sync(dst, src)
+	assert.NoError(t, err)
+
+	linkInfo, err := os.Lstat(filepath.Join(dst, "link"))
+	assert.NoError(t, err)
+	assert.True(t, mtime.Equal(linkInfo.ModTime()))
+	assert.Equal(t, uint32(1000), sysStatOf(t, linkInfo).Uid)
+	assert.Equal(t, uint32(1001), sysStatOf(t, linkInfo).Gid)
+	// The target keeps its own ownership and times
+	fileInfo, err := os.Lstat(filepath.Join(dst, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), sysStatOf(t, fileInfo).Uid)
+	assert.False(t, mtime.Equal(fileInfo.ModTime()))
+
+	report, err := syncer.Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+	verifyReport, err := syncer.Verify(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, verifyReport.Matches())
+}
+
+func TestFsSyncer_Sync_SymlinkFollow(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0644))
+	assert.NoError(t, os.Symlink("dir", filepath.Join(src, "link-dir")))
+	assert.NoError(t, os.Symlink(filepath.Join("dir", "file"), filepath.Join(src, "link-file")))
+	assert.NoError(t, os.Symlink("..", filepath.Join(src, "dir", "up")))
+	assert.NoError(t, os.Symlink("missing", filepath.Join(src, "broken")))
+
+	dst := filepath.Join(tmp, "dst")
+	syncer := New(WithSymlinkMode(SymlinkFollow))
+	report, err := syncer.Sync(dst, src)
+	assert.NoError(t, err)
+
+	info, err := os.Lstat(filepath.Join(dst, "link-dir"))
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+	content, err := os.ReadFile(filepath.Join(dst, "link-dir", "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "file", string(content))
+
+	info, err = os.Lstat(filepath.Join(dst, "link-file"))
+	assert.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+
+	for _, name := range []string{filepath.Join("dir", "up"), filepath.Join("link-dir", "up"), "broken"} {
+		_, err := os.Lstat(filepath.Join(dst, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+	assert.Len(t, report.Warnings(), 3)
+
+	t.Run("it should not change anything on the next sync", func(t *testing.T) {
+		report, err := syncer.Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, report.ChangeCount())
+	})
+}
@@ -2,24 +2,55 @@ package fssync
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"crypto/sha1"
+	"encoding/binary"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
-
-	iopkg "github.com/Scalingo/go-utils/io"
 )
 
 type SyncReport interface {
 	HasChanged(file string) bool
 	ChangeCount() int
+	// Unchanged returns true if the destination was already in sync: no file
+	// has been written, deleted or had its times or ownership changed
+	Unchanged() bool
+	// PendingDeletions returns the destination files which would have been
+	// deleted if the DeleteDryRun option was not set
+	PendingDeletions() []string
+	// CopiedBytes returns the amount of file content written to the destination
+	CopiedBytes() int64
+	// Warnings returns the problems which did not prevent the sync to complete
+	// but degraded its fidelity
+	Warnings() []string
+	// UnreadableFiles returns the source files which have been skipped with the
+	// ContinueOnError option because they can't be read by the current user
+	UnreadableFiles() []string
+	// UnsafeSymlinks returns the source symlinks which have been skipped with
+	// the SafeLinks option because their target is outside of the source
+	UnsafeSymlinks() []string
+	// RenamedPaths returns the source paths whose name has been translated on
+	// the destination, see WithMaxNameLength, with their destination path
+	RenamedPaths() map[string]string
+	// DeletionFailures returns the extraneous entries of the destination which
+	// could not be deleted with the ContinueOnError option
+	DeletionFailures() []DeletionFailure
+	// OwnershipFailures returns the entries of the destination whose ownership
+	// could not be changed with the BestEffortOwnership option
+	OwnershipFailures() []OwnershipFailure
+	// ResourceUsage returns the resources used by each stage of the sync with
+	// the MeasureResourceUsage option
+	ResourceUsage() []ResourceUsage
 }
 
 type Syncer interface {
@@ -27,53 +58,190 @@ type Syncer interface {
 }
 
 // Copier is the interface used to copy content from one file to another
-// By default it's using iopkg.Copier
+// By default it's using fileCopier
 type Copier interface {
 	Copy(dst io.Writer, src io.Reader) (int64, error)
 }
 
 type FsSyncer struct {
-	checkChecksum     bool
-	preserveOwnership bool
-	ignoreNotFound    bool
-	noCache           bool
-	bufferSize        int64
-	copier            Copier
+	checkChecksum       bool
+	preserveOwnership   bool
+	bestEffortOwnership bool
+	ignoreNotFound      bool
+	noCache             bool
+	readahead           bool
+	dirFdTraversal      bool
+	sandboxed           bool
+	deterministicOrder  bool
+	maxDepth            int
+	maxEntriesPerDir    int
+	deleteDryRun        bool
+	noDelete            bool
+	deleteTiming        DeleteTiming
+	continueOnError     bool
+	detectCaps          bool
+	bufferSize          int64
+	bandwidthLimit      int64
+	maxOpsPerSecond     int
+	opsLimiter          *rateLimiter
+	timesConcurrency    int
+	noDirTimes          bool
+	patternPolicies     []patternPolicy
+	filterRules         []filterRule
+	filterPrefix        string
+	caseCollisionPolicy CaseCollisionPolicy
+	clockSkewPolicy     ClockSkewPolicy
+	modTimeWindow       time.Duration
+	symlinkMode         SymlinkMode
+	noSymlinkRewrite    bool
+	relativeSymlinks    bool
+	safeLinks           bool
+	noHardlinks         bool
+	retryAttempts       int
+	retryBackoff        time.Duration
+	appendMode          bool
+	overlayWhiteouts    bool
+	noPerms             bool
+	umask               os.FileMode
+	chmodSet            os.FileMode
+	chmodClear          os.FileMode
+	fileMode            os.FileMode
+	dirMode             os.FileMode
+	minSize             int64
+	maxSize             int64
+	modifiedSince       time.Time
+	oneFileSystem       bool
+	cloneMode           bool
+	cleanDestination    bool
+	dedupe              bool
+	memoryLimit         int64
+	linkDest            string
+	manifestPath        string
+	trustManifest       bool
+	protectedPaths      []string
+	partialDir          string
+	tempDir             string
+	destinationPrefix   string
+	trailingSlash       bool
+	priorityPaths       []string
+	priorityReady       func()
+	ownerLookup         OwnerLookup
+	ownershipOverrides  []ownershipOverride
+	ownerMapper         func(group bool, id int) int
+	maxNameLength       int
+	longNamePolicy      LongNamePolicy
+	newHash             func() hash.Hash
+	copier              Copier
+	publisher           Publisher
+	measureUsage        bool
+	progressInterval    time.Duration
+	progressFunc        func(Progress)
+	logger              *slog.Logger
+	tracer              Tracer
+	hooks               Hooks
 }
 
 type fsSyncReport struct {
-	fileChanges map[string]bool
+	fileChanges       spillSet
+	pendingDeletions  []string
+	copiedBytes       int64
+	warnings          []string
+	renamedPaths      map[string]string
+	unreadableFiles   []string
+	unsafeSymlinks    []string
+	deletionFailures  []DeletionFailure
+	ownershipFailures []OwnershipFailure
+	resourceUsage     []ResourceUsage
+	metadataChanged   bool
+	// logger logs the warnings, see WithLogger
+	logger *slog.Logger
 }
 
 func (r fsSyncReport) HasChanged(file string) bool {
-	return r.fileChanges[file]
+	return r.fileChanges.has(file)
+}
+
+func (r fsSyncReport) Unchanged() bool {
+	return r.fileChanges.empty() && !r.metadataChanged
 }
 
 func (r fsSyncReport) ChangeCount() int {
-	return len(r.fileChanges)
+	return r.fileChanges.len()
+}
+
+func (r fsSyncReport) PendingDeletions() []string {
+	return r.pendingDeletions
+}
+
+func (r fsSyncReport) CopiedBytes() int64 {
+	return r.copiedBytes
+}
+
+func (r fsSyncReport) Warnings() []string {
+	return r.warnings
+}
+
+func (r fsSyncReport) UnreadableFiles() []string {
+	return r.unreadableFiles
+}
+
+func (r fsSyncReport) UnsafeSymlinks() []string {
+	return r.unsafeSymlinks
+}
+
+func (r fsSyncReport) DeletionFailures() []DeletionFailure {
+	return r.deletionFailures
+}
+
+func (r fsSyncReport) OwnershipFailures() []OwnershipFailure {
+	return r.ownershipFailures
+}
+
+func (r fsSyncReport) ResourceUsage() []ResourceUsage {
+	return r.resourceUsage
+}
+
+func (r fsSyncReport) RenamedPaths() map[string]string {
+	return r.renamedPaths
+}
+
+func (r *fsSyncReport) warn(format string, args ...interface{}) {
+	warning := fmt.Sprintf(format, args...)
+	r.warnings = append(r.warnings, warning)
+	if r.logger != nil {
+		r.logger.Warn("sync warning", "warning", warning)
+	}
 }
 
 func New(opts ...func(*FsSyncer)) *FsSyncer {
 	s := &FsSyncer{
-		bufferSize: 512 * 1024,
+		bufferSize:       512 * 1024,
+		timesConcurrency: 8,
+		newHash:          sha1.New,
 	}
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.noPerms {
+		s.umask = processUmask()
+	}
 
-	copierOpts := []iopkg.CopierOpt{}
-	if s.bufferSize != 0 {
-		copierOpts = append(copierOpts, iopkg.WithBufferSize(s.bufferSize))
+	copier := fileCopier{bufferSize: s.bufferSize, noCache: s.noCache, readahead: s.readahead && !s.noCache}
+	if s.bandwidthLimit > 0 {
+		copier.limiter = newRateLimiter(s.bandwidthLimit)
 	}
-	if s.noCache {
-		copierOpts = append(copierOpts, iopkg.WithNoDiskCache)
+	s.copier = copier
+	if s.maxOpsPerSecond > 0 {
+		s.opsLimiter = newRateLimiter(int64(s.maxOpsPerSecond))
 	}
-	s.copier = iopkg.NewCopier(copierOpts...)
 
 	return s
 }
 
-// WithChecksum option: Check SHA1 checksum instead of modtime + size
+// WithChecksum option: Check checksum instead of modtime + size, the
+// algorithm is SHA1 unless configured with WithHash. On Linux, the files
+// sharing all their extents with their source, like reflink clones, are
+// considered identical without being read.
 func WithChecksum(s *FsSyncer) {
 	s.checkChecksum = true
 }
@@ -92,12 +260,57 @@ func IgnoreNotFound(s *FsSyncer) {
 }
 
 // NoCache option: Use the system call fadvise to discard kernel cache after
-// reading/writing Inspired from
-// https://github.com/coreutils/coreutils/blob/master/src/dd.c
+// reading/writing, it has no effect on OpenBSD which has no fadvise. Inspired
+// from https://github.com/coreutils/coreutils/blob/master/src/dd.c
 func NoCache(s *FsSyncer) {
 	s.noCache = true
 }
 
+// WithReadahead option: advise the kernel with posix_fadvise that the source
+// files are read sequentially before copying them, for it to read ahead more
+// of them, which speeds up the copy of large files on spinning disks. It has
+// no effect with NoCache and on OpenBSD and Windows.
+func WithReadahead(s *FsSyncer) {
+	s.readahead = true
+}
+
+// NoHardlinks option: files with several links in the source are copied
+// once per link instead of being hardlinked together on the destination
+func NoHardlinks(s *FsSyncer) {
+	s.noHardlinks = true
+}
+
+// NoDelete option: files of the destination which are not present in the
+// source are kept, to layer multiple sources into the same destination
+func NoDelete(s *FsSyncer) {
+	s.noDelete = true
+}
+
+// DeleteDryRun option: files are copied and updated but extraneous files of
+// the destination are not deleted, they are listed in the report with
+// PendingDeletions instead
+func DeleteDryRun(s *FsSyncer) {
+	s.deleteDryRun = true
+}
+
+// DetectCapabilities option: probe once per sync the features supported by
+// each destination filesystem and degrade instead of failing when one is
+// missing: hardlinks are replaced by copies, symlinks are skipped and
+// modification times are compared to the second. A warning is added to the
+// report for each degradation.
+func DetectCapabilities(s *FsSyncer) {
+	s.detectCaps = true
+}
+
+// ContinueOnError option: source files which can't be read by the current
+// user are skipped and listed in the report with UnreadableFiles instead of
+// failing the sync. Their existing copy in the destination is kept. The
+// extraneous entries which can't be deleted are kept too and listed with
+// DeletionFailures.
+func ContinueOnError(s *FsSyncer) {
+	s.continueOnError = true
+}
+
 // WithBufferSize option: lets you configure the size of the memory buffer used
 // to perform the copy from one file to another
 // Default is 512kB
@@ -111,12 +324,21 @@ type syncInfo struct {
 	base     string
 	path     string
 	fileInfo os.FileInfo
-	stat     *syscall.Stat_t
+	stat     *sysStat
 	times    statTimes
 }
 
-func (s syncInfo) SHA1() ([]byte, error) {
-	hash := sha1.New()
+// mtime returns the modification time of the entry with the nanoseconds of
+// its stat timespec
+func (s syncInfo) mtime() time.Time {
+	if s.stat == nil {
+		return s.fileInfo.ModTime()
+	}
+	return statMtime(s.stat)
+}
+
+func (s syncInfo) checksum(newHash func() hash.Hash) ([]byte, error) {
+	hash := newHash()
 	fd, err := os.Open(s.path)
 	if err != nil {
 		return nil, errors.Wrapf(err, "fail to open file")
@@ -130,8 +352,51 @@ func (s syncInfo) SHA1() ([]byte, error) {
 }
 
 type syncState struct {
-	timesMap map[string]statTimes
-	inoMap   map[uint64]string
+	timesMap spillTimes
+	inoMap   spillLinks
+	// capabilities of the destination filesystems, by device ID
+	capabilities map[uint64]Capabilities
+	// source paths synced by case-folded path, see checkCaseCollision
+	caseFolded map[string]string
+	// destination IDs of the source owners, see destinationOwnerID
+	ownerIDs map[ownerKey]int
+	// destination directories in which entries have been deleted, with their
+	// source directory
+	deletionParents map[string]string
+	// times of the destination entries which are already matching the source
+	unchangedTimes spillTimes
+	manifest       *manifestState
+	// protected destination paths, see isProtected
+	protected map[string]bool
+	// destination directory of the sync, to which the extraneous entries are
+	// relative for WithFilterRules
+	dstRoot string
+	// source directory of the sync, see SafeLinks
+	srcRoot string
+	// false if extraneous files are not deleted or deleted from the manifest
+	deleteFromDst bool
+	// device ID of the source directory, see OneFileSystem
+	srcDevice uint64
+	// destination files compared by checksum as their modification times are
+	// unreliable, and their directories, see checkUnstableMtime
+	checksumPaths     map[string]bool
+	unstableMtimeDirs map[string]bool
+	// destination files to which identical files are hardlinked, see WithDedupe
+	dedupeCandidates map[dedupeKey][]*dedupeCandidate
+	// memory used by the maps which spill to disk, see WithMemoryLimit
+	memory *memoryBudget
+	// changes of the destination by path, see WithEventPublisher
+	changes *spillMap
+	// progress of the sync, see WithProgress
+	progress *progressTracker
+	// context of the current span, see WithTracer
+	traceCtx context.Context
+	// directory of the source being walked, see walkSource
+	listing *dirListing
+	// extraneous entries of the destination to delete after the walk of the
+	// source, see deleteExtraneousEntries
+	extraneous *extraneousQueue
+	report     *fsSyncReport
 }
 
 type statTimes struct {
@@ -142,41 +407,136 @@ type statTimes struct {
 type existingFileRes struct {
 	shouldUpdateTimes bool
 	hasContentChanged bool
+	// checksum of the source when computed to compare it
+	checksum    []byte
+	copiedBytes int64
+	// appended is true if the tail of the source has been appended to the
+	// destination instead of replacing it, see AppendMode
+	appended bool
 }
 
 type unexistingFileRes struct {
 	shouldUpdateTimes bool
+	copiedBytes       int64
+	// skipped is true if the file has not been created on the destination
+	skipped bool
 }
 
 func (s *FsSyncer) Sync(dst, src string) (SyncReport, error) {
-	state := syncState{
-		timesMap: map[string]statTimes{},
-		inoMap:   map[uint64]string{},
+	plan := s.NewSyncPlan(dst, src)
+	var span Span
+	plan.state, span = s.startSpan(plan.state, SpanSync)
+	span.SetAttribute("src", src)
+	span.SetAttribute("dst", dst)
+	stages := []func() error{plan.Scan, plan.Transfer, plan.Delete, plan.Finalize}
+	for _, stage := range stages {
+		err := stage()
+		if err != nil {
+			span.End(err)
+			s.hookComplete(plan.Report(), err)
+			return plan.Report(), err
+		}
 	}
-	report := fsSyncReport{fileChanges: map[string]bool{}}
-
-	src = filepath.Clean(src)
-	dst = filepath.Clean(dst)
+	span.SetAttribute("changes", int64(plan.state.report.ChangeCount()))
+	span.SetAttribute("copied_bytes", plan.state.report.copiedBytes)
+	span.End(nil)
+	s.hookComplete(plan.Report(), nil)
+	return plan.Report(), nil
+}
 
-	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+// syncWalkFunc returns the function syncing each entry of src walked to dst
+func (s *FsSyncer) syncWalkFunc(state syncState, dst, src string) filepath.WalkFunc {
+	report := state.report
+	walkError := func(path string, err error) error {
+		if os.IsNotExist(err) && s.ignoreNotFound {
+			return nil
+		}
+		if os.IsPermission(err) && s.continueOnError {
+			s.unreadableSkipped(path, err)
+			report.unreadableFiles = append(report.unreadableFiles, path)
+			state.manifest.keep(dst, s.destinationPath(dst, src, path, report))
+			return nil
+		}
+		return err
+	}
+	return s.retryWalkFunc(func(path string, info os.FileInfo, err error) error {
+		s.throttleOp()
 		if err != nil {
-			if os.IsNotExist(err) && s.ignoreNotFound {
-				return nil
+			return walkError(path, err)
+		}
+		skip, err := s.checkCaseCollision(state, path, info)
+		if skip && info.IsDir() && state.deleteFromDst && s.deleteTiming != DeleteBefore {
+			deleteErr := s.deleteUnwalkedExtraneousEntries(state, s.destinationPath(dst, src, path, report), path)
+			if deleteErr != nil {
+				return deleteErr
 			}
+		}
+		if skip || err != nil {
+			return err
+		}
+		info, skip, err = s.resolveSymlink(src, path, info, report)
+		if skip || err != nil {
 			return err
 		}
-		dstPath := strings.Replace(path, src, dst, 1)
+		dstPath := s.destinationPath(dst, src, path, report)
+		if path != src && s.isProtected(state, dstPath) {
+			report.warn("%v is protected on the destination, skipped", path)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if s.isExcluded(src, path, info.IsDir()) {
+			s.logSkip(path, "excluded")
+			state.manifest.keep(dst, dstPath)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// The entries excluded by their path are not stated
+		info, err = statEntry(info)
+		if err != nil {
+			return walkError(path, err)
+		}
+		if s.isFiltered(info) {
+			s.logSkip(path, "filtered")
+			state.manifest.keep(dst, dstPath)
+			return nil
+		}
+		if name, ok := s.whiteoutName(info); ok {
+			return s.applyWhiteout(state, path, dstPath, name)
+		}
+		s.trackScan(state, path)
+		s.hookFileStart(dstPath, path)
 
-		srcSysStat, ok := info.Sys().(*syscall.Stat_t)
+		srcSysStat, ok := fileStat(info)
 		if !ok {
 			return errors.Wrapf(err, "fail to get detailed stat info for %s", path)
 		}
-		atime := time.Unix(srcSysStat.Atim.Sec, srcSysStat.Atim.Nsec)
-		mtime := time.Unix(srcSysStat.Mtim.Sec, srcSysStat.Mtim.Nsec)
+		atime := statAtime(srcSysStat)
+		mtime := statMtime(srcSysStat)
+
+		manifestEntry := newManifestEntry(info, srcSysStat)
+		synced, err := s.syncFromManifest(state, dst, dstPath, syncInfo{
+			base:     src,
+			path:     path,
+			fileInfo: info,
+			stat:     srcSysStat,
+			times:    statTimes{atime: atime, mtime: mtime},
+		}, manifestEntry)
+		if isUnreadableSource(err) && s.continueOnError {
+			s.unreadableSkipped(path, err)
+			report.unreadableFiles = append(report.unreadableFiles, path)
+			state.manifest.keep(dst, dstPath)
+			return nil
+		}
+		if synced || err != nil {
+			return err
+		}
 
-		dstStat, err := os.Lstat(dstPath)
+		dstStat, err := s.lstatDestination(dstPath)
 		if os.IsNotExist(err) {
-			report.fileChanges[dstPath] = true
 			res, err := s.syncUnexistingFile(syncInfo{
 				base:     src,
 				path:     path,
@@ -186,30 +546,42 @@ func (s *FsSyncer) Sync(dst, src string) (SyncReport, error) {
 				base: dst,
 				path: dstPath,
 			}, state)
+			if isUnreadableSource(err) && s.continueOnError {
+				s.unreadableSkipped(path, err)
+				report.unreadableFiles = append(report.unreadableFiles, path)
+				state.manifest.keep(dst, dstPath)
+				return nil
+			}
 			if err != nil {
 				return errors.Wrapf(err, "fail to handle unexisting file %v", path)
 			}
-			if res.shouldUpdateTimes {
-				state.timesMap[dstPath] = statTimes{atime: atime, mtime: mtime}
+			if res.skipped {
+				return nil
 			}
-			if s.preserveOwnership {
-				err = os.Chown(dstPath, int(srcSysStat.Uid), int(srcSysStat.Gid))
-				if err != nil {
-					return errors.Wrapf(err, "fail to chown %v", dstPath)
-				}
+			report.fileChanges.add(dstPath)
+			s.recordChange(state, ChangeCreate, dstPath, path)
+			report.copiedBytes += res.copiedBytes
+			if res.shouldUpdateTimes && s.preservesTimes(info) {
+				state.timesMap.set(dstPath, statTimes{atime: atime, mtime: mtime})
 			}
+			err = s.chown(state, src, path, dstPath, srcSysStat, nil)
+			if err != nil {
+				return err
+			}
+			state.manifest.record(dst, dstPath, path, manifestEntry)
 			return nil
 		} else if err != nil {
 			return errors.Wrapf(err, "fail to stat %v", dstPath)
 		}
 
-		dstSysStat, ok := dstStat.Sys().(*syscall.Stat_t)
+		dstSysStat, ok := fileStat(dstStat)
 		if !ok {
 			return errors.Wrapf(err, "fail to get detailed stat info for %s", dstPath)
 		}
-		dstatime := time.Unix(dstSysStat.Atim.Sec, dstSysStat.Atim.Nsec)
-		dstmtime := time.Unix(dstSysStat.Mtim.Sec, dstSysStat.Mtim.Nsec)
+		dstatime := statAtime(dstSysStat)
+		dstmtime := statMtime(dstSysStat)
 
+		s.checkUnstableMtime(state, dst, dstPath)
 		res, err := s.syncExistingFile(syncInfo{
 			base:     src,
 			path:     path,
@@ -223,192 +595,418 @@ func (s *FsSyncer) Sync(dst, src string) (SyncReport, error) {
 			stat:     dstSysStat,
 			times:    statTimes{atime: dstatime, mtime: dstmtime},
 		}, state)
+		if isUnreadableSource(err) && s.continueOnError {
+			s.unreadableSkipped(path, err)
+			report.unreadableFiles = append(report.unreadableFiles, path)
+			state.manifest.keep(dst, dstPath)
+			return nil
+		}
 		if err != nil {
 			return errors.Wrapf(err, "fail to sync existing file %v", path)
 		}
-		if res.shouldUpdateTimes {
-			state.timesMap[dstPath] = statTimes{atime: atime, mtime: mtime}
+		if res.shouldUpdateTimes && s.preservesTimes(info) {
+			times := statTimes{atime: atime, mtime: mtime}
+			// Access times are not compared as reading the destination, to compute
+			// its checksum for instance, may change it
+			if !res.hasContentChanged && s.mtimesEqual(state, dstPath, mtime, dstmtime) {
+				state.unchangedTimes.set(dstPath, times)
+			} else {
+				state.timesMap.set(dstPath, times)
+			}
 		}
 		if res.hasContentChanged {
-			report.fileChanges[dstPath] = true
+			report.fileChanges.add(dstPath)
+			s.recordChange(state, ChangeUpdate, dstPath, path)
+		}
+		report.copiedBytes += res.copiedBytes
+		// A replaced file is a new file whose ownership must be set
+		currentOwner := dstSysStat
+		if res.hasContentChanged && !res.appended {
+			currentOwner = nil
+		}
+		err = s.chown(state, src, path, dstPath, srcSysStat, currentOwner)
+		if err != nil {
+			return err
 		}
-		if s.preserveOwnership {
-			err = os.Chown(dstPath, int(srcSysStat.Uid), int(srcSysStat.Gid))
+		if !res.hasContentChanged || res.appended {
+			err = s.adjustMode(state, dstPath, dstStat)
 			if err != nil {
-				return errors.Wrapf(err, "fail to chown %v", dstPath)
+				return err
 			}
 		}
+		if info.IsDir() && s.deletesExtraneousEntries(state, path) {
+			err = s.deleteExtraneousEntries(state, dstPath, path)
+			if err != nil {
+				return err
+			}
+		}
+		manifestEntry.Checksum = res.checksum
+		manifestEntry.UnstableRuns = s.unstableRuns(state, dst, dstPath, manifestEntry, res.hasContentChanged)
+		state.manifest.record(dst, dstPath, path, manifestEntry)
 		return nil
 	})
+}
 
+func (s *FsSyncer) syncExistingFile(src, dst syncInfo, state syncState) (existingFileRes, error) {
+	res, err := s.compareExistingFile(src, dst, state)
 	if err != nil {
-		return report, errors.Wrapf(err, "fail to walk %v", src)
+		return res, err
 	}
-
-	dirsToRemove := []string{}
-	err = filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+	if !res.hasContentChanged && s.isDedupedLink(state, src, dst) {
+		res.hasContentChanged = true
+	}
+	if !res.hasContentChanged {
+		unlinked, err := s.isUnlinkedAlias(state, src, dst)
 		if err != nil {
-			return err
-		}
-		srcPath := strings.Replace(path, dst, src, 1)
-		_, err = os.Lstat(srcPath)
-		if os.IsNotExist(err) {
-			report.fileChanges[path] = true
-			if info.IsDir() {
-				// Do not delete directory straight we want to tag all files
-				// recursively before deleting empty dirs
-				dirsToRemove = append(dirsToRemove, path)
-			} else {
-				err := os.Remove(path)
-				if err != nil {
-					return errors.Wrapf(err, "fail to delete %v", path)
-				}
-			}
+			return res, err
 		}
-		return nil
-	})
+		res.hasContentChanged = unlinked
+	}
+	if !res.hasContentChanged {
+		s.addDedupeCandidate(state, src, dst.path)
+		return res, nil
+	}
+
+	appended, copiedBytes, err := s.appendTail(state, src, dst)
 	if err != nil {
-		return report, errors.Wrapf(err, "fail to walk %v", dst)
+		return res, err
+	}
+	if appended {
+		res.shouldUpdateTimes = true
+		res.copiedBytes = copiedBytes
+		res.appended = true
+		return res, nil
 	}
 
-	for i := len(dirsToRemove) - 1; i >= 0; i-- {
-		dir := dirsToRemove[i]
-		err := os.Remove(dir)
+	if src.fileInfo.IsDir() != dst.fileInfo.IsDir() {
+		err := s.inDestination(state, dst.path, os.RemoveAll)
 		if err != nil {
-			return report, errors.Wrapf(err, "fail to delete %v", dir)
+			return res, errors.Wrapf(err, "fail to remove destination invalid file %v", dst.path)
 		}
 	}
-
-	// Change times after removing entries as removing a file
-	// changes the mtime at the os level
-	for file, times := range state.timesMap {
-		err = os.Chtimes(file, times.atime, times.mtime)
-		if err != nil && !(os.IsNotExist(err) && s.ignoreNotFound) {
-			return report, errors.Wrapf(err, "fail to set atime and mtime of %v", file)
-		}
+	// Entries are created through a temporary file which replaces the old one
+	// once ready, see createAtomically
+	newFileRes, err := s.syncUnexistingFile(src, syncInfo{base: dst.base, path: dst.path}, state)
+	if err != nil {
+		return res, errors.Wrapf(err, "fail to replace %v by %v", dst.path, src.path)
 	}
+	res.shouldUpdateTimes = newFileRes.shouldUpdateTimes
+	res.copiedBytes = newFileRes.copiedBytes
 
-	return report, nil
+	return res, nil
 }
 
-func (s *FsSyncer) syncExistingFile(src, dst syncInfo, state syncState) (existingFileRes, error) {
+// compareExistingFile compares the src entry to the existing dst entry without
+// modifying it, hasContentChanged is true if dst has to be replaced
+func (s *FsSyncer) compareExistingFile(src, dst syncInfo, state syncState) (existingFileRes, error) {
 	res := existingFileRes{}
 	if src.fileInfo.IsDir() && dst.fileInfo.IsDir() {
 		res.shouldUpdateTimes = true
 		return res, nil
-	} else if src.fileInfo.IsDir() && !dst.fileInfo.IsDir() ||
-		!src.fileInfo.IsDir() && dst.fileInfo.IsDir() {
-		err := os.RemoveAll(dst.path)
-		if err != nil {
-			return res, errors.Wrapf(err, "fail to remove destination invalid file %v", dst.path)
-		}
+	} else if src.fileInfo.IsDir() != dst.fileInfo.IsDir() {
+		res.hasContentChanged = true
+		return res, nil
 	}
 
-	if s.checkChecksum {
-		srcSHA1, err := src.SHA1()
+	if isSymlink(src.fileInfo) && isSymlink(dst.fileInfo) {
+		// Symlinks are compared by target, their times are updated otherwise
+		srcTarget, err := s.symlinkTarget(src, dst)
 		if err != nil {
-			return res, errors.Wrapf(err, "fail to compute SHA1 of %v", src.path)
+			return res, err
 		}
-		dstSHA1, err := dst.SHA1()
+		dstTarget, err := os.Readlink(dst.path)
 		if err != nil {
-			return res, errors.Wrapf(err, "fail to compute SHA1 of %v", dst.path)
+			return res, errors.Wrapf(err, "fail to get link destination of dst %v", dst.path)
+		}
+		if srcTarget == dstTarget {
+			res.shouldUpdateTimes = true
+			return res, nil
 		}
-		if bytes.Equal(srcSHA1, dstSHA1) {
+	} else if policy := s.comparePolicy(src.fileInfo); policy == CompareSizeOnly {
+		if dst.fileInfo.Mode().IsRegular() && src.fileInfo.Size() == dst.fileInfo.Size() {
+			res.shouldUpdateTimes = true
+			return res, nil
+		}
+	} else if policy == CompareChecksum || s.compareByChecksum(state, dst.path) {
+		if isClone(src, dst) {
+			res.shouldUpdateTimes = true
+			return res, nil
+		}
+		srcChecksum, err := src.checksum(s.newHash)
+		if err != nil {
+			err = sourceReadError(errors.Cause(err))
+			return res, errors.Wrapf(err, "fail to compute checksum of %v", src.path)
+		}
+		dstChecksum, err := dst.checksum(s.newHash)
+		if err != nil {
+			return res, errors.Wrapf(err, "fail to compute checksum of %v", dst.path)
+		}
+		res.checksum = srcChecksum
+		if bytes.Equal(srcChecksum, dstChecksum) {
 			res.shouldUpdateTimes = true
 			return res, nil
 		}
 	} else {
-		if src.fileInfo.Size() == dst.fileInfo.Size() && src.fileInfo.ModTime() == dst.fileInfo.ModTime() {
+		if src.fileInfo.Size() == dst.fileInfo.Size() && s.mtimesEqual(state, dst.path, src.mtime(), dst.mtime()) {
 			return res, nil
 		}
 	}
 
 	res.hasContentChanged = true
-	dir := filepath.Dir(dst.path)
-	base := filepath.Base(dst.path)
-	tmpDst := tmpFileName(dir, base)
-	newFileRes, err := s.syncUnexistingFile(src, syncInfo{base: dst.base, path: tmpDst}, state)
-	if err != nil {
-		return res, errors.Wrapf(err, "fail to sync src to temp file %v -> %v", src.path, tmpDst)
-	}
-	res.shouldUpdateTimes = newFileRes.shouldUpdateTimes
-
-	// Once the new file is ready, replace the old one
-	err = os.Rename(tmpDst, dst.path)
-	if err != nil {
-		return res, errors.Wrapf(err, "fail to mv tmp file on original file %v -> %v", tmpDst, dst.path)
-	}
-	// temp file name has been set to state, restore it to real name
-	state.inoMap[src.stat.Ino] = dst.path
-
 	return res, nil
 }
 
 func (s *FsSyncer) syncUnexistingFile(src, dst syncInfo, state syncState) (unexistingFileRes, error) {
 	res := unexistingFileRes{}
+	symlink := isSymlink(src.fileInfo)
+	// Skipped symlinks must not be recorded as the first link of their inode
+	if symlink && !s.supports(state, dst.path, symlinksCapability) {
+		return unexistingFileRes{skipped: true}, nil
+	}
 
-	if existingLink, ok := state.inoMap[src.stat.Ino]; ok {
-		err := os.Link(existingLink, dst.path)
-		if err != nil {
-			return res, errors.Wrapf(err, "fail to create link from %v to %v", existingLink, dst.path)
+	// Only files with several links can be hardlinked, tracking them only keeps
+	// the map small on large trees
+	if !s.noHardlinks && !src.fileInfo.IsDir() && src.stat.Nlink > 1 {
+		if existingLink, ok := state.inoMap.get(src.stat.Ino); ok && s.supports(state, dst.path, hardlinksCapability) {
+			var linked bool
+			var err error
+			if symlink {
+				linked, err = s.linkSymlink(state, src, dst, existingLink)
+			} else {
+				linked, err = s.linkExisting(state, existingLink, dst.path)
+			}
+			if err != nil || linked {
+				return res, err
+			}
 		}
-		return res, nil
+		state.inoMap.set(src.stat.Ino, dst.path)
 	}
 
-	state.inoMap[src.stat.Ino] = dst.path
-
 	if src.fileInfo.IsDir() {
-		err := os.MkdirAll(dst.path, src.fileInfo.Mode())
+		mode := s.destinationMode(src.fileInfo)
+		err := s.inDestination(state, dst.path, func(path string) error {
+			return os.MkdirAll(path, mode)
+		})
 		if err != nil {
 			return res, errors.Wrapf(err, "fail to create dst directory %v", dst.path)
 		}
+		err = s.chmodCreated(state, dst.path, mode)
+		if err != nil {
+			return res, err
+		}
 		return unexistingFileRes{shouldUpdateTimes: true}, nil
 	}
 
-	if src.fileInfo.Mode()&os.ModeSymlink == os.ModeSymlink {
-		linkDst, err := os.Readlink(src.path)
+	if symlink {
+		linkDst, err := s.symlinkTarget(src, dst)
 		if err != nil {
-			return res, errors.Wrapf(err, "fail to get link destination of src %v", src.path)
-		}
-		if strings.Contains(linkDst, src.base) {
-			linkDst = strings.Replace(linkDst, src.base, dst.base, 1)
+			return res, err
 		}
-		err = os.Symlink(linkDst, dst.path)
+		err = s.inDestination(state, dst.path, func(path string) error {
+			return createAtomicallyIn(s.tmpDirOf(path), path, func(tmpPath string) error {
+				return os.Symlink(linkDst, tmpPath)
+			})
+		})
 		if err != nil {
 			return res, errors.Wrapf(err, "fail to create symlink %v (%v)", dst.path, linkDst)
 		}
+		return unexistingFileRes{shouldUpdateTimes: true}, nil
+	}
+
+	if s.linkDest != "" && src.fileInfo.Mode().IsRegular() {
+		linked, err := s.linkFromReference(src, dst, state)
+		if err != nil {
+			return res, err
+		}
+		if linked {
+			// The times are shared with the reference file
+			return res, nil
+		}
+	}
+	linked, err := s.linkDuplicate(src, dst, state)
+	if err != nil {
+		return res, err
+	}
+	if linked {
+		// The times are shared with the duplicate file
 		return res, nil
 	}
 
-	_, err := s.copyFileContent(src.path, dst.path, src.fileInfo)
+	_, span := s.startSpan(state, SpanCopy)
+	span.SetAttribute("src", src.path)
+	span.SetAttribute("dst", dst.path)
+	var copiedBytes int64
+	if s.partialDir != "" && !s.cloneMode && src.fileInfo.Mode().IsRegular() {
+		copiedBytes, err = s.copyFileWithPartial(state, src, dst.path, s.destinationMode(src.fileInfo))
+	} else {
+		err = s.inDestination(state, dst.path, func(path string) error {
+			var err error
+			copiedBytes, err = s.copyFileAtomically(src, path, s.destinationMode(src.fileInfo))
+			return err
+		})
+	}
+	span.SetAttribute("bytes", copiedBytes)
+	span.End(err)
 	if err != nil {
 		return res, errors.Wrapf(err, "fail to copy content from %v to %v", src.path, dst.path)
 	}
+	s.addDedupeCandidate(state, src, dst.path)
 
-	return unexistingFileRes{shouldUpdateTimes: true}, nil
+	return unexistingFileRes{shouldUpdateTimes: true, copiedBytes: copiedBytes}, nil
 }
 
-func (s *FsSyncer) copyFileContent(src, dst string, info os.FileInfo) (int64, error) {
-	sfd, err := os.Open(src)
+// linkExisting hardlinks path to existingLink, the first destination path of
+// their source inode. It returns false if the destination filesystem can't
+// add more links to existingLink: the file is copied instead, the next links
+// of the inode are made to the copy and a warning is reported.
+func (s *FsSyncer) linkExisting(state syncState, existingLink, path string) (bool, error) {
+	err := s.linkInDestination(state, existingLink, path)
+	if errors.Is(err, syscall.EMLINK) {
+		state.report.warn("%v has the maximum number of links of the destination filesystem, %v is a copy", existingLink, path)
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "fail to create link from %v to %v", existingLink, path)
+	}
+	return true, nil
+}
+
+// linkInDestination atomically hardlinks path to existingLink, both located in
+// the destination
+func (s *FsSyncer) linkInDestination(state syncState, existingLink, path string) error {
+	return s.inDestination(state, existingLink, func(existingLink string) error {
+		return s.inDestination(state, path, func(path string) error {
+			return createAtomicallyIn(s.tmpDirOf(path), path, func(tmpPath string) error {
+				return os.Link(existingLink, tmpPath)
+			})
+		})
+	})
+}
+
+// isUnlinkedAlias records the unchanged dst file as the first destination path
+// of its source inode if src has several links, the aliases of the inode
+// synced afterwards are then hardlinked to it instead of being copied again.
+// It returns true if another destination path of the inode is already known
+// and dst is not linked to it: dst must be replaced by a link.
+func (s *FsSyncer) isUnlinkedAlias(state syncState, src, dst syncInfo) (bool, error) {
+	if s.noHardlinks || src.fileInfo.IsDir() || src.stat.Nlink < 2 {
+		return false, nil
+	}
+	existingLink, ok := state.inoMap.get(src.stat.Ino)
+	if !ok {
+		state.inoMap.set(src.stat.Ino, dst.path)
+		return false, nil
+	}
+	if existingLink == dst.path || !s.supports(state, dst.path, hardlinksCapability) {
+		return false, nil
+	}
+	s.throttleOp()
+	existingInfo, err := os.Lstat(existingLink)
 	if err != nil {
-		return -1, errors.Wrapf(err, "fail to open src %v", src)
+		return false, errors.Wrapf(err, "fail to stat %v", existingLink)
 	}
-	defer sfd.Close()
-	fd, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, info.Mode())
+	if sameFile(existingInfo, dst.fileInfo) {
+		return false, nil
+	}
+	if isSymlink(src.fileInfo) {
+		// Symlinks rewritten to different targets can't be linked, see linkSymlink
+		existingTarget, err := os.Readlink(existingLink)
+		if err != nil {
+			return false, errors.Wrapf(err, "fail to get link destination of %v", existingLink)
+		}
+		dstTarget, err := os.Readlink(dst.path)
+		if err != nil {
+			return false, errors.Wrapf(err, "fail to get link destination of dst %v", dst.path)
+		}
+		return existingTarget == dstTarget, nil
+	}
+	return true, nil
+}
+
+func (s *FsSyncer) copyFileContent(src syncInfo, dst string, mode os.FileMode) (int64, error) {
+	// The temporary file must not exist, a symlink at its path is not followed
+	fd, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
 	if err != nil {
 		return -1, errors.Wrapf(err, "fail to open dest %v", dst)
 	}
 	defer fd.Close()
-	n, err := s.copier.Copy(fd, sfd)
+	if s.forcesModes() {
+		err = fd.Chmod(mode)
+		if err != nil {
+			return -1, errors.Wrapf(err, "fail to chmod dest %v", dst)
+		}
+	}
+	return s.copyContent(src, fd)
+}
+
+// copyContent copies the content of the src file to the opened dst file
+func (s *FsSyncer) copyContent(src syncInfo, dst *os.File) (int64, error) {
+	s.throttleOp()
+	sfd, err := openSource(src.path, src.fileInfo)
+	if err != nil {
+		err = sourceReadError(err)
+		return -1, errors.Wrapf(err, "fail to open src %v", src.path)
+	}
+	defer sfd.Close()
+	if s.cloneMode {
+		return cloneContent(dst, sfd)
+	}
+	n, err := s.copier.Copy(dst, sfd)
 	if err != nil {
 		return -1, errors.Wrapf(err, "fail to copy data")
 	}
+	s.log(slog.LevelDebug, "file copied", "src", src.path, "bytes", n)
 	return n, nil
 }
 
+// createAtomically creates the entry located at path by calling create on a
+// temporary path in the same directory, then renames it to path. A crash in
+// the middle of the creation never leaves a partially written entry at path
+// and an existing entry at path is atomically replaced.
+func createAtomically(path string, create func(tmpPath string) error) error {
+	return createAtomicallyIn(filepath.Dir(path), path, create)
+}
+
+// tmpNameAttempts is the number of temporary names tried by
+// createAtomicallyIn before giving up
+const tmpNameAttempts = 10
+
+// createAtomicallyIn is createAtomically with the temporary path located in
+// the tmpDir directory, on the filesystem of path. create must fail if the
+// temporary path already exists, like with O_EXCL, another temporary name is
+// then tried: the temporary entries of concurrent syncs are never reused nor
+// deleted.
+func createAtomicallyIn(tmpDir, path string, create func(tmpPath string) error) error {
+	var tmpPath string
+	var err error
+	for attempt := 0; attempt < tmpNameAttempts; attempt++ {
+		tmpPath = tmpFileName(tmpDir, filepath.Base(path))
+		err = create(tmpPath)
+		if !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if errors.Is(err, fs.ErrExist) {
+		return errors.Wrapf(err, "fail to find an unused temporary name for %v", path)
+	} else if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrapf(err, "fail to mv tmp file on original file %v -> %v", tmpPath, path)
+	}
+	return nil
+}
+
+// tmpFileName returns a random temporary name for the base entry in the dir
+// directory, see isTmpFileName
 func tmpFileName(dir, base string) string {
-	// From io/ioutil.TempFile
-	r := uint32(time.Now().UnixNano() + int64(os.Getpid()))
-	r = r*1664525 + 1013904223 // constants from Numerical Recipes
-	return filepath.Join(dir, fmt.Sprintf(".%s-%s", base, strconv.Itoa(int(1e9 + r%1e9))[1:]))
+	var b [4]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		// Collisions are still detected by the exclusive creation of the entry
+		binary.LittleEndian.PutUint32(b[:], uint32(time.Now().UnixNano()+int64(os.Getpid())))
+	}
+	return filepath.Join(dir, fmt.Sprintf(".%s-%09d", base, binary.LittleEndian.Uint32(b[:])%1e9))
 }
@@ -1,14 +1,19 @@
 package fssync
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/Scalingo/go-fssync/internal/blake3"
 )
 
 func TestMain(m *testing.M) {
@@ -49,6 +54,18 @@ func TestFsSyncer_Sync(t *testing.T) {
 			expectedChanges: []string{},
 			syncOptions:     []func(*FsSyncer){WithChecksum},
 		},
+		"it should not replace a file with the same content with a configured hash algorithm": {
+			fixtureSrc:      "src/file",
+			fixtureDst:      "dst/cp-file",
+			expectedChanges: []string{},
+			syncOptions:     []func(*FsSyncer){WithChecksum, WithHash(blake3.New)},
+		},
+		"it should replace a file with the same size but not the same content with a configured hash algorithm": {
+			fixtureSrc:      "src/file",
+			fixtureDst:      "dst/same-size",
+			expectedChanges: []string{"a"},
+			syncOptions:     []func(*FsSyncer){WithChecksum, WithHash(sha256.New)},
+		},
 		"it should not replace a file with the same size and mtime": {
 			fixtureSrc:      "src/file",
 			fixtureDst:      "dst/rsync-file",
@@ -59,6 +76,17 @@ func TestFsSyncer_Sync(t *testing.T) {
 			fixtureDst:      "dst/mtime-file",
 			expectedChanges: []string{"a"},
 		},
+		"it should not leave temporary files when replacing a file": {
+			fixtureSrc:      "src/file",
+			fixtureDst:      "dst/mtime-file",
+			expectedChanges: []string{"a"},
+			additionalSpecs: func(t *testing.T, src, dst string) {
+				entries, err := os.ReadDir(dst)
+				assert.NoError(t, err)
+				assert.Len(t, entries, 1)
+				assert.Equal(t, "a", entries[0].Name())
+			},
+		},
 		"it should replace a file by a directory": {
 			fixtureSrc:      "src/dir",
 			fixtureDst:      "dst/replace-dir",
@@ -82,6 +110,69 @@ func TestFsSyncer_Sync(t *testing.T) {
 				assert.True(t, os.IsNotExist(err))
 			},
 		},
+		"it should copy links when detecting capabilities": {
+			fixtureSrc:  "src/local-symlink",
+			syncOptions: []func(*FsSyncer){DetectCapabilities},
+			additionalSpecs: func(t *testing.T, src, dst string) {
+				entries, err := os.ReadDir(dst)
+				assert.NoError(t, err)
+				assert.Len(t, entries, 2)
+			},
+		},
+		"it should delete extraneous files before copying": {
+			fixtureSrc:      "src/file",
+			fixtureDst:      "dst/extraneous-files",
+			expectedChanges: []string{"b", "dir", "dir/c"},
+			syncOptions:     []func(*FsSyncer){WithDeleteTiming(DeleteBefore)},
+			additionalSpecs: func(t *testing.T, src, dst string) {
+				_, err := os.Stat(filepath.Join(dst, "b"))
+				assert.True(t, os.IsNotExist(err))
+				_, err = os.Stat(filepath.Join(dst, "dir"))
+				assert.True(t, os.IsNotExist(err))
+			},
+		},
+		"it should delete extraneous files during the copy": {
+			fixtureSrc:      "src/file",
+			fixtureDst:      "dst/extraneous-files",
+			expectedChanges: []string{"b", "dir", "dir/c"},
+			syncOptions:     []func(*FsSyncer){WithDeleteTiming(DeleteDuring)},
+			additionalSpecs: func(t *testing.T, src, dst string) {
+				_, err := os.Stat(filepath.Join(dst, "b"))
+				assert.True(t, os.IsNotExist(err))
+				_, err = os.Stat(filepath.Join(dst, "dir"))
+				assert.True(t, os.IsNotExist(err))
+			},
+		},
+		"it should replace a directory by a file when deleting before copying": {
+			fixtureSrc:      "src/file",
+			fixtureDst:      "dst/replace-file",
+			expectedChanges: []string{"a", "a/another"},
+			syncOptions:     []func(*FsSyncer){WithDeleteTiming(DeleteBefore)},
+		},
+		"it should keep extraneous files with no delete": {
+			fixtureSrc:      "src/file",
+			fixtureDst:      "dst/extraneous-files",
+			expectedChanges: []string{},
+			syncOptions:     []func(*FsSyncer){NoDelete},
+			additionalSpecs: func(t *testing.T, src, dst string) {
+				_, err := os.Stat(filepath.Join(dst, "b"))
+				assert.NoError(t, err)
+				_, err = os.Stat(filepath.Join(dst, "dir", "c"))
+				assert.NoError(t, err)
+			},
+		},
+		"it should only report extraneous files with delete dry run": {
+			fixtureSrc:      "src/file",
+			fixtureDst:      "dst/extraneous-files",
+			expectedChanges: []string{},
+			syncOptions:     []func(*FsSyncer){DeleteDryRun},
+			additionalSpecs: func(t *testing.T, src, dst string) {
+				_, err := os.Stat(filepath.Join(dst, "b"))
+				assert.NoError(t, err)
+				_, err = os.Stat(filepath.Join(dst, "dir", "c"))
+				assert.NoError(t, err)
+			},
+		},
 	}
 
 	for msg, test := range tests {
@@ -159,3 +250,154 @@ func TestFsSyncer_Sync(t *testing.T) {
 		})
 	}
 }
+
+func TestFsSyncer_Sync_Hardlinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.Mkdir(src, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+	assert.NoError(t, os.Link(filepath.Join(src, "a"), filepath.Join(src, "b")))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "c"), []byte("c"), 0644))
+
+	tests := map[string]struct {
+		syncOptions    []func(*FsSyncer)
+		expectedLinked bool
+	}{
+		"it should recreate hardlinks": {
+			expectedLinked: true,
+		},
+		"it should copy hardlinks with NoHardlinks": {
+			syncOptions:    []func(*FsSyncer){NoHardlinks},
+			expectedLinked: false,
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			dst, err := ioutil.TempDir("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dst)
+
+			_, err = New(test.syncOptions...).Sync(dst, src)
+			assert.NoError(t, err)
+
+			a, err := os.Stat(filepath.Join(dst, "a"))
+			assert.NoError(t, err)
+			b, err := os.Stat(filepath.Join(dst, "b"))
+			assert.NoError(t, err)
+			c, err := os.Stat(filepath.Join(dst, "c"))
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedLinked, os.SameFile(a, b))
+			assert.False(t, os.SameFile(a, c))
+		})
+	}
+}
+
+func TestFsSyncer_Sync_HardlinksAcrossRuns(t *testing.T) {
+	tmp, err := ioutil.TempDir("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.Mkdir(src, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+
+	t.Run("it should link a new alias to the existing destination file", func(t *testing.T) {
+		assert.NoError(t, os.Link(filepath.Join(src, "a"), filepath.Join(src, "b")))
+		report, err := New().Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), report.CopiedBytes())
+
+		a, err := os.Stat(filepath.Join(dst, "a"))
+		assert.NoError(t, err)
+		b, err := os.Stat(filepath.Join(dst, "b"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(a, b))
+	})
+
+	t.Run("it should relink the aliases copied by a previous sync", func(t *testing.T) {
+		assert.NoError(t, os.RemoveAll(dst))
+		_, err := New(NoHardlinks).Sync(dst, src)
+		assert.NoError(t, err)
+
+		report, err := New().Sync(dst, src)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), report.CopiedBytes())
+		a, err := os.Stat(filepath.Join(dst, "a"))
+		assert.NoError(t, err)
+		b, err := os.Stat(filepath.Join(dst, "b"))
+		assert.NoError(t, err)
+		assert.True(t, os.SameFile(a, b))
+
+		report, err = New().Sync(dst, src)
+		assert.NoError(t, err)
+		assert.True(t, report.Unchanged())
+	})
+}
+
+func TestFsSyncer_Sync_Unchanged(t *testing.T) {
+	tests := map[string]struct {
+		syncOptions []func(*FsSyncer)
+	}{
+		"it should not change anything once synced": {},
+		"it should not change anything once synced with checksum checks": {
+			syncOptions: []func(*FsSyncer){WithChecksum},
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			dst, err := ioutil.TempDir("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dst)
+			src := filepath.Join("test-fixtures", "src", "dir")
+			syncer := New(test.syncOptions...)
+
+			report, err := syncer.Sync(dst, src)
+			assert.NoError(t, err)
+			assert.False(t, report.Unchanged())
+
+			for i := 0; i < 2; i++ {
+				report, err = syncer.Sync(dst, src)
+				assert.NoError(t, err)
+				assert.True(t, report.Unchanged())
+			}
+
+			// The file is replaced, or only its times are changed with checksum checks
+			mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			assert.NoError(t, os.Chtimes(filepath.Join(dst, "dir1", "file"), mtime, mtime))
+			report, err = syncer.Sync(dst, src)
+			assert.NoError(t, err)
+			assert.False(t, report.Unchanged())
+
+			srcInfo, err := os.Stat(filepath.Join(src, "dir1"))
+			assert.NoError(t, err)
+			dstInfo, err := os.Stat(filepath.Join(dst, "dir1"))
+			assert.NoError(t, err)
+			assert.Equal(t, srcInfo.ModTime(), dstInfo.ModTime())
+		})
+	}
+}
+
+func TestFsSyncer_Sync_WithReadahead(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a"), bytes.Repeat([]byte("a"), 100000), 0644))
+
+	report, err := New(WithReadahead, WithBufferSize(4096)).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100000), report.CopiedBytes())
+	content, err := os.ReadFile(filepath.Join(dst, "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("a"), 100000), content)
+}
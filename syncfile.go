@@ -0,0 +1,83 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// FileReport is the report of the sync of a single file with SyncFile
+type FileReport struct {
+	// Changed is true if the destination file has been created or replaced
+	Changed bool
+	// MetadataChanged is true if the times, ownership or mode of the
+	// destination file have been changed without replacing it
+	MetadataChanged bool
+	// CopiedBytes is the amount of content written to the destination file
+	CopiedBytes int64
+	// Warnings are the problems which did not prevent the sync to complete but
+	// degraded its fidelity
+	Warnings []string
+}
+
+// Unchanged returns true if the destination file was already in sync
+func (r FileReport) Unchanged() bool {
+	return !r.Changed && !r.MetadataChanged
+}
+
+// SyncFile syncs the srcFile file, symlink or special file to dstFile like
+// Sync does for each entry of a directory: it is compared to the existing
+// destination file, atomically replaced if it differs and its times,
+// ownership and mode are applied according to the options. The directory of
+// dstFile must exist. Nothing else is walked, compared nor deleted, for the
+// callers detecting the changed files on their own.
+func (s *FsSyncer) SyncFile(dstFile, srcFile string) (FileReport, error) {
+	report := FileReport{}
+	info, err := os.Lstat(srcFile)
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to stat %v", srcFile)
+	}
+	if info.IsDir() {
+		return report, errors.Errorf("%v is a directory, it must be synced with Sync", srcFile)
+	}
+
+	err = s.checkSandbox()
+	if err != nil {
+		return report, err
+	}
+	err = s.checkTempDir(dstFile)
+	if err != nil {
+		return report, err
+	}
+
+	state := s.newSyncState()
+	// The writes are sandboxed in the directory of dstFile
+	state.dstRoot = filepath.Dir(dstFile)
+	err = s.syncWalkFunc(state, dstFile, srcFile)(srcFile, info, nil)
+	if err != nil {
+		return report, err
+	}
+	err = s.applyTimes(state)
+	if err != nil {
+		return report, err
+	}
+	if !state.timesMap.empty() {
+		state.report.metadataChanged = true
+	}
+	if state.memory.err != nil {
+		return report, state.memory.err
+	}
+
+	report.Changed = !state.report.fileChanges.empty()
+	report.MetadataChanged = state.report.metadataChanged
+	report.CopiedBytes = state.report.copiedBytes
+	for _, file := range state.report.unreadableFiles {
+		state.report.warn("%v can't be read, skipped", file)
+	}
+	for _, failure := range state.report.ownershipFailures {
+		state.report.warn("ownership of %v can't be changed: %v", failure.Path, failure.Err)
+	}
+	report.Warnings = state.report.warnings
+	return report, nil
+}
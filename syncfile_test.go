@@ -0,0 +1,71 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_SyncFile(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	srcFile := filepath.Join(src, "file")
+	dstFile := filepath.Join(dst, "renamed")
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.WriteFile(srcFile, []byte("content"), 0644))
+	assert.NoError(t, os.Chtimes(srcFile, mtime, mtime))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "other"), []byte("other"), 0644))
+
+	t.Run("it should copy the missing file", func(t *testing.T) {
+		report, err := New().SyncFile(dstFile, srcFile)
+		assert.NoError(t, err)
+		assert.True(t, report.Changed)
+		assert.Equal(t, int64(7), report.CopiedBytes)
+		content, err := os.ReadFile(dstFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "content", string(content))
+		assert.True(t, mtime.Equal(modTime(t, dstFile)))
+		// The other files of the directory are not synced
+		_, err = os.Lstat(filepath.Join(dst, "other"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("it should not write the file already in sync", func(t *testing.T) {
+		report, err := New().SyncFile(dstFile, srcFile)
+		assert.NoError(t, err)
+		assert.True(t, report.Unchanged())
+	})
+
+	t.Run("it should replace the modified file", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(srcFile, []byte("modified"), 0644))
+		report, err := New().SyncFile(dstFile, srcFile)
+		assert.NoError(t, err)
+		assert.True(t, report.Changed)
+		content, err := os.ReadFile(dstFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "modified", string(content))
+	})
+
+	t.Run("it should only update the metadata of the file with the same content", func(t *testing.T) {
+		assert.NoError(t, os.Chtimes(srcFile, mtime, mtime))
+		report, err := New(WithChecksum).SyncFile(dstFile, srcFile)
+		assert.NoError(t, err)
+		assert.False(t, report.Changed)
+		assert.True(t, report.MetadataChanged)
+		assert.True(t, mtime.Equal(modTime(t, dstFile)))
+	})
+
+	t.Run("it should refuse to sync a directory", func(t *testing.T) {
+		_, err := New().SyncFile(dst, src)
+		assert.Error(t, err)
+	})
+}
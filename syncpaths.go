@@ -0,0 +1,175 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SyncPaths syncs the paths of relPaths, relative to src, to their destination
+// in dst without walking the rest of the trees, for the callers which already
+// know the changed paths. Directories are synced with their whole content and
+// the paths missing from src are deleted from dst unless NoDelete is set. The
+// missing parent directories of the paths are created on the destination.
+// WithManifest, TrustManifest, WithEventPublisher and WithProgress don't
+// apply.
+func (s *FsSyncer) SyncPaths(dst, src string, relPaths []string) (SyncReport, error) {
+	report, err := s.syncPaths(dst, src, relPaths)
+	s.hookComplete(report, err)
+	return report, err
+}
+
+func (s *FsSyncer) syncPaths(dst, src string, relPaths []string) (SyncReport, error) {
+	s = s.forSource(src)
+	syncer := *s
+	syncer.hooks.OnComplete = nil
+	syncer.destinationPrefix = ""
+	syncer.manifestPath = ""
+	syncer.trustManifest = false
+	syncer.publisher = nil
+	syncer.progressFunc = nil
+	state := syncer.newSyncState()
+	report := state.report
+
+	src = filepath.Clean(src)
+	paths := map[string]bool{}
+	for _, rel := range relPaths {
+		rel = filepath.Clean(rel)
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return report, errors.Errorf("%v is not a relative path located in the source", rel)
+		}
+		paths[filepath.Join(src, rel)] = true
+	}
+
+	dst, err := s.prefixedDestination(filepath.Clean(dst))
+	if err != nil {
+		return report, err
+	}
+	err = checkOverlap(dst, src)
+	if err != nil {
+		return report, err
+	}
+	err = s.checkSandbox()
+	if err != nil {
+		return report, err
+	}
+	err = s.checkTempDir(dst)
+	if err != nil {
+		return report, err
+	}
+	state.dstRoot = dst
+	err = s.createPrefixParents(dst)
+	if err != nil {
+		return report, err
+	}
+
+	for _, path := range topmostPaths(paths) {
+		if syncer.isExcludedPath(src, path) {
+			continue
+		}
+		if path != src {
+			err = syncer.createParents(state, dst, src, path)
+			if err != nil {
+				return report, err
+			}
+		}
+		pathReport, err := syncer.syncPath(dst, src, path)
+		if pathReport, ok := pathReport.(*fsSyncReport); ok {
+			mergeErr := report.merge(pathReport)
+			if mergeErr != nil {
+				return report, mergeErr
+			}
+		}
+		if err != nil {
+			return report, err
+		}
+		syncer.trackModifiedParents(state, dst, src, path)
+	}
+
+	// The created parents have their times once their content is synced, the
+	// existing ones get the times of their source again
+	err = syncer.restoreDeletionParentTimes(state)
+	if err != nil {
+		return report, err
+	}
+	err = syncer.applyTimes(state)
+	if err != nil {
+		return report, err
+	}
+	return report, state.memory.err
+}
+
+// trackModifiedParents schedules the times of the destination directories
+// containing path, up to the root, to be set to the times of their source
+// directories: syncing path may have created or deleted entries in any of them
+func (s *FsSyncer) trackModifiedParents(state syncState, dst, src, path string) {
+	for parent := path; parent != src; {
+		parent = filepath.Dir(parent)
+		s.trackDeletionParent(state, s.destinationPath(dst, src, parent, state.report), parent)
+	}
+}
+
+// createParents syncs the parent directories of path, located in src, which
+// are missing from dst or which are not directories on dst. The other entries
+// of these directories are not synced.
+func (s *FsSyncer) createParents(state syncState, dst, src, path string) error {
+	rel, err := filepath.Rel(src, filepath.Dir(path))
+	if err != nil {
+		return errors.Wrapf(err, "fail to get path of %v in %v", path, src)
+	}
+	if rel == "." {
+		return nil
+	}
+	walk := s.syncWalkFunc(state, dst, src)
+	parent := src
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		parent = filepath.Join(parent, name)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			// path is missing too, its destination is deleted
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to stat %v", parent)
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		dstInfo, err := os.Lstat(s.destinationPath(dst, src, parent, state.report))
+		if err == nil && dstInfo.IsDir() {
+			continue
+		}
+		err = walk(parent, info, nil)
+		if err == filepath.SkipDir {
+			return errors.Errorf("fail to sync %v, its parent %v is protected on the destination", path, parent)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge adds the changes, warnings and skipped files of other to the report
+func (r *fsSyncReport) merge(other *fsSyncReport) error {
+	err := other.fileChanges.each(func(file string, _ []byte) error {
+		r.fileChanges.add(file)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.pendingDeletions = append(r.pendingDeletions, other.pendingDeletions...)
+	r.copiedBytes += other.copiedBytes
+	r.warnings = append(r.warnings, other.warnings...)
+	r.unreadableFiles = append(r.unreadableFiles, other.unreadableFiles...)
+	r.unsafeSymlinks = append(r.unsafeSymlinks, other.unsafeSymlinks...)
+	r.deletionFailures = append(r.deletionFailures, other.deletionFailures...)
+	r.ownershipFailures = append(r.ownershipFailures, other.ownershipFailures...)
+	r.resourceUsage = append(r.resourceUsage, other.resourceUsage...)
+	for path, renamed := range other.renamedPaths {
+		r.renamedPaths[path] = renamed
+	}
+	r.metadataChanged = r.metadataChanged || other.metadataChanged
+	return nil
+}
@@ -0,0 +1,89 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_SyncPaths(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	files := map[string]string{"dir/changed": "a", "untouched": "a", "gone": "a"}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(content), 0644))
+	}
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "changed"), []byte("changed"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "untouched"), []byte("changed"), 0644))
+	assert.NoError(t, os.Remove(filepath.Join(src, "gone")))
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "new", "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "new", "sub", "file"), []byte("new"), 0644))
+	for _, dir := range []string{"new/sub", "new"} {
+		assert.NoError(t, os.Chtimes(filepath.Join(src, dir), mtime, mtime))
+	}
+
+	t.Run("it should reject the paths outside of the source", func(t *testing.T) {
+		_, err := New().SyncPaths(dst, src, []string{"../other"})
+		assert.Error(t, err)
+	})
+
+	t.Run("it should only sync the given paths", func(t *testing.T) {
+		report, err := New().SyncPaths(dst, src, []string{"dir/changed", "new/sub/file", "./gone"})
+		assert.NoError(t, err)
+		// new, new/sub, new/sub/file, dir/changed and gone
+		assert.Equal(t, 5, report.ChangeCount())
+		assert.True(t, report.HasChanged(filepath.Join(dst, "new", "sub")))
+
+		content, err := os.ReadFile(filepath.Join(dst, "dir", "changed"))
+		assert.NoError(t, err)
+		assert.Equal(t, "changed", string(content))
+		content, err = os.ReadFile(filepath.Join(dst, "new", "sub", "file"))
+		assert.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+		content, err = os.ReadFile(filepath.Join(dst, "untouched"))
+		assert.NoError(t, err)
+		assert.Equal(t, "a", string(content))
+		_, err = os.Lstat(filepath.Join(dst, "gone"))
+		assert.True(t, os.IsNotExist(err))
+		for _, dir := range []string{"new/sub", "new"} {
+			assert.True(t, mtime.Equal(modTime(t, filepath.Join(dst, dir))), dir)
+		}
+	})
+	t.Run("it should restore the times of the parent directories", func(t *testing.T) {
+		tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+		assert.NoError(t, err)
+		defer os.RemoveAll(tmp)
+		src := filepath.Join(tmp, "src")
+		dst := filepath.Join(tmp, "dst")
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, "a"), 0755))
+		_, err = New().Sync(dst, src)
+		assert.NoError(t, err)
+
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "a", "b", "file"), []byte("a"), 0644))
+		assert.NoError(t, os.MkdirAll(filepath.Join(src, "x"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "x", "file"), []byte("a"), 0644))
+		dirs := []string{"a/b", "a", "x", "."}
+		for _, dir := range dirs {
+			assert.NoError(t, os.Chtimes(filepath.Join(src, dir), mtime, mtime))
+		}
+
+		_, err = New().SyncPaths(dst, src, []string{"a/b/file", "x/file"})
+		assert.NoError(t, err)
+		for _, dir := range dirs {
+			assert.True(t, mtime.Equal(modTime(t, filepath.Join(dst, dir))), dir)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package fssync
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// statAtime returns the access time of stat
+func statAtime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(stat.Atimespec.Sec, stat.Atimespec.Nsec)
+}
+
+// statMtime returns the modification time of stat
+func statMtime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(stat.Mtimespec.Sec, stat.Mtimespec.Nsec)
+}
+
+// dropCache discards the pages of the length bytes at offset of fd from the
+// buffer cache with posix_fadvise, errors are ignored as it's only a hint
+func dropCache(fd *os.File, offset, length int64) {
+	unix.Fadvise(int(fd.Fd()), offset, length, unix.FADV_DONTNEED)
+}
+
+// adviseSequential tells the kernel that fd is read sequentially from its
+// start with posix_fadvise, to read ahead more of it. Errors are ignored as
+// it's only a hint.
+func adviseSequential(fd *os.File) {
+	unix.Fadvise(int(fd.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+	unix.Fadvise(int(fd.Fd()), 0, 0, unix.FADV_WILLNEED)
+}
+
+// mknod creates the special file at path with the device number dev
+func mknod(path string, mode uint32, dev uint64) error {
+	return unix.Mknod(path, mode, dev)
+}
+
+// cloneFile is not supported, FreeBSD has no reflinks
+func cloneFile(dst, src *os.File) error {
+	return unix.EOPNOTSUPP
+}
+
+// fallocate preallocates length bytes to fd with posix_fallocate, which
+// returns its error instead of setting errno
+func fallocate(fd *os.File, length int64) error {
+	errno, _, _ := unix.Syscall(unix.SYS_POSIX_FALLOCATE, fd.Fd(), 0, uintptr(length))
+	if errno != 0 {
+		return unix.Errno(errno)
+	}
+	return nil
+}
+
+// lsetxattr sets the extended attribute name of path, without following
+// symlinks. The user. prefix selects the user namespace of extattr(2).
+func lsetxattr(path, name string, value []byte) error {
+	return unix.Lsetxattr(path, name, value, 0)
+}
+
+// lgetxattr reads the extended attribute name of path into value, without
+// following symlinks
+func lgetxattr(path, name string, value []byte) (int, error) {
+	return unix.Lgetxattr(path, name, value)
+}
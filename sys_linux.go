@@ -0,0 +1,61 @@
+package fssync
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// statAtime returns the access time of stat
+func statAtime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+}
+
+// statMtime returns the modification time of stat
+func statMtime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(stat.Mtim.Sec, stat.Mtim.Nsec)
+}
+
+// dropCache discards the pages of the length bytes at offset of fd from the
+// page cache with posix_fadvise, errors are ignored as it's only a hint
+func dropCache(fd *os.File, offset, length int64) {
+	unix.Fadvise(int(fd.Fd()), offset, length, unix.FADV_DONTNEED)
+}
+
+// adviseSequential tells the kernel that fd is read sequentially from its
+// start with posix_fadvise, to read ahead more of it. Errors are ignored as
+// it's only a hint.
+func adviseSequential(fd *os.File) {
+	unix.Fadvise(int(fd.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+	unix.Fadvise(int(fd.Fd()), 0, 0, unix.FADV_WILLNEED)
+}
+
+// mknod creates the special file at path with the device number dev
+func mknod(path string, mode uint32, dev uint64) error {
+	return unix.Mknod(path, mode, int(dev))
+}
+
+// cloneFile shares the extents of src with dst with the FICLONE ioctl,
+// supported by btrfs or XFS for instance
+func cloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
+
+// fallocate preallocates length bytes to fd
+func fallocate(fd *os.File, length int64) error {
+	return unix.Fallocate(int(fd.Fd()), 0, 0, length)
+}
+
+// lsetxattr sets the extended attribute name of path, without following
+// symlinks
+func lsetxattr(path, name string, value []byte) error {
+	return unix.Lsetxattr(path, name, value, 0)
+}
+
+// lgetxattr reads the extended attribute name of path into value, without
+// following symlinks
+func lgetxattr(path, name string, value []byte) (int, error) {
+	return unix.Lgetxattr(path, name, value)
+}
@@ -0,0 +1,17 @@
+package fssync
+
+import "golang.org/x/sys/unix"
+
+// mountTmpfs mounts an empty tmpfs on dir, root privileges are required
+func mountTmpfs(dir string) error {
+	return unix.Mount("tmpfs", dir, "tmpfs", 0, "mode=0755")
+}
+
+func unmount(dir string) error {
+	return unix.Unmount(dir, 0)
+}
+
+// bindMount mounts the src directory on dir, root privileges are required
+func bindMount(src, dir string) error {
+	return unix.Mount(src, dir, "", unix.MS_BIND, "")
+}
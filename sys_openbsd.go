@@ -0,0 +1,51 @@
+package fssync
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// statAtime returns the access time of stat
+func statAtime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(stat.Atim.Sec, stat.Atim.Nsec)
+}
+
+// statMtime returns the modification time of stat
+func statMtime(stat *syscall.Stat_t) time.Time {
+	return time.Unix(stat.Mtim.Sec, stat.Mtim.Nsec)
+}
+
+// dropCache does nothing, OpenBSD has no posix_fadvise and its buffer cache
+// can't be controlled per file
+func dropCache(fd *os.File, offset, length int64) {}
+
+// adviseSequential does nothing, OpenBSD has no posix_fadvise
+func adviseSequential(fd *os.File) {}
+
+// mknod creates the special file at path with the device number dev
+func mknod(path string, mode uint32, dev uint64) error {
+	return unix.Mknod(path, mode, int(dev))
+}
+
+// cloneFile is not supported, OpenBSD has no reflinks
+func cloneFile(dst, src *os.File) error {
+	return unix.EOPNOTSUPP
+}
+
+// fallocate is not supported, OpenBSD has no posix_fallocate
+func fallocate(fd *os.File, length int64) error {
+	return unix.EOPNOTSUPP
+}
+
+// lsetxattr is not supported, OpenBSD has no extended attributes
+func lsetxattr(path, name string, value []byte) error {
+	return unix.EOPNOTSUPP
+}
+
+// lgetxattr is not supported, OpenBSD has no extended attributes
+func lgetxattr(path, name string, value []byte) (int, error) {
+	return -1, unix.EOPNOTSUPP
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package fssync
+
+import "github.com/pkg/errors"
+
+// mountTmpfs is not implemented, the tests requiring a mount point are
+// skipped
+func mountTmpfs(dir string) error {
+	return errors.New("mounting a tmpfs is only implemented on Linux")
+}
+
+func unmount(dir string) error {
+	return nil
+}
+
+// bindMount is not implemented, the tests requiring it are skipped
+func bindMount(src, dir string) error {
+	return errors.New("bind mounts are only implemented on Linux")
+}
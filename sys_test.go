@@ -0,0 +1,105 @@
+package fssync
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatTimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "file")
+	assert.NoError(t, os.WriteFile(path, []byte("file"), 0644))
+	atime := time.Unix(1e9, 123456789)
+	mtime := time.Unix(1.5e9, 987654321)
+	assert.NoError(t, lutimes(path, atime, mtime))
+
+	info, err := os.Lstat(path)
+	assert.NoError(t, err)
+	stat := sysStatOf(t, info)
+	assert.True(t, atime.Equal(statAtime(stat)), statAtime(stat))
+	assert.True(t, mtime.Equal(statMtime(stat)), statMtime(stat))
+	assert.True(t, info.ModTime().Equal(statMtime(stat)))
+}
+
+func TestFileCopier_Copy(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	content := bytes.Repeat([]byte("fssync"), 10000)
+	srcPath := filepath.Join(tmp, "src")
+	assert.NoError(t, os.WriteFile(srcPath, content, 0644))
+
+	tests := map[string]fileCopier{
+		"it should copy the content":                         {bufferSize: 4096},
+		"it should copy the content without caching it":      {bufferSize: 4096, noCache: true},
+		"it should copy the content with the default buffer": {},
+	}
+	for msg, copier := range tests {
+		t.Run(msg, func(t *testing.T) {
+			src, err := os.Open(srcPath)
+			assert.NoError(t, err)
+			defer src.Close()
+			dstPath := filepath.Join(tmp, "dst")
+			dst, err := os.Create(dstPath)
+			assert.NoError(t, err)
+			defer dst.Close()
+
+			n, err := copier.Copy(dst, src)
+			assert.NoError(t, err)
+			assert.EqualValues(t, len(content), n)
+			copied, err := os.ReadFile(dstPath)
+			assert.NoError(t, err)
+			assert.Equal(t, content, copied)
+		})
+	}
+}
+
+// sysStatOf returns the detailed stat info of info
+func sysStatOf(t *testing.T, info os.FileInfo) *sysStat {
+	stat, ok := fileStat(info)
+	assert.True(t, ok)
+	return stat
+}
+
+func TestLstatAt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("lstatAt stats the entries by their path on Windows")
+	}
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "file"), []byte("content"), 0640))
+	assert.NoError(t, os.Mkdir(filepath.Join(tmp, "dir"), 0755|os.ModeSticky))
+	assert.NoError(t, os.Chmod(filepath.Join(tmp, "dir"), 0755|os.ModeSticky))
+	assert.NoError(t, os.Symlink("file", filepath.Join(tmp, "link")))
+
+	dir, err := os.Open(tmp)
+	assert.NoError(t, err)
+	defer dir.Close()
+	for _, name := range []string{"file", "dir", "link"} {
+		expected, err := os.Lstat(filepath.Join(tmp, name))
+		assert.NoError(t, err)
+		info, err := lstatAt(dir, name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected.Name(), info.Name())
+		assert.Equal(t, expected.Mode(), info.Mode())
+		assert.Equal(t, expected.Size(), info.Size())
+		assert.True(t, expected.ModTime().Equal(info.ModTime()))
+		assert.Equal(t, expected.Sys(), info.Sys())
+	}
+
+	_, err = lstatAt(dir, "missing")
+	assert.True(t, os.IsNotExist(err))
+	_, err = openDirAt(dir, "link")
+	assert.Error(t, err)
+}
@@ -0,0 +1,189 @@
+//go:build linux || freebsd || openbsd
+
+package fssync
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sysStat is the detailed stat info of an entry
+type sysStat = syscall.Stat_t
+
+// fileStat returns the detailed stat info of info
+func fileStat(info os.FileInfo) (*sysStat, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return stat, ok
+}
+
+// sameFile returns true if a and b are the stat info of the same entry,
+// identified by their device and inode numbers
+func sameFile(a, b os.FileInfo) bool {
+	aStat, aOk := fileStat(a)
+	bStat, bOk := fileStat(b)
+	return aOk && bOk && aStat.Dev == bStat.Dev && aStat.Ino == bStat.Ino
+}
+
+// isWhiteoutDevice returns true if info is a character device with the 0:0
+// device number, the whiteouts of overlayfs
+func isWhiteoutDevice(info os.FileInfo) bool {
+	stat, ok := fileStat(info)
+	return ok && info.Mode()&os.ModeCharDevice != 0 && stat.Rdev == 0
+}
+
+// openNoFollow opens path like os.OpenFile, without following path if it's a
+// symlink: it fails with ELOOP instead
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag|syscall.O_NOFOLLOW, perm)
+}
+
+// isOwnedByProcess returns true if the info entry is owned by the effective
+// user of the process
+func isOwnedByProcess(info os.FileInfo) bool {
+	stat, ok := fileStat(info)
+	return ok && int(stat.Uid) == os.Geteuid()
+}
+
+// openDirAt opens the name directory located in the dir directory with
+// openat(2), without following name if it's a symlink
+func openDirAt(dir *os.File, name string) (*os.File, error) {
+	path := filepath.Join(dir.Name(), name)
+	fd, err := unix.Openat(int(dir.Fd()), name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// lstatAt returns the stat info of the name entry located in the dir
+// directory with fstatat(2), without following name if it's a symlink
+func lstatAt(dir *os.File, name string) (os.FileInfo, error) {
+	var stat unix.Stat_t
+	err := unix.Fstatat(int(dir.Fd()), name, &stat, unix.AT_SYMLINK_NOFOLLOW)
+	if err != nil {
+		return nil, &os.PathError{Op: "fstatat", Path: filepath.Join(dir.Name(), name), Err: err}
+	}
+	// Both are the stat struct of the kernel
+	sysStat := *(*syscall.Stat_t)(unsafe.Pointer(&stat))
+	return &statInfo{name: name, stat: &sysStat, dir: dir}, nil
+}
+
+// openFileAt opens the name file located in the dir directory for reading
+// with openat(2), without following name if it's a symlink
+func openFileAt(dir *os.File, name string) (*os.File, error) {
+	path := filepath.Join(dir.Name(), name)
+	fd, err := unix.Openat(int(dir.Fd()), name, unix.O_RDONLY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "openat", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// statDir returns the directory an entry has been stated in by lstatAt, nil
+// if info has not been returned by lstatAt
+func statDir(info os.FileInfo) *os.File {
+	statInfo, ok := info.(*statInfo)
+	if !ok {
+		return nil
+	}
+	return statInfo.dir
+}
+
+// statInfo is the os.FileInfo of a stat struct returned by lstatAt, stated in
+// the dir directory
+type statInfo struct {
+	name string
+	stat *syscall.Stat_t
+	dir  *os.File
+}
+
+func (i *statInfo) Name() string       { return i.name }
+func (i *statInfo) Size() int64        { return i.stat.Size }
+func (i *statInfo) ModTime() time.Time { return statMtime(i.stat) }
+func (i *statInfo) IsDir() bool        { return i.Mode().IsDir() }
+func (i *statInfo) Sys() interface{}   { return i.stat }
+
+func (i *statInfo) Mode() os.FileMode {
+	mode := os.FileMode(i.stat.Mode & 0777)
+	switch i.stat.Mode & syscall.S_IFMT {
+	case syscall.S_IFBLK:
+		mode |= os.ModeDevice
+	case syscall.S_IFCHR:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case syscall.S_IFDIR:
+		mode |= os.ModeDir
+	case syscall.S_IFIFO:
+		mode |= os.ModeNamedPipe
+	case syscall.S_IFLNK:
+		mode |= os.ModeSymlink
+	case syscall.S_IFSOCK:
+		mode |= os.ModeSocket
+	}
+	if i.stat.Mode&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if i.stat.Mode&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if i.stat.Mode&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// lutimes sets the access and modification times of path with utimensat(2),
+// which keeps their nanoseconds, without following path if it's a symlink. A
+// zero time is left unchanged like with os.Chtimes.
+func lutimes(path string, atime, mtime time.Time) error {
+	ts := make([]unix.Timespec, 2)
+	for i, t := range []time.Time{atime, mtime} {
+		if t.IsZero() {
+			ts[i] = unix.Timespec{Nsec: unix.UTIME_OMIT}
+			continue
+		}
+		var err error
+		ts[i], err = unix.TimeToTimespec(t)
+		if err != nil {
+			return err
+		}
+	}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// unixMode converts the permissions of mode to the bits expected by open(2)
+func unixMode(mode os.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		m |= unix.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		m |= unix.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		m |= unix.S_ISVTX
+	}
+	return m
+}
+
+// createSpecialFile creates the character device, block device or FIFO of the
+// tar header at path
+func createSpecialFile(path string, mode os.FileMode, header *tar.Header) error {
+	dev := unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))
+	return mknod(path, unixMode(mode)|fileTypeBits(header.Typeflag), dev)
+}
+
+func fileTypeBits(typeflag byte) uint32 {
+	switch typeflag {
+	case tar.TypeChar:
+		return unix.S_IFCHR
+	case tar.TypeBlock:
+		return unix.S_IFBLK
+	}
+	return unix.S_IFIFO
+}
@@ -0,0 +1,152 @@
+package fssync
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sysStat is the detailed stat info of an entry. Windows has no owners nor
+// inode numbers in the stat info: the entries are owned by 0:0 and have a
+// single link, ownership and hardlinks are not preserved.
+type sysStat struct {
+	Dev   uint64
+	Ino   uint64
+	Nlink uint64
+	Uid   uint32
+	Gid   uint32
+	atime time.Time
+	mtime time.Time
+}
+
+// fileStat returns the detailed stat info of info
+func fileStat(info os.FileInfo) (*sysStat, bool) {
+	stat := &sysStat{Nlink: 1, atime: info.ModTime(), mtime: info.ModTime()}
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		stat.atime = time.Unix(0, data.LastAccessTime.Nanoseconds())
+	}
+	return stat, true
+}
+
+// statAtime returns the access time of stat
+func statAtime(stat *sysStat) time.Time {
+	return stat.atime
+}
+
+// statMtime returns the modification time of stat
+func statMtime(stat *sysStat) time.Time {
+	return stat.mtime
+}
+
+// lutimes sets the access and modification times of path without following
+// path if it's a symlink or a junction. A zero time is left unchanged like
+// with os.Chtimes.
+func lutimes(path string, atime, mtime time.Time) error {
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	handle, err := syscall.CreateFile(pathp, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_WRITE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return &os.PathError{Op: "lutimes", Path: path, Err: err}
+	}
+	defer syscall.Close(handle)
+
+	var a, m *syscall.Filetime
+	if !atime.IsZero() {
+		ft := syscall.NsecToFiletime(atime.UnixNano())
+		a = &ft
+	}
+	if !mtime.IsZero() {
+		ft := syscall.NsecToFiletime(mtime.UnixNano())
+		m = &ft
+	}
+	err = syscall.SetFileTime(handle, nil, a, m)
+	if err != nil {
+		return &os.PathError{Op: "lutimes", Path: path, Err: err}
+	}
+	return nil
+}
+
+// dropCache does nothing, the cache manager of Windows can't be controlled
+// per range of an open file
+func dropCache(fd *os.File, offset, length int64) {}
+
+// adviseSequential does nothing, the read ahead of Windows can't be hinted on
+// an opened file
+func adviseSequential(fd *os.File) {}
+
+// createSpecialFile is not supported, Windows has no device files nor FIFOs
+func createSpecialFile(path string, mode os.FileMode, header *tar.Header) error {
+	return errors.Wrapf(syscall.EWINDOWS, "fail to create special file %v", path)
+}
+
+// cloneFile is not supported
+func cloneFile(dst, src *os.File) error {
+	return syscall.EWINDOWS
+}
+
+// fallocate is not supported
+func fallocate(fd *os.File, length int64) error {
+	return syscall.EWINDOWS
+}
+
+// lsetxattr is not supported, the alternate data streams of NTFS are not
+// extended attributes
+func lsetxattr(path, name string, value []byte) error {
+	return syscall.EWINDOWS
+}
+
+// lgetxattr is not supported, see lsetxattr
+func lgetxattr(path, name string, value []byte) (int, error) {
+	return -1, syscall.EWINDOWS
+}
+
+// openNoFollow opens path like os.OpenFile, Windows has no O_NOFOLLOW
+func openNoFollow(path string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(path, flag, perm)
+}
+
+// isOwnedByProcess returns true, the stat info of Windows has no owner
+func isOwnedByProcess(info os.FileInfo) bool {
+	return true
+}
+
+// openDirAt opens the name directory located in the dir directory by its
+// path, Windows has no openat
+func openDirAt(dir *os.File, name string) (*os.File, error) {
+	return os.Open(filepath.Join(dir.Name(), name))
+}
+
+// lstatAt returns the stat info of the name entry located in the dir
+// directory by its path, Windows has no fstatat
+func lstatAt(dir *os.File, name string) (os.FileInfo, error) {
+	return os.Lstat(filepath.Join(dir.Name(), name))
+}
+
+// openFileAt opens the name file located in the dir directory by its path,
+// Windows has no openat
+func openFileAt(dir *os.File, name string) (*os.File, error) {
+	return os.Open(filepath.Join(dir.Name(), name))
+}
+
+// statDir returns nil, the entries are stated by their path on Windows
+func statDir(info os.FileInfo) *os.File {
+	return nil
+}
+
+// sameFile returns true if a and b are the stat info of the same entry, the
+// stat info of Windows has no inode numbers
+func sameFile(a, b os.FileInfo) bool {
+	return os.SameFile(a, b)
+}
+
+// isWhiteoutDevice returns false, Windows has no device files
+func isWhiteoutDevice(info os.FileInfo) bool {
+	return false
+}
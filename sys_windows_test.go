@@ -0,0 +1,39 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_WindowsAttributes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	path := filepath.Join(src, "readonly")
+	assert.NoError(t, os.WriteFile(path, []byte("readonly"), 0644))
+	mtime := time.Unix(1.5e9, 100)
+	assert.NoError(t, lutimes(path, mtime, mtime))
+	// The mode of a read-only file is 0444 on Windows
+	assert.NoError(t, os.Chmod(path, 0444))
+	defer os.Chmod(filepath.Join(dst, "readonly"), 0666)
+
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+	info, err := os.Lstat(filepath.Join(dst, "readonly"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0444), info.Mode())
+	assert.True(t, mtime.Equal(info.ModTime()))
+	assert.EqualValues(t, 1, sysStatOf(t, info).Nlink)
+
+	report, err := New().Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+}
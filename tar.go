@@ -0,0 +1,407 @@
+package fssync
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SyncToTar writes the src tree as a tar stream to w instead of syncing it to
+// a destination directory, to produce image layers for instance. The entries
+// are named relatively to src, under the WithDestinationPrefix directory if
+// any, the first one being the root directory with the mode and times of src.
+// Hardlinks, symlinks and ownership are handled like with Sync, absolute
+// symlink targets located in src are rewritten to relative targets unless
+// NoSymlinkRewrite is set. Options specific to a destination directory
+// (deletions, manifest, protected paths, etc.) are ignored.
+//
+// Like Sync, the report lists the written entries. The tar stream is closed
+// but not w.
+func (s *FsSyncer) SyncToTar(w io.Writer, src string) (SyncReport, error) {
+	s = s.forSource(src)
+	state := s.newSyncState()
+	report := state.report
+	src = filepath.Clean(src)
+
+	err := s.checkLongNames(src)
+	if err != nil {
+		return report, err
+	}
+	state.srcDevice, err = s.sourceDevice(src)
+	if err != nil {
+		return report, err
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.Walk(src, s.skipOtherFileSystems(state, src, s.tarWalkFunc(state, tw, src)))
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to walk %v", src)
+	}
+	err = tw.Close()
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to close tar stream")
+	}
+	return report, state.memory.err
+}
+
+func (s *FsSyncer) tarWalkFunc(state syncState, tw *tar.Writer, src string) filepath.WalkFunc {
+	report := state.report
+	return func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && s.ignoreNotFound {
+				return nil
+			}
+			if os.IsPermission(err) && s.continueOnError {
+				report.unreadableFiles = append(report.unreadableFiles, path)
+				return nil
+			}
+			return err
+		}
+		if path == src {
+			if !info.IsDir() {
+				return nil
+			}
+			// The root entry carries the mode and times of src to the
+			// destination root
+			return s.writeTarEntry(state, tw, src, path, info)
+		}
+		skip, err := s.checkCaseCollision(state, path, info)
+		if skip || err != nil {
+			return err
+		}
+		info, skip, err = s.resolveSymlink(src, path, info, report)
+		if skip || err != nil {
+			return err
+		}
+		if s.isExcluded(src, path, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if s.isFiltered(info) {
+			return nil
+		}
+
+		err = s.writeTarEntry(state, tw, src, path, info)
+		if isUnreadableSource(err) && s.continueOnError {
+			report.unreadableFiles = append(report.unreadableFiles, path)
+			return nil
+		}
+		return err
+	}
+}
+
+// writeTarEntry writes the header and the content of the source entry at path
+func (s *FsSyncer) writeTarEntry(state syncState, tw *tar.Writer, src, path string, info os.FileInfo) error {
+	report := state.report
+	stat, ok := fileStat(info)
+	if !ok {
+		return errors.Errorf("fail to get detailed stat info for %s", path)
+	}
+	name := s.tarEntryName(src, path, report)
+
+	link := ""
+	if isSymlink(info) {
+		target, err := s.tarSymlinkTarget(src, path)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return errors.Wrapf(err, "fail to create tar header of %v", path)
+	}
+	// PAX keeps the sub-second precision of times, compared by Sync
+	header.Format = tar.FormatPAX
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	header.Uname, header.Gname = "", ""
+	header.Uid, header.Gid = os.Getuid(), os.Getgid()
+	if owner, ok := s.destinationOwner(state, src, path, stat); ok {
+		header.Uid, header.Gid = int(stat.Uid), int(stat.Gid)
+		if owner.UID != -1 {
+			header.Uid = owner.UID
+		}
+		if owner.GID != -1 {
+			header.Gid = owner.GID
+		}
+	}
+
+	if !s.noHardlinks && !info.IsDir() && stat.Nlink > 1 {
+		if first, ok := state.inoMap.get(stat.Ino); ok {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = first
+			header.Size = 0
+			return s.writeTarHeader(tw, header, report)
+		}
+		state.inoMap.set(stat.Ino, name)
+	}
+
+	if !info.Mode().IsRegular() {
+		return s.writeTarHeader(tw, header, report)
+	}
+
+	// The source file is opened before writing the header to keep the stream
+	// valid if it can't be read
+	fd, err := os.Open(path)
+	if err != nil {
+		err = sourceReadError(err)
+		return errors.Wrapf(err, "fail to open src %v", path)
+	}
+	defer fd.Close()
+	err = s.writeTarHeader(tw, header, report)
+	if err != nil {
+		return err
+	}
+	n, err := s.copier.Copy(tw, fd)
+	if err != nil {
+		return errors.Wrapf(err, "fail to write content of %v to tar stream", path)
+	}
+	report.copiedBytes += n
+	return nil
+}
+
+func (s *FsSyncer) writeTarHeader(tw *tar.Writer, header *tar.Header, report *fsSyncReport) error {
+	err := tw.WriteHeader(header)
+	if err != nil {
+		return errors.Wrapf(err, "fail to write tar header of %v", header.Name)
+	}
+	report.fileChanges.add(strings.TrimSuffix(header.Name, "/"))
+	return nil
+}
+
+// tarEntryName returns the name of the entry of the source path in the tar
+// stream
+func (s *FsSyncer) tarEntryName(src, path string, report *fsSyncReport) string {
+	name := s.destinationPath("", src, path, report)
+	if s.destinationPrefix != "" {
+		name = filepath.Join(filepath.Clean(s.destinationPrefix), name)
+	}
+	return name
+}
+
+// tarSymlinkTarget returns the target of the symlink at path, rewritten
+// relatively to the symlink when it contains the source path, as the location
+// where the tar stream is extracted is unknown
+func (s *FsSyncer) tarSymlinkTarget(src, path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		err = sourceReadError(err)
+		return "", errors.Wrapf(err, "fail to get link destination of src %v", path)
+	}
+	if s.noSymlinkRewrite {
+		return target, nil
+	}
+	return relativeSymlinkTarget(target, src, path), nil
+}
+
+// SyncFromTar applies the tar stream read from r onto dst: the stream is
+// extracted to a staging directory next to dst, which is then synced to dst
+// with the change detection of Sync. Only the entries which differ are
+// rewritten and the extraneous files of dst are deleted, according to the
+// options of the syncer. Entry names escaping the root of the stream are
+// rejected.
+func (s *FsSyncer) SyncFromTar(r io.Reader, dst string) (SyncReport, error) {
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get absolute path of %v", dst)
+	}
+	staging := tmpFileName(filepath.Dir(absDst), filepath.Base(absDst))
+	err = os.Mkdir(staging, 0700)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to create staging directory %v", staging)
+	}
+	defer os.RemoveAll(staging)
+
+	// The root directory keeps the mode and times of dst unless the stream
+	// has a root entry
+	rootMode := os.FileMode(0755)
+	dirTimes := map[string]statTimes{}
+	if info, err := os.Stat(dst); err == nil {
+		rootMode = info.Mode().Perm()
+		if stat, ok := fileStat(info); ok {
+			dirTimes[staging] = statTimes{
+				atime: statAtime(stat),
+				mtime: statMtime(stat),
+			}
+		}
+	}
+	err = os.Chmod(staging, rootMode)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to chmod %v", staging)
+	}
+
+	err = extractTar(r, staging, dirTimes)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sync(dst, staging)
+}
+
+// extractTar extracts the tar stream read from r to the dir directory,
+// preserving modes, times and, when running as root, ownership. The times of
+// dirTimes are set to the directories once extracted.
+func extractTar(r io.Reader, dir string, dirTimes map[string]statTimes) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "fail to read tar stream")
+		}
+		path, err := tarEntryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			err = os.Chmod(path, header.FileInfo().Mode())
+			if err != nil {
+				return errors.Wrapf(err, "fail to chmod %v", path)
+			}
+			dirTimes[path] = statTimes{atime: header.AccessTime, mtime: header.ModTime}
+			continue
+		}
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return errors.Wrapf(err, "fail to create parent directory of %v", path)
+		}
+
+		// Later entries of a stream replace the previous ones
+		info, err := os.Lstat(path)
+		if err == nil && (header.Typeflag != tar.TypeDir || !info.IsDir()) {
+			err = os.RemoveAll(path)
+			if err != nil {
+				return errors.Wrapf(err, "fail to remove %v", path)
+			}
+		}
+
+		err = extractTarEntry(tr, header, dir, path)
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag == tar.TypeLink {
+			continue
+		}
+		if os.Geteuid() == 0 {
+			err = os.Lchown(path, header.Uid, header.Gid)
+			if err != nil {
+				return errors.Wrapf(err, "fail to chown %v", path)
+			}
+		}
+		if header.Typeflag == tar.TypeSymlink {
+			err = lutimes(path, header.AccessTime, header.ModTime)
+			if err != nil {
+				return errors.Wrapf(err, "fail to set times of %v", path)
+			}
+			continue
+		}
+		// chmod after chown which clears the setuid and setgid bits
+		err = os.Chmod(path, header.FileInfo().Mode())
+		if err != nil {
+			return errors.Wrapf(err, "fail to chmod %v", path)
+		}
+		if header.Typeflag == tar.TypeDir {
+			// Set once the directory content is extracted
+			dirTimes[path] = statTimes{atime: header.AccessTime, mtime: header.ModTime}
+			continue
+		}
+		err = lutimes(path, header.AccessTime, header.ModTime)
+		if err != nil {
+			return errors.Wrapf(err, "fail to set times of %v", path)
+		}
+	}
+
+	for path, times := range dirTimes {
+		err := lutimes(path, times.atime, times.mtime)
+		if err != nil {
+			return errors.Wrapf(err, "fail to set times of %v", path)
+		}
+	}
+	return nil
+}
+
+func extractTarEntry(tr *tar.Reader, header *tar.Header, dir, path string) error {
+	mode := header.FileInfo().Mode()
+	switch header.Typeflag {
+	case tar.TypeDir:
+		err := os.Mkdir(path, 0700)
+		if err != nil && !os.IsExist(err) {
+			return errors.Wrapf(err, "fail to create directory %v", path)
+		}
+	case tar.TypeReg:
+		fd, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "fail to create %v", path)
+		}
+		defer fd.Close()
+		_, err = io.Copy(fd, tr)
+		if err != nil {
+			return errors.Wrapf(err, "fail to extract %v", path)
+		}
+		err = fd.Close()
+		if err != nil {
+			return errors.Wrapf(err, "fail to close %v", path)
+		}
+	case tar.TypeSymlink:
+		err := os.Symlink(header.Linkname, path)
+		if err != nil {
+			return errors.Wrapf(err, "fail to create symlink %v", path)
+		}
+	case tar.TypeLink:
+		target, err := tarEntryPath(dir, header.Linkname)
+		if err != nil {
+			return err
+		}
+		err = os.Link(target, path)
+		if err != nil {
+			return errors.Wrapf(err, "fail to create hardlink %v", path)
+		}
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		err := createSpecialFile(path, mode, header)
+		if err != nil {
+			return errors.Wrapf(err, "fail to create special file %v", path)
+		}
+	default:
+		return errors.Errorf("unsupported type %q of tar entry %v", header.Typeflag, header.Name)
+	}
+	return nil
+}
+
+// tarEntryPath returns the path of the entry name extracted to dir. Names
+// escaping dir, directly or through a previously extracted symlink, are
+// rejected.
+func tarEntryPath(dir, name string) (string, error) {
+	path := filepath.Join(dir, name)
+	rel, ok := trimPathPrefix(path, dir)
+	if !ok {
+		return "", errors.Errorf("tar entry %v is outside of the extraction directory", name)
+	}
+	parent := dir
+	for _, component := range strings.Split(filepath.Dir(rel), "/") {
+		if component == "" {
+			continue
+		}
+		parent = filepath.Join(parent, component)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return "", errors.Wrapf(err, "fail to stat %v", parent)
+		}
+		if isSymlink(info) {
+			return "", errors.Errorf("tar entry %v is extracted through the symlink %v", name, parent)
+		}
+	}
+	return path, nil
+}
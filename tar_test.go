@@ -0,0 +1,192 @@
+package fssync
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_SyncToTar(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0640))
+	assert.NoError(t, os.Link(filepath.Join(src, "dir", "file"), filepath.Join(src, "hardlink")))
+	assert.NoError(t, os.Symlink("dir/file", filepath.Join(src, "relative")))
+	absFile, err := filepath.Abs(filepath.Join(src, "dir", "file"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Symlink(absFile, filepath.Join(src, "dir", "absolute")))
+
+	type entry struct {
+		typeflag byte
+		linkname string
+		content  string
+		mode     int64
+	}
+
+	cases := []struct {
+		name    string
+		options []func(*FsSyncer)
+		entries map[string]entry
+		// owner of dir/file, the current user if nil
+		owner *Owner
+	}{
+		{
+			name: "default",
+			entries: map[string]entry{
+				"./":           {typeflag: tar.TypeDir, mode: 0755},
+				"dir/":         {typeflag: tar.TypeDir, mode: 0755},
+				"dir/absolute": {typeflag: tar.TypeSymlink, linkname: "file", mode: 0777},
+				"dir/file":     {typeflag: tar.TypeReg, content: "content", mode: 0640},
+				"hardlink":     {typeflag: tar.TypeLink, linkname: "dir/file", mode: 0640},
+				"relative":     {typeflag: tar.TypeSymlink, linkname: "dir/file", mode: 0777},
+			},
+		}, {
+			name:    "with destination prefix, no hardlinks and dereferenced symlinks",
+			options: []func(*FsSyncer){WithDestinationPrefix("layer"), NoHardlinks, WithSymlinkMode(SymlinkDereference)},
+			entries: map[string]entry{
+				"layer/":             {typeflag: tar.TypeDir, mode: 0755},
+				"layer/dir/":         {typeflag: tar.TypeDir, mode: 0755},
+				"layer/dir/absolute": {typeflag: tar.TypeReg, content: "content", mode: 0640},
+				"layer/dir/file":     {typeflag: tar.TypeReg, content: "content", mode: 0640},
+				"layer/hardlink":     {typeflag: tar.TypeReg, content: "content", mode: 0640},
+				"layer/relative":     {typeflag: tar.TypeReg, content: "content", mode: 0640},
+			},
+		}, {
+			name:    "with ownership override",
+			options: []func(*FsSyncer){WithOwnershipOverride(map[string]Owner{"dir": {UID: 1000, GID: 1000}}), WithSymlinkMode(SymlinkSkip)},
+			entries: map[string]entry{
+				"./":       {typeflag: tar.TypeDir, mode: 0755},
+				"dir/":     {typeflag: tar.TypeDir, mode: 0755},
+				"dir/file": {typeflag: tar.TypeReg, content: "content", mode: 0640},
+				"hardlink": {typeflag: tar.TypeLink, linkname: "dir/file", mode: 0640},
+			},
+			owner: &Owner{UID: 1000, GID: 1000},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			report, err := New(c.options...).SyncToTar(buffer, src)
+			assert.NoError(t, err)
+			assert.Equal(t, len(c.entries), report.ChangeCount())
+
+			entries := map[string]entry{}
+			tr := tar.NewReader(buffer)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+				content, err := io.ReadAll(tr)
+				assert.NoError(t, err)
+				entries[header.Name] = entry{
+					typeflag: header.Typeflag,
+					linkname: header.Linkname,
+					content:  string(content),
+					mode:     header.Mode,
+				}
+				if header.Name == "dir/file" {
+					owner := Owner{UID: os.Getuid(), GID: os.Getgid()}
+					if c.owner != nil {
+						owner = *c.owner
+					}
+					assert.Equal(t, owner, Owner{UID: header.Uid, GID: header.Gid})
+				}
+			}
+			assert.Equal(t, c.entries, entries)
+		})
+	}
+}
+
+func TestFsSyncer_SyncFromTar(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0750))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0640))
+	assert.NoError(t, os.Link(filepath.Join(src, "dir", "file"), filepath.Join(src, "hardlink")))
+	assert.NoError(t, os.Symlink("dir/file", filepath.Join(src, "link")))
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous"), []byte("extraneous"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "new"), []byte("new"), 0644))
+
+	stream := &bytes.Buffer{}
+	_, err = New().SyncToTar(stream, src)
+	assert.NoError(t, err)
+	report, err := New().SyncFromTar(stream, dst)
+	assert.NoError(t, err)
+
+	// Only the new file and the deleted one have changed
+	assert.Equal(t, 2, report.ChangeCount())
+	assert.True(t, report.HasChanged(filepath.Join(dst, "new")))
+	assert.True(t, report.HasChanged(filepath.Join(dst, "extraneous")))
+	assert.NoFileExists(t, filepath.Join(dst, "extraneous"))
+	info, err := os.Stat(filepath.Join(dst, "dir"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeDir|0750, info.Mode())
+	// The root directory gets the times of src like the other directories
+	srcInfo, err := os.Stat(src)
+	assert.NoError(t, err)
+	info, err = os.Stat(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, srcInfo.ModTime(), info.ModTime())
+
+	stream.Reset()
+	_, err = New().SyncToTar(stream, src)
+	assert.NoError(t, err)
+	report, err = New().SyncFromTar(stream, dst)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+
+	entries, err := os.ReadDir(tmp)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2, "staging directory must be removed")
+}
+
+func TestFsSyncer_SyncFromTar_Escaping(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+
+	cases := map[string][]*tar.Header{
+		"parent directory": {
+			{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		"through symlink": {
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0777},
+			{Name: "link/escaped", Typeflag: tar.TypeReg, Mode: 0644},
+		},
+		"hardlink target": {
+			{Name: "hardlink", Typeflag: tar.TypeLink, Linkname: "../../escaped"},
+		},
+	}
+	for name, headers := range cases {
+		t.Run(name, func(t *testing.T) {
+			stream := &bytes.Buffer{}
+			tw := tar.NewWriter(stream)
+			for _, header := range headers {
+				assert.NoError(t, tw.WriteHeader(header))
+			}
+			assert.NoError(t, tw.Close())
+
+			_, err := New().SyncFromTar(stream, dst)
+			assert.Error(t, err)
+			assert.NoFileExists(t, filepath.Join(tmp, "escaped"))
+		})
+	}
+}
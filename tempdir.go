@@ -0,0 +1,64 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ErrTempDirOtherFilesystem is returned when the directory of WithTempDir is
+// not located on the filesystem of the destination: the temporary files
+// could not be renamed to their destination path
+var ErrTempDirOtherFilesystem = errors.New("temporary directory is not on the filesystem of the destination")
+
+// WithTempDir option: the temporary files replacing the destination entries
+// are created in dir instead of in the directory of each entry, so that the
+// watchers of the destination directories don't see them. dir must be on the
+// filesystem of the destination, the sync fails with
+// ErrTempDirOtherFilesystem otherwise. A dir located in the destination is
+// protected like with WithProtectedPaths.
+func WithTempDir(dir string) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.tempDir = filepath.Clean(dir)
+	}
+}
+
+// checkTempDir returns ErrTempDirOtherFilesystem if the directory of
+// WithTempDir is not on the filesystem of the dst destination, which may not
+// exist yet
+func (s *FsSyncer) checkTempDir(dst string) error {
+	if s.tempDir == "" {
+		return nil
+	}
+	info, err := os.Stat(s.tempDir)
+	if err != nil {
+		return errors.Wrapf(err, "fail to stat temporary directory %v", s.tempDir)
+	}
+	if !info.IsDir() {
+		return errors.Errorf("temporary directory %v is not a directory", s.tempDir)
+	}
+	dstInfo, err := os.Stat(dst)
+	for p := dst; os.IsNotExist(err) && p != filepath.Dir(p); {
+		p = filepath.Dir(p)
+		dstInfo, err = os.Stat(p)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "fail to stat %v", dst)
+	}
+	stat, ok := fileStat(info)
+	dstStat, dstOk := fileStat(dstInfo)
+	if ok && dstOk && uint64(stat.Dev) != uint64(dstStat.Dev) {
+		return errors.Wrapf(ErrTempDirOtherFilesystem, "fail to use temporary directory %v for %v", s.tempDir, dst)
+	}
+	return nil
+}
+
+// tmpDirOf returns the directory in which the temporary file replacing the
+// destination entry at path is created, see WithTempDir
+func (s *FsSyncer) tmpDirOf(path string) string {
+	if s.tempDir != "" {
+		return s.tempDir
+	}
+	return filepath.Dir(path)
+}
@@ -0,0 +1,76 @@
+package fssync
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_TempDir(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0644))
+	assert.NoError(t, os.Symlink("file", filepath.Join(src, "dir", "link")))
+
+	t.Run("it should create the temporary files in the temporary directory", func(t *testing.T) {
+		dst := filepath.Join(tmp, "dst")
+		tempDir := filepath.Join(dst, ".tmp")
+		assert.NoError(t, os.MkdirAll(tempDir, 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dst, "dir"), []byte("replaced"), 0644))
+
+		_, err := New(WithTempDir(tempDir)).Sync(dst, src)
+		assert.NoError(t, err)
+		content, err := os.ReadFile(filepath.Join(dst, "dir", "file"))
+		assert.NoError(t, err)
+		assert.Equal(t, "file", string(content))
+		target, err := os.Readlink(filepath.Join(dst, "dir", "link"))
+		assert.NoError(t, err)
+		assert.Equal(t, "file", target)
+		entries, err := os.ReadDir(tempDir)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("it should fail if the temporary directory does not exist", func(t *testing.T) {
+		_, err := New(WithTempDir(filepath.Join(tmp, "missing"))).Sync(filepath.Join(tmp, "dst-missing"), src)
+		assert.Error(t, err)
+		assert.NoDirExists(t, filepath.Join(tmp, "dst-missing"))
+	})
+}
+
+func TestCreateAtomicallyIn(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	t.Run("it should try another temporary name if it exists", func(t *testing.T) {
+		path := filepath.Join(tmp, "file")
+		tried := []string{}
+		err := createAtomicallyIn(tmp, path, func(tmpPath string) error {
+			tried = append(tried, tmpPath)
+			if len(tried) == 1 {
+				return &os.PathError{Op: "open", Path: tmpPath, Err: fs.ErrExist}
+			}
+			return os.WriteFile(tmpPath, []byte("file"), 0644)
+		})
+		assert.NoError(t, err)
+		assert.Len(t, tried, 2)
+		assert.NotEqual(t, tried[0], tried[1])
+		assert.FileExists(t, path)
+	})
+
+	t.Run("it should fail if no temporary name is available", func(t *testing.T) {
+		err := createAtomicallyIn(tmp, filepath.Join(tmp, "other"), func(tmpPath string) error {
+			return fs.ErrExist
+		})
+		assert.ErrorIs(t, err, fs.ErrExist)
+		assert.NoFileExists(t, filepath.Join(tmp, "other"))
+	})
+}
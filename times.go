@@ -0,0 +1,187 @@
+package fssync
+
+import (
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// timesBatchSize is the number of entries whose times are set at once by a
+// worker of applyTimes
+const timesBatchSize = 256
+
+// errTimesStopped stops the iteration of the times to set once a worker of
+// applyTimes failed
+var errTimesStopped = errors.New("times application stopped")
+
+// WithTimesConcurrency option: number of workers setting the times of the
+// destination entries at the end of the sync, in batches. Each call is a round
+// trip on network filesystems, which adds minutes to the syncs of millions of
+// entries when done one at a time.
+// Default is 8
+func WithTimesConcurrency(n int) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.timesConcurrency = n
+	}
+}
+
+// PreserveDirTimes option: with false, the times of the directories are not
+// set on the destination nor compared, only the ones of the other entries are
+// preserved. It saves the finalization pass over every directory when only
+// the modification times of the files matter, for build caches for instance.
+// Default is true
+func PreserveDirTimes(preserve bool) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.noDirTimes = !preserve
+	}
+}
+
+// preservesTimes returns true if the times of the source entry info are set
+// on its destination, according to PreserveDirTimes
+func (s *FsSyncer) preservesTimes(info os.FileInfo) bool {
+	return !s.noDirTimes || !info.IsDir()
+}
+
+type timesEntry struct {
+	path  string
+	times statTimes
+}
+
+// applyTimes sets the times of timesMap to the destination entries with the
+// workers of WithTimesConcurrency, deepest entries first: some filesystems
+// update the times of a directory when the metadata of its entries changes,
+// its times are only set once its entries are done. timesMap is walked once
+// per depth to not load it in memory when it's spilled.
+func (s *FsSyncer) applyTimes(state syncState) error {
+	depths, err := timesDepths(state)
+	if err != nil {
+		return err
+	}
+	for _, depth := range depths {
+		err := s.applyTimesAtDepth(state, depth)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timesDepths returns the depths of the paths of timesMap, deepest first
+func timesDepths(state syncState) ([]int, error) {
+	seen := map[int]bool{}
+	depths := []int{}
+	err := state.timesMap.each(func(file string, _ statTimes) error {
+		depth := pathDepth(file)
+		if !seen[depth] {
+			seen[depth] = true
+			depths = append(depths, depth)
+		}
+		return nil
+	})
+	sort.Sort(sort.Reverse(sort.IntSlice(depths)))
+	return depths, err
+}
+
+// applyTimesAtDepth sets the times of the paths of timesMap located at depth,
+// their order doesn't matter as none of them contains another one
+func (s *FsSyncer) applyTimesAtDepth(state syncState, depth int) error {
+	if s.deterministicOrder {
+		return s.applyTimesInOrder(state, depth)
+	}
+	workers := s.timesConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	batches := make(chan []timesEntry)
+	stopped := make(chan struct{})
+	var firstErr error
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			close(stopped)
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				for _, entry := range batch {
+					err := s.retry(entry.path, func() error {
+						return s.inDestination(state, entry.path, func(path string) error {
+							return lutimes(path, entry.times.atime, entry.times.mtime)
+						})
+					})
+					if err != nil && !(os.IsNotExist(err) && s.ignoreNotFound) {
+						fail(errors.Wrapf(err, "fail to set atime and mtime of %v", entry.path))
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	batch := []timesEntry{}
+	send := func() error {
+		select {
+		case batches <- batch:
+			batch = []timesEntry{}
+			return nil
+		case <-stopped:
+			return errTimesStopped
+		}
+	}
+	err := state.timesMap.each(func(file string, times statTimes) error {
+		if pathDepth(file) != depth {
+			return nil
+		}
+		batch = append(batch, timesEntry{path: file, times: times})
+		if len(batch) < timesBatchSize {
+			return nil
+		}
+		return send()
+	})
+	if err == nil && len(batch) > 0 {
+		err = send()
+	}
+	close(batches)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return err
+}
+
+// applyTimesInOrder sets the times of the paths of timesMap located at depth
+// one at a time in lexical order, see WithDeterministicOrder
+func (s *FsSyncer) applyTimesInOrder(state syncState, depth int) error {
+	entries := []timesEntry{}
+	err := state.timesMap.each(func(file string, times statTimes) error {
+		if pathDepth(file) == depth {
+			entries = append(entries, timesEntry{path: file, times: times})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+	for _, entry := range entries {
+		err := s.retry(entry.path, func() error {
+			return s.inDestination(state, entry.path, func(path string) error {
+				return lutimes(path, entry.times.atime, entry.times.mtime)
+			})
+		})
+		if err != nil && !(os.IsNotExist(err) && s.ignoreNotFound) {
+			return errors.Wrapf(err, "fail to set atime and mtime of %v", entry.path)
+		}
+	}
+	return nil
+}
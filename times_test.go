@@ -0,0 +1,205 @@
+package fssync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLutimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	file := filepath.Join(tmp, "file")
+	link := filepath.Join(tmp, "link")
+	assert.NoError(t, os.WriteFile(file, []byte("file"), 0644))
+	assert.NoError(t, os.Symlink("file", link))
+	atime := time.Unix(1e9, 123456789)
+	mtime := time.Unix(1.5e9, 987654321)
+
+	t.Run("it should keep the nanoseconds", func(t *testing.T) {
+		assert.NoError(t, lutimes(file, atime, mtime))
+		stat := lstatTimes(t, file)
+		assert.True(t, atime.Equal(stat.atime))
+		assert.True(t, mtime.Equal(stat.mtime))
+	})
+
+	t.Run("it should leave the zero times unchanged", func(t *testing.T) {
+		other := time.Unix(2e9, 1)
+		assert.NoError(t, lutimes(file, time.Time{}, other))
+		stat := lstatTimes(t, file)
+		assert.True(t, atime.Equal(stat.atime))
+		assert.True(t, other.Equal(stat.mtime))
+	})
+
+	t.Run("it should not follow symlinks", func(t *testing.T) {
+		before := lstatTimes(t, file)
+		assert.NoError(t, lutimes(link, atime, mtime))
+		assert.True(t, mtime.Equal(lstatTimes(t, link).mtime))
+		assert.True(t, before.mtime.Equal(lstatTimes(t, file).mtime))
+	})
+}
+
+func TestFsSyncer_Sync_NanosecondTimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0644))
+	mtime := time.Unix(1.5e9, 1)
+	for _, name := range []string{"dir/file", "dir"} {
+		assert.NoError(t, lutimes(filepath.Join(src, name), mtime, mtime))
+	}
+
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+	for _, name := range []string{"dir/file", "dir"} {
+		assert.True(t, mtime.Equal(lstatTimes(t, filepath.Join(dst, name)).mtime), name)
+	}
+
+	report, err := New().Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+}
+
+func lstatTimes(t *testing.T, path string) statTimes {
+	info, err := os.Lstat(path)
+	assert.NoError(t, err)
+	stat := sysStatOf(t, info)
+	return statTimes{
+		atime: statAtime(stat),
+		mtime: statMtime(stat),
+	}
+}
+
+func TestFsSyncer_Sync_TimesConcurrency(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	// Enough entries to fill several batches
+	mtime := time.Unix(1.5e9, 0)
+	for i := 0; i < 3*timesBatchSize; i++ {
+		path := filepath.Join(src, fmt.Sprintf("file-%d", i))
+		assert.NoError(t, os.WriteFile(path, []byte("file"), 0644))
+		assert.NoError(t, lutimes(path, mtime, mtime))
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		assert.NoError(t, os.RemoveAll(dst))
+		_, err = New(WithTimesConcurrency(concurrency)).Sync(dst, src)
+		assert.NoError(t, err)
+		for i := 0; i < 3*timesBatchSize; i++ {
+			name := fmt.Sprintf("file-%d", i)
+			assert.True(t, mtime.Equal(lstatTimes(t, filepath.Join(dst, name)).mtime), name)
+		}
+	}
+}
+
+func TestFsSyncer_applyTimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	s := New(WithTimesConcurrency(4))
+	state := s.newSyncState()
+	mtime := time.Unix(1.5e9, 0)
+	for i := 0; i < 2*timesBatchSize; i++ {
+		path := filepath.Join(tmp, fmt.Sprintf("file-%d", i))
+		if i != timesBatchSize {
+			assert.NoError(t, os.WriteFile(path, []byte("file"), 0644))
+		}
+		state.timesMap.set(path, statTimes{atime: mtime, mtime: mtime})
+	}
+
+	err = s.applyTimes(state)
+	assert.Error(t, err)
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	s.ignoreNotFound = true
+	assert.NoError(t, s.applyTimes(state))
+}
+
+func TestFsSyncer_Sync_NestedDirectoryTimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	names := []string{"a", "a/b", "a/b/c", "a/b/c/d"}
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, names[len(names)-1]), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a/b/c/d/file"), []byte("file"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a/file"), []byte("file"), 0644))
+	names = append(names, "a/b/c/d/file", "a/file")
+	// Deepest first so that the times of the parents are kept
+	for i := len(names) - 1; i >= 0; i-- {
+		mtime := time.Unix(1.5e9+int64(i)*3600, 0)
+		assert.NoError(t, lutimes(filepath.Join(src, names[i]), mtime, mtime))
+	}
+
+	_, err = New(WithTimesConcurrency(4)).Sync(dst, src)
+	assert.NoError(t, err)
+	for i, name := range names {
+		mtime := time.Unix(1.5e9+int64(i)*3600, 0)
+		assert.True(t, mtime.Equal(lstatTimes(t, filepath.Join(dst, name)).mtime), name)
+	}
+}
+
+func TestTimesDepths(t *testing.T) {
+	state := New().newSyncState()
+	for _, path := range []string{"/dst/a", "/dst/a/b/c", "/dst", "/dst/a/b", "/dst/d/e"} {
+		state.timesMap.set(path, statTimes{})
+	}
+
+	depths, err := timesDepths(state)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 3, 2, 1}, depths)
+}
+
+func TestFsSyncer_Sync_PreserveDirTimes(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("file"), 0644))
+	mtime := time.Unix(1.5e9, 0)
+	for _, name := range []string{"dir/file", "dir"} {
+		assert.NoError(t, lutimes(filepath.Join(src, name), mtime, mtime))
+	}
+
+	_, err = New(PreserveDirTimes(false)).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, mtime.Equal(lstatTimes(t, filepath.Join(dst, "dir", "file")).mtime))
+	assert.False(t, mtime.Equal(lstatTimes(t, filepath.Join(dst, "dir")).mtime))
+
+	// Deleting an entry changes the times of its directory, they are kept
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "dir", "extraneous"), []byte("extraneous"), 0644))
+	report, err := New(PreserveDirTimes(false)).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, report.ChangeCount())
+	assert.False(t, mtime.Equal(lstatTimes(t, filepath.Join(dst, "dir")).mtime))
+
+	report, err = New(PreserveDirTimes(false)).Sync(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+
+	verifyReport, err := New(PreserveDirTimes(false)).Verify(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, verifyReport.Matches())
+}
@@ -0,0 +1,44 @@
+package fssync
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// copyFileAtomically copies the content of the src file to path like
+// createAtomically. When the filesystem supports it, the content is written
+// to an unnamed file created with O_TMPFILE, which is linked to path once
+// complete: the file being written never appears in directory listings.
+func (s *FsSyncer) copyFileAtomically(src syncInfo, path string, mode os.FileMode) (int64, error) {
+	tmpDir := s.tmpDirOf(path)
+	tmpFile, err := openTmpFile(tmpDir, path, mode)
+	if err != nil {
+		// O_TMPFILE is not supported by all filesystems nor kernels, the
+		// content is then written to a temporary file
+		var n int64
+		err := createAtomicallyIn(tmpDir, path, func(tmpPath string) error {
+			var err error
+			n, err = s.copyFileContent(src, tmpPath, mode)
+			return err
+		})
+		return n, err
+	}
+	defer tmpFile.Close()
+	if s.forcesModes() {
+		err = tmpFile.Chmod(mode)
+		if err != nil {
+			return -1, errors.Wrapf(err, "fail to chmod temporary file of %v", path)
+		}
+	}
+
+	n, err := s.copyContent(src, tmpFile)
+	if err != nil {
+		return -1, err
+	}
+	err = linkTmpFile(tmpFile, tmpDir, path)
+	if err != nil {
+		return -1, err
+	}
+	return n, nil
+}
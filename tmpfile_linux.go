@@ -0,0 +1,45 @@
+package fssync
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// openTmpFile opens an unnamed file with O_TMPFILE in the dir directory, on
+// the filesystem of path, to be linked to path with linkTmpFile
+func openTmpFile(dir, path string, mode os.FileMode) (*os.File, error) {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_WRONLY|unix.O_CLOEXEC, unixMode(mode))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to open temporary file of %v", path)
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// linkTmpFile gives the path name to the unnamed file opened with O_TMPFILE,
+// replacing the existing entry at path if any through a temporary name of the
+// tmpDir directory
+func linkTmpFile(tmpFile *os.File, tmpDir, path string) error {
+	// Linking the file descriptor itself with AT_EMPTY_PATH requires the
+	// CAP_DAC_READ_SEARCH capability, unlike linking its /proc entry
+	procPath := "/proc/self/fd/" + strconv.Itoa(int(tmpFile.Fd()))
+	err := unix.Linkat(unix.AT_FDCWD, procPath, unix.AT_FDCWD, path, unix.AT_SYMLINK_FOLLOW)
+	if err == nil {
+		return nil
+	}
+	if err != unix.EEXIST {
+		return errors.Wrapf(err, "fail to link temporary file to %v", path)
+	}
+
+	// linkat doesn't replace existing entries, the file is linked to a
+	// temporary name which is renamed right away
+	err = createAtomicallyIn(tmpDir, path, func(tmpPath string) error {
+		return unix.Linkat(unix.AT_FDCWD, procPath, unix.AT_FDCWD, tmpPath, unix.AT_SYMLINK_FOLLOW)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to link temporary file to %v", path)
+	}
+	return nil
+}
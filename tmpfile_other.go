@@ -0,0 +1,22 @@
+//go:build !linux
+
+package fssync
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// errNoTmpFile is returned when opening unnamed files, O_TMPFILE is specific
+// to Linux
+var errNoTmpFile = errors.New("unnamed temporary files are not supported")
+
+func openTmpFile(dir, path string, mode os.FileMode) (*os.File, error) {
+	return nil, errors.Wrapf(errNoTmpFile, "fail to open temporary file of %v", path)
+}
+
+// linkTmpFile is not supported, the files of openTmpFile can't be opened
+func linkTmpFile(tmpFile *os.File, tmpDir, path string) error {
+	return errors.Wrapf(errNoTmpFile, "fail to link temporary file to %v", path)
+}
@@ -0,0 +1,52 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_copyFileAtomically(t *testing.T) {
+	src := filepath.Join("test-fixtures", "src", "file", "a")
+	srcInfo, err := os.Stat(src)
+	assert.NoError(t, err)
+	expected, err := os.ReadFile(src)
+	assert.NoError(t, err)
+
+	tests := map[string]struct {
+		existingContent []byte
+	}{
+		"it should create a file": {},
+		"it should replace an existing file": {
+			existingContent: []byte("previous content"),
+		},
+	}
+
+	for msg, test := range tests {
+		t.Run(msg, func(t *testing.T) {
+			dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dst)
+			path := filepath.Join(dst, "a")
+			if test.existingContent != nil {
+				assert.NoError(t, os.WriteFile(path, test.existingContent, 0600))
+			}
+
+			n, err := New().copyFileAtomically(syncInfo{path: src, fileInfo: srcInfo}, path, srcInfo.Mode())
+			assert.NoError(t, err)
+			assert.Equal(t, srcInfo.Size(), n)
+
+			content, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, content)
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			assert.Equal(t, srcInfo.Mode(), info.Mode())
+			entries, err := os.ReadDir(dst)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
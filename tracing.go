@@ -0,0 +1,63 @@
+package fssync
+
+import (
+	"context"
+)
+
+// WithTracer option: tracer starts spans around the walk of the source, the
+// copy of each file, the deletion of the extraneous entries and the
+// restoration of the times, children of a span covering the whole Sync, to
+// see where the time goes during slow syncs. Tracer is the subset of a
+// tracer of OpenTelemetry used by fssync, to not depend on it, see the
+// adapter in the README.
+func WithTracer(tracer Tracer) func(*FsSyncer) {
+	return func(s *FsSyncer) {
+		s.tracer = tracer
+	}
+}
+
+// Tracer starts the spans of WithTracer
+type Tracer interface {
+	// Start starts the span name, child of the span of ctx if any, and
+	// returns the context of the new span
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a traced operation started by a Tracer
+type Span interface {
+	// SetAttribute sets an attribute of the span, value is a string or an
+	// int64
+	SetAttribute(key string, value interface{})
+	// End ends the span, err is the error of the operation, if any
+	End(err error)
+}
+
+// Names of the spans of WithTracer
+const (
+	SpanSync   = "fssync.sync"
+	SpanWalk   = "fssync.walk"
+	SpanCopy   = "fssync.copy"
+	SpanDelete = "fssync.delete"
+	SpanTimes  = "fssync.times"
+)
+
+// noopSpan is the span started without WithTracer
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End(error)                        {}
+
+// startSpan starts the span name, child of the span of the sync state, with
+// the tracer of WithTracer. The returned state is the one of the new span.
+func (s *FsSyncer) startSpan(state syncState, name string) (syncState, Span) {
+	if s.tracer == nil {
+		return state, noopSpan{}
+	}
+	ctx := state.traceCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := s.tracer.Start(ctx, name)
+	state.traceCtx = ctx
+	return state, span
+}
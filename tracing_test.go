@@ -0,0 +1,78 @@
+package fssync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type spanKey struct{}
+
+// recordingTracer records the spans with the name of their parent
+type recordingTracer struct {
+	m     sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	name       string
+	parent     string
+	attributes map[string]interface{}
+	ended      bool
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	span := &recordedSpan{name: name, attributes: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *recordedSpan) End(err error) {
+	s.ended = true
+}
+
+func TestFsSyncer_Sync_WithTracer(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(src, 0755))
+	assert.NoError(t, os.MkdirAll(dst, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "b"), []byte("b"), 0644))
+
+	tracer := &recordingTracer{}
+	_, err = New(WithTracer(tracer)).Sync(dst, src)
+	assert.NoError(t, err)
+
+	names := []string{}
+	for _, span := range tracer.spans {
+		names = append(names, span.parent+">"+span.name)
+		assert.True(t, span.ended, span.name)
+	}
+	assert.Equal(t, []string{
+		">" + SpanSync,
+		SpanSync + ">" + SpanWalk,
+		SpanWalk + ">" + SpanCopy,
+		SpanSync + ">" + SpanDelete,
+		SpanSync + ">" + SpanTimes,
+	}, names)
+	assert.Equal(t, map[string]interface{}{
+		"src": filepath.Join(src, "a"), "dst": filepath.Join(dst, "a"), "bytes": int64(1),
+	}, tracer.spans[2].attributes)
+	assert.Equal(t, int64(2), tracer.spans[0].attributes["changes"])
+}
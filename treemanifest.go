@@ -0,0 +1,468 @@
+package fssync
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidSignature is returned when the signature of a TreeManifest does
+// not match its entries
+var ErrInvalidSignature = errors.New("invalid tree manifest signature")
+
+// ErrContentMismatch is returned by SyncFromTreeManifest when the content
+// provided for a file does not match the checksum of the manifest
+var ErrContentMismatch = errors.New("content does not match the tree manifest checksum")
+
+// Types of the TreeManifest entries
+const (
+	TreeEntryDir     = "dir"
+	TreeEntryFile    = "file"
+	TreeEntrySymlink = "symlink"
+)
+
+// TreeManifest describes a tree to ship it between machines: the destination
+// is synced from the manifest and a ContentSource, see GenerateTreeManifest
+// and SyncFromTreeManifest. It is serialized in JSON and can be signed.
+type TreeManifest struct {
+	// Entries sorted by path
+	Entries   []TreeManifestEntry `json:"entries"`
+	Signature []byte              `json:"signature,omitempty"`
+}
+
+// treeManifestFormat is the format of the serialized TreeManifest, see
+// fileFormat
+var treeManifestFormat = fileFormat{
+	name: "fssync-tree-manifest", version: 1, compat: 1,
+	migrations: map[int]func(json.RawMessage) (json.RawMessage, error){0: unchangedData},
+}
+
+// treeManifestData is the serialized TreeManifest, without the JSON methods
+type treeManifestData TreeManifest
+
+// MarshalJSON encodes the manifest in a versioned envelope
+func (m TreeManifest) MarshalJSON() ([]byte, error) {
+	return treeManifestFormat.encode(treeManifestData(m))
+}
+
+// UnmarshalJSON decodes a manifest written by this version of fssync or an
+// older one. ErrUnsupportedFormat is returned for the manifests written by a
+// newer version in a format this one can't read.
+func (m *TreeManifest) UnmarshalJSON(content []byte) error {
+	return treeManifestFormat.decode(content, (*treeManifestData)(m))
+}
+
+// TreeManifestEntry describes an entry of a TreeManifest
+type TreeManifestEntry struct {
+	// Path relative to the root of the tree, . for the root
+	Path  string      `json:"path"`
+	Type  string      `json:"type"`
+	Mode  os.FileMode `json:"mode"`
+	UID   uint32      `json:"uid"`
+	GID   uint32      `json:"gid"`
+	Mtime int64       `json:"mtime"`
+	// Size and Checksum, hex encoded SHA-256, of the files
+	Size     int64  `json:"size,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+	// Link is the target of the symlinks
+	Link string `json:"link,omitempty"`
+}
+
+// ContentSource provides the content of the files of a TreeManifest
+type ContentSource interface {
+	Open(path string) (io.ReadCloser, error)
+}
+
+type dirContentSource struct {
+	dir string
+}
+
+// DirContentSource returns a ContentSource reading the files from dir, like
+// the tree the manifest has been generated from
+func DirContentSource(dir string) ContentSource {
+	return dirContentSource{dir: dir}
+}
+
+func (s dirContentSource) Open(path string) (io.ReadCloser, error) {
+	fullPath, err := tarEntryPath(s.dir, path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+// GenerateTreeManifest describes the src tree, symlinks are handled according
+// to the syncer options. Hardlinks are described as independent files.
+func (s *FsSyncer) GenerateTreeManifest(src string) (TreeManifest, error) {
+	m := TreeManifest{Entries: []TreeManifestEntry{}}
+	state := s.newSyncState()
+	src = filepath.Clean(src)
+	var err error
+	state.srcDevice, err = s.sourceDevice(src)
+	if err != nil {
+		return m, err
+	}
+	err = filepath.Walk(src, s.skipOtherFileSystems(state, src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		skip, err := s.checkCaseCollision(state, path, info)
+		if skip || err != nil {
+			return err
+		}
+		info, skip, err = s.resolveSymlink(src, path, info, state.report)
+		if skip || err != nil {
+			return err
+		}
+		stat, ok := fileStat(info)
+		if !ok {
+			return errors.Errorf("fail to get detailed stat info for %s", path)
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return errors.Wrapf(err, "fail to get relative path of %v", path)
+		}
+
+		entry := TreeManifestEntry{
+			Path: rel, Mode: info.Mode(), UID: stat.Uid, GID: stat.Gid,
+			Mtime: info.ModTime().UnixNano(),
+		}
+		switch {
+		case info.IsDir():
+			entry.Type = TreeEntryDir
+		case isSymlink(info):
+			entry.Type = TreeEntrySymlink
+			entry.Link, err = os.Readlink(path)
+			if err != nil {
+				return errors.Wrapf(err, "fail to get link destination of src %v", path)
+			}
+		case info.Mode().IsRegular():
+			entry.Type = TreeEntryFile
+			entry.Size = info.Size()
+			checksum, err := syncInfo{path: path}.checksum(sha256.New)
+			if err != nil {
+				return errors.Wrapf(err, "fail to compute checksum of %v", path)
+			}
+			entry.Checksum = hex.EncodeToString(checksum)
+		default:
+			state.report.warn("%v is not a regular file, directory or symlink, skipped", path)
+			return nil
+		}
+		m.Entries = append(m.Entries, entry)
+		return nil
+	}))
+	if err != nil {
+		return m, errors.Wrapf(err, "fail to walk %v", src)
+	}
+	return m, nil
+}
+
+// Sign signs the entries of the manifest with key
+func (m *TreeManifest) Sign(key ed25519.PrivateKey) error {
+	payload, err := json.Marshal(m.Entries)
+	if err != nil {
+		return errors.Wrap(err, "fail to encode tree manifest entries")
+	}
+	m.Signature = ed25519.Sign(key, payload)
+	return nil
+}
+
+// VerifySignature returns ErrInvalidSignature if the manifest has not been
+// signed by the private key of key
+func (m TreeManifest) VerifySignature(key ed25519.PublicKey) error {
+	payload, err := json.Marshal(m.Entries)
+	if err != nil {
+		return errors.Wrap(err, "fail to encode tree manifest entries")
+	}
+	if !ed25519.Verify(key, payload, m.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// SyncFromTreeManifest syncs dst to the tree described by m, the content of
+// the created and updated files is read from content and checked against the
+// checksums of the manifest. Files are compared by size and modification
+// time, or by checksum with WithChecksum. Extraneous entries are deleted
+// unless NoDelete is set and ownership is applied with PreserveOwnership.
+// The signature of m must be checked beforehand with VerifySignature.
+func (s *FsSyncer) SyncFromTreeManifest(dst string, m TreeManifest, content ContentSource) (SyncReport, error) {
+	state := s.newSyncState()
+	report := state.report
+	dst = filepath.Clean(dst)
+	state.protected = s.protectedDestinationPaths(dst)
+	state.dstRoot = dst
+	err := s.checkSandbox()
+	if err != nil {
+		return report, err
+	}
+	err = os.MkdirAll(dst, 0755)
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to create %v", dst)
+	}
+
+	entries := append([]TreeManifestEntry{}, m.Entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	paths := map[string]bool{}
+	for _, entry := range entries {
+		if !filepath.IsLocal(entry.Path) && entry.Path != "." {
+			return report, errors.Errorf("invalid tree manifest path %v", entry.Path)
+		}
+		dstPath, err := tarEntryPath(dst, entry.Path)
+		if err != nil {
+			return report, err
+		}
+		paths[dstPath] = true
+		if entry.Path != "." && s.isProtected(state, dstPath) {
+			report.warn("%v is protected on the destination, skipped", dstPath)
+			continue
+		}
+		err = s.syncTreeManifestEntry(state, dstPath, entry, content)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if !s.noDelete {
+		err = filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == dst || paths[path] {
+				return nil
+			}
+			if s.isProtected(state, path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			_, err = s.deleteTree(state, path)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if err != nil {
+			return report, errors.Wrapf(err, "fail to walk %v", dst)
+		}
+	}
+
+	// Directory times are set once their content is synced, deepest first
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Type != TreeEntryDir {
+			continue
+		}
+		err := s.syncTreeManifestTimes(state, filepath.Join(dst, entries[i].Path), entries[i])
+		if err != nil {
+			return report, err
+		}
+	}
+	return report, state.memory.err
+}
+
+func (s *FsSyncer) syncTreeManifestEntry(state syncState, dstPath string, entry TreeManifestEntry, content ContentSource) error {
+	report := state.report
+	info, err := os.Lstat(dstPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "fail to stat %v", dstPath)
+	}
+	changed := err != nil
+	if err == nil && info.Mode().Type() != entry.Mode.Type() {
+		err := s.inDestination(state, dstPath, os.RemoveAll)
+		if err != nil {
+			return errors.Wrapf(err, "fail to remove destination invalid file %v", dstPath)
+		}
+		changed = true
+	}
+
+	if changed && entry.Type != TreeEntryDir {
+		err := s.mkdirAllInDestination(state, filepath.Dir(dstPath), 0755)
+		if err != nil {
+			return errors.Wrapf(err, "fail to create parents of %v", dstPath)
+		}
+	}
+
+	switch entry.Type {
+	case TreeEntryDir:
+		if changed {
+			err := s.mkdirAllInDestination(state, dstPath, entry.Mode.Perm())
+			if err != nil {
+				return errors.Wrapf(err, "fail to create dst directory %v", dstPath)
+			}
+		}
+	case TreeEntrySymlink:
+		if !changed {
+			target, err := os.Readlink(dstPath)
+			if err != nil {
+				return errors.Wrapf(err, "fail to get link destination of dst %v", dstPath)
+			}
+			changed = target != entry.Link
+		}
+		if changed {
+			err := s.inDestination(state, dstPath, func(path string) error {
+				return createAtomicallyIn(s.tmpDirOf(path), path, func(tmpPath string) error {
+					return os.Symlink(entry.Link, tmpPath)
+				})
+			})
+			if err != nil {
+				return errors.Wrapf(err, "fail to create symlink %v", dstPath)
+			}
+		}
+	case TreeEntryFile:
+		if !changed {
+			changed, err = s.treeManifestFileChanged(dstPath, info, entry)
+			if err != nil {
+				return err
+			}
+		}
+		if changed {
+			err := s.inDestination(state, dstPath, func(path string) error {
+				return createAtomicallyIn(s.tmpDirOf(path), path, func(tmpPath string) error {
+					return s.writeTreeManifestFile(state, tmpPath, entry, content)
+				})
+			})
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("invalid type %v of tree manifest entry %v", entry.Type, entry.Path)
+	}
+	if changed {
+		report.fileChanges.add(dstPath)
+	}
+
+	if s.preserveOwnership {
+		stat, err := lstatSys(dstPath)
+		if err != nil {
+			return err
+		}
+		if stat.Uid != entry.UID || stat.Gid != entry.GID {
+			err = s.inDestination(state, dstPath, func(path string) error {
+				return os.Lchown(path, int(entry.UID), int(entry.GID))
+			})
+			if err != nil {
+				err = s.ownershipFailed(state, dstPath, Owner{UID: int(entry.UID), GID: int(entry.GID)}, err)
+				if err != nil {
+					return err
+				}
+			} else {
+				report.metadataChanged = true
+			}
+		}
+	}
+	if entry.Type == TreeEntrySymlink {
+		return s.syncTreeManifestTimes(state, dstPath, entry)
+	}
+	info, err = os.Lstat(dstPath)
+	if err != nil {
+		return errors.Wrapf(err, "fail to stat %v", dstPath)
+	}
+	if info.Mode() != entry.Mode {
+		err = s.onDestinationEntry(state, dstPath, func(path string) error {
+			return os.Chmod(path, entry.Mode)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "fail to chmod %v", dstPath)
+		}
+		report.metadataChanged = true
+	}
+	if entry.Type == TreeEntryFile {
+		return s.syncTreeManifestTimes(state, dstPath, entry)
+	}
+	return nil
+}
+
+// treeManifestFileChanged returns true if the existing dstPath file differs
+// from the entry
+func (s *FsSyncer) treeManifestFileChanged(dstPath string, info os.FileInfo, entry TreeManifestEntry) (bool, error) {
+	if info.Size() != entry.Size {
+		return true, nil
+	}
+	if !s.checkChecksum {
+		return info.ModTime().UnixNano() != entry.Mtime, nil
+	}
+	checksum, err := syncInfo{path: dstPath}.checksum(sha256.New)
+	if err != nil {
+		return false, errors.Wrapf(err, "fail to compute checksum of %v", dstPath)
+	}
+	return hex.EncodeToString(checksum) != entry.Checksum, nil
+}
+
+// writeTreeManifestFile writes the content of the entry to path, the content
+// must match the checksum of the entry
+func (s *FsSyncer) writeTreeManifestFile(state syncState, path string, entry TreeManifestEntry, content ContentSource) error {
+	expected, err := hex.DecodeString(entry.Checksum)
+	if err != nil {
+		return errors.Wrapf(err, "invalid checksum of tree manifest entry %v", entry.Path)
+	}
+	src, err := content.Open(entry.Path)
+	if err != nil {
+		return errors.Wrapf(err, "fail to open content of %v", entry.Path)
+	}
+	defer src.Close()
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, entry.Mode.Perm())
+	if err != nil {
+		return errors.Wrapf(err, "fail to create %v", path)
+	}
+	defer fd.Close()
+
+	hash := sha256.New()
+	n, err := s.copier.Copy(io.MultiWriter(fd, hash), src)
+	if err != nil {
+		return errors.Wrapf(err, "fail to copy content of %v", entry.Path)
+	}
+	if !bytes.Equal(hash.Sum(nil), expected) {
+		return errors.Wrapf(ErrContentMismatch, "content of %v", entry.Path)
+	}
+	err = fd.Close()
+	if err != nil {
+		return errors.Wrapf(err, "fail to close %v", path)
+	}
+	state.report.copiedBytes += n
+	return nil
+}
+
+func (s *FsSyncer) syncTreeManifestTimes(state syncState, path string, entry TreeManifestEntry) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return errors.Wrapf(err, "fail to stat %v", path)
+	}
+	if info.ModTime().UnixNano() == entry.Mtime {
+		return nil
+	}
+	mtime := time.Unix(0, entry.Mtime)
+	err = s.inDestination(state, path, func(path string) error {
+		return lutimes(path, mtime, mtime)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to set atime and mtime of %v", path)
+	}
+	state.report.metadataChanged = true
+	return nil
+}
+
+func lstatSys(path string) (*sysStat, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to stat %v", path)
+	}
+	stat, ok := fileStat(info)
+	if !ok {
+		return nil, errors.Errorf("fail to get detailed stat info for %s", path)
+	}
+	return stat, nil
+}
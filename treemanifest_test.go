@@ -0,0 +1,139 @@
+package fssync
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryContentSource map[string]string
+
+func (s memoryContentSource) Open(path string) (io.ReadCloser, error) {
+	content, ok := s[path]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewBufferString(content)), nil
+}
+
+func TestTreeManifest_Sign(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	m, err := New().GenerateTreeManifest("./test-fixtures/src")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Sign(privateKey))
+	assert.NoError(t, m.VerifySignature(publicKey))
+	assert.Equal(t, ErrInvalidSignature, m.VerifySignature(otherKey))
+
+	m.Entries[len(m.Entries)-1].Checksum = "tampered"
+	assert.Equal(t, ErrInvalidSignature, m.VerifySignature(publicKey))
+}
+
+func TestFsSyncer_SyncFromTreeManifest(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0750))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("content"), 0640))
+	assert.NoError(t, os.Symlink("dir/file", filepath.Join(src, "link")))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "extraneous"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous", "file"), []byte("extraneous"), 0644))
+
+	m, err := New().GenerateTreeManifest(src)
+	assert.NoError(t, err)
+	assert.Len(t, m.Entries, 4)
+
+	// The manifest is shipped without the source
+	encoded := &bytes.Buffer{}
+	assert.NoError(t, json.NewEncoder(encoded).Encode(m))
+	var shipped TreeManifest
+	assert.NoError(t, json.NewDecoder(encoded).Decode(&shipped))
+
+	report, err := New().SyncFromTreeManifest(dst, shipped, DirContentSource(src))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, report.ChangeCount())
+	assert.Equal(t, int64(len("content")), report.CopiedBytes())
+	verifyReport, err := New(WithChecksum).Verify(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, verifyReport.Matches(), verifyReport.Mismatches)
+
+	report, err = New().SyncFromTreeManifest(dst, shipped, memoryContentSource{})
+	assert.NoError(t, err)
+	assert.True(t, report.Unchanged())
+
+	// Content not matching the manifest is rejected
+	assert.NoError(t, os.Remove(filepath.Join(dst, "dir", "file")))
+	_, err = New().SyncFromTreeManifest(dst, shipped, memoryContentSource{"dir/file": "corrupted"})
+	assert.Equal(t, ErrContentMismatch, errors.Cause(err))
+	assert.NoFileExists(t, filepath.Join(dst, "dir", "file"))
+
+	shipped.Entries = append(shipped.Entries, TreeManifestEntry{Path: "../escaped", Type: TreeEntryDir, Mode: os.ModeDir | 0755})
+	_, err = New().SyncFromTreeManifest(dst, shipped, DirContentSource(src))
+	assert.Error(t, err)
+	assert.NoDirExists(t, filepath.Join(tmp, "escaped"))
+}
+
+// swappingContentSource is a memoryContentSource calling swap before opening
+// the content of a file
+type swappingContentSource struct {
+	memoryContentSource
+	swap func(path string)
+}
+
+func (s swappingContentSource) Open(path string) (io.ReadCloser, error) {
+	s.swap(path)
+	return s.memoryContentSource.Open(path)
+}
+
+func TestFsSyncer_SyncFromTreeManifest_Sandboxed(t *testing.T) {
+	if !sandboxSupported() {
+		_, err := New(Sandboxed).SyncFromTreeManifest("dst", TreeManifest{}, memoryContentSource{})
+		assert.Equal(t, ErrSandboxUnsupported, err)
+		t.Skip("openat2 is not supported")
+	}
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	dst := filepath.Join(tmp, "dst")
+	outside := filepath.Join(tmp, "outside")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "dir"), 0755))
+	assert.NoError(t, os.Mkdir(outside, 0755))
+
+	m := TreeManifest{Entries: []TreeManifestEntry{{
+		Path: "dir",
+		Type: TreeEntryDir,
+		Mode: os.ModeDir | 0755,
+	}, {
+		Path:     "dir/file",
+		Type:     TreeEntryFile,
+		Mode:     0644,
+		Size:     7,
+		Checksum: "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+	}}}
+	// The parent of the file is replaced by a symlink to outside of the
+	// destination once checked
+	content := swappingContentSource{
+		memoryContentSource: memoryContentSource{"dir/file": "content"},
+		swap: func(path string) {
+			assert.NoError(t, os.Rename(filepath.Join(dst, "dir"), filepath.Join(dst, "moved")))
+			assert.NoError(t, os.Symlink("../outside", filepath.Join(dst, "dir")))
+		},
+	}
+	_, err = New(Sandboxed).SyncFromTreeManifest(dst, m, content)
+	assert.Error(t, err)
+	entries, err := os.ReadDir(outside)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
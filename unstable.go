@@ -0,0 +1,54 @@
+package fssync
+
+import (
+	"path/filepath"
+)
+
+// unstableMtimeRuns is the number of consecutive syncs copying again a source
+// file which didn't change after which its destination modification time is
+// considered unreliable
+const unstableMtimeRuns = 2
+
+// previousEntry returns the entry of dstPath in the manifest of the previous
+// sync
+func (m *manifestState) previousEntry(dst, dstPath string) (manifestEntry, bool) {
+	if m == nil {
+		return manifestEntry{}, false
+	}
+	entry, ok := m.previous.Entries[manifestKey(dst, dstPath)]
+	return entry, ok
+}
+
+// checkUnstableMtime makes the destination file at dstPath compared by
+// checksum if it has been copied again by the last syncs while its source
+// didn't change, which means the modification times of the destination are
+// unreliable. It's tracked in the manifest of WithManifest.
+func (s *FsSyncer) checkUnstableMtime(state syncState, dst, dstPath string) {
+	previous, ok := state.manifest.previousEntry(dst, dstPath)
+	if !ok || previous.UnstableRuns < unstableMtimeRuns {
+		return
+	}
+	state.checksumPaths[dstPath] = true
+	dir := filepath.Dir(dstPath)
+	if !state.unstableMtimeDirs[dir] {
+		state.unstableMtimeDirs[dir] = true
+		state.report.warn("modification times are unreliable in %v, files copied again on every sync are compared by checksum", dir)
+	}
+}
+
+// unstableRuns returns the number of consecutive syncs which copied again the
+// source file described by entry while it didn't change
+func (s *FsSyncer) unstableRuns(state syncState, dst, dstPath string, entry manifestEntry, changed bool) int {
+	previous, ok := state.manifest.previousEntry(dst, dstPath)
+	if !ok {
+		return 0
+	}
+	if state.checksumPaths[dstPath] {
+		// Keep comparing by checksum
+		return previous.UnstableRuns
+	}
+	if changed && previous.unchanged(entry) {
+		return previous.UnstableRuns + 1
+	}
+	return 0
+}
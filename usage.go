@@ -0,0 +1,79 @@
+package fssync
+
+import (
+	"time"
+)
+
+// MeasureResourceUsage option: the resources used by the process during each
+// stage of the sync are measured with getrusage and listed by ResourceUsage
+// in the report, to quantify the effect of NoCache, WithBufferSize or
+// WithTimesConcurrency on real workloads. The measures cover the whole
+// process, including the other goroutines running meanwhile.
+func MeasureResourceUsage(s *FsSyncer) {
+	s.measureUsage = true
+}
+
+// ResourceUsage is the usage of the resources of the process during a stage
+// of a sync, see MeasureResourceUsage
+type ResourceUsage struct {
+	// Stage is the name of the stage: scan, transfer, delete or finalize
+	Stage      string        `json:"stage"`
+	Duration   time.Duration `json:"duration"`
+	UserTime   time.Duration `json:"user_time"`
+	SystemTime time.Duration `json:"system_time"`
+	// MaxRSS is the peak resident set size of the process at the end of the
+	// stage, in bytes
+	MaxRSS int64 `json:"max_rss"`
+	// InBlocks and OutBlocks are the blocks read from and written to the
+	// filesystems, the reads served by the page cache are not counted
+	InBlocks  int64 `json:"in_blocks"`
+	OutBlocks int64 `json:"out_blocks"`
+	// ReadSyscalls and WriteSyscalls are the read and write system calls, only
+	// counted on Linux
+	ReadSyscalls  int64 `json:"read_syscalls"`
+	WriteSyscalls int64 `json:"write_syscalls"`
+}
+
+// processUsage is the cumulative usage of the process at a point in time
+type processUsage struct {
+	time time.Time
+	ResourceUsage
+}
+
+// since returns the usage of the process between start and u
+func (u processUsage) since(start processUsage) ResourceUsage {
+	return ResourceUsage{
+		Duration:      u.time.Sub(start.time),
+		UserTime:      u.UserTime - start.UserTime,
+		SystemTime:    u.SystemTime - start.SystemTime,
+		MaxRSS:        u.MaxRSS,
+		InBlocks:      u.InBlocks - start.InBlocks,
+		OutBlocks:     u.OutBlocks - start.OutBlocks,
+		ReadSyscalls:  u.ReadSyscalls - start.ReadSyscalls,
+		WriteSyscalls: u.WriteSyscalls - start.WriteSyscalls,
+	}
+}
+
+// measureStage starts measuring the resources used by the stage of the plan
+// with MeasureResourceUsage, the returned function records them in the report
+// at the end of the stage
+func (p *SyncPlan) measureStage(stage string) func() {
+	if !p.syncer.measureUsage || p.usageUnavailable {
+		return func() {}
+	}
+	start, err := readProcessUsage()
+	if err != nil {
+		p.usageUnavailable = true
+		p.state.report.warn("resource usage not measured: %v", err)
+		return func() {}
+	}
+	return func() {
+		end, err := readProcessUsage()
+		if err != nil {
+			return
+		}
+		usage := end.since(start)
+		usage.Stage = stage
+		p.state.report.resourceUsage = append(p.state.report.resourceUsage, usage)
+	}
+}
@@ -0,0 +1,42 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Sync_MeasureResourceUsage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("measuring the resource usage is not supported on Windows")
+	}
+	dst, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dst)
+
+	report, err := New().Sync(dst, filepath.Join("test-fixtures", "src"))
+	assert.NoError(t, err)
+	assert.Empty(t, report.ResourceUsage())
+	assert.NoError(t, os.RemoveAll(dst))
+
+	report, err = New(MeasureResourceUsage).Sync(dst, filepath.Join("test-fixtures", "src"))
+	assert.NoError(t, err)
+	usage := report.ResourceUsage()
+	if !assert.Len(t, usage, 4) {
+		return
+	}
+	for i, stage := range []string{"scan", "transfer", "delete", "finalize"} {
+		assert.Equal(t, stage, usage[i].Stage)
+		assert.Positive(t, usage[i].Duration)
+		assert.Positive(t, usage[i].MaxRSS)
+		assert.GreaterOrEqual(t, int64(usage[i].UserTime+usage[i].SystemTime), int64(0))
+	}
+	if runtime.GOOS == "linux" {
+		// The source files have been read and written to the destination
+		assert.Positive(t, usage[1].ReadSyscalls)
+		assert.Positive(t, usage[1].WriteSyscalls)
+	}
+}
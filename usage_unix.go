@@ -0,0 +1,62 @@
+//go:build linux || freebsd || openbsd
+
+package fssync
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// readProcessUsage returns the usage of the process with getrusage, and the
+// system calls counted in /proc/self/io on Linux
+func readProcessUsage() (processUsage, error) {
+	rusage := syscall.Rusage{}
+	err := syscall.Getrusage(syscall.RUSAGE_SELF, &rusage)
+	if err != nil {
+		return processUsage{}, errors.Wrapf(err, "fail to get resource usage")
+	}
+	usage := processUsage{time: time.Now()}
+	usage.UserTime = time.Duration(rusage.Utime.Nano())
+	usage.SystemTime = time.Duration(rusage.Stime.Nano())
+	// ru_maxrss is in kilobytes
+	usage.MaxRSS = int64(rusage.Maxrss) * 1024
+	usage.InBlocks = int64(rusage.Inblock)
+	usage.OutBlocks = int64(rusage.Oublock)
+	usage.ReadSyscalls, usage.WriteSyscalls = readSyscallCounts()
+	return usage, nil
+}
+
+// readSyscallCounts returns the read and write system calls of the process
+// counted in /proc/self/io, 0 if it can't be read
+func readSyscallCounts() (reads, writes int64) {
+	fd, err := os.Open("/proc/self/io")
+	if err != nil {
+		return 0, 0
+	}
+	defer fd.Close()
+
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		count, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "syscr":
+			reads = count
+		case "syscw":
+			writes = count
+		}
+	}
+	return reads, writes
+}
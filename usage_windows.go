@@ -0,0 +1,9 @@
+package fssync
+
+import "github.com/pkg/errors"
+
+// readProcessUsage is not implemented, getrusage has no Windows equivalent
+// in the syscall package
+func readProcessUsage() (processUsage, error) {
+	return processUsage{}, errors.New("measuring the resource usage is not supported on Windows")
+}
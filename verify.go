@@ -0,0 +1,261 @@
+package fssync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// MismatchKind is the kind of difference between a source entry and its
+// destination entry found by Verify
+type MismatchKind int
+
+const (
+	// MismatchMissing is a source entry missing from the destination
+	MismatchMissing MismatchKind = iota
+	// MismatchExtraneous is a destination entry missing from the source
+	MismatchExtraneous
+	// MismatchType is an entry of different types, like a file and a directory
+	MismatchType
+	// MismatchContent is a file whose size, or checksum with WithChecksum,
+	// differs
+	MismatchContent
+	// MismatchMode is an entry whose permissions or special bits differ
+	MismatchMode
+	// MismatchOwner is an entry whose ownership differs from the one the sync
+	// gives, only checked when ownership is managed
+	MismatchOwner
+	// MismatchTimes is an entry whose modification time differs
+	MismatchTimes
+	// MismatchLink is a symlink whose target differs
+	MismatchLink
+	// MismatchHardlink is an entry hardlinked to other entries in the source
+	// but not in the destination
+	MismatchHardlink
+)
+
+func (k MismatchKind) String() string {
+	switch k {
+	case MismatchMissing:
+		return "missing"
+	case MismatchExtraneous:
+		return "extraneous"
+	case MismatchType:
+		return "type"
+	case MismatchContent:
+		return "content"
+	case MismatchMode:
+		return "mode"
+	case MismatchOwner:
+		return "owner"
+	case MismatchTimes:
+		return "times"
+	case MismatchLink:
+		return "link"
+	case MismatchHardlink:
+		return "hardlink"
+	}
+	return "unknown"
+}
+
+// Mismatch is a difference between the source and the destination
+type Mismatch struct {
+	Kind MismatchKind
+	// Path of the destination entry
+	Path string
+	// SrcPath is the path of the source entry, empty for extraneous entries
+	SrcPath string
+	// Src and Dst describe the mismatching values, like the modes
+	Src string
+	Dst string
+}
+
+// VerifyReport lists the differences found by Verify
+type VerifyReport struct {
+	Mismatches []Mismatch
+}
+
+// Matches returns true if the destination matches the source
+func (r VerifyReport) Matches() bool {
+	return len(r.Mismatches) == 0
+}
+
+// Verify checks that dst matches src without modifying any of them: content,
+// modes, times, symlinks and hardlinks, ownership when it is managed and
+// extraneous entries unless NoDelete is set. The options of the syncer are
+// taken into account, the destination of a successful sync matches its
+// source.
+func (s *FsSyncer) Verify(dst, src string) (VerifyReport, error) {
+	report := VerifyReport{Mismatches: []Mismatch{}}
+	plan := s.NewSyncPlan(dst, src)
+	err := plan.Scan()
+	if err != nil {
+		return report, err
+	}
+	state := plan.state
+	dst, src = plan.dst, plan.src
+
+	// destination inode of the first link of each hardlinked source inode
+	links := map[uint64]uint64{}
+	err = filepath.Walk(src, s.skipOtherFileSystems(state, src, s.verifyWalkFunc(state, &report, links, dst, src)))
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to walk %v", src)
+	}
+
+	if s.noDelete {
+		return report, nil
+	}
+	dryRun := *s
+	dryRun.deleteDryRun = true
+	_, err = os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	err = dryRun.deleteExtraneousFiles(state, dst, src)
+	if err != nil {
+		return report, err
+	}
+	for _, path := range state.report.pendingDeletions {
+		report.Mismatches = append(report.Mismatches, Mismatch{Kind: MismatchExtraneous, Path: path})
+	}
+	return report, nil
+}
+
+func (s *FsSyncer) verifyWalkFunc(state syncState, report *VerifyReport, links map[uint64]uint64, dst, src string) filepath.WalkFunc {
+	return func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && s.ignoreNotFound {
+				return nil
+			}
+			return err
+		}
+		skip, err := s.checkCaseCollision(state, path, info)
+		if skip || err != nil {
+			return err
+		}
+		info, skip, err = s.resolveSymlink(src, path, info, state.report)
+		if skip || err != nil {
+			return err
+		}
+		dstPath := s.destinationPath(dst, src, path, state.report)
+		if path != src && s.isProtected(state, dstPath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if s.isExcluded(src, path, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if s.isFiltered(info) {
+			return nil
+		}
+		mismatch := func(kind MismatchKind, srcValue, dstValue interface{}) {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Kind: kind, Path: dstPath, SrcPath: path,
+				Src: fmt.Sprint(srcValue), Dst: fmt.Sprint(dstValue),
+			})
+		}
+
+		// The content of missing directories is walked to report every
+		// missing entry
+		dstInfo, err := os.Lstat(dstPath)
+		if os.IsNotExist(err) {
+			mismatch(MismatchMissing, info.Mode().Type(), "")
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to stat %v", dstPath)
+		}
+		if info.Mode().Type() != dstInfo.Mode().Type() {
+			mismatch(MismatchType, info.Mode().Type(), dstInfo.Mode().Type())
+			// The destination entry, which can be a symlink, is not walked
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		srcStat, ok := fileStat(info)
+		if !ok {
+			return errors.Errorf("fail to get detailed stat info for %s", path)
+		}
+		dstStat, ok := fileStat(dstInfo)
+		if !ok {
+			return errors.Errorf("fail to get detailed stat info for %s", dstPath)
+		}
+		srcEntry := syncInfo{base: src, path: path, fileInfo: info, stat: srcStat}
+		dstEntry := syncInfo{base: dst, path: dstPath, fileInfo: dstInfo, stat: dstStat}
+
+		if isSymlink(info) {
+			srcTarget, err := s.symlinkTarget(srcEntry, dstEntry)
+			if err != nil {
+				return err
+			}
+			dstTarget, err := os.Readlink(dstPath)
+			if err != nil {
+				return errors.Wrapf(err, "fail to get link destination of dst %v", dstPath)
+			}
+			if srcTarget != dstTarget {
+				mismatch(MismatchLink, srcTarget, dstTarget)
+			}
+		} else if s.replicatesModes() && info.Mode() != dstInfo.Mode() {
+			mismatch(MismatchMode, info.Mode(), dstInfo.Mode())
+		}
+		if s.preservesTimes(info) && !s.mtimesEqual(state, dstPath, info.ModTime(), dstInfo.ModTime()) {
+			mismatch(MismatchTimes, info.ModTime(), dstInfo.ModTime())
+		}
+
+		if info.Mode().IsRegular() {
+			err := s.verifyContent(srcEntry, dstEntry, mismatch)
+			if err != nil {
+				return err
+			}
+		}
+
+		if owner, ok := s.destinationOwner(state, src, path, srcStat); ok && !owner.matches(dstStat) {
+			mismatch(MismatchOwner, fmt.Sprintf("%d:%d", owner.UID, owner.GID), fmt.Sprintf("%d:%d", dstStat.Uid, dstStat.Gid))
+		}
+
+		// Hardlinked symlinks are recreated independently when their targets
+		// differ or when they can't be linked, see linkSymlink
+		if !s.noHardlinks && !info.IsDir() && !isSymlink(info) && srcStat.Nlink > 1 {
+			if dstIno, ok := links[srcStat.Ino]; !ok {
+				links[srcStat.Ino] = dstStat.Ino
+			} else if dstIno != dstStat.Ino {
+				mismatch(MismatchHardlink, "linked", "not linked")
+			}
+		}
+		return nil
+	}
+}
+
+// verifyContent compares the content of the regular files by size, and by
+// checksum with WithChecksum
+func (s *FsSyncer) verifyContent(src, dst syncInfo, mismatch func(MismatchKind, interface{}, interface{})) error {
+	if src.fileInfo.Size() != dst.fileInfo.Size() {
+		mismatch(MismatchContent, src.fileInfo.Size(), dst.fileInfo.Size())
+		return nil
+	}
+	policy := s.comparePolicy(src.fileInfo)
+	if policy == CompareSizeOnly || !s.checkChecksum && policy != CompareChecksum || isClone(src, dst) {
+		return nil
+	}
+	srcChecksum, err := src.checksum(s.newHash)
+	if err != nil {
+		return errors.Wrapf(err, "fail to compute checksum of %v", src.path)
+	}
+	dstChecksum, err := dst.checksum(s.newHash)
+	if err != nil {
+		return errors.Wrapf(err, "fail to compute checksum of %v", dst.path)
+	}
+	if !bytes.Equal(srcChecksum, dstChecksum) {
+		mismatch(MismatchContent, fmt.Sprintf("%x", srcChecksum), fmt.Sprintf("%x", dstChecksum))
+	}
+	return nil
+}
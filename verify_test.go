@@ -0,0 +1,113 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_Verify(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	for _, name := range []string{"content", "checksum", "mode", "times", "hardlink", "type"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(name), 0644))
+	}
+	assert.NoError(t, os.Link(filepath.Join(src, "hardlink"), filepath.Join(src, "dir", "hardlink")))
+	assert.NoError(t, os.Symlink("content", filepath.Join(src, "link")))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "missing"), []byte("missing"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "missingdir", "sub"), 0755))
+
+	_, err = New().Sync(dst, src)
+	assert.NoError(t, err)
+	report, err := New(WithChecksum).Verify(dst, src)
+	assert.NoError(t, err)
+	assert.True(t, report.Matches(), report.Mismatches)
+
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "content"), []byte("other content"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "checksum"), []byte("CHECKSUM"), 0644))
+	assert.NoError(t, os.Chmod(filepath.Join(dst, "mode"), 0600))
+	assert.NoError(t, os.Chtimes(filepath.Join(dst, "times"), mtime, mtime))
+	assert.NoError(t, os.Remove(filepath.Join(dst, "dir", "hardlink")))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "dir", "hardlink"), []byte("hardlink"), 0644))
+	assert.NoError(t, os.Remove(filepath.Join(dst, "type")))
+	assert.NoError(t, os.Mkdir(filepath.Join(dst, "type"), 0755))
+	assert.NoError(t, os.Remove(filepath.Join(dst, "link")))
+	assert.NoError(t, os.Symlink("other", filepath.Join(dst, "link")))
+	assert.NoError(t, os.Remove(filepath.Join(dst, "dir", "missing")))
+	assert.NoError(t, os.RemoveAll(filepath.Join(dst, "missingdir")))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous"), []byte("extraneous"), 0644))
+	// The changes of the destination entries change the times of dir
+	assert.NoError(t, os.Chtimes(filepath.Join(dst, "dir"), time.Now(), modTime(t, filepath.Join(src, "dir"))))
+
+	for _, c := range []struct {
+		name     string
+		options  []func(*FsSyncer)
+		expected map[string][]MismatchKind
+	}{
+		{
+			name:    "with checksum",
+			options: []func(*FsSyncer){WithChecksum},
+			expected: map[string][]MismatchKind{
+				"":             {MismatchTimes},
+				"content":      {MismatchTimes, MismatchContent},
+				"checksum":     {MismatchTimes, MismatchContent},
+				"mode":         {MismatchMode},
+				"times":        {MismatchTimes},
+				"dir/hardlink": {MismatchTimes},
+				// dir/hardlink is walked first
+				"hardlink":       {MismatchHardlink},
+				"type":           {MismatchType},
+				"link":           {MismatchLink, MismatchTimes},
+				"dir/missing":    {MismatchMissing},
+				"missingdir":     {MismatchMissing},
+				"missingdir/sub": {MismatchMissing},
+				"extraneous":     {MismatchExtraneous},
+			},
+		}, {
+			name:    "without checksum, hardlinks and deletion",
+			options: []func(*FsSyncer){NoHardlinks, NoDelete},
+			expected: map[string][]MismatchKind{
+				"":               {MismatchTimes},
+				"content":        {MismatchTimes, MismatchContent},
+				"checksum":       {MismatchTimes},
+				"mode":           {MismatchMode},
+				"times":          {MismatchTimes},
+				"dir/hardlink":   {MismatchTimes},
+				"type":           {MismatchType},
+				"link":           {MismatchLink, MismatchTimes},
+				"dir/missing":    {MismatchMissing},
+				"missingdir":     {MismatchMissing},
+				"missingdir/sub": {MismatchMissing},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			report, err := New(c.options...).Verify(dst, src)
+			assert.NoError(t, err)
+			mismatches := map[string][]MismatchKind{}
+			for _, mismatch := range report.Mismatches {
+				rel, err := filepath.Rel(dst, mismatch.Path)
+				assert.NoError(t, err)
+				if rel == "." {
+					rel = ""
+				}
+				mismatches[rel] = append(mismatches[rel], mismatch.Kind)
+			}
+			assert.Equal(t, c.expected, mismatches)
+		})
+	}
+}
+
+func modTime(t *testing.T, path string) time.Time {
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	return info.ModTime()
+}
@@ -0,0 +1,253 @@
+package fssync
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// dirListing is the directory of the source being walked by walkSource with
+// its entries, for sourceEntries to compare it to its destination without
+// listing it again
+type dirListing struct {
+	dir   string
+	info  os.FileInfo
+	names []string
+}
+
+// DirFdTraversal option: walk the source through the file descriptors of its
+// directories, kept open while their content is walked. The entries are
+// listed, stated with fstatat(2), and the subdirectories and the copied files
+// opened with openat(2) relative to the descriptor of their parent instead of
+// their full path: the reads of the source are not disturbed by concurrent
+// renames of the ancestors of its entries and the paths are not resolved
+// again for each entry. It only applies to the source, the destination is
+// still accessed by its paths, see Sandboxed. It uses one descriptor per level
+// of depth, and has no effect on Windows.
+func DirFdTraversal(s *FsSyncer) {
+	s.dirFdTraversal = true
+}
+
+// walkSource walks the src tree like filepath.Walk, in lexical order. The
+// entries of each directory are listed once: sourceEntries reuses the listing
+// of the directory being walked to find the extraneous entries of its
+// destination. Unlike filepath.Walk, the walked entries are not stated before
+// calling fn, their os.FileInfo is a dirEntryInfo.
+func (s *FsSyncer) walkSource(state syncState, root string, fn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = s.walkSourceEntry(state, nil, nil, root, info, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkSourceEntry walks path, located in the parent directory which is nil
+// unless walked with DirFdTraversal. ancestors are the directories containing
+// path with SymlinkFollow, to detect the symlinks looping to them.
+func (s *FsSyncer) walkSourceEntry(state syncState, parent *os.File, ancestors []os.FileInfo, path string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if s.symlinkMode == SymlinkFollow && isSymlink(info) {
+		targetInfo, skip, err := s.resolveSymlink(state.srcRoot, path, info, state.report)
+		if err != nil {
+			return fn(path, nil, err)
+		} else if skip {
+			return nil
+		}
+		if targetInfo.IsDir() {
+			for _, ancestor := range ancestors {
+				if sameFile(ancestor, targetInfo) {
+					state.report.warn("symlink %v loops to its parent directory, skipped", path)
+					return nil
+				}
+			}
+			// The directory is opened by its path to follow the symlink
+			parent = nil
+		}
+		info = targetInfo
+	}
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+	if s.symlinkMode == SymlinkFollow {
+		dirInfo, err := statEntry(info)
+		if err != nil {
+			return fn(path, nil, err)
+		}
+		ancestors = append(ancestors, dirInfo)
+	}
+
+	dir, err := s.openWalkedDir(parent, path)
+	var entries []fs.DirEntry
+	if err == nil {
+		entries, err = readDirEntries(dir, s.dirListLimit())
+		if s.dirFdTraversal {
+			defer dir.Close()
+		} else {
+			dir.Close()
+			dir = nil
+		}
+	}
+	if err == nil {
+		err = s.checkEntriesCount(path, len(entries))
+		if err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if state.listing != nil {
+		*state.listing = dirListing{dir: path, info: info, names: names}
+	}
+	fnErr := fn(path, info, err)
+	if state.listing != nil {
+		*state.listing = dirListing{}
+	}
+	if err != nil || fnErr != nil {
+		return fnErr
+	}
+
+	for _, entry := range entries {
+		filename := filepath.Join(path, entry.Name())
+		entryInfo := &dirEntryInfo{entry: entry, dir: dir}
+		err = s.walkSourceEntry(state, dir, ancestors, filename, entryInfo, fn)
+		if err != nil && (!entryInfo.IsDir() || err != filepath.SkipDir) {
+			return err
+		}
+	}
+	return nil
+}
+
+// openWalkedDir opens the path directory, relatively to its parent directory
+// with DirFdTraversal
+func (s *FsSyncer) openWalkedDir(parent *os.File, path string) (*os.File, error) {
+	if parent == nil {
+		return os.Open(path)
+	}
+	return openDirAt(parent, filepath.Base(path))
+}
+
+// openSource opens the path file of the source, relatively to the descriptor
+// of its directory if it has been stated with DirFdTraversal
+func openSource(path string, info os.FileInfo) (*os.File, error) {
+	dir := statDir(info)
+	if dir == nil {
+		return os.Open(path)
+	}
+	return openFileAt(dir, filepath.Base(path))
+}
+
+// dirEntryInfo is the os.FileInfo of an entry listed by walkSource. Its name
+// and type come from the listing of its directory, the entry is only stated
+// once its other attributes are read, see statEntry. It is stated relatively
+// to dir with DirFdTraversal.
+type dirEntryInfo struct {
+	entry  fs.DirEntry
+	dir    *os.File
+	info   os.FileInfo
+	err    error
+	loaded bool
+}
+
+func (i *dirEntryInfo) load() error {
+	if i.loaded {
+		return i.err
+	}
+	if i.dir != nil {
+		i.info, i.err = lstatAt(i.dir, i.entry.Name())
+	} else {
+		i.info, i.err = i.entry.Info()
+	}
+	i.loaded = true
+	return i.err
+}
+
+func (i *dirEntryInfo) Name() string { return i.entry.Name() }
+func (i *dirEntryInfo) IsDir() bool  { return i.entry.IsDir() }
+
+func (i *dirEntryInfo) Mode() os.FileMode {
+	if i.load() != nil {
+		return i.entry.Type()
+	}
+	return i.info.Mode()
+}
+
+func (i *dirEntryInfo) Size() int64 {
+	if i.load() != nil {
+		return 0
+	}
+	return i.info.Size()
+}
+
+func (i *dirEntryInfo) ModTime() time.Time {
+	if i.load() != nil {
+		return time.Time{}
+	}
+	return i.info.ModTime()
+}
+
+func (i *dirEntryInfo) Sys() interface{} {
+	if i.load() != nil {
+		return nil
+	}
+	return i.info.Sys()
+}
+
+// statEntry returns the stat info of an entry walked by walkSource, the
+// entries which are not stated yet are stated. The error of the stat, if the
+// entry has been deleted since the listing of its directory for instance, is
+// returned.
+func statEntry(info os.FileInfo) (os.FileInfo, error) {
+	entryInfo, ok := info.(*dirEntryInfo)
+	if !ok {
+		return info, nil
+	}
+	err := entryInfo.load()
+	if err != nil {
+		return nil, err
+	}
+	return entryInfo.info, nil
+}
+
+// readDirEntries returns at most limit entries of the dir directory, all of
+// them if limit is -1, sorted by name
+func readDirEntries(dir *os.File, limit int) ([]fs.DirEntry, error) {
+	entries, err := dir.ReadDir(limit)
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// readDirNames returns the sorted names of at most limit entries of the dir
+// directory, all of them if limit is -1
+func readDirNames(dir string, limit int) ([]string, error) {
+	fd, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	names, err := fd.Readdirnames(limit)
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
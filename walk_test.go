@@ -0,0 +1,156 @@
+package fssync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsSyncer_walkSource(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	assert.NoError(t, os.MkdirAll(filepath.Join(tmp, "b", "skipped"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "b", "skipped", "file"), nil, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "b", "c"), nil, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "a"), nil, 0644))
+
+	state := syncState{listing: &dirListing{}}
+	walked := []string{}
+	listed := map[string][]string{}
+	err = New().walkSource(state, tmp, func(path string, info os.FileInfo, err error) error {
+		assert.NoError(t, err)
+		rel, _ := filepath.Rel(tmp, path)
+		walked = append(walked, rel)
+		if info.IsDir() {
+			assert.Equal(t, path, state.listing.dir)
+			listed[rel] = state.listing.names
+		}
+		if info.Name() == "skipped" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "a", "b", "b/c", "b/skipped"}, walked)
+	assert.Equal(t, []string{"a", "b"}, listed["."])
+	assert.Equal(t, []string{"c", "skipped"}, listed["b"])
+	assert.Equal(t, dirListing{}, *state.listing)
+}
+
+func TestFsSyncer_Sync_DeleteAfterQueue(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("a"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dst, "dir", "extraneous"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "dir", "extraneous", "file"), []byte("b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dst, "extraneous"), []byte("c"), 0644))
+
+	plan := New(WithDeleteTiming(DeleteAfter)).NewSyncPlan(dst, src)
+	assert.NoError(t, plan.Scan())
+	assert.NoError(t, plan.Transfer())
+
+	// The extraneous entries are found during the transfer but only deleted
+	// by the Delete stage
+	assert.Len(t, plan.state.extraneous.entries, 2)
+	assert.FileExists(t, filepath.Join(dst, "extraneous"))
+	assert.FileExists(t, filepath.Join(dst, "dir", "file"))
+
+	assert.NoError(t, plan.Delete())
+	assert.NoError(t, plan.Finalize())
+	assert.NoFileExists(t, filepath.Join(dst, "extraneous"))
+	assert.NoDirExists(t, filepath.Join(dst, "dir", "extraneous"))
+	assert.FileExists(t, filepath.Join(dst, "dir", "file"))
+}
+
+func TestStatEntry(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "file"), []byte("content"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "deleted"), nil, 0644))
+
+	dir, err := os.Open(tmp)
+	assert.NoError(t, err)
+	defer dir.Close()
+	entries, err := readDirEntries(dir, -1)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.NoError(t, os.Remove(filepath.Join(tmp, "deleted")))
+
+	// The type is known from the listing, the entry is stated once its other
+	// attributes are needed
+	deleted := &dirEntryInfo{entry: entries[0]}
+	assert.Equal(t, "deleted", deleted.Name())
+	assert.False(t, deleted.IsDir())
+	_, err = statEntry(deleted)
+	assert.True(t, os.IsNotExist(err))
+
+	info, err := statEntry(&dirEntryInfo{entry: entries[1]})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), info.Size())
+	_, ok := fileStat(info)
+	assert.True(t, ok)
+}
+
+func TestFsSyncer_walkSource_DirFdTraversal(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a", "b", "c"), []byte("c"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a", "b", "d"), []byte("d"), 0644))
+
+	// The ancestors of the walked entries are renamed during the walk
+	state := syncState{listing: &dirListing{}}
+	sizes := map[string]int64{}
+	err = New(DirFdTraversal).walkSource(state, src, func(path string, info os.FileInfo, err error) error {
+		assert.NoError(t, err)
+		if info.Name() == "b" {
+			assert.NoError(t, os.Rename(filepath.Join(src, "a"), filepath.Join(src, "renamed")))
+		}
+		info, err = statEntry(info)
+		assert.NoError(t, err)
+		rel, _ := filepath.Rel(src, path)
+		sizes[rel] = info.Size()
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), sizes["a/b/c"])
+	assert.Equal(t, int64(1), sizes["a/b/d"])
+}
+
+func TestFsSyncer_Sync_DirFdTraversalRenamedAncestor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the source is read by its paths on Windows")
+	}
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "a", "b", "c"), []byte("c"), 0644))
+
+	// The ancestor of the copied file is renamed once it's stated
+	renamed := false
+	hooks := Hooks{OnFileStart: func(_, path string) {
+		if filepath.Base(path) == "c" && !renamed {
+			renamed = true
+			assert.NoError(t, os.Rename(filepath.Join(src, "a"), filepath.Join(src, "renamed")))
+		}
+	}}
+	_, err = New(DirFdTraversal, WithHooks(hooks)).Sync(dst, src)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(dst, "a", "b", "c"))
+	assert.NoError(t, err)
+	assert.Equal(t, "c", string(content))
+}
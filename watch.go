@@ -0,0 +1,207 @@
+package fssync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Watcher keeps a destination in sync with a source continuously: it performs
+// a full sync then subscribes to the changes of the source, with inotify on
+// Linux, to only sync the changed paths
+type Watcher struct {
+	syncer *FsSyncer
+	// Delay is the time during which changes are accumulated before being
+	// synced, 1s by default
+	Delay time.Duration
+	// OnSync is called after each sync with its report. If nil, the watch
+	// stops at the first sync error.
+	OnSync func(report SyncReport, err error)
+}
+
+// NewWatcher returns a Watcher syncing with the given syncer options
+func NewWatcher(opts ...func(*FsSyncer)) *Watcher {
+	return &Watcher{syncer: New(opts...), Delay: time.Second}
+}
+
+// Watch syncs src to dst, then syncs the changes of src until ctx is done,
+// see Watcher
+func Watch(ctx context.Context, dst, src string, opts ...func(*FsSyncer)) error {
+	return NewWatcher(opts...).Watch(ctx, dst, src)
+}
+
+// Watch syncs src to dst, then syncs the changes of src until ctx is done.
+// The options WithManifest and TrustManifest only apply to the initial sync.
+func (w *Watcher) Watch(ctx context.Context, dst, src string) error {
+	sourceSyncer := w.syncer.forSource(src)
+	src = filepath.Clean(src)
+	dst, err := sourceSyncer.prefixedDestination(filepath.Clean(dst))
+	if err != nil {
+		return err
+	}
+	err = sourceSyncer.createPrefixParents(dst)
+	if err != nil {
+		return err
+	}
+	syncer := *sourceSyncer
+	syncer.destinationPrefix = ""
+
+	// Changes are watched before the initial sync to not miss any of them
+	changes, err := newChangeWatcher(src)
+	if err != nil {
+		return err
+	}
+	defer changes.Close()
+	err = w.sync(dst, src, src, &syncer)
+	if err != nil {
+		return err
+	}
+
+	events := make(chan []string)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- changes.read(ctx, events)
+	}()
+
+	// Paths are only synced once for a batch of changes
+	partial := syncer
+	partial.manifestPath = ""
+	partial.trustManifest = false
+	partial.publisher = nil
+	partial.progressFunc = nil
+	pending := map[string]bool{}
+	var timer <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case paths := <-events:
+			for _, path := range paths {
+				pending[path] = true
+			}
+			if timer == nil {
+				timer = time.After(w.Delay)
+			}
+		case <-timer:
+			timer = nil
+			for _, path := range topmostPaths(pending) {
+				pathSyncer := &partial
+				if path == src {
+					pathSyncer = &syncer
+				}
+				err = w.sync(dst, src, path, pathSyncer)
+				if err != nil {
+					return err
+				}
+			}
+			pending = map[string]bool{}
+		}
+	}
+}
+
+// sync syncs the path of src to its destination in dst and reports it
+func (w *Watcher) sync(dst, src, path string, syncer *FsSyncer) error {
+	report, err := syncer.syncPath(dst, src, path)
+	if w.OnSync != nil {
+		w.OnSync(report, err)
+		return nil
+	}
+	return err
+}
+
+// syncPath syncs path, located in src, to its destination in dst. Its
+// destination is deleted if path does not exist anymore.
+func (s *FsSyncer) syncPath(dst, src, path string) (SyncReport, error) {
+	if path == src {
+		return s.Sync(dst, src)
+	}
+	if s.isExcludedPath(src, path) {
+		return s.newSyncState().report, nil
+	}
+	rel, err := filepath.Rel(src, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fail to get path of %v in %v", path, src)
+	}
+	dstPath := dst
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		dstPath = filepath.Join(dstPath, s.destinationName(name))
+	}
+
+	var report SyncReport
+	info, err := os.Lstat(path)
+	if err == nil {
+		var skip bool
+		skip, err = s.isInOtherFileSystem(src, path, info)
+		if skip {
+			return s.newSyncState().report, nil
+		}
+	}
+	if os.IsNotExist(err) {
+		state := syncState{
+			report:    &fsSyncReport{fileChanges: newSpillSet(nil), renamedPaths: map[string]string{}},
+			protected: s.protectedDestinationPaths(dst),
+			dstRoot:   dst,
+		}
+		report = state.report
+		_, err = os.Lstat(dstPath)
+		if err == nil && !s.noDelete {
+			_, err = s.deleteTree(state, dstPath)
+		} else if os.IsNotExist(err) {
+			err = nil
+		}
+	} else if err == nil {
+		// Protected paths and filter rules are relative to the destination
+		// being synced
+		sub := *s
+		sub.protectedPaths = s.rebaseProtectedPaths(rel)
+		sub.filterPrefix = filepath.Join(s.filterPrefix, rel)
+		report, err = sub.Sync(dstPath, path)
+	}
+	if err != nil {
+		return report, errors.Wrapf(err, "fail to sync %v", path)
+	}
+
+	// Creating or deleting the entry changed the times of its parent
+	parentInfo, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return report, nil
+	}
+	parentStat, ok := fileStat(parentInfo)
+	if !ok {
+		return report, nil
+	}
+	err = lutimes(filepath.Dir(dstPath),
+		statAtime(parentStat),
+		statMtime(parentStat))
+	if err != nil && !os.IsNotExist(err) {
+		return report, errors.Wrapf(err, "fail to set atime and mtime of %v", filepath.Dir(dstPath))
+	}
+	return report, nil
+}
+
+// topmostPaths returns the paths which are not located in another of the
+// paths, syncing them syncs all the paths
+func topmostPaths(paths map[string]bool) []string {
+	topmost := []string{}
+	for path := range paths {
+		covered := false
+		for parent := filepath.Dir(path); parent != filepath.Dir(parent); parent = filepath.Dir(parent) {
+			if paths[parent] {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			topmost = append(topmost, path)
+		}
+	}
+	sort.Strings(topmost)
+	return topmost
+}
@@ -0,0 +1,130 @@
+package fssync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const watchEvents = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_ONLYDIR
+
+// changeWatcher reports the changes of the tree at root with inotify
+type changeWatcher struct {
+	inotify *os.File
+	// fd is the descriptor of inotify, File.Fd would make it blocking
+	fd   int
+	root string
+	// dirs are the watched directories indexed by watch descriptor
+	dirs map[int]string
+}
+
+// newChangeWatcher watches root and its subdirectories, the changes are
+// reported from then on by read
+func newChangeWatcher(root string) (*changeWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, errors.Wrap(err, "fail to initialize inotify")
+	}
+	// The file is non-blocking so closing it interrupts the pending read
+	w := &changeWatcher{inotify: os.NewFile(uintptr(fd), "inotify"), fd: fd, root: root, dirs: map[int]string{}}
+	err = addWatches(fd, root, w.dirs)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Close stops watching the changes, interrupting read
+func (w *changeWatcher) Close() error {
+	return w.inotify.Close()
+}
+
+// addWatches watches root and its subdirectories, indexed by watch
+// descriptor in dirs
+func addWatches(fd int, root string, dirs map[int]string) error {
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		wd, err := unix.InotifyAddWatch(fd, path, watchEvents)
+		if os.IsNotExist(err) || err == unix.ENOTDIR {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "fail to watch %v", path)
+		}
+		dirs[wd] = path
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "fail to watch %v", root)
+	}
+	return nil
+}
+
+// read sends the paths changed according to the events read from the
+// inotify file until it's closed or ctx is done. The root directory is sent
+// when events have been lost.
+func (w *changeWatcher) read(ctx context.Context, events chan<- []string) error {
+	inotify, fd, root, dirs := w.inotify, w.fd, w.root, w.dirs
+	buffer := make([]byte, 64*1024)
+	for {
+		n, err := inotify.Read(buffer)
+		if errors.Is(err, os.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "fail to read inotify events")
+		}
+
+		paths := []string{}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			offset = nameStart + int(event.Len)
+			name := strings.TrimRight(string(buffer[nameStart:offset]), "\x00")
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				paths = append(paths, root)
+				continue
+			}
+			dir, ok := dirs[int(event.Wd)]
+			if !ok {
+				continue
+			}
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(dirs, int(event.Wd))
+				continue
+			}
+			if name == "" {
+				// Event on the watched directory itself
+				paths = append(paths, dir)
+				continue
+			}
+			path := filepath.Join(dir, name)
+			if event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+				err := addWatches(fd, path, dirs)
+				if err != nil {
+					return err
+				}
+			}
+			paths = append(paths, path)
+		}
+
+		select {
+		case events <- paths:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package fssync
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// changeWatcher is not implemented on BSD nor Windows, kqueue would need a
+// file descriptor per watched file
+type changeWatcher struct{}
+
+func newChangeWatcher(root string) (*changeWatcher, error) {
+	return nil, errors.New("watching changes requires inotify, it is only supported on Linux")
+}
+
+func (w *changeWatcher) Close() error {
+	return nil
+}
+
+func (w *changeWatcher) read(ctx context.Context, events chan<- []string) error {
+	return nil
+}
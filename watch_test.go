@@ -0,0 +1,85 @@
+package fssync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher_Watch(t *testing.T) {
+	tmp, err := os.MkdirTemp("./.tmp", "fssync-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "src")
+	dst := filepath.Join(tmp, "dst")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "a"), []byte("a"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watcher := NewWatcher()
+	watcher.Delay = 10 * time.Millisecond
+	synced := make(chan SyncReport, 100)
+	watcher.OnSync = func(report SyncReport, err error) {
+		assert.NoError(t, err)
+		synced <- report
+	}
+	watchErr := make(chan error)
+	go func() {
+		watchErr <- watcher.Watch(ctx, dst, src)
+	}()
+
+	// waitFor waits until the condition is true after syncs
+	waitFor := func(msg string, condition func() bool) {
+		timeout := time.After(5 * time.Second)
+		for !condition() {
+			select {
+			case <-synced:
+			case <-timeout:
+				t.Fatalf("timeout waiting for %s", msg)
+			}
+		}
+	}
+	fileContent := func(path string) string {
+		content, _ := os.ReadFile(filepath.Join(dst, path))
+		return string(content)
+	}
+
+	waitFor("initial sync", func() bool { return fileContent("dir/a") == "a" })
+
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "dir", "a"), []byte("modified"), 0644))
+	waitFor("modified file", func() bool { return fileContent("dir/a") == "modified" })
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "new", "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "new", "sub", "b"), []byte("b"), 0644))
+	waitFor("new directory", func() bool { return fileContent("new/sub/b") == "b" })
+
+	// Files created in new directories are watched
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "new", "sub", "c"), []byte("c"), 0644))
+	waitFor("file in new directory", func() bool { return fileContent("new/sub/c") == "c" })
+
+	assert.NoError(t, os.RemoveAll(filepath.Join(src, "dir")))
+	waitFor("deleted directory", func() bool {
+		_, err := os.Lstat(filepath.Join(dst, "dir"))
+		return os.IsNotExist(err)
+	})
+
+	srcInfo, err := os.Stat(src)
+	assert.NoError(t, err)
+	dstInfo, err := os.Stat(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, srcInfo.ModTime(), dstInfo.ModTime())
+
+	cancel()
+	assert.NoError(t, <-watchErr)
+}
+
+func TestTopmostPaths(t *testing.T) {
+	paths := topmostPaths(map[string]bool{
+		"src/a": true, "src/a/b": true, "src/a/b/c": true, "src/ab": true, "src/d/e": true,
+	})
+	assert.Equal(t, []string{"src/a", "src/ab", "src/d/e"}, paths)
+}